@@ -60,13 +60,33 @@ var (
 		utils.DataDirFlag,
 		utils.KeyStoreDirFlag,
 		utils.NoUSBFlag,
+		utils.EthashCacheDirFlag,
+		utils.EthashCachesInMemoryFlag,
+		utils.EthashCachesOnDiskFlag,
+		utils.EthashDatasetDirFlag,
+		utils.EthashDatasetsInMemoryFlag,
+		utils.EthashDatasetsOnDiskFlag,
+		utils.TxPoolLocalsFlag,
 		utils.TxPoolNoLocalsFlag,
+		utils.TxPoolJournalFlag,
+		utils.TxPoolRejournalFlag,
 		utils.TxPoolAccountSlotsFlag,
 		utils.TxPoolGlobalSlotsFlag,
 		utils.TxPoolAccountQueueFlag,
 		utils.TxPoolGlobalQueueFlag,
+		utils.TxPoolGlobalBytesFlag,
+		utils.TxPoolAccountRateFlag,
+		utils.TxPoolRateWindowFlag,
+		utils.TxPoolReplaceDelayFlag,
+		utils.TxPoolSimulateFlag,
+		utils.TxPoolSimulationStepsFlag,
+		utils.TxPoolSimulationQuotaFlag,
 		utils.TxPoolLifetimeFlag,
+		utils.TxFilterSendersFlag,
+		utils.TxFilterRecipientsFlag,
+		utils.TxFilterContractFlag,
 		utils.CacheFlag,
+		utils.TxLookupLimitFlag,
 		utils.TrieCacheGenFlag,
 		utils.ListenPortFlag,
 		utils.MaxPeersFlag,
@@ -81,16 +101,28 @@ var (
 		utils.NodeKeyFileFlag,
 		utils.NodeKeyHexFlag,
 		utils.DevModeFlag,
+		utils.DevPeriodFlag,
 		utils.TestnetFlag,
 		utils.RinkebyFlag,
 		utils.VMEnableDebugFlag,
+		utils.SyncModeFlag,
+		utils.LightServFlag,
+		utils.LightPeersFlag,
 		utils.NetworkIdFlag,
 		utils.RPCCORSDomainFlag,
 		utils.EthStatsURLFlag,
 		utils.MetricsEnabledFlag,
 		utils.FakePoWFlag,
+		utils.TestPoWFlag,
 		utils.NoCompactionFlag,
 		utils.ExtraDataFlag,
+		utils.MinerBudgetFlag,
+		utils.MinerMaxTxsFlag,
+		utils.MinerMaxBytesFlag,
+		utils.MinerOrderingFlag,
+		utils.StratumAddrFlag,
+		utils.StratumDifficultyFlag,
+		utils.CliqueDropInactiveFlag,
 		configFileFlag,
 	}
 
@@ -232,7 +264,7 @@ func startNode(ctx *cli.Context, stack *node.Node) {
 		}
 	}()
 	// Start auxiliary services if enabled
-	if ctx.GlobalBool(utils.MiningEnabledFlag.Name) {
+	if ctx.GlobalBool(utils.MiningEnabledFlag.Name) || ctx.GlobalBool(utils.DevModeFlag.Name) {
 		// Mining only makes sense if a full Ethereum node is running
 		var ethereum *eth.Ethereum
 		if err := stack.Service(&ethereum); err != nil {
@@ -72,26 +72,60 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.NetworkIdFlag,
 			utils.TestnetFlag,
 			utils.RinkebyFlag,
+			utils.SyncModeFlag,
+			utils.LightServFlag,
+			utils.LightPeersFlag,
 			utils.DevModeFlag,
+			utils.DevPeriodFlag,
 			utils.EthStatsURLFlag,
 			utils.IdentityFlag,
 		},
 	},
+	{
+		Name: "ETHASH",
+		Flags: []cli.Flag{
+			utils.EthashCacheDirFlag,
+			utils.EthashCachesInMemoryFlag,
+			utils.EthashCachesOnDiskFlag,
+			utils.EthashDatasetDirFlag,
+			utils.EthashDatasetsInMemoryFlag,
+			utils.EthashDatasetsOnDiskFlag,
+		},
+	},
 	{
 		Name: "TRANSACTION POOL",
 		Flags: []cli.Flag{
+			utils.TxPoolLocalsFlag,
 			utils.TxPoolNoLocalsFlag,
+			utils.TxPoolJournalFlag,
+			utils.TxPoolRejournalFlag,
 			utils.TxPoolAccountSlotsFlag,
 			utils.TxPoolGlobalSlotsFlag,
 			utils.TxPoolAccountQueueFlag,
 			utils.TxPoolGlobalQueueFlag,
+			utils.TxPoolGlobalBytesFlag,
+			utils.TxPoolAccountRateFlag,
+			utils.TxPoolRateWindowFlag,
+			utils.TxPoolReplaceDelayFlag,
+			utils.TxPoolSimulateFlag,
+			utils.TxPoolSimulationStepsFlag,
+			utils.TxPoolSimulationQuotaFlag,
 			utils.TxPoolLifetimeFlag,
 		},
 	},
+	{
+		Name: "TRANSACTION FILTER",
+		Flags: []cli.Flag{
+			utils.TxFilterSendersFlag,
+			utils.TxFilterRecipientsFlag,
+			utils.TxFilterContractFlag,
+		},
+	},
 	{
 		Name: "PERFORMANCE TUNING",
 		Flags: []cli.Flag{
 			utils.CacheFlag,
+			utils.TxLookupLimitFlag,
 			utils.TrieCacheGenFlag,
 		},
 	},
@@ -146,6 +180,13 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.MinerThreadsFlag,
 			utils.EtherbaseFlag,
 			utils.ExtraDataFlag,
+			utils.MinerBudgetFlag,
+			utils.MinerMaxTxsFlag,
+			utils.MinerMaxBytesFlag,
+			utils.MinerOrderingFlag,
+			utils.StratumAddrFlag,
+			utils.StratumDifficultyFlag,
+			utils.CliqueDropInactiveFlag,
 		},
 	},
 	{
@@ -159,6 +200,7 @@ var AppHelpFlagGroups = []flagGroup{
 		Flags: append([]cli.Flag{
 			utils.MetricsEnabledFlag,
 			utils.FakePoWFlag,
+			utils.TestPoWFlag,
 			utils.NoCompactionFlag,
 		}, debug.Flags...),
 	},
@@ -30,17 +30,25 @@ import (
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/bft"
+	"github.com/ethereum/go-ethereum/consensus/clique"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/consensus/instant"
+	"github.com/ethereum/go-ethereum/consensus/transition"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/ethstats"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/les"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/miner"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/discover"
@@ -123,6 +131,22 @@ var (
 		Usage: "Network identifier (integer, 1=Frontier, 2=Morden (disused), 3=Ropsten, 4=Rinkeby)",
 		Value: eth.DefaultConfig.NetworkId,
 	}
+	defaultSyncMode = eth.DefaultConfig.SyncMode
+	SyncModeFlag    = TextMarshalerFlag{
+		Name:  "syncmode",
+		Usage: `Blockchain sync mode ("fast", "full", or "light")`,
+		Value: &defaultSyncMode,
+	}
+	LightServFlag = cli.IntFlag{
+		Name:  "lightserv",
+		Usage: "Maximum percentage of time allowed for serving LES requests (0-90)",
+		Value: 0,
+	}
+	LightPeersFlag = cli.IntFlag{
+		Name:  "lightpeers",
+		Usage: "Maximum number of LES client peers",
+		Value: eth.DefaultConfig.LightPeers,
+	}
 	TestnetFlag = cli.BoolFlag{
 		Name:  "testnet",
 		Usage: "Ropsten network: pre-configured proof-of-work test network",
@@ -133,7 +157,11 @@ var (
 	}
 	DevModeFlag = cli.BoolFlag{
 		Name:  "dev",
-		Usage: "Developer mode: pre-configured private network with several debugging flags",
+		Usage: "Ephemeral instant sealing network with a pre-funded developer account, mining enabled",
+	}
+	DevPeriodFlag = cli.Uint64Flag{
+		Name:  "dev.period",
+		Usage: "Block period to use in developer mode (0 = seal as soon as transactions are pending)",
 	}
 	IdentityFlag = cli.StringFlag{
 		Name:  "identity",
@@ -144,12 +172,56 @@ var (
 		Usage: "Document Root for HTTPClient file scheme",
 		Value: DirectoryString{homeDir()},
 	}
+	// Ethash settings
+	EthashCacheDirFlag = DirectoryFlag{
+		Name:  "ethash.cachedir",
+		Usage: "Directory to store the ethash verification caches (default = inside the datadir)",
+	}
+	EthashCachesInMemoryFlag = cli.IntFlag{
+		Name:  "ethash.cachesinmem",
+		Usage: "Number of recent ethash caches to keep in memory (16MB each)",
+		Value: eth.DefaultConfig.EthashCachesInMem,
+	}
+	EthashCachesOnDiskFlag = cli.IntFlag{
+		Name:  "ethash.cachesondisk",
+		Usage: "Number of recent ethash caches to keep on disk (16MB each)",
+		Value: eth.DefaultConfig.EthashCachesOnDisk,
+	}
+	EthashDatasetDirFlag = DirectoryFlag{
+		Name:  "ethash.dagdir",
+		Usage: "Directory to store the ethash mining DAGs (default = inside home folder)",
+		Value: DirectoryString{eth.DefaultConfig.EthashDatasetDir},
+	}
+	EthashDatasetsInMemoryFlag = cli.IntFlag{
+		Name:  "ethash.dagsinmem",
+		Usage: "Number of recent ethash mining DAGs to keep in memory (1+GB each)",
+		Value: eth.DefaultConfig.EthashDatasetsInMem,
+	}
+	EthashDatasetsOnDiskFlag = cli.IntFlag{
+		Name:  "ethash.dagsondisk",
+		Usage: "Number of recent ethash mining DAGs to keep on disk (1+GB each)",
+		Value: eth.DefaultConfig.EthashDatasetsOnDisk,
+	}
 
 	// Transaction pool settings
+	TxPoolLocalsFlag = cli.StringFlag{
+		Name:  "txpool.locals",
+		Usage: "Comma separated accounts to treat as locals (no flush, priority inclusion)",
+	}
 	TxPoolNoLocalsFlag = cli.BoolFlag{
 		Name:  "txpool.nolocals",
 		Usage: "Disables price exemptions for locally submitted transactions",
 	}
+	TxPoolJournalFlag = cli.StringFlag{
+		Name:  "txpool.journal",
+		Usage: "Disk journal for local transactions to survive node restarts",
+		Value: core.DefaultTxPoolConfig.Journal,
+	}
+	TxPoolRejournalFlag = cli.DurationFlag{
+		Name:  "txpool.rejournal",
+		Usage: "Time interval to regenerate the local transaction journal",
+		Value: core.DefaultTxPoolConfig.Rejournal,
+	}
 	TxPoolAccountSlotsFlag = cli.Uint64Flag{
 		Name:  "txpool.accountslots",
 		Usage: "Minimum number of executable transaction slots guaranteed per account",
@@ -170,17 +242,69 @@ var (
 		Usage: "Maximum number of non-executable transaction slots for all accounts",
 		Value: eth.DefaultConfig.TxPool.GlobalQueue,
 	}
+	TxPoolGlobalBytesFlag = cli.Uint64Flag{
+		Name:  "txpool.globalbytes",
+		Usage: "Maximum total size of all pooled transactions in bytes (0 = unlimited)",
+		Value: eth.DefaultConfig.TxPool.GlobalBytes,
+	}
+	TxPoolAccountRateFlag = cli.Uint64Flag{
+		Name:  "txpool.accountrate",
+		Usage: "Maximum number of transactions accepted per account within a rate window (0 = unlimited)",
+		Value: eth.DefaultConfig.TxPool.AccountRate,
+	}
+	TxPoolRateWindowFlag = cli.DurationFlag{
+		Name:  "txpool.ratewindow",
+		Usage: "Time window over which the per account rate limit is enforced",
+		Value: eth.DefaultConfig.TxPool.RateWindow,
+	}
+	TxPoolReplaceDelayFlag = cli.DurationFlag{
+		Name:  "txpool.replacedelay",
+		Usage: "Minimum time a transaction is pooled before it can be replaced",
+		Value: eth.DefaultConfig.TxPool.ReplaceDelay,
+	}
+	TxPoolSimulateFlag = cli.BoolFlag{
+		Name:  "txpool.simulate",
+		Usage: "Execute remote transactions on the pending state before admitting them",
+	}
+	TxPoolSimulationStepsFlag = cli.Uint64Flag{
+		Name:  "txpool.simulationsteps",
+		Usage: "Execution budget of a simulated transaction in VM steps",
+		Value: eth.DefaultConfig.TxPool.SimulationSteps,
+	}
+	TxPoolSimulationQuotaFlag = cli.Uint64Flag{
+		Name:  "txpool.simulationquota",
+		Usage: "Maximum number of failed simulations per account within a rate window (0 = unlimited)",
+		Value: eth.DefaultConfig.TxPool.SimulationQuota,
+	}
 	TxPoolLifetimeFlag = cli.DurationFlag{
 		Name:  "txpool.lifetime",
 		Usage: "Maximum amount of time non-executable transaction are queued",
 		Value: eth.DefaultConfig.TxPool.Lifetime,
 	}
+	// Transaction admission filter settings
+	TxFilterSendersFlag = cli.StringFlag{
+		Name:  "txfilter.senders",
+		Usage: "Comma separated accounts exclusively permitted to send transactions",
+	}
+	TxFilterRecipientsFlag = cli.StringFlag{
+		Name:  "txfilter.recipients",
+		Usage: "Comma separated accounts forbidden to be called or transferred to",
+	}
+	TxFilterContractFlag = cli.StringFlag{
+		Name:  "txfilter.contract",
+		Usage: "Address of the on-chain sender allowlist contract",
+	}
 	// Performance tuning settings
 	CacheFlag = cli.IntFlag{
 		Name:  "cache",
 		Usage: "Megabytes of memory allocated to internal caching (min 16MB / database forced)",
 		Value: 128,
 	}
+	TxLookupLimitFlag = cli.Uint64Flag{
+		Name:  "txlookuplimit",
+		Usage: "Number of recent blocks to maintain transactions index for (default = index all blocks)",
+		Value: eth.DefaultConfig.TxLookupLimit,
+	}
 	TrieCacheGenFlag = cli.IntFlag{
 		Name:  "trie-cache-gens",
 		Usage: "Number of trie node generations to keep in memory",
@@ -205,6 +329,40 @@ var (
 		Name:  "extradata",
 		Usage: "Block extra data set by the miner (default = client version)",
 	}
+	MinerBudgetFlag = cli.DurationFlag{
+		Name:  "miner.budget",
+		Usage: "Time allowed for filling a block before sealing it, the rest is added until its slot (0 = unlimited)",
+		Value: eth.DefaultConfig.Miner.Budget,
+	}
+	MinerMaxTxsFlag = cli.IntFlag{
+		Name:  "miner.maxtxs",
+		Usage: "Maximum number of transactions included in a block (0 = unlimited)",
+		Value: eth.DefaultConfig.Miner.MaxTxs,
+	}
+	MinerMaxBytesFlag = cli.Uint64Flag{
+		Name:  "miner.maxbytes",
+		Usage: "Maximum total size of the transactions included in a block (0 = unlimited)",
+		Value: eth.DefaultConfig.Miner.MaxBytes,
+	}
+	MinerOrderingFlag = cli.StringFlag{
+		Name:  "miner.ordering",
+		Usage: `Transaction ordering across accounts ("nonce", "arrival", "roundrobin" or "local")`,
+		Value: eth.DefaultConfig.Miner.Ordering,
+	}
+	StratumAddrFlag = cli.StringFlag{
+		Name:  "stratum.addr",
+		Usage: "Stratum mining server listening address (empty = disabled)",
+		Value: eth.DefaultConfig.Stratum.Addr,
+	}
+	StratumDifficultyFlag = cli.Uint64Flag{
+		Name:  "stratum.difficulty",
+		Usage: "Proof-of-work difficulty of the shares submitted by stratum miners",
+		Value: eth.DefaultConfig.Stratum.Difficulty,
+	}
+	CliqueDropInactiveFlag = cli.Uint64Flag{
+		Name:  "clique.dropinactive",
+		Usage: "Number of epochs after which to propose dropping clique signers that didn't seal any block (0 = disabled)",
+	}
 	// Account settings
 	UnlockedAccountFlag = cli.StringFlag{
 		Name:  "unlock",
@@ -234,6 +392,10 @@ var (
 		Name:  "fakepow",
 		Usage: "Disables proof-of-work verification",
 	}
+	TestPoWFlag = cli.BoolFlag{
+		Name:  "testpow",
+		Usage: "Uses tiny ethash caches and DAGs for proof-of-work (test networks only)",
+	}
 	NoCompactionFlag = cli.BoolFlag{
 		Name:  "nocompaction",
 		Usage: "Disables db compaction after import",
@@ -654,7 +816,8 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 	if ctx.GlobalIsSet(MaxPendingPeersFlag.Name) {
 		cfg.MaxPendingPeers = ctx.GlobalInt(MaxPendingPeersFlag.Name)
 	}
-	if ctx.GlobalIsSet(NoDiscoverFlag.Name) {
+	if ctx.GlobalIsSet(NoDiscoverFlag.Name) || ctx.GlobalString(SyncModeFlag.Name) == "light" {
+		// Light clients look up their servers through the topic discovery only
 		cfg.NoDiscovery = true
 	}
 
@@ -698,7 +861,7 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	case ctx.GlobalIsSet(DataDirFlag.Name):
 		cfg.DataDir = ctx.GlobalString(DataDirFlag.Name)
 	case ctx.GlobalBool(DevModeFlag.Name):
-		cfg.DataDir = filepath.Join(os.TempDir(), "ethereum_dev_mode")
+		cfg.DataDir = "" // In-memory database and ephemeral keystore
 	case ctx.GlobalBool(TestnetFlag.Name):
 		cfg.DataDir = filepath.Join(node.DefaultDataDir(), "testnet")
 	case ctx.GlobalBool(RinkebyFlag.Name):
@@ -713,10 +876,50 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	}
 }
 
+// splitAddresses parses a comma separated list of accounts from the given flag,
+// aborting on any invalid entry.
+func splitAddresses(ctx *cli.Context, name string) []common.Address {
+	var addrs []common.Address
+	for _, account := range strings.Split(ctx.GlobalString(name), ",") {
+		if trimmed := strings.TrimSpace(account); !common.IsHexAddress(trimmed) {
+			Fatalf("Invalid account in --%s: %s", name, trimmed)
+		} else {
+			addrs = append(addrs, common.HexToAddress(trimmed))
+		}
+	}
+	return addrs
+}
+
+func setTxFilter(ctx *cli.Context, cfg *core.TxFilterConfig) {
+	if ctx.GlobalIsSet(TxFilterSendersFlag.Name) {
+		cfg.AllowedSenders = splitAddresses(ctx, TxFilterSendersFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxFilterRecipientsFlag.Name) {
+		cfg.DeniedRecipients = splitAddresses(ctx, TxFilterRecipientsFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxFilterContractFlag.Name) {
+		contract := ctx.GlobalString(TxFilterContractFlag.Name)
+		if !common.IsHexAddress(contract) {
+			Fatalf("Invalid allowlist contract in --%s: %s", TxFilterContractFlag.Name, contract)
+		}
+		addr := common.HexToAddress(contract)
+		cfg.AllowlistContract = &addr
+	}
+}
+
 func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
+	if ctx.GlobalIsSet(TxPoolLocalsFlag.Name) {
+		cfg.Locals = splitAddresses(ctx, TxPoolLocalsFlag.Name)
+	}
 	if ctx.GlobalIsSet(TxPoolNoLocalsFlag.Name) {
 		cfg.NoLocals = ctx.GlobalBool(TxPoolNoLocalsFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolJournalFlag.Name) {
+		cfg.Journal = ctx.GlobalString(TxPoolJournalFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolRejournalFlag.Name) {
+		cfg.Rejournal = ctx.GlobalDuration(TxPoolRejournalFlag.Name)
+	}
 	if ctx.GlobalIsSet(TxPoolAccountSlotsFlag.Name) {
 		cfg.AccountSlots = ctx.GlobalUint64(TxPoolAccountSlotsFlag.Name)
 	}
@@ -729,11 +932,83 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolGlobalQueueFlag.Name) {
 		cfg.GlobalQueue = ctx.GlobalUint64(TxPoolGlobalQueueFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolGlobalBytesFlag.Name) {
+		cfg.GlobalBytes = ctx.GlobalUint64(TxPoolGlobalBytesFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolAccountRateFlag.Name) {
+		cfg.AccountRate = ctx.GlobalUint64(TxPoolAccountRateFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolRateWindowFlag.Name) {
+		cfg.RateWindow = ctx.GlobalDuration(TxPoolRateWindowFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolReplaceDelayFlag.Name) {
+		cfg.ReplaceDelay = ctx.GlobalDuration(TxPoolReplaceDelayFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolSimulateFlag.Name) {
+		cfg.Simulate = ctx.GlobalBool(TxPoolSimulateFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolSimulationStepsFlag.Name) {
+		cfg.SimulationSteps = ctx.GlobalUint64(TxPoolSimulationStepsFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolSimulationQuotaFlag.Name) {
+		cfg.SimulationQuota = ctx.GlobalUint64(TxPoolSimulationQuotaFlag.Name)
+	}
 	if ctx.GlobalIsSet(TxPoolLifetimeFlag.Name) {
 		cfg.Lifetime = ctx.GlobalDuration(TxPoolLifetimeFlag.Name)
 	}
 }
 
+func setEthash(ctx *cli.Context, cfg *eth.Config) {
+	if ctx.GlobalIsSet(EthashCacheDirFlag.Name) {
+		cfg.EthashCacheDir = ctx.GlobalString(EthashCacheDirFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthashDatasetDirFlag.Name) {
+		cfg.EthashDatasetDir = ctx.GlobalString(EthashDatasetDirFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthashCachesInMemoryFlag.Name) {
+		cfg.EthashCachesInMem = ctx.GlobalInt(EthashCachesInMemoryFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthashCachesOnDiskFlag.Name) {
+		cfg.EthashCachesOnDisk = ctx.GlobalInt(EthashCachesOnDiskFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthashDatasetsInMemoryFlag.Name) {
+		cfg.EthashDatasetsInMem = ctx.GlobalInt(EthashDatasetsInMemoryFlag.Name)
+	}
+	if ctx.GlobalIsSet(EthashDatasetsOnDiskFlag.Name) {
+		cfg.EthashDatasetsOnDisk = ctx.GlobalInt(EthashDatasetsOnDiskFlag.Name)
+	}
+	if ctx.GlobalIsSet(FakePoWFlag.Name) {
+		cfg.PowFake = ctx.GlobalBool(FakePoWFlag.Name)
+	}
+	if ctx.GlobalIsSet(TestPoWFlag.Name) {
+		cfg.PowTest = ctx.GlobalBool(TestPoWFlag.Name)
+	}
+}
+
+func setMiner(ctx *cli.Context, cfg *miner.Config) {
+	if ctx.GlobalIsSet(MinerBudgetFlag.Name) {
+		cfg.Budget = ctx.GlobalDuration(MinerBudgetFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerMaxTxsFlag.Name) {
+		cfg.MaxTxs = ctx.GlobalInt(MinerMaxTxsFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerMaxBytesFlag.Name) {
+		cfg.MaxBytes = ctx.GlobalUint64(MinerMaxBytesFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerOrderingFlag.Name) {
+		cfg.Ordering = ctx.GlobalString(MinerOrderingFlag.Name)
+	}
+}
+
+func setStratum(ctx *cli.Context, cfg *miner.StratumConfig) {
+	if ctx.GlobalIsSet(StratumAddrFlag.Name) {
+		cfg.Addr = ctx.GlobalString(StratumAddrFlag.Name)
+	}
+	if ctx.GlobalIsSet(StratumDifficultyFlag.Name) {
+		cfg.Difficulty = ctx.GlobalUint64(StratumDifficultyFlag.Name)
+	}
+}
+
 func checkExclusive(ctx *cli.Context, flags ...cli.Flag) {
 	set := make([]string, 0, 1)
 	for _, flag := range flags {
@@ -750,14 +1025,28 @@ func checkExclusive(ctx *cli.Context, flags ...cli.Flag) {
 func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	// Avoid conflicting network flags
 	checkExclusive(ctx, DevModeFlag, TestnetFlag, RinkebyFlag)
+	checkExclusive(ctx, FakePoWFlag, TestPoWFlag)
 
 	ks := stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
 	setEtherbase(ctx, ks, cfg)
 	setTxPool(ctx, &cfg.TxPool)
+	setMiner(ctx, &cfg.Miner)
+	setStratum(ctx, &cfg.Stratum)
+	setEthash(ctx, cfg)
+	setTxFilter(ctx, &cfg.TxFilter)
 
+	if ctx.GlobalIsSet(SyncModeFlag.Name) {
+		cfg.SyncMode = *GlobalTextMarshaler(ctx, SyncModeFlag.Name).(*downloader.SyncMode)
+	}
 	if ctx.GlobalIsSet(NetworkIdFlag.Name) {
 		cfg.NetworkId = ctx.GlobalUint64(NetworkIdFlag.Name)
 	}
+	if ctx.GlobalIsSet(LightServFlag.Name) {
+		cfg.LightServ = ctx.GlobalInt(LightServFlag.Name)
+	}
+	if ctx.GlobalIsSet(LightPeersFlag.Name) {
+		cfg.LightPeers = ctx.GlobalInt(LightPeersFlag.Name)
+	}
 
 	// Ethereum needs to know maxPeers to calculate the light server peer ratio.
 	// TODO(fjl): ensure Ethereum can get MaxPeers from node.
@@ -768,9 +1057,16 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	}
 	cfg.DatabaseHandles = makeDatabaseHandles()
 
+	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) {
+		cfg.TxLookupLimit = ctx.GlobalUint64(TxLookupLimitFlag.Name)
+	}
+
 	if ctx.GlobalIsSet(MinerThreadsFlag.Name) {
 		cfg.MinerThreads = ctx.GlobalInt(MinerThreadsFlag.Name)
 	}
+	if ctx.GlobalIsSet(CliqueDropInactiveFlag.Name) {
+		cfg.CliqueDropInactive = ctx.GlobalUint64(CliqueDropInactiveFlag.Name)
+	}
 	if ctx.GlobalIsSet(DocRootFlag.Name) {
 		cfg.DocRoot = ctx.GlobalString(DocRootFlag.Name)
 	}
@@ -796,8 +1092,28 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 		}
 		cfg.Genesis = core.DefaultRinkebyGenesisBlock()
 	case ctx.GlobalBool(DevModeFlag.Name):
-		cfg.Genesis = core.DevGenesisBlock()
-		cfg.PowTest = true
+		// Create a new developer account or reuse the existing one
+		var (
+			developer accounts.Account
+			err       error
+		)
+		if accs := ks.Accounts(); len(accs) > 0 {
+			developer = accs[0]
+		} else {
+			developer, err = ks.NewAccount("")
+			if err != nil {
+				Fatalf("Failed to create developer account: %v", err)
+			}
+		}
+		if err := ks.Unlock(developer, ""); err != nil {
+			Fatalf("Failed to unlock developer account: %v", err)
+		}
+		log.Info("Using developer account", "address", developer.Address)
+
+		if !ctx.GlobalIsSet(EtherbaseFlag.Name) {
+			cfg.Etherbase = developer.Address
+		}
+		cfg.Genesis = core.DeveloperGenesisBlock(ctx.GlobalUint64(DevPeriodFlag.Name), developer.Address)
 	}
 
 	// TODO(fjl): move trie cache generations into config
@@ -808,9 +1124,24 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 
 // RegisterEthService adds an Ethereum client to the stack.
 func RegisterEthService(stack *node.Node, cfg *eth.Config) {
-	err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
-		return eth.New(ctx, cfg)
-	})
+	var err error
+	if cfg.SyncMode == downloader.LightSync {
+		err = stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+			return les.New(ctx, cfg)
+		})
+	} else {
+		err = stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+			fullNode, err := eth.New(ctx, cfg)
+			if fullNode != nil && cfg.LightServ > 0 {
+				ls, err := les.NewLesServer(fullNode, cfg)
+				if err != nil {
+					return nil, err
+				}
+				fullNode.AddLesServer(ls)
+			}
+			return fullNode, err
+		})
+	}
 	if err != nil {
 		Fatalf("Failed to register the Ethereum service: %v", err)
 	}
@@ -822,7 +1153,9 @@ func RegisterEthStatsService(stack *node.Node, url string) {
 	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
 		// Retrieve eth service
 		var ethServ *eth.Ethereum
-		ctx.Service(&ethServ)
+		if err := ctx.Service(&ethServ); err != nil {
+			return nil, err
+		}
 		return ethstats.New(url, ethServ)
 	}); err != nil {
 		Fatalf("Failed to register the Ethereum Stats service: %v", err)
@@ -856,23 +1189,49 @@ func MakeGenesis(ctx *cli.Context) *core.Genesis {
 	case ctx.GlobalBool(RinkebyFlag.Name):
 		genesis = core.DefaultRinkebyGenesisBlock()
 	case ctx.GlobalBool(DevModeFlag.Name):
-		genesis = core.DevGenesisBlock()
+		Fatalf("Developer chains are ephemeral")
 	}
 	return genesis
 }
 
+// makeEngine creates the consensus engine configured at the top level of the
+// chain config.
+func makeEngine(ctx *cli.Context, stack *node.Node, config *params.ChainConfig, chainDb ethdb.Database) consensus.Engine {
+	if config.Clique != nil {
+		return clique.New(config.Clique, chainDb)
+	} else if config.Instant != nil {
+		return instant.New(config.Instant)
+	} else if config.BFT != nil {
+		return bft.New(config.BFT, chainDb)
+	}
+	switch {
+	case ctx.GlobalBool(FakePoWFlag.Name):
+		return ethash.NewFaker()
+	case ctx.GlobalBool(TestPoWFlag.Name):
+		return ethash.NewTester()
+	default:
+		return ethash.New(
+			stack.ResolvePath(eth.DefaultConfig.EthashCacheDir), eth.DefaultConfig.EthashCachesInMem, eth.DefaultConfig.EthashCachesOnDisk,
+			stack.ResolvePath(eth.DefaultConfig.EthashDatasetDir), eth.DefaultConfig.EthashDatasetsInMem, eth.DefaultConfig.EthashDatasetsOnDisk,
+		)
+	}
+}
+
 // MakeChain creates a chain manager from set command line flags.
 func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chainDb ethdb.Database) {
 	var err error
 	chainDb = MakeChainDatabase(ctx, stack)
 
-	engine := ethash.NewFaker()
 	config, _, err := core.SetupGenesisBlock(chainDb, MakeGenesis(ctx))
 	if err != nil {
 		Fatalf("%v", err)
 	}
+	engine := makeEngine(ctx, stack, config, chainDb)
+	if t := config.Transition; t != nil {
+		engine = transition.New(engine, makeEngine(ctx, stack, config.AfterTransition(), chainDb), t.Block.Uint64(), t.Signers)
+	}
 	vmcfg := vm.Config{EnablePreimageRecording: ctx.GlobalBool(VMEnableDebugFlag.Name)}
-	chain, err = core.NewBlockChain(chainDb, config, engine, new(event.TypeMux), vmcfg)
+	chain, err = core.NewBlockChain(chainDb, config, engine, new(event.TypeMux), vmcfg, ctx.GlobalUint64(TxLookupLimitFlag.Name))
 	if err != nil {
 		Fatalf("Can't create BlockChain: %v", err)
 	}
@@ -0,0 +1,813 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package bft implements a byzantine fault tolerant consensus engine, in which a
+// set of validators agrees on each block through rounds of proposal, prevote and
+// precommit, making blocks final as soon as they are committed.
+package bft
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	checkpointInterval = 1024 // Number of blocks after which to save the vote snapshot to the database
+	inmemorySnapshots  = 128  // Number of recent vote snapshots to keep in memory
+	inmemorySignatures = 4096 // Number of recent block signatures to keep in memory
+	inmemoryCommits    = 128  // Number of recent commit certificates to keep in memory
+	inmemoryMessages   = 4096 // Number of recent consensus message hashes to keep in memory
+)
+
+// BFT protocol constants.
+var (
+	epochLength  = uint64(30000) // Default number of blocks after which to checkpoint and reset the pending votes
+	roundTimeout = uint64(3000)  // Default number of milliseconds of the first round of each height
+
+	extraVanity = 32 // Fixed number of extra-data prefix bytes reserved for proposer vanity
+
+	nonceAuthVote = hexutil.MustDecode("0xffffffffffffffff") // Magic nonce number to vote on adding a new validator
+	nonceDropVote = hexutil.MustDecode("0x0000000000000000") // Magic nonce number to vote on removing a validator.
+
+	blockDifficulty = big.NewInt(1) // Difficulty of every block, finality replaces the heaviest chain rule
+)
+
+// Various error messages to mark blocks invalid. These should be private to
+// prevent engine specific errors from being referenced in the remainder of the
+// codebase, inherently breaking if the engine is swapped out. Please put common
+// error types into the consensus package.
+var (
+	// errUnknownBlock is returned when the list of validators is requested for a
+	// block that is not part of the local blockchain.
+	errUnknownBlock = errors.New("unknown block")
+
+	// errInvalidCheckpointBeneficiary is returned if a checkpoint/epoch transition
+	// block has a beneficiary set to non-zeroes.
+	errInvalidCheckpointBeneficiary = errors.New("beneficiary in checkpoint block non-zero")
+
+	// errInvalidVote is returned if a nonce value is something else that the two
+	// allowed constants of 0x00..0 or 0xff..f.
+	errInvalidVote = errors.New("vote nonce not 0x00..0 or 0xff..f")
+
+	// errInvalidCheckpointVote is returned if a checkpoint/epoch transition block
+	// has a vote nonce set to non-zeroes.
+	errInvalidCheckpointVote = errors.New("vote nonce in checkpoint block non-zero")
+
+	// errMissingVanity is returned if a block's extra-data section is shorter than
+	// 32 bytes, which is required to store the proposer vanity.
+	errMissingVanity = errors.New("extra-data 32 byte vanity prefix missing")
+
+	// errInvalidExtra is returned if a block's extra-data section after the vanity
+	// doesn't contain the consensus fields.
+	errInvalidExtra = errors.New("invalid extra-data consensus fields")
+
+	// errMissingSignature is returned if a block's extra-data section doesn't
+	// contain the signature of its proposer.
+	errMissingSignature = errors.New("extra-data proposer signature missing")
+
+	// errExtraValidators is returned if non-checkpoint block contain validator
+	// data in their extra-data fields.
+	errExtraValidators = errors.New("non-checkpoint block contains extra validator list")
+
+	// errInvalidCheckpointValidators is returned if a checkpoint block contains an
+	// invalid list of validators.
+	errInvalidCheckpointValidators = errors.New("invalid validator list on checkpoint block")
+
+	// errInvalidMixDigest is returned if a block's mix digest is non-zero.
+	errInvalidMixDigest = errors.New("non-zero mix digest")
+
+	// errInvalidDifficulty is returned if the difficulty of a block is not 1.
+	errInvalidDifficulty = errors.New("invalid difficulty")
+
+	// errInvalidTimestamp is returned if the timestamp of a block is lower than
+	// the previous block's timestamp + the minimum block period.
+	errInvalidTimestamp = errors.New("invalid timestamp")
+
+	// errInvalidCommit is returned if a block carries a commit seal for its parent
+	// that wasn't made by a distinct validator of the parent.
+	errInvalidCommit = errors.New("invalid parent commit seal")
+
+	// errInsufficientCommit is returned if a block doesn't carry commit seals for
+	// its parent from a quorum of validators.
+	errInsufficientCommit = errors.New("insufficient parent commit seals")
+
+	// errUnknownCommit is returned when preparing a block on top of a parent the
+	// local node doesn't know the commit seals of, nor could fetch them from peers.
+	errUnknownCommit = errors.New("parent commit seals unknown")
+
+	// errInvalidVotingChain is returned if an authorization list is attempted to
+	// be modified via out-of-range or non-contiguous headers.
+	errInvalidVotingChain = errors.New("invalid voting chain")
+
+	// errUnauthorized is returned if a header is signed by a non-validator.
+	errUnauthorized = errors.New("unauthorized")
+
+	// errStopped is returned when sealing is requested from a stopped engine.
+	errStopped = errors.New("engine stopped")
+)
+
+// SignerFn is a signer callback function to request a hash to be signed by a
+// backing account.
+type SignerFn func(accounts.Account, []byte) ([]byte, error)
+
+// bftExtra is the consensus data stored in a header's extra-data section, after
+// the proposer vanity.
+type bftExtra struct {
+	Validators   []common.Address // Validator set, only stored on checkpoint blocks
+	ParentCommit [][]byte         // Commit seals of a quorum of validators on the parent block
+	Seal         []byte           // Signature of the proposer over the rest of the header
+}
+
+// decodeExtra extracts the consensus data from a header's extra-data section.
+func decodeExtra(header *types.Header) (*bftExtra, error) {
+	if len(header.Extra) < extraVanity {
+		return nil, errMissingVanity
+	}
+	extra := new(bftExtra)
+	if err := rlp.DecodeBytes(header.Extra[extraVanity:], extra); err != nil {
+		return nil, errInvalidExtra
+	}
+	return extra, nil
+}
+
+// encode assembles the extra-data section of a header from the given vanity and
+// the consensus data.
+func (extra *bftExtra) encode(vanity []byte) []byte {
+	blob, err := rlp.EncodeToBytes(extra)
+	if err != nil {
+		panic("can't encode: " + err.Error())
+	}
+	return append(append([]byte{}, vanity[:extraVanity]...), blob...)
+}
+
+// GenesisExtra returns the extra-data section of a genesis block configuring the
+// initial validator set.
+func GenesisExtra(validators []common.Address) []byte {
+	return (&bftExtra{Validators: validators}).encode(make([]byte, extraVanity))
+}
+
+// sigHash returns the hash which is used as input for the proposer signature. It
+// is the hash of the entire header with the proposer seal left empty.
+func sigHash(header *types.Header) (common.Hash, error) {
+	extra, err := decodeExtra(header)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	extra.Seal = nil
+
+	cpy := types.CopyHeader(header)
+	cpy.Extra = extra.encode(header.Extra)
+
+	return cpy.Hash(), nil
+}
+
+// commitHash returns the hash validators sign to certify committing a block.
+func commitHash(hash common.Hash) common.Hash {
+	return crypto.Keccak256Hash(hash[:], []byte{byte(msgPrecommit)})
+}
+
+// recoverAddress extracts the Ethereum account address having signed a hash.
+func recoverAddress(hash common.Hash, signature []byte) (common.Address, error) {
+	pubkey, err := crypto.Ecrecover(hash[:], signature)
+	if err != nil {
+		return common.Address{}, err
+	}
+	var signer common.Address
+	copy(signer[:], crypto.Keccak256(pubkey[1:])[12:])
+
+	return signer, nil
+}
+
+// ecrecover extracts the Ethereum account address of the proposer of a header.
+func ecrecover(header *types.Header, sigcache *lru.ARCCache) (common.Address, error) {
+	// If the signature's already cached, return that
+	hash := header.Hash()
+	if address, known := sigcache.Get(hash); known {
+		return address.(common.Address), nil
+	}
+	// Retrieve the signature from the header extra-data
+	extra, err := decodeExtra(header)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if len(extra.Seal) == 0 {
+		return common.Address{}, errMissingSignature
+	}
+	sighash, err := sigHash(header)
+	if err != nil {
+		return common.Address{}, err
+	}
+	signer, err := recoverAddress(sighash, extra.Seal)
+	if err != nil {
+		return common.Address{}, err
+	}
+	sigcache.Add(hash, signer)
+	return signer, nil
+}
+
+// BFT is the byzantine fault tolerant consensus engine, finalizing every block
+// agreed upon by a quorum of its validators.
+type BFT struct {
+	config *params.BFTConfig // Consensus engine configuration parameters
+	db     ethdb.Database    // Database to store and retrieve snapshot checkpoints
+
+	recents    *lru.ARCCache // Snapshots for recent block to speed up reorgs
+	signatures *lru.ARCCache // Signatures of recent blocks to speed up mining
+	commits    *lru.ARCCache // Commit seals of recently committed blocks
+	messages   *lru.Cache    // Hashes of recently seen consensus messages
+
+	proposals map[common.Address]bool // Current list of proposals we are pushing
+
+	takeover []common.Address // Initial validators if taking over a running chain
+	first    uint64           // First block sealed if taking over a running chain (0 = genesis)
+
+	signer common.Address // Ethereum address of the signing key
+	signFn SignerFn       // Signer function to authorize hashes with
+	lock   sync.RWMutex   // Protects the signer fields
+
+	peers    map[discover.NodeID]*peer // Peers running the consensus protocol
+	peerLock sync.RWMutex              // Protects the peer set
+
+	fetches   map[common.Hash][]chan [][]byte // Pending commit fetches waiting for deliveries
+	fetchLock sync.Mutex                      // Protects the pending commit fetches
+
+	msgCh  chan *message     // Channel delivering consensus messages to the state machine
+	sealCh chan *sealRequest // Channel delivering blocks to propose to the state machine
+	quit   chan struct{}     // Channel signalling the engine's termination
+	wg     sync.WaitGroup    // Wait group for the running state machine
+	once   sync.Once         // Ensures the engine is stopped only once
+	start  sync.Once         // Ensures the state machine is started only once
+}
+
+// New creates a BFT consensus engine with the initial validators set to the ones
+// in the genesis block.
+func New(config *params.BFTConfig, db ethdb.Database) *BFT {
+	// Set any missing consensus parameters to their defaults
+	conf := *config
+	if conf.Epoch == 0 {
+		conf.Epoch = epochLength
+	}
+	if conf.Timeout == 0 {
+		conf.Timeout = roundTimeout
+	}
+	// Allocate the caches and create the engine
+	recents, _ := lru.NewARC(inmemorySnapshots)
+	signatures, _ := lru.NewARC(inmemorySignatures)
+	commits, _ := lru.NewARC(inmemoryCommits)
+	messages, _ := lru.New(inmemoryMessages)
+
+	return &BFT{
+		config:     &conf,
+		db:         db,
+		recents:    recents,
+		signatures: signatures,
+		commits:    commits,
+		messages:   messages,
+		proposals:  make(map[common.Address]bool),
+		peers:      make(map[discover.NodeID]*peer),
+		fetches:    make(map[common.Hash][]chan [][]byte),
+		msgCh:      make(chan *message, 256),
+		sealCh:     make(chan *sealRequest),
+		quit:       make(chan struct{}),
+	}
+}
+
+// Author implements consensus.Engine, returning the Ethereum address recovered
+// from the proposer signature in the header's extra-data section.
+func (b *BFT) Author(header *types.Header) (common.Address, error) {
+	return ecrecover(header, b.signatures)
+}
+
+// VerifyHeader checks whether a header conforms to the consensus rules.
+func (b *BFT) VerifyHeader(chain consensus.ChainReader, header *types.Header, seal bool) error {
+	return b.verifyHeader(chain, header, nil)
+}
+
+// VerifyHeaders is similar to VerifyHeader, but verifies a batch of headers. The
+// method returns a quit channel to abort the operations and a results channel to
+// retrieve the async verifications (the order is that of the input slice).
+func (b *BFT) VerifyHeaders(chain consensus.ChainReader, headers []*types.Header, seals []bool) (chan<- struct{}, <-chan error) {
+	abort := make(chan struct{})
+	results := make(chan error, len(headers))
+
+	go func() {
+		for i, header := range headers {
+			err := b.verifyHeader(chain, header, headers[:i])
+
+			select {
+			case <-abort:
+				return
+			case results <- err:
+			}
+		}
+	}()
+	return abort, results
+}
+
+// verifyHeader checks whether a header conforms to the consensus rules. The
+// caller may optionally pass in a batch of parents (ascending order) to avoid
+// looking those up from the database.
+func (b *BFT) verifyHeader(chain consensus.ChainReader, header *types.Header, parents []*types.Header) error {
+	if header.Number == nil {
+		return errUnknownBlock
+	}
+	number := header.Number.Uint64()
+
+	// Don't waste time checking blocks from the future
+	if header.Time.Cmp(big.NewInt(time.Now().Unix())) > 0 {
+		return consensus.ErrFutureBlock
+	}
+	// Checkpoint blocks need to enforce zero beneficiary
+	checkpoint := (number % b.config.Epoch) == 0
+	if checkpoint && header.Coinbase != (common.Address{}) {
+		return errInvalidCheckpointBeneficiary
+	}
+	// Nonces must be 0x00..0 or 0xff..f, zeroes enforced on checkpoints
+	if !bytes.Equal(header.Nonce[:], nonceAuthVote) && !bytes.Equal(header.Nonce[:], nonceDropVote) {
+		return errInvalidVote
+	}
+	if checkpoint && !bytes.Equal(header.Nonce[:], nonceDropVote) {
+		return errInvalidCheckpointVote
+	}
+	// Ensure that the extra-data contains a validator list on checkpoint, but none otherwise
+	extra, err := decodeExtra(header)
+	if err != nil {
+		return err
+	}
+	if !checkpoint && len(extra.Validators) != 0 {
+		return errExtraValidators
+	}
+	// Ensure that the mix digest is zero as we don't have fork protection currently
+	if header.MixDigest != (common.Hash{}) {
+		return errInvalidMixDigest
+	}
+	// Ensure that the block's difficulty is meaningful
+	if number > 0 {
+		if header.Difficulty == nil || header.Difficulty.Cmp(blockDifficulty) != 0 {
+			return errInvalidDifficulty
+		}
+	}
+	// All basic checks passed, verify cascading fields
+	return b.verifyCascadingFields(chain, header, extra, parents)
+}
+
+// verifyCascadingFields verifies all the header fields that are not standalone,
+// rather depend on a batch of previous headers.
+func (b *BFT) verifyCascadingFields(chain consensus.ChainReader, header *types.Header, extra *bftExtra, parents []*types.Header) error {
+	// The genesis block is the always valid dead-end
+	number := header.Number.Uint64()
+	if number == 0 {
+		return nil
+	}
+	// Ensure that the block's timestamp isn't too close to it's parent
+	var parent *types.Header
+	if len(parents) > 0 {
+		parent = parents[len(parents)-1]
+	} else {
+		parent = chain.GetHeader(header.ParentHash, number-1)
+	}
+	if parent == nil || parent.Number.Uint64() != number-1 || parent.Hash() != header.ParentHash {
+		return consensus.ErrUnknownAncestor
+	}
+	if parent.Time.Uint64()+b.config.Period > header.Time.Uint64() {
+		return errInvalidTimestamp
+	}
+	// Retrieve the snapshot needed to verify this header and cache it
+	snap, err := b.snapshot(chain, number-1, header.ParentHash, parents)
+	if err != nil {
+		return err
+	}
+	// If the block is a checkpoint block, verify the validator list
+	if number%b.config.Epoch == 0 {
+		validators := snap.validators()
+		if len(extra.Validators) != len(validators) {
+			return errInvalidCheckpointValidators
+		}
+		for i, validator := range validators {
+			if extra.Validators[i] != validator {
+				return errInvalidCheckpointValidators
+			}
+		}
+	}
+	// Ensure the parent was committed by a quorum of its validators
+	if len(parents) > 0 {
+		parents = parents[:len(parents)-1]
+	}
+	if err := b.verifyCommit(chain, parent, extra.ParentCommit, parents); err != nil {
+		return err
+	}
+	// All basic checks passed, verify the seal and return
+	return b.verifySeal(snap, header)
+}
+
+// verifyCommit checks whether the commit seals certify a quorum of validators
+// committing the given block. The method accepts an optional list of ancestor
+// headers that aren't yet part of the local blockchain.
+func (b *BFT) verifyCommit(chain consensus.ChainReader, header *types.Header, seals [][]byte, parents []*types.Header) error {
+	// The genesis block is never committed
+	number := header.Number.Uint64()
+	if number == 0 {
+		if len(seals) > 0 {
+			return errInvalidCommit
+		}
+		return nil
+	}
+	snap, err := b.snapshot(chain, number-1, header.ParentHash, parents)
+	if err != nil {
+		return err
+	}
+	var (
+		hash    = commitHash(header.Hash())
+		signers = make(map[common.Address]struct{})
+	)
+	for _, seal := range seals {
+		signer, err := recoverAddress(hash, seal)
+		if err != nil {
+			return errInvalidCommit
+		}
+		if _, ok := snap.Validators[signer]; !ok {
+			return errInvalidCommit
+		}
+		if _, ok := signers[signer]; ok {
+			return errInvalidCommit
+		}
+		signers[signer] = struct{}{}
+	}
+	if len(signers) < snap.quorum() {
+		return errInsufficientCommit
+	}
+	return nil
+}
+
+// snapshot retrieves the validator snapshot at a given point in time.
+func (b *BFT) snapshot(chain consensus.ChainReader, number uint64, hash common.Hash, parents []*types.Header) (*Snapshot, error) {
+	// Search for a snapshot in memory or on disk for checkpoints
+	var (
+		headers []*types.Header
+		snap    *Snapshot
+	)
+	for snap == nil {
+		// If an in-memory snapshot was found, use that
+		if s, ok := b.recents.Get(hash); ok {
+			snap = s.(*Snapshot)
+			break
+		}
+		// If we're right before taking over a running chain, make a snapshot
+		if b.first > 0 && number == b.first-1 {
+			snap = newSnapshot(b.config, b.signatures, number, hash, b.takeover)
+			log.Trace("Created take over validator snapshot", "number", number, "hash", hash)
+			break
+		}
+		// If an on-disk checkpoint snapshot can be found, use that
+		if number%checkpointInterval == 0 {
+			if s, err := loadSnapshot(b.config, b.signatures, b.db, hash); err == nil {
+				log.Trace("Loaded validator snapshot form disk", "number", number, "hash", hash)
+				snap = s
+				break
+			}
+		}
+		// If we're at block zero, make a snapshot
+		if number == 0 {
+			genesis := chain.GetHeaderByNumber(0)
+			if err := b.VerifyHeader(chain, genesis, false); err != nil {
+				return nil, err
+			}
+			extra, err := decodeExtra(genesis)
+			if err != nil {
+				return nil, err
+			}
+			snap = newSnapshot(b.config, b.signatures, 0, genesis.Hash(), extra.Validators)
+			if err := snap.store(b.db); err != nil {
+				return nil, err
+			}
+			log.Trace("Stored genesis validator snapshot to disk")
+			break
+		}
+		// No snapshot for this header, gather the header and move backward
+		var header *types.Header
+		if len(parents) > 0 {
+			// If we have explicit parents, pick from there (enforced)
+			header = parents[len(parents)-1]
+			if header.Hash() != hash || header.Number.Uint64() != number {
+				return nil, consensus.ErrUnknownAncestor
+			}
+			parents = parents[:len(parents)-1]
+		} else {
+			// No explicit parents (or no more left), reach out to the database
+			header = chain.GetHeader(hash, number)
+			if header == nil {
+				return nil, consensus.ErrUnknownAncestor
+			}
+		}
+		headers = append(headers, header)
+		number, hash = number-1, header.ParentHash
+	}
+	// Previous snapshot found, apply any pending headers on top of it
+	for i := 0; i < len(headers)/2; i++ {
+		headers[i], headers[len(headers)-1-i] = headers[len(headers)-1-i], headers[i]
+	}
+	snap, err := snap.apply(headers)
+	if err != nil {
+		return nil, err
+	}
+	b.recents.Add(snap.Hash, snap)
+
+	// If we've generated a new checkpoint snapshot, save to disk
+	if snap.Number%checkpointInterval == 0 && len(headers) > 0 {
+		if err = snap.store(b.db); err != nil {
+			return nil, err
+		}
+		log.Trace("Stored validator snapshot to disk", "number", snap.Number, "hash", snap.Hash)
+	}
+	return snap, err
+}
+
+// VerifySeal implements consensus.Engine, checking whether the block was proposed
+// by one of the validators. Whether the block was actually committed can only be
+// told by its child carrying the commit seals.
+func (b *BFT) VerifySeal(chain consensus.ChainReader, header *types.Header) error {
+	// Verifying the genesis block is not supported
+	number := header.Number.Uint64()
+	if number == 0 {
+		return errUnknownBlock
+	}
+	// Retrieve the snapshot needed to verify this header and cache it
+	snap, err := b.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	return b.verifySeal(snap, header)
+}
+
+// verifySeal checks whether the proposer of a header is a validator of the given
+// snapshot.
+func (b *BFT) verifySeal(snap *Snapshot, header *types.Header) error {
+	proposer, err := ecrecover(header, b.signatures)
+	if err != nil {
+		return err
+	}
+	if _, ok := snap.Validators[proposer]; !ok {
+		return errUnauthorized
+	}
+	return nil
+}
+
+// Prepare implements consensus.Engine, preparing all the consensus fields of the
+// header for running the transactions on top.
+func (b *BFT) Prepare(chain consensus.ChainReader, header *types.Header) error {
+	// If the block isn't a checkpoint, cast a random vote (good enough for now)
+	header.Coinbase = common.Address{}
+	header.Nonce = types.BlockNonce{}
+
+	number := header.Number.Uint64()
+
+	// Assemble the voting snapshot to check which votes make sense
+	snap, err := b.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	if number%b.config.Epoch != 0 {
+		b.lock.RLock()
+
+		// Gather all the proposals that make sense voting on
+		addresses := make([]common.Address, 0, len(b.proposals))
+		for address, authorize := range b.proposals {
+			if snap.validVote(address, authorize) {
+				addresses = append(addresses, address)
+			}
+		}
+		// If there's pending proposals, cast a vote on them
+		if len(addresses) > 0 {
+			header.Coinbase = addresses[rand.Intn(len(addresses))]
+			if b.proposals[header.Coinbase] {
+				copy(header.Nonce[:], nonceAuthVote)
+			} else {
+				copy(header.Nonce[:], nonceDropVote)
+			}
+		}
+		b.lock.RUnlock()
+	}
+	header.Difficulty = new(big.Int).Set(blockDifficulty)
+
+	// Assemble the consensus fields, certifying the parent was committed
+	extra := new(bftExtra)
+	if number%b.config.Epoch == 0 {
+		extra.Validators = snap.validators()
+	}
+	parent := chain.GetHeader(header.ParentHash, number-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	if number > 1 {
+		seals, ok := b.fetchCommit(chain, parent)
+		if !ok {
+			return errUnknownCommit
+		}
+		extra.ParentCommit = seals
+	}
+	if len(header.Extra) < extraVanity {
+		header.Extra = append(header.Extra, bytes.Repeat([]byte{0x00}, extraVanity-len(header.Extra))...)
+	}
+	header.Extra = extra.encode(header.Extra)
+
+	// Mix digest is reserved for now, set to empty
+	header.MixDigest = common.Hash{}
+
+	// Ensure the timestamp has the correct delay
+	header.Time = new(big.Int).Add(parent.Time, new(big.Int).SetUint64(b.config.Period))
+	if header.Time.Int64() < time.Now().Unix() {
+		header.Time = big.NewInt(time.Now().Unix())
+	}
+	return nil
+}
+
+// Finalize implements consensus.Engine, paying the scheduled block rewards (none
+// by default) to the proposer, and returns the final block. The transaction fees
+// are credited while processing the transactions.
+//
+// The rewards are not credited to the coinbase, as that carries the votes of the
+// validators instead of a beneficiary.
+func (b *BFT) Finalize(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, receipts []*types.Receipt) (*types.Block, error) {
+	consensus.AccumulateRewards(chain.Config(), state, header, b.producer(header))
+	header.Root = state.IntermediateRoot(true)
+
+	// Assemble and return the final block for sealing
+	return types.NewBlock(header, txs, receipts), nil
+}
+
+// producer returns the proposer of the given block, or the local signer if the
+// block is being assembled locally and isn't sealed yet.
+func (b *BFT) producer(header *types.Header) common.Address {
+	if proposer, err := ecrecover(header, b.signatures); err == nil {
+		return proposer
+	}
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.signer
+}
+
+// Finalized implements consensus.Finality. Every block with a known commit is
+// final: the head if its commit is stored locally, otherwise its parent, whose
+// commit seals the head carries.
+func (b *BFT) Finalized(chain consensus.ChainReader, head *types.Header) uint64 {
+	number := head.Number.Uint64()
+	if number == 0 {
+		return number
+	}
+	if _, ok := b.loadCommit(head.Hash()); ok {
+		return number
+	}
+	return number - 1
+}
+
+// TakeOver configures the engine to seal a chain started by a different engine
+// from the given block onwards, with the given initial validators. The snapshot
+// of the preceding block is seeded with them instead of the genesis extra-data.
+//
+// Note, this method must be called before the engine is used.
+func (b *BFT) TakeOver(number uint64, validators []common.Address) {
+	b.first = number
+	b.takeover = append([]common.Address{}, validators...)
+}
+
+// Authorize injects a private key into the consensus engine to propose and vote
+// on blocks with.
+func (b *BFT) Authorize(signer common.Address, signFn SignerFn) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.signer = signer
+	b.signFn = signFn
+}
+
+// Seal implements consensus.Engine, signing the block as its proposer and running
+// it through the consensus rounds. The block is returned once committed by the
+// validators, or nil if another block was committed in its stead.
+func (b *BFT) Seal(chain consensus.ChainReader, block *types.Block, stop <-chan struct{}) (*types.Block, error) {
+	header := block.Header()
+
+	// Sealing the genesis block is not supported
+	number := header.Number.Uint64()
+	if number == 0 {
+		return nil, errUnknownBlock
+	}
+	// Don't hold the signer fields for the entire sealing procedure
+	b.lock.RLock()
+	signer, signFn := b.signer, b.signFn
+	b.lock.RUnlock()
+
+	// Bail out if we're not a validator
+	snap, err := b.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, authorized := snap.Validators[signer]; !authorized {
+		return nil, errUnauthorized
+	}
+	// Sweet, we may propose the block, wait for its time
+	delay := time.Unix(header.Time.Int64(), 0).Sub(time.Now())
+	log.Trace("Waiting for slot to propose", "delay", common.PrettyDuration(delay))
+
+	select {
+	case <-stop:
+		return nil, nil
+	case <-time.After(delay):
+	}
+	// Sign the block as its proposer and hand it to the consensus rounds
+	extra, err := decodeExtra(header)
+	if err != nil {
+		return nil, err
+	}
+	sighash, err := sigHash(header)
+	if err != nil {
+		return nil, err
+	}
+	if extra.Seal, err = signFn(accounts.Account{Address: signer}, sighash.Bytes()); err != nil {
+		return nil, err
+	}
+	header.Extra = extra.encode(header.Extra)
+
+	req := &sealRequest{
+		block:  block.WithSeal(header),
+		stop:   stop,
+		result: make(chan *types.Block, 1),
+	}
+	select {
+	case b.sealCh <- req:
+	case <-stop:
+		return nil, nil
+	case <-b.quit:
+		return nil, errStopped
+	}
+	// Wait for the block to be committed, or sealing to be aborted
+	select {
+	case block := <-req.result:
+		return block, nil
+	case <-stop:
+		// The block may have been committed concurrently, don't lose it
+		select {
+		case block := <-req.result:
+			return block, nil
+		default:
+			return nil, nil
+		}
+	case <-b.quit:
+		return nil, errStopped
+	}
+}
+
+// Protocols returns the p2p protocols needed to exchange consensus messages with
+// the other validators.
+func (b *BFT) Protocols() []p2p.Protocol {
+	return []p2p.Protocol{{
+		Name:    protocolName,
+		Version: protocolVersion,
+		Length:  protocolLength,
+		Run:     b.runPeer,
+	}}
+}
+
+// APIs implements consensus.Engine, returning the user facing RPC API to allow
+// controlling the validator voting.
+func (b *BFT) APIs(chain consensus.ChainReader) []rpc.API {
+	return []rpc.API{{
+		Namespace: "bft",
+		Version:   "1.0",
+		Service:   &API{chain: chain, bft: b},
+		Public:    false,
+	}}
+}
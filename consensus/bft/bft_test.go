@@ -0,0 +1,395 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// testNode is an in-process validator running the consensus engine on top of
+// its own chain, sealing blocks whenever its head changes.
+type testNode struct {
+	key    *ecdsa.PrivateKey
+	engine *BFT
+	chain  *core.BlockChain
+	mux    *event.TypeMux
+	quit   chan struct{}
+}
+
+// newTestGenesis creates a genesis block with the given validator keys.
+func newTestGenesis(config *params.BFTConfig, keys []*ecdsa.PrivateKey) *core.Genesis {
+	validators := make([]common.Address, len(keys))
+	for i, key := range keys {
+		validators[i] = crypto.PubkeyToAddress(key.PublicKey)
+	}
+	return &core.Genesis{
+		Config:     &params.ChainConfig{ChainId: big.NewInt(1), BFT: config},
+		Timestamp:  uint64(time.Now().Unix()) - 100,
+		ExtraData:  GenesisExtra(validators),
+		Difficulty: big.NewInt(1),
+	}
+}
+
+// newTestNode creates a validator node on a fresh chain of the given genesis.
+func newTestNode(t *testing.T, genesis *core.Genesis, key *ecdsa.PrivateKey) *testNode {
+	db, _ := ethdb.NewMemDatabase()
+	genesis.MustCommit(db)
+
+	node := &testNode{
+		key:    key,
+		engine: New(genesis.Config.BFT, db),
+		mux:    new(event.TypeMux),
+		quit:   make(chan struct{}),
+	}
+	chain, err := core.NewBlockChain(db, genesis.Config, node.engine, node.mux, vm.Config{}, 0)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	node.chain = chain
+	node.engine.Authorize(crypto.PubkeyToAddress(key.PublicKey), func(account accounts.Account, hash []byte) ([]byte, error) {
+		return crypto.Sign(hash, key)
+	})
+	return node
+}
+
+// start launches the consensus rounds and the block production of the node.
+func (n *testNode) start() {
+	n.engine.Start(n.chain, n.mux)
+	go n.produce(n.mux.Subscribe(core.ChainHeadEvent{}))
+}
+
+// stop terminates the node.
+func (n *testNode) stop() {
+	close(n.quit)
+	n.engine.Stop()
+	n.chain.Stop()
+}
+
+// produce is a minimal miner, sealing an empty block on top of every new head
+// and importing it once committed.
+func (n *testNode) produce(heads *event.TypeMuxSubscription) {
+	defer heads.Unsubscribe()
+
+	stop := make(chan struct{})
+	seal := func(parent *types.Block) {
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number(), common.Big1),
+			Time:       big.NewInt(time.Now().Unix()),
+		}
+		if err := n.engine.Prepare(n.chain, header); err != nil {
+			return
+		}
+		statedb, err := n.chain.StateAt(parent.Root())
+		if err != nil {
+			return
+		}
+		block, err := n.engine.Finalize(n.chain, header, statedb, nil, nil)
+		if err != nil {
+			return
+		}
+		go func(stop chan struct{}) {
+			if sealed, _ := n.engine.Seal(n.chain, block, stop); sealed != nil {
+				n.chain.InsertChain(types.Blocks{sealed})
+			}
+		}(stop)
+	}
+	seal(n.chain.CurrentBlock())
+	for {
+		select {
+		case ev := <-heads.Chan():
+			if ev == nil {
+				return
+			}
+			close(stop)
+			stop = make(chan struct{})
+			seal(ev.Data.(core.ChainHeadEvent).Block)
+
+		case <-n.quit:
+			close(stop)
+			return
+		}
+	}
+}
+
+// connect links two nodes through the consensus protocol.
+func connect(a, b *testNode) {
+	arw, brw := p2p.MsgPipe()
+	go a.engine.Protocols()[0].Run(p2p.NewPeer(discover.PubkeyID(&b.key.PublicKey), "", nil), arw)
+	go b.engine.Protocols()[0].Run(p2p.NewPeer(discover.PubkeyID(&a.key.PublicKey), "", nil), brw)
+}
+
+// Tests that a network of validators agrees on identical blocks, changing rounds
+// to make progress past a validator that is offline.
+func TestConsensus(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 4)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	genesis := newTestGenesis(&params.BFTConfig{Timeout: 200}, keys)
+
+	// Run all validators but the last one, still a quorum
+	nodes := make([]*testNode, len(keys)-1)
+	for i := range nodes {
+		nodes[i] = newTestNode(t, genesis, keys[i])
+		defer nodes[i].stop()
+	}
+	for i := 0; i < len(nodes); i++ {
+		for j := i + 1; j < len(nodes); j++ {
+			connect(nodes[i], nodes[j])
+		}
+	}
+	for _, node := range nodes {
+		node.start()
+	}
+	// Wait until all validators committed a few blocks, covering every proposer
+	const height = 6
+
+	deadline := time.Now().Add(30 * time.Second)
+	for _, node := range nodes {
+		for node.chain.CurrentBlock().NumberU64() < height {
+			if time.Now().After(deadline) {
+				t.Fatalf("validators stalled at heights %d, %d, %d", nodes[0].chain.CurrentBlock().NumberU64(),
+					nodes[1].chain.CurrentBlock().NumberU64(), nodes[2].chain.CurrentBlock().NumberU64())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	// Ensure all validators have the same chain, never proposed by the offline one
+	offline := crypto.PubkeyToAddress(keys[len(keys)-1].PublicKey)
+	for number := uint64(1); number <= height; number++ {
+		block := nodes[0].chain.GetBlockByNumber(number)
+		for i, node := range nodes[1:] {
+			if other := node.chain.GetBlockByNumber(number); other.Hash() != block.Hash() {
+				t.Fatalf("block #%d mismatch on validator %d: have %x, want %x", number, i+1, other.Hash(), block.Hash())
+			}
+		}
+		if proposer, err := nodes[0].engine.Author(block.Header()); err != nil || proposer == offline {
+			t.Errorf("block #%d proposer invalid: %x, %v", number, proposer, err)
+		}
+	}
+	// Ensure committed blocks are considered final
+	head := nodes[0].chain.GetBlockByNumber(height).Header()
+	if finalized := nodes[0].engine.Finalized(nodes[0].chain, head); finalized < height-1 {
+		t.Errorf("finalized block mismatch: have %d, want at least %d", finalized, height-1)
+	}
+}
+
+// makeCommittedChain creates a chain of empty blocks on top of parent, proposed
+// and committed by the given single validator on top of the parent's seals.
+func makeCommittedChain(parent *types.Block, seals [][]byte, key *ecdsa.PrivateKey, n int, vanity byte) []*types.Block {
+	var blocks []*types.Block
+	for i := 0; i < n; i++ {
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Root:       parent.Root(),
+			Number:     new(big.Int).Add(parent.Number(), common.Big1),
+			Time:       new(big.Int).Add(parent.Time(), common.Big1),
+			Difficulty: big.NewInt(1),
+		}
+		vanities := make([]byte, extraVanity)
+		vanities[0] = vanity
+
+		extra := &bftExtra{ParentCommit: seals}
+		header.Extra = extra.encode(vanities)
+		header = types.NewBlock(header, nil, nil).Header()
+
+		sighash, _ := sigHash(header)
+		extra.Seal, _ = crypto.Sign(sighash.Bytes(), key)
+		header.Extra = extra.encode(vanities)
+
+		block := types.NewBlock(header, nil, nil)
+		seal, _ := crypto.Sign(commitHash(block.Hash()).Bytes(), key)
+
+		blocks, parent, seals = append(blocks, block), block, [][]byte{seal}
+	}
+	return blocks
+}
+
+// Tests that the chain refuses reorganisations reverting finalized blocks, even
+// if the competing chain is heavier, but accepts the ones above them.
+func TestFinalizedReorg(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	genesis := newTestGenesis(&params.BFTConfig{}, []*ecdsa.PrivateKey{key})
+
+	db, _ := ethdb.NewMemDatabase()
+	block := genesis.MustCommit(db)
+
+	engine := New(genesis.Config.BFT, db)
+	chain, err := core.NewBlockChain(db, genesis.Config, engine, new(event.TypeMux), vm.Config{}, 0)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// Import a canonical chain and ensure a heavier fork from genesis is refused
+	canon := makeCommittedChain(block, nil, key, 3, 0x01)
+	if _, err := chain.InsertChain(canon); err != nil {
+		t.Fatalf("failed to import canonical chain: %v", err)
+	}
+	fork := makeCommittedChain(block, nil, key, 5, 0x02)
+	if _, err := chain.InsertChain(fork); err != core.ErrFinalizedReorg {
+		t.Fatalf("finalized reorg error mismatch: have %v, want %v", err, core.ErrFinalizedReorg)
+	}
+	if head := chain.CurrentBlock().Hash(); head != canon[2].Hash() {
+		t.Fatalf("head mismatch after refused reorg: have %x, want %x", head, canon[2].Hash())
+	}
+	// Replacing the head, whose commit is only known to its proposer, is allowed
+	seal, _ := crypto.Sign(commitHash(canon[1].Hash()).Bytes(), key)
+	fork = makeCommittedChain(canon[1], [][]byte{seal}, key, 2, 0x03)
+	if _, err := chain.InsertChain(fork); err != nil {
+		t.Fatalf("failed to reorg above finalized block: %v", err)
+	}
+	if head := chain.CurrentBlock().Hash(); head != fork[1].Hash() {
+		t.Fatalf("head mismatch after reorg: have %x, want %x", head, fork[1].Hash())
+	}
+}
+
+// newTestChain creates a chain of the given genesis with a fresh engine,
+// importing the given blocks.
+func newTestChain(t *testing.T, genesis *core.Genesis, blocks []*types.Block) (*BFT, *core.BlockChain, ethdb.Database) {
+	db, _ := ethdb.NewMemDatabase()
+	genesis.MustCommit(db)
+
+	engine := New(genesis.Config.BFT, db)
+	chain, err := core.NewBlockChain(db, genesis.Config, engine, new(event.TypeMux), vm.Config{}, 0)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import chain: %v", err)
+	}
+	return engine, chain, db
+}
+
+// Tests that the commit seals of the head survive a restart, so the validator
+// can still finalize the head and propose on top of it.
+func TestCommitPersistence(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	genesis := newTestGenesis(&params.BFTConfig{}, []*ecdsa.PrivateKey{key})
+
+	block, _ := genesis.ToBlock()
+	blocks := makeCommittedChain(block, nil, key, 3, 0x01)
+	engine, chain, db := newTestChain(t, genesis, blocks)
+
+	head := blocks[len(blocks)-1]
+	seal, _ := crypto.Sign(commitHash(head.Hash()).Bytes(), key)
+	if err := engine.storeCommit(head.Hash(), [][]byte{seal}); err != nil {
+		t.Fatalf("failed to store commit: %v", err)
+	}
+	chain.Stop()
+
+	// Restart the engine on the same database and ensure the commit is known
+	engine = New(genesis.Config.BFT, db)
+	chain, err := core.NewBlockChain(db, genesis.Config, engine, new(event.TypeMux), vm.Config{}, 0)
+	if err != nil {
+		t.Fatalf("failed to recreate chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if finalized := engine.Finalized(chain, head.Header()); finalized != head.NumberU64() {
+		t.Errorf("finalized block mismatch: have %d, want %d", finalized, head.NumberU64())
+	}
+	header := &types.Header{ParentHash: head.Hash(), Number: new(big.Int).Add(head.Number(), common.Big1)}
+	if err := engine.Prepare(chain, header); err != nil {
+		t.Fatalf("failed to prepare block after restart: %v", err)
+	}
+	extra, err := decodeExtra(header)
+	if err != nil {
+		t.Fatalf("failed to decode extra-data: %v", err)
+	}
+	if len(extra.ParentCommit) != 1 || !bytes.Equal(extra.ParentCommit[0], seal) {
+		t.Errorf("parent commit mismatch: have %x, want [%x]", extra.ParentCommit, seal)
+	}
+}
+
+// Tests that a validator lacking the commit seals of its head, e.g. after syncing
+// it, fetches them from its peers, discarding invalid ones.
+func TestCommitFetch(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	genesis := newTestGenesis(&params.BFTConfig{}, []*ecdsa.PrivateKey{key})
+
+	block, _ := genesis.ToBlock()
+	blocks := makeCommittedChain(block, nil, key, 3, 0x01)
+	head := blocks[len(blocks)-1]
+	seal, _ := crypto.Sign(commitHash(head.Hash()).Bytes(), key)
+
+	// Create a validator knowing the commit and a forger serving a fake one
+	server, serverChain, _ := newTestChain(t, genesis, blocks)
+	defer serverChain.Stop()
+	if err := server.storeCommit(head.Hash(), [][]byte{seal}); err != nil {
+		t.Fatalf("failed to store commit: %v", err)
+	}
+	forger, forgerChain, _ := newTestChain(t, genesis, blocks)
+	defer forgerChain.Stop()
+
+	other, _ := crypto.GenerateKey()
+	fake, _ := crypto.Sign(commitHash(head.Hash()).Bytes(), other)
+	forger.commits.Add(head.Hash(), [][]byte{fake})
+
+	// Connect a synced node lacking the commit and ensure it fetches the valid one
+	client, clientChain, clientDb := newTestChain(t, genesis, blocks)
+	defer clientChain.Stop()
+	defer client.Stop()
+
+	for _, remote := range []*BFT{forger, server} {
+		id, _ := crypto.GenerateKey()
+		crw, srw := p2p.MsgPipe()
+		go client.Protocols()[0].Run(p2p.NewPeer(discover.PubkeyID(&id.PublicKey), "", nil), crw)
+		go remote.Protocols()[0].Run(p2p.NewPeer(discover.PubkeyID(&id.PublicKey), "", nil), srw)
+	}
+	for {
+		client.peerLock.RLock()
+		n := len(client.peers)
+		client.peerLock.RUnlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	header := &types.Header{ParentHash: head.Hash(), Number: new(big.Int).Add(head.Number(), common.Big1)}
+	if err := client.Prepare(clientChain, header); err != nil {
+		t.Fatalf("failed to prepare block on fetched commit: %v", err)
+	}
+	extra, err := decodeExtra(header)
+	if err != nil {
+		t.Fatalf("failed to decode extra-data: %v", err)
+	}
+	if len(extra.ParentCommit) != 1 || !bytes.Equal(extra.ParentCommit[0], seal) {
+		t.Errorf("parent commit mismatch: have %x, want [%x]", extra.ParentCommit, seal)
+	}
+	// Ensure the fetched commit was persisted
+	if seals, ok := New(genesis.Config.BFT, clientDb).loadCommit(head.Hash()); !ok || len(seals) != 1 || !bytes.Equal(seals[0], seal) {
+		t.Errorf("persisted commit mismatch: have %x, want [%x]", seals, seal)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	commitFetchTimeout  = 2 * time.Second // Maximum time to wait for peers to deliver a missing commit
+	maxCommitDeliveries = 16              // Maximum number of unverified deliveries to buffer per fetch
+)
+
+// commitData is the network packet delivering the commit seals of a block.
+type commitData struct {
+	Hash  common.Hash // Hash of the committed block
+	Seals [][]byte    // Commit seals of a quorum of validators
+}
+
+// storeCommit caches the commit seals of a block and persists them into the
+// database, so the next block can be proposed after a restart too.
+func (b *BFT) storeCommit(hash common.Hash, seals [][]byte) error {
+	b.commits.Add(hash, seals)
+
+	blob, err := rlp.EncodeToBytes(seals)
+	if err != nil {
+		return err
+	}
+	return b.db.Put(append([]byte("bft-commit-"), hash[:]...), blob)
+}
+
+// loadCommit retrieves the commit seals of a block from memory or the database.
+func (b *BFT) loadCommit(hash common.Hash) ([][]byte, bool) {
+	if seals, ok := b.commits.Get(hash); ok {
+		return seals.([][]byte), true
+	}
+	blob, err := b.db.Get(append([]byte("bft-commit-"), hash[:]...))
+	if err != nil {
+		return nil, false
+	}
+	var seals [][]byte
+	if err := rlp.DecodeBytes(blob, &seals); err != nil {
+		log.Error("Corrupted commit seals in database", "hash", hash, "err", err)
+		return nil, false
+	}
+	b.commits.Add(hash, seals)
+	return seals, true
+}
+
+// fetchCommit retrieves the commit seals of a block, requesting them from the
+// connected peers if unknown locally, e.g. after syncing the block from them.
+// Delivered seals are verified against the block before being stored.
+func (b *BFT) fetchCommit(chain consensus.ChainReader, header *types.Header) ([][]byte, bool) {
+	hash := header.Hash()
+	if seals, ok := b.loadCommit(hash); ok {
+		return seals, true
+	}
+	deliveries := make(chan [][]byte, maxCommitDeliveries)
+
+	b.fetchLock.Lock()
+	b.fetches[hash] = append(b.fetches[hash], deliveries)
+	b.fetchLock.Unlock()
+
+	defer func() {
+		b.fetchLock.Lock()
+		defer b.fetchLock.Unlock()
+
+		waiters := b.fetches[hash]
+		for i, waiter := range waiters {
+			if waiter == deliveries {
+				waiters = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+		if len(waiters) == 0 {
+			delete(b.fetches, hash)
+		} else {
+			b.fetches[hash] = waiters
+		}
+	}()
+	b.requestCommit(hash)
+
+	timeout := time.NewTimer(commitFetchTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case seals := <-deliveries:
+			if err := b.verifyCommit(chain, header, seals, nil); err != nil {
+				log.Debug("Discarded invalid commit seals", "number", header.Number, "hash", hash, "err", err)
+				continue
+			}
+			if err := b.storeCommit(hash, seals); err != nil {
+				log.Warn("Failed to store commit seals", "number", header.Number, "hash", hash, "err", err)
+			}
+			return seals, true
+
+		case <-timeout.C:
+			log.Warn("Timed out fetching commit seals", "number", header.Number, "hash", hash)
+			return nil, false
+
+		case <-b.quit:
+			return nil, false
+		}
+	}
+}
+
+// deliverCommit hands commit seals received from a peer to the fetches waiting
+// for them. Unrequested seals are dropped.
+func (b *BFT) deliverCommit(commit *commitData) {
+	b.fetchLock.Lock()
+	defer b.fetchLock.Unlock()
+
+	for _, waiter := range b.fetches[commit.Hash] {
+		select {
+		case waiter <- commit.Seals:
+		default:
+		}
+	}
+}
@@ -0,0 +1,521 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// maxFutureMessages is the number of messages of the next height to buffer until
+// the local chain catches up.
+const maxFutureMessages = 1024
+
+// Steps of a consensus round.
+const (
+	stepPropose   = iota // Waiting for the proposal of the round
+	stepPrevote          // Prevoted, waiting for a quorum of prevotes
+	stepPrecommit        // Precommitted, waiting for a quorum of precommits
+)
+
+// sealRequest is a locally assembled block handed to the state machine to be
+// proposed when the local validator is in turn.
+type sealRequest struct {
+	block  *types.Block      // Block signed by the local validator as proposer
+	stop   <-chan struct{}   // Channel signalling that the sealer lost interest
+	result chan *types.Block // Channel to return the block on once committed
+}
+
+// roundVotes are the votes cast by the validators in a single round.
+type roundVotes struct {
+	prevotes   map[common.Address]*message // First prevote of each validator
+	precommits map[common.Address]*message // First precommit of each validator
+	senders    map[common.Address]struct{} // Validators having sent any message
+}
+
+// count returns the number of votes cast for the given block hash.
+func count(votes map[common.Address]*message, digest common.Hash) int {
+	n := 0
+	for _, vote := range votes {
+		if vote.Digest == digest {
+			n++
+		}
+	}
+	return n
+}
+
+// machine is the consensus state machine running the rounds of a single height
+// at a time, in the spirit of Tendermint: validators prevote on the proposal of
+// a round, precommit once a quorum prevoted it, and commit once a quorum
+// precommitted it. Validators lock on blocks they precommitted, only prevoting
+// other blocks once a later round proves a quorum prevoted those instead.
+type machine struct {
+	bft   *BFT
+	chain *core.BlockChain
+
+	parent     *types.Header // Head of the local chain to build on
+	height     uint64        // Number of the block being agreed upon
+	round      uint64        // Current round of the height
+	step       int           // Current step of the round
+	validators *Snapshot     // Validator set of the height
+	committed  bool          // Whether the height was committed, waiting for the next
+
+	proposals map[uint64]*message    // Proposals received for each round
+	votes     map[uint64]*roundVotes // Votes received for each round
+	verified  map[common.Hash]error  // Validation results of proposed blocks
+	proposed  map[uint64]bool        // Rounds the local validator already proposed in
+	polka     map[uint64]bool        // Rounds whose prevote quorum was already acted upon
+
+	lockedRound int64        // Round the local validator locked in (-1 = none)
+	lockedBlock *types.Block // Block the local validator is locked on
+	validRound  int64        // Latest round a quorum prevoted a block in (-1 = none)
+	validBlock  *types.Block // Block a quorum prevoted most recently
+
+	pending *sealRequest // Local block waiting to be proposed
+	future  []*message   // Messages of the next height, buffered until reaching it
+
+	timer *time.Timer // Round timer triggering round changes
+}
+
+// Start launches the consensus state machine on top of the given chain, taking
+// part in the rounds if authorized as a validator.
+func (b *BFT) Start(chain *core.BlockChain, mux *event.TypeMux) {
+	b.start.Do(func() {
+		m := &machine{
+			bft:   b,
+			chain: chain,
+			timer: time.NewTimer(0),
+		}
+		<-m.timer.C
+
+		b.wg.Add(1)
+		go m.loop(mux.Subscribe(core.ChainHeadEvent{}))
+	})
+}
+
+// Stop terminates the consensus state machine.
+func (b *BFT) Stop() {
+	b.once.Do(func() {
+		close(b.quit)
+		b.wg.Wait()
+	})
+}
+
+// loop is the main event loop of the state machine, serializing all access to
+// its fields.
+func (m *machine) loop(heads *event.TypeMuxSubscription) {
+	defer m.bft.wg.Done()
+	defer heads.Unsubscribe()
+	defer m.timer.Stop()
+
+	m.newHeight(m.chain.CurrentBlock().Header())
+
+	for {
+		select {
+		case ev := <-heads.Chan():
+			if ev == nil {
+				return
+			}
+			if head := ev.Data.(core.ChainHeadEvent).Block; head.NumberU64() >= m.height {
+				m.newHeight(head.Header())
+			}
+
+		case msg := <-m.bft.msgCh:
+			m.handle(msg)
+
+		case req := <-m.bft.sealCh:
+			m.pending = req
+			m.propose()
+			m.process()
+
+		case <-m.timer.C:
+			m.timeout()
+
+		case <-m.bft.quit:
+			return
+		}
+	}
+}
+
+// newHeight resets the state machine to agree on the block after the given head.
+func (m *machine) newHeight(head *types.Header) {
+	m.parent, m.height = head, head.Number.Uint64()+1
+	m.committed = false
+
+	snap, err := m.bft.snapshot(m.chain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		log.Error("Failed to retrieve validator set", "number", head.Number, "hash", head.Hash(), "err", err)
+		snap = newSnapshot(m.bft.config, m.bft.signatures, head.Number.Uint64(), head.Hash(), nil)
+	}
+	m.validators = snap
+
+	m.proposals = make(map[uint64]*message)
+	m.votes = make(map[uint64]*roundVotes)
+	m.verified = make(map[common.Hash]error)
+	m.proposed = make(map[uint64]bool)
+	m.polka = make(map[uint64]bool)
+
+	m.lockedRound, m.lockedBlock = -1, nil
+	m.validRound, m.validBlock = -1, nil
+
+	if m.pending != nil && m.pending.block.NumberU64() < m.height {
+		m.pending = nil
+	}
+	m.startRound(0)
+
+	// Replay any messages received early for this height
+	future := m.future
+	m.future = nil
+	for _, msg := range future {
+		m.handle(msg)
+	}
+}
+
+// startRound moves the state machine to the given round of the current height.
+func (m *machine) startRound(round uint64) {
+	m.round, m.step = round, stepPropose
+
+	// Give the proposer the block period on top of the round timeout
+	timeout := time.Duration(m.bft.config.Timeout*(round+1)) * time.Millisecond
+	if round == 0 {
+		if delay := time.Unix(int64(m.parent.Time.Uint64()+m.bft.config.Period), 0).Sub(time.Now()); delay > 0 {
+			timeout += delay
+		}
+	}
+	if !m.timer.Stop() {
+		select {
+		case <-m.timer.C:
+		default:
+		}
+	}
+	m.timer.Reset(timeout)
+
+	log.Debug("Starting consensus round", "height", m.height, "round", round, "proposer", m.validators.proposer(m.height, round))
+	m.propose()
+	m.process()
+}
+
+// timeout moves on to the next round if the current one didn't commit in time,
+// announcing the round change to the other validators.
+func (m *machine) timeout() {
+	if m.committed {
+		return
+	}
+	log.Debug("Consensus round timed out", "height", m.height, "round", m.round)
+	m.send(&message{Code: msgRoundChange, Height: m.height, Round: m.round + 1})
+	m.startRound(m.round + 1)
+}
+
+// roundVotes retrieves the votes of a round, creating them if needed.
+func (m *machine) roundVotes(round uint64) *roundVotes {
+	votes, ok := m.votes[round]
+	if !ok {
+		votes = &roundVotes{
+			prevotes:   make(map[common.Address]*message),
+			precommits: make(map[common.Address]*message),
+			senders:    make(map[common.Address]struct{}),
+		}
+		m.votes[round] = votes
+	}
+	return votes
+}
+
+// handle processes a consensus message of a validator.
+func (m *machine) handle(msg *message) {
+	switch {
+	case msg.Height < m.height || (msg.Height == m.height && m.committed):
+		return
+
+	case msg.Height > m.height:
+		if msg.Height == m.height+1 && len(m.future) < maxFutureMessages {
+			m.future = append(m.future, msg)
+		}
+		return
+	}
+	if _, ok := m.validators.Validators[msg.sender]; !ok {
+		return
+	}
+	// Message of the current height from a validator, track and relay it
+	votes := m.roundVotes(msg.Round)
+
+	switch msg.Code {
+	case msgProposal:
+		if msg.sender != m.validators.proposer(m.height, msg.Round) || msg.block.ParentHash() != m.parent.Hash() {
+			return
+		}
+		if _, ok := m.proposals[msg.Round]; ok {
+			return
+		}
+		m.proposals[msg.Round] = msg
+
+	case msgPrevote:
+		if _, ok := votes.prevotes[msg.sender]; ok {
+			return
+		}
+		votes.prevotes[msg.sender] = msg
+
+	case msgPrecommit:
+		if _, ok := votes.precommits[msg.sender]; ok {
+			return
+		}
+		votes.precommits[msg.sender] = msg
+	}
+	votes.senders[msg.sender] = struct{}{}
+	m.bft.broadcast(msg)
+
+	// Catch up with the other validators if enough of them moved on
+	if msg.Round > m.round && len(votes.senders) > m.validators.faulty() {
+		m.startRound(msg.Round)
+		return
+	}
+	m.process()
+}
+
+// process applies the consensus rules on the current state until no more
+// progress can be made.
+func (m *machine) process() {
+	if len(m.validators.Validators) == 0 {
+		return
+	}
+	for !m.committed && m.advance() {
+	}
+}
+
+// advance applies the first consensus rule that makes progress, reporting whether
+// any did.
+func (m *machine) advance() bool {
+	// Commit any proposal a quorum precommitted in any round
+	for round, votes := range m.votes {
+		proposal, ok := m.proposals[round]
+		if !ok || count(votes.precommits, proposal.Digest) < m.validators.quorum() {
+			continue
+		}
+		if m.validate(proposal.block) == nil {
+			m.commit(proposal.block, votes)
+			return false
+		}
+	}
+	var (
+		proposal = m.proposals[m.round]
+		votes    = m.roundVotes(m.round)
+	)
+	// Prevote on the proposal of the current round
+	if m.step == stepPropose && proposal != nil {
+		var (
+			digest = proposal.Digest
+			valid  = m.validate(proposal.block) == nil
+		)
+		switch {
+		case proposal.ValidRound == proposal.Round:
+			if !valid || (m.lockedRound >= 0 && m.lockedBlock.Hash() != digest) {
+				digest = common.Hash{}
+			}
+		case count(m.roundVotes(proposal.ValidRound).prevotes, digest) >= m.validators.quorum():
+			if !valid || (m.lockedRound > int64(proposal.ValidRound) && m.lockedBlock.Hash() != digest) {
+				digest = common.Hash{}
+			}
+		default:
+			return false // Wait for the prevotes justifying the re-proposal
+		}
+		m.step = stepPrevote
+		m.send(&message{Code: msgPrevote, Height: m.height, Round: m.round, Digest: digest})
+		return true
+	}
+	// Lock on the proposal of the current round once a quorum prevoted it
+	if m.step >= stepPrevote && proposal != nil && !m.polka[m.round] &&
+		count(votes.prevotes, proposal.Digest) >= m.validators.quorum() && m.validate(proposal.block) == nil {
+
+		m.polka[m.round] = true
+		if m.step == stepPrevote {
+			m.lockedRound, m.lockedBlock = int64(m.round), proposal.block
+			m.step = stepPrecommit
+			m.precommit(proposal.Digest)
+		}
+		m.validRound, m.validBlock = int64(m.round), proposal.block
+		return true
+	}
+	// Precommit nil if a quorum refused all proposals of the current round
+	if m.step == stepPrevote && count(votes.prevotes, common.Hash{}) >= m.validators.quorum() {
+		m.step = stepPrecommit
+		m.precommit(common.Hash{})
+		return true
+	}
+	// Move on to the next round if a quorum refused to commit in the current one
+	if count(votes.precommits, common.Hash{}) >= m.validators.quorum() {
+		m.startRound(m.round + 1)
+		return false
+	}
+	return false
+}
+
+// propose sends the proposal of the current round if the local validator is the
+// proposer and has a block to propose.
+func (m *machine) propose() {
+	if m.step != stepPropose || m.proposed[m.round] {
+		return
+	}
+	m.bft.lock.RLock()
+	signer := m.bft.signer
+	m.bft.lock.RUnlock()
+
+	if signer != m.validators.proposer(m.height, m.round) {
+		return
+	}
+	// Re-propose the block a quorum prevoted most recently, or a fresh one
+	block, valid := m.validBlock, uint64(m.validRound)
+	if block == nil {
+		if m.pending == nil || m.pending.block.ParentHash() != m.parent.Hash() {
+			return
+		}
+		block, valid = m.pending.block, m.round
+	}
+	payload, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		log.Error("Failed to encode proposal", "err", err)
+		return
+	}
+	m.proposed[m.round] = true
+
+	log.Debug("Proposing block", "height", m.height, "round", m.round, "hash", block.Hash(), "validround", valid)
+	m.send(&message{Code: msgProposal, Height: m.height, Round: m.round, Digest: block.Hash(), ValidRound: valid, Payload: payload})
+}
+
+// precommit sends a precommit for the given block of the current round, along
+// with the commit seal certifying it.
+func (m *machine) precommit(digest common.Hash) {
+	msg := &message{Code: msgPrecommit, Height: m.height, Round: m.round, Digest: digest}
+	if digest != (common.Hash{}) {
+		m.bft.lock.RLock()
+		signer, signFn := m.bft.signer, m.bft.signFn
+		m.bft.lock.RUnlock()
+
+		if signFn == nil {
+			return
+		}
+		seal, err := signFn(accounts.Account{Address: signer}, commitHash(digest).Bytes())
+		if err != nil {
+			log.Error("Failed to sign commit seal", "err", err)
+			return
+		}
+		msg.Seal = seal
+	}
+	m.send(msg)
+}
+
+// send signs a consensus message with the local validator's credentials and
+// processes it as if received from the network, which also broadcasts it.
+func (m *machine) send(msg *message) {
+	m.bft.lock.RLock()
+	signer, signFn := m.bft.signer, m.bft.signFn
+	m.bft.lock.RUnlock()
+
+	if _, ok := m.validators.Validators[signer]; !ok || signFn == nil {
+		return
+	}
+	if err := msg.sign(signer, signFn); err != nil {
+		log.Error("Failed to sign consensus message", "err", err)
+		return
+	}
+	m.handle(msg)
+}
+
+// validate checks whether a proposed block is a valid successor of the local
+// head, executing its transactions. The results are cached for the height.
+func (m *machine) validate(block *types.Block) error {
+	hash := block.Hash()
+	if err, ok := m.verified[hash]; ok {
+		return err
+	}
+	err := m.verify(block)
+	if err != consensus.ErrFutureBlock {
+		m.verified[hash] = err
+	}
+	if err != nil {
+		log.Debug("Invalid block proposed", "height", m.height, "hash", hash, "err", err)
+	}
+	return err
+}
+
+// verify runs the full block validation of a proposed block.
+func (m *machine) verify(block *types.Block) error {
+	if err := m.bft.VerifyHeader(m.chain, block.Header(), true); err != nil {
+		return err
+	}
+	if err := m.chain.Validator().ValidateBody(block); err != nil {
+		if err == core.ErrKnownBlock {
+			return nil
+		}
+		return err
+	}
+	parent := m.chain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	statedb, err := m.chain.StateAt(parent.Root())
+	if err != nil {
+		return err
+	}
+	receipts, _, err := m.chain.Processor().Process(block, statedb, vm.Config{})
+	if err != nil {
+		return err
+	}
+	return m.chain.Validator().ValidateState(block, parent, statedb, receipts)
+}
+
+// commit finalizes a block precommitted by a quorum of validators, storing the
+// commit seals for the next block and importing it into the chain.
+func (m *machine) commit(block *types.Block, votes *roundVotes) {
+	m.committed = true
+	m.timer.Stop()
+
+	var seals [][]byte
+	for _, vote := range votes.precommits {
+		if vote.Digest == block.Hash() {
+			seals = append(seals, vote.Seal)
+		}
+	}
+	if err := m.bft.storeCommit(block.Hash(), seals); err != nil {
+		log.Error("Failed to store commit seals", "number", block.Number(), "hash", block.Hash(), "err", err)
+	}
+
+	log.Info("Committed new block", "number", block.Number(), "hash", block.Hash(), "round", m.round, "seals", len(seals))
+
+	// Hand the block back to the local sealer if it proposed it, import otherwise
+	if req := m.pending; req != nil && req.block.Hash() == block.Hash() {
+		m.pending = nil
+		select {
+		case <-req.stop:
+		default:
+			req.result <- block
+			return
+		}
+	}
+	go func() {
+		if _, err := m.chain.InsertChain(types.Blocks{block}); err != nil {
+			log.Error("Failed to import committed block", "number", block.Number(), "hash", block.Hash(), "err", err)
+		}
+	}()
+}
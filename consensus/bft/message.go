@@ -0,0 +1,120 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Consensus message types exchanged between validators.
+const (
+	msgProposal    = iota // Block proposed by the proposer of a round
+	msgPrevote            // First stage vote on a proposal (or nil)
+	msgPrecommit          // Second stage vote on a proposal (or nil), carrying a commit seal
+	msgRoundChange        // Announcement of moving to a later round after a timeout
+)
+
+var (
+	// errUnknownMessage is returned if a consensus message of unknown type is
+	// received.
+	errUnknownMessage = errors.New("unknown consensus message")
+
+	// errInvalidProposal is returned if a proposal message doesn't carry the block
+	// it's proposing.
+	errInvalidProposal = errors.New("invalid proposal")
+
+	// errInvalidSeal is returned if a precommit message doesn't carry a valid
+	// commit seal from its sender.
+	errInvalidSeal = errors.New("invalid commit seal")
+)
+
+// message is a signed consensus message of a validator, voting or proposing a
+// block at a given height and round.
+type message struct {
+	Code       uint64      // Type of the consensus message
+	Height     uint64      // Number of the block being agreed upon
+	Round      uint64      // Round of the height the message belongs to
+	Digest     common.Hash // Hash of the proposed or voted block (zero = nil vote)
+	ValidRound uint64      // Round a re-proposed block gathered prevotes in (Round = fresh proposal)
+	Payload    []byte      // RLP encoded block for proposals
+	Seal       []byte      // Commit seal for precommits
+	Signature  []byte      // Signature of the sender over the rest of the message
+
+	hash   common.Hash    // Hash of the entire message for deduplication
+	sender common.Address // Validator recovered from the signature
+	block  *types.Block   // Decoded block of proposals
+}
+
+// sigHash returns the hash the sender of the message signs.
+func (m *message) sigHash() common.Hash {
+	blob, _ := rlp.EncodeToBytes([]interface{}{m.Code, m.Height, m.Round, m.Digest, m.ValidRound, m.Payload, m.Seal})
+	return crypto.Keccak256Hash(blob)
+}
+
+// sign signs the message with the given credentials, filling the derived fields.
+func (m *message) sign(signer common.Address, signFn SignerFn) error {
+	signature, err := signFn(accounts.Account{Address: signer}, m.sigHash().Bytes())
+	if err != nil {
+		return err
+	}
+	m.Signature = signature
+	return m.recover()
+}
+
+// recover validates the message and fills in its derived fields, recovering the
+// sender and decoding any proposed block.
+func (m *message) recover() error {
+	if m.Code > msgRoundChange {
+		return errUnknownMessage
+	}
+	sender, err := recoverAddress(m.sigHash(), m.Signature)
+	if err != nil {
+		return err
+	}
+	blob, err := rlp.EncodeToBytes(m)
+	if err != nil {
+		return err
+	}
+	m.hash, m.sender = crypto.Keccak256Hash(blob), sender
+
+	switch m.Code {
+	case msgProposal:
+		block := new(types.Block)
+		if err := rlp.DecodeBytes(m.Payload, block); err != nil {
+			return errInvalidProposal
+		}
+		if block.Hash() != m.Digest || block.NumberU64() != m.Height || m.ValidRound > m.Round {
+			return errInvalidProposal
+		}
+		m.block = block
+
+	case msgPrecommit:
+		if m.Digest != (common.Hash{}) {
+			signer, err := recoverAddress(commitHash(m.Digest), m.Seal)
+			if err != nil || signer != sender {
+				return errInvalidSeal
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bft
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+	"gopkg.in/fatih/set.v0"
+)
+
+// Constants to match up protocol versions and messages
+const (
+	protocolName       = "bft"
+	protocolVersion    = 2
+	protocolLength     = 3
+	protocolMaxMsgSize = 10 * 1024 * 1024 // Maximum cap on the size of a protocol message
+
+	consensusMsg = 0x00 // Signed consensus message of a validator
+	getCommitMsg = 0x01 // Request for the commit seals of a block
+	commitMsg    = 0x02 // Commit seals of a block, replying to a request
+)
+
+const (
+	maxKnownMessages  = 4096 // Maximum message hashes to keep in the known list (prevent DOS)
+	maxQueuedMessages = 256  // Maximum number of messages to queue up for sending to a peer
+)
+
+// peer is a remote node running the consensus protocol.
+type peer struct {
+	*p2p.Peer
+
+	rw    p2p.MsgReadWriter
+	known *set.Set      // Set of message hashes known to be known by this peer
+	queue chan *message // Queue of messages to send to the peer
+	term  chan struct{} // Termination channel to stop the broadcaster
+}
+
+// broadcast is a write loop sending the queued messages to the remote peer, so
+// that a slow peer doesn't stall the consensus rounds.
+func (p *peer) broadcast() {
+	for {
+		select {
+		case msg := <-p.queue:
+			if err := p2p.Send(p.rw, consensusMsg, msg); err != nil {
+				return
+			}
+		case <-p.term:
+			return
+		}
+	}
+}
+
+// markMessage marks a message as known for the peer, ensuring that it will never
+// be propagated to this particular peer.
+func (p *peer) markMessage(msg *message) {
+	for p.known.Size() >= maxKnownMessages {
+		p.known.Pop()
+	}
+	p.known.Add(msg.hash)
+}
+
+// runPeer is the p2p protocol handler, relaying the consensus messages of the
+// peer to the state machine and serving commit seal requests until the
+// connection is torn down.
+func (b *BFT) runPeer(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+	peer := &peer{
+		Peer:  p,
+		rw:    rw,
+		known: set.New(),
+		queue: make(chan *message, maxQueuedMessages),
+		term:  make(chan struct{}),
+	}
+	b.peerLock.Lock()
+	b.peers[p.ID()] = peer
+	b.peerLock.Unlock()
+
+	defer func() {
+		b.peerLock.Lock()
+		delete(b.peers, p.ID())
+		b.peerLock.Unlock()
+
+		close(peer.term)
+	}()
+	go peer.broadcast()
+
+	for {
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			return err
+		}
+		if msg.Size > protocolMaxMsgSize {
+			msg.Discard()
+			return fmt.Errorf("message too large: %v > %v", msg.Size, protocolMaxMsgSize)
+		}
+		switch msg.Code {
+		case consensusMsg:
+		case getCommitMsg:
+			// Reply with the requested commit seals if known locally
+			var hash common.Hash
+			if err := msg.Decode(&hash); err != nil {
+				return fmt.Errorf("invalid commit request: %v", err)
+			}
+			if seals, ok := b.loadCommit(hash); ok {
+				if err := p2p.Send(rw, commitMsg, &commitData{Hash: hash, Seals: seals}); err != nil {
+					return err
+				}
+			}
+			continue
+
+		case commitMsg:
+			// Hand the commit seals to any pending fetch, verifying them there
+			commit := new(commitData)
+			if err := msg.Decode(commit); err != nil {
+				return fmt.Errorf("invalid commit: %v", err)
+			}
+			b.deliverCommit(commit)
+			continue
+
+		default:
+			msg.Discard()
+			return fmt.Errorf("invalid message code: %v", msg.Code)
+		}
+		consensus := new(message)
+		if err := msg.Decode(consensus); err != nil {
+			return fmt.Errorf("invalid message: %v", err)
+		}
+		if err := consensus.recover(); err != nil {
+			return fmt.Errorf("invalid message: %v", err)
+		}
+		peer.markMessage(consensus)
+
+		// Hand any unseen message to the state machine
+		if b.messages.Contains(consensus.hash) {
+			continue
+		}
+		b.messages.Add(consensus.hash, struct{}{})
+		select {
+		case b.msgCh <- consensus:
+		case <-b.quit:
+			return p2p.DiscQuitting
+		}
+	}
+}
+
+// broadcast propagates a consensus message to all peers not yet knowing about it.
+func (b *BFT) broadcast(msg *message) {
+	b.messages.Add(msg.hash, struct{}{})
+
+	b.peerLock.RLock()
+	defer b.peerLock.RUnlock()
+
+	for _, peer := range b.peers {
+		if peer.known.Has(msg.hash) {
+			continue
+		}
+		peer.markMessage(msg)
+		select {
+		case peer.queue <- msg:
+		default:
+			log.Debug("Dropping consensus message to slow peer", "peer", peer.ID(), "height", msg.Height, "round", msg.Round)
+		}
+	}
+}
+
+// requestCommit asks all peers for the commit seals of a block. The requests are
+// sent in the background to not stall on slow peers.
+func (b *BFT) requestCommit(hash common.Hash) {
+	b.peerLock.RLock()
+	defer b.peerLock.RUnlock()
+
+	for _, p := range b.peers {
+		go func(p *peer) {
+			if err := p2p.Send(p.rw, getCommitMsg, hash); err != nil {
+				log.Debug("Failed to request commit seals", "peer", p.ID(), "hash", hash, "err", err)
+			}
+		}(p)
+	}
+}
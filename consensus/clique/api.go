@@ -88,6 +88,16 @@ func (api *API) GetSignersAtHash(hash common.Hash) ([]common.Address, error) {
 	return snap.signers(), nil
 }
 
+// GetSignerStatus retrieves the liveness of the signers over the recent blocks
+// at the specified block.
+func (api *API) GetSignerStatus(number *rpc.BlockNumber) (map[common.Address]*SignerStatus, error) {
+	snap, err := api.GetSnapshot(number)
+	if err != nil {
+		return nil, err
+	}
+	return snap.status(), nil
+}
+
 // Proposals returns the current proposals the node tries to uphold and vote on.
 func (api *API) Proposals() map[common.Address]bool {
 	api.clique.lock.RLock()
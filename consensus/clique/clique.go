@@ -85,6 +85,10 @@ var (
 	// has a vote nonce set to non-zeroes.
 	errInvalidCheckpointVote = errors.New("vote nonce in checkpoint block non-zero")
 
+	// errGovernedVote is returned if a block casts a header vote while the signer
+	// set is governed by a contract.
+	errGovernedVote = errors.New("header vote in contract governed signer set")
+
 	// errMissingVanity is returned if a block's extra-data section is shorter than
 	// 32 bytes, which is required to store the signer vanity.
 	errMissingVanity = errors.New("extra-data 32 byte vanity prefix missing")
@@ -187,7 +191,12 @@ type Clique struct {
 	recents    *lru.ARCCache // Snapshots for recent block to speed up reorgs
 	signatures *lru.ARCCache // Signatures of recent blocks to speed up mining
 
-	proposals map[common.Address]bool // Current list of proposals we are pushing
+	proposals    map[common.Address]bool // Current list of proposals we are pushing
+	dropInactive uint64                  // Number of epochs after which to propose dropping inactive signers (0 = off)
+	metered      uint64                  // Highest block whose signing turn was reported to the metrics system
+
+	takeover []common.Address // Initial signers if taking over a running chain
+	first    uint64           // First block sealed if taking over a running chain (0 = genesis)
 
 	signer common.Address // Ethereum address of the signing key
 	signFn SignerFn       // Signer function to authorize hashes with
@@ -276,6 +285,10 @@ func (c *Clique) verifyHeader(chain consensus.ChainReader, header *types.Header,
 	if checkpoint && !bytes.Equal(header.Nonce[:], nonceDropVote) {
 		return errInvalidCheckpointVote
 	}
+	// Contract governed signer sets are voted on-chain, not in the headers
+	if c.config.Governance != nil && (header.Coinbase != (common.Address{}) || !bytes.Equal(header.Nonce[:], nonceDropVote)) {
+		return errGovernedVote
+	}
 	// Check that the extra-data contains both the vanity and signature
 	if len(header.Extra) < extraVanity {
 		return errMissingVanity
@@ -333,8 +346,21 @@ func (c *Clique) verifyCascadingFields(chain consensus.ChainReader, header *type
 	if err != nil {
 		return err
 	}
-	// If the block is a checkpoint block, verify the signer list
-	if number%c.config.Epoch == 0 {
+	// If the block is a checkpoint block, verify the signer list. Contract governed
+	// lists can only be checked against the state, so ensure they're usable here
+	// and leave the contents to Finalize. Header-only sync is refused on such chains
+	// (see params.ChainConfig.HeaderVerifiable), every header gets executed.
+	if number%c.config.Epoch == 0 && c.config.Governance != nil {
+		signers := checkpointSigners(header)
+		if len(signers) == 0 {
+			return errInvalidCheckpointSigners
+		}
+		for i := 1; i < len(signers); i++ {
+			if bytes.Compare(signers[i-1][:], signers[i][:]) >= 0 {
+				return errInvalidCheckpointSigners
+			}
+		}
+	} else if number%c.config.Epoch == 0 {
 		signers := make([]byte, len(snap.Signers)*common.AddressLength)
 		for i, signer := range snap.signers() {
 			copy(signers[i*common.AddressLength:], signer[:])
@@ -361,6 +387,12 @@ func (c *Clique) snapshot(chain consensus.ChainReader, number uint64, hash commo
 			snap = s.(*Snapshot)
 			break
 		}
+		// If we're right before taking over a running chain, make a snapshot
+		if c.first > 0 && number == c.first-1 {
+			snap = newSnapshot(c.config, c.signatures, number, hash, c.takeover)
+			log.Trace("Created take over voting snapshot", "number", number, "hash", hash)
+			break
+		}
 		// If an on-disk checkpoint snapshot can be found, use that
 		if number%checkpointInterval == 0 {
 			if s, err := loadSnapshot(c.config, c.signatures, c.db, hash); err == nil {
@@ -414,6 +446,9 @@ func (c *Clique) snapshot(chain consensus.ChainReader, number uint64, hash commo
 		return nil, err
 	}
 	c.recents.Add(snap.Hash, snap)
+	if len(headers) > 0 {
+		c.meter(snap)
+	}
 
 	// If we've generated a new checkpoint snapshot, save to disk
 	if snap.Number%checkpointInterval == 0 && len(headers) > 0 {
@@ -488,7 +523,7 @@ func (c *Clique) Prepare(chain consensus.ChainReader, header *types.Header) erro
 	if err != nil {
 		return err
 	}
-	if number%c.config.Epoch != 0 {
+	if number%c.config.Epoch != 0 && c.config.Governance == nil {
 		c.lock.RLock()
 
 		// Gather all the proposals that make sense voting on
@@ -498,6 +533,15 @@ func (c *Clique) Prepare(chain consensus.ChainReader, header *types.Header) erro
 				addresses = append(addresses, address)
 			}
 		}
+		// Propose dropping the signers inactive for too long, unless explicitly
+		// requested otherwise
+		if c.dropInactive > 0 {
+			for _, signer := range snap.inactive(number, c.dropInactive*c.config.Epoch) {
+				if _, ok := c.proposals[signer]; !ok && signer != c.signer {
+					addresses = append(addresses, signer)
+				}
+			}
+		}
 		// If there's pending proposals, cast a vote on them
 		if len(addresses) > 0 {
 			header.Coinbase = addresses[rand.Intn(len(addresses))]
@@ -521,6 +565,7 @@ func (c *Clique) Prepare(chain consensus.ChainReader, header *types.Header) erro
 	header.Extra = header.Extra[:extraVanity]
 
 	if number%c.config.Epoch == 0 {
+		// Contract governed signer lists are replaced from the state in Finalize
 		for _, signer := range snap.signers() {
 			header.Extra = append(header.Extra, signer[:]...)
 		}
@@ -542,16 +587,91 @@ func (c *Clique) Prepare(chain consensus.ChainReader, header *types.Header) erro
 	return nil
 }
 
-// Finalize implements consensus.Engine, nor block
-// rewards given, and returns the final block.
+// Finalize implements consensus.Engine, paying the scheduled block rewards (none
+// by default) to the signer of the block, and returns the final block. The
+// transaction fees are credited while processing the transactions.
+//
+// The rewards are not credited to the coinbase, as that carries the votes of the
+// signers instead of a beneficiary.
+//
+// If the signer set is governed by a contract, checkpoint blocks carry the signer
+// list from the contract state after the block's transactions: it is filled in
+// when assembling the block locally, and verified when importing one.
 func (c *Clique) Finalize(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, receipts []*types.Receipt) (*types.Block, error) {
-	// No block rewards in PoA, so the state remains as is
+	if number := header.Number.Uint64(); c.config.Governance != nil && number > 0 && number%c.config.Epoch == 0 {
+		if err := c.governCheckpoint(chain, header, state); err != nil {
+			return nil, err
+		}
+	}
+	// Pay out the scheduled block rewards (none by default)
+	consensus.AccumulateRewards(chain.Config(), state, header, c.producer(header))
 	header.Root = state.IntermediateRoot(true)
 
 	// Assemble and return the final block for sealing
 	return types.NewBlock(header, txs, receipts), nil
 }
 
+// governCheckpoint fills in or verifies the signer list of a checkpoint header
+// against the governance contract. Should the contract not hold any signers, the
+// signer set is kept as is to avoid halting the chain.
+func (c *Clique) governCheckpoint(chain consensus.ChainReader, header *types.Header, state *state.StateDB) error {
+	signers := governedSigners(state, *c.config.Governance)
+	if len(signers) == 0 {
+		number := header.Number.Uint64()
+		snap, err := c.snapshot(chain, number-1, header.ParentHash, nil)
+		if err != nil {
+			return err
+		}
+		signers = snap.signers()
+	}
+	list := make([]byte, 0, len(signers)*common.AddressLength)
+	for _, signer := range signers {
+		list = append(list, signer[:]...)
+	}
+	// Locally assembled blocks aren't sealed yet, fill the list in
+	extraSuffix := len(header.Extra) - extraSeal
+	if seal := header.Extra[extraSuffix:]; bytes.Equal(seal, make([]byte, extraSeal)) {
+		header.Extra = append(append(header.Extra[:extraVanity:extraVanity], list...), seal...)
+		return nil
+	}
+	if !bytes.Equal(header.Extra[extraVanity:extraSuffix], list) {
+		return errInvalidCheckpointSigners
+	}
+	return nil
+}
+
+// producer returns the signer of the given block, or the local signer if the
+// block is being assembled locally and isn't sealed yet.
+func (c *Clique) producer(header *types.Header) common.Address {
+	if signer, err := ecrecover(header, c.signatures); err == nil {
+		return signer
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.signer
+}
+
+// SetDropInactive sets the number of epochs after which signers that didn't seal
+// any block are automatically proposed to be dropped, 0 disabling it. Note, the
+// proposals are only cast as header votes, not into a governance contract.
+func (c *Clique) SetDropInactive(epochs uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.dropInactive = epochs
+}
+
+// TakeOver configures the engine to seal a chain started by a different engine
+// from the given block onwards, with the given initial signers. The snapshot of
+// the preceding block is seeded with them instead of the genesis extra-data.
+//
+// Note, this method must be called before the engine is used.
+func (c *Clique) TakeOver(number uint64, signers []common.Address) {
+	c.first = number
+	c.takeover = append([]common.Address{}, signers...)
+}
+
 // Authorize injects a private key into the consensus engine to mint new blocks
 // with.
 func (c *Clique) Authorize(signer common.Address, signFn SignerFn) {
@@ -0,0 +1,322 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// maxGovernedSigners is the maximum number of signers read out of a governance
+// contract, capping the work a misbehaving contract can inflict on a checkpoint.
+const maxGovernedSigners = 1024
+
+// governanceSource is the EVM assembly (core/asm) of the reference governance
+// contract, a multisig where the authorized signers vote on adding or removing
+// signers by sending it transactions with the 32 byte padded target address and
+// a 32 byte authorize flag as call data. A proposal passes once more than half
+// of the current signers voted for it, after which the tally of all votes on the
+// target is reset.
+//
+// The signers are stored the same way as a Solidity `address[]` at slot 0, which
+// is the only layout the consensus engine relies on to read the signer set from
+// an arbitrary contract: the number of signers at slot 0, and the signers from
+// slot keccak256(0) onwards.
+//
+// Invalid votes (non-signer voter, useless or repeated vote) abort execution.
+const governanceSource = `
+	;; load the call arguments: mem[128] = target, mem[160] = authorize
+	;; the target is masked to 160 bits (2^160-1)
+	push 1461501637330902918203684832716283019655932542975
+	push 0
+	calldataload
+	and
+	push 128
+	mstore
+	push 32
+	calldataload
+	iszero
+	iszero
+	push 160
+	mstore
+
+	;; load the signer set: mem[192] = count, mem[224] = keccak256(0)
+	push 0
+	sload
+	push 192
+	mstore
+	push 0
+	push 0
+	mstore
+	push 32
+	push 0
+	sha3
+	push 224
+	mstore
+
+	;; scan the signers: mem[256] = caller is signer, mem[288] = target index + 1, mem[320] = i
+	push 0
+	push 320
+	mstore
+scan:
+	push 192
+	mload
+	push 320
+	mload
+	lt
+	iszero
+	jumpi @scanned
+	push 320
+	mload
+	push 224
+	mload
+	add
+	sload
+	dup1
+	caller
+	eq
+	iszero
+	jumpi @other
+	push 1
+	push 256
+	mstore
+other:
+	push 128
+	mload
+	eq
+	iszero
+	jumpi @next
+	push 320
+	mload
+	push 1
+	add
+	push 288
+	mstore
+next:
+	push 320
+	mload
+	push 1
+	add
+	push 320
+	mstore
+	jump @scan
+
+scanned:
+	;; only signers may vote, and only on changes to the signer set
+	push 256
+	mload
+	iszero
+	jumpi @fail
+	push 288
+	mload
+	iszero
+	iszero
+	push 160
+	mload
+	eq
+	jumpi @fail
+
+	;; generation of the target: keccak256(target, 1)
+	push 128
+	mload
+	push 0
+	mstore
+	push 1
+	push 32
+	mstore
+	push 64
+	push 0
+	sha3
+	dup1
+	sload
+
+	;; tally of the proposal: keccak256(target, authorize, generation)
+	push 64
+	mstore
+	push 160
+	mload
+	push 32
+	mstore
+	push 96
+	push 0
+	sha3
+
+	;; vote of the caller: keccak256(target, authorize, generation, caller)
+	caller
+	push 96
+	mstore
+	push 128
+	push 0
+	sha3
+	dup1
+	sload
+	jumpi @fail
+	push 1
+	swap1
+	sstore
+
+	;; count the vote and check whether the majority was reached
+	dup1
+	sload
+	push 1
+	add
+	dup1
+	swap2
+	sstore
+	push 192
+	mload
+	swap1
+	push 2
+	mul
+	gt
+	iszero
+	jumpi @done
+
+	;; proposal passed, bump the generation to reset the votes on the target
+	dup1
+	sload
+	push 1
+	add
+	swap1
+	sstore
+	push 160
+	mload
+	iszero
+	jumpi @drop
+
+	;; append the new signer to the set
+	push 128
+	mload
+	push 192
+	mload
+	push 224
+	mload
+	add
+	sstore
+	push 192
+	mload
+	push 1
+	add
+	push 0
+	sstore
+	stop
+
+drop:
+	;; move the last signer into the place of the dropped one
+	push 192
+	mload
+	push 1
+	swap1
+	sub
+	dup1
+	push 224
+	mload
+	add
+	dup1
+	sload
+	push 1
+	push 288
+	mload
+	sub
+	push 224
+	mload
+	add
+	sstore
+	push 0
+	swap1
+	sstore
+	push 0
+	sstore
+	stop
+
+done:
+	stop
+
+fail:
+	;; abort by popping until the stack underflows
+	pop
+	jump @fail
+`
+
+// GovernanceCode is the runtime bytecode of the reference governance contract,
+// compiled from governanceSource. It can be placed into the genesis allocation
+// together with the initial signer set from GovernanceStorage.
+var GovernanceCode = common.FromHex("73ffffffffffffffffffffffffffffffffffffffff60003516608052602035151560a05260005460c0526000600052602060002060e0526000610140525b60c051610140511015630000008f576101405160e0510154803314156300000066576001610100525b6080511415630000007d5761014051600101610120525b6101405160010161014052630000003d565b610100511563000001425761012051151560a0511463000001425760805160005260016020526040600020805460405260a0516020526060600020336060526080600020805463000001425760019055805460010180915560c0519060020211156300000140578054600101905560a05115630000011d5760805160c05160e051015560c051600101600055005b60c051600190038060e0510180546001610120510360e051015560009055600055005b005b50630000014256")
+
+// governanceSignersSlot is the storage slot of the first signer of a governance
+// contract, the location of the data of an `address[]` at slot 0.
+var governanceSignersSlot = crypto.Keccak256Hash(common.Hash{}.Bytes()).Big()
+
+// governanceSlot returns the storage slot of the i-th signer of a governance
+// contract.
+func governanceSlot(i int) common.Hash {
+	slot := new(big.Int).Add(governanceSignersSlot, big.NewInt(int64(i)))
+	return common.BigToHash(slot)
+}
+
+// GovernanceStorage returns the storage of a governance contract containing the
+// given signer set, to be used in the genesis allocation.
+func GovernanceStorage(signers []common.Address) map[common.Hash]common.Hash {
+	storage := map[common.Hash]common.Hash{
+		common.Hash{}: common.BigToHash(big.NewInt(int64(len(signers)))),
+	}
+	for i, signer := range signers {
+		storage[governanceSlot(i)] = signer.Hash()
+	}
+	return storage
+}
+
+// governedSigners reads the signer set out of the storage of a governance
+// contract, returning it in ascending order without duplicates and empty slots.
+func governedSigners(state *state.StateDB, contract common.Address) []common.Address {
+	count := state.GetState(contract, common.Hash{}).Big()
+	if count.Cmp(big.NewInt(maxGovernedSigners)) > 0 {
+		count.SetInt64(maxGovernedSigners)
+	}
+	set := make(map[common.Address]struct{})
+	for i := 0; i < int(count.Int64()); i++ {
+		// Slots beyond the populated ones (count larger than the array) read empty
+		signer := common.BytesToAddress(state.GetState(contract, governanceSlot(i)).Bytes())
+		if signer == (common.Address{}) {
+			continue
+		}
+		set[signer] = struct{}{}
+	}
+	signers := make([]common.Address, 0, len(set))
+	for signer := range set {
+		signers = append(signers, signer)
+	}
+	sort.Slice(signers, func(i, j int) bool {
+		return bytes.Compare(signers[i][:], signers[j][:]) < 0
+	})
+	return signers
+}
+
+// checkpointSigners extracts the signer list contained in a checkpoint header.
+func checkpointSigners(header *types.Header) []common.Address {
+	signers := make([]common.Address, (len(header.Extra)-extraVanity-extraSeal)/common.AddressLength)
+	for i := 0; i < len(signers); i++ {
+		copy(signers[i][:], header.Extra[extraVanity+i*common.AddressLength:])
+	}
+	return signers
+}
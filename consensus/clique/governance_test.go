@@ -0,0 +1,255 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/asm"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var governanceAddress = common.HexToAddress("0x000000000000000000000000000000000000c11c")
+
+// Tests that the shipped governance bytecode is the compilation of its source.
+func TestGovernanceCode(t *testing.T) {
+	compiler := asm.NewCompiler(false)
+	compiler.Feed(asm.Lex("governance", []byte(governanceSource), false))
+
+	code, errs := compiler.Compile()
+	if len(errs) > 0 {
+		t.Fatalf("failed to compile governance source: %v", errs)
+	}
+	if !bytes.Equal(common.FromHex(code), GovernanceCode) {
+		t.Fatalf("governance code mismatch, recompile:\n%s", code)
+	}
+}
+
+// governanceVote assembles the call data of a governance contract vote.
+func governanceVote(target common.Address, authorize bool) []byte {
+	data := append(common.LeftPadBytes(target[:], 32), make([]byte, 32)...)
+	if authorize {
+		data[63] = 1
+	}
+	return data
+}
+
+// sortedAddresses returns the addresses of the given accounts in ascending order.
+func sortedAddresses(ap *testerAccountPool, accounts ...string) []common.Address {
+	addresses := make([]common.Address, len(accounts))
+	for i, account := range accounts {
+		addresses[i] = ap.address(account)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return bytes.Compare(addresses[i][:], addresses[j][:]) < 0
+	})
+	return addresses
+}
+
+// Tests that the governance contract only accepts valid votes from signers, and
+// updates the signer set once a majority is reached.
+func TestGovernanceContract(t *testing.T) {
+	ap := newTesterAccountPool()
+
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	statedb.SetCode(governanceAddress, GovernanceCode)
+	for slot, value := range GovernanceStorage(sortedAddresses(ap, "A", "B", "C")) {
+		statedb.SetState(governanceAddress, slot, value)
+	}
+	ctx := vm.Context{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		BlockNumber: big.NewInt(1),
+		Time:        big.NewInt(0),
+		Difficulty:  big.NewInt(1),
+	}
+	evm := vm.NewEVM(ctx, statedb, params.TestChainConfig, vm.Config{})
+
+	tests := []struct {
+		voter   string
+		target  string
+		auth    bool
+		fail    bool
+		signers []string
+	}{
+		{voter: "D", target: "D", auth: true, fail: true, signers: []string{"A", "B", "C"}},  // non-signers can't vote
+		{voter: "A", target: "B", auth: true, fail: true, signers: []string{"A", "B", "C"}},  // can't add a signer
+		{voter: "A", target: "D", auth: false, fail: true, signers: []string{"A", "B", "C"}}, // can't drop a non-signer
+		{voter: "A", target: "D", auth: true, signers: []string{"A", "B", "C"}},
+		{voter: "A", target: "D", auth: true, fail: true, signers: []string{"A", "B", "C"}}, // can't vote twice
+		{voter: "B", target: "D", auth: true, signers: []string{"A", "B", "C", "D"}},
+		{voter: "A", target: "B", auth: false, signers: []string{"A", "B", "C", "D"}},
+		{voter: "C", target: "B", auth: false, signers: []string{"A", "B", "C", "D"}}, // half isn't a majority
+		{voter: "D", target: "B", auth: false, signers: []string{"A", "C", "D"}},
+		{voter: "A", target: "B", auth: true, signers: []string{"A", "C", "D"}}, // earlier votes were reset
+		{voter: "C", target: "B", auth: true, signers: []string{"A", "B", "C", "D"}},
+	}
+	for i, tt := range tests {
+		_, err := evm.Call(vm.AccountRef(ap.address(tt.voter)), governanceAddress, governanceVote(ap.address(tt.target), tt.auth), new(big.Int))
+		if (err != nil) != tt.fail {
+			t.Errorf("test %d: vote failure mismatch: have %v, want %v", i, err, tt.fail)
+		}
+		if signers := governedSigners(statedb, governanceAddress); !reflect.DeepEqual(signers, sortedAddresses(ap, tt.signers...)) {
+			t.Errorf("test %d: signers mismatch: have %x, want %x", i, signers, sortedAddresses(ap, tt.signers...))
+		}
+	}
+}
+
+// Tests that signer sets read from a malformed contract storage skip the empty
+// slots beyond the populated ones and drop duplicates.
+func TestGovernedSignersMalformed(t *testing.T) {
+	ap := newTesterAccountPool()
+
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	for slot, value := range GovernanceStorage([]common.Address{ap.address("B"), ap.address("A"), ap.address("B")}) {
+		statedb.SetState(governanceAddress, slot, value)
+	}
+	statedb.SetState(governanceAddress, common.Hash{}, common.BigToHash(big.NewInt(5)))
+
+	if signers := governedSigners(statedb, governanceAddress); !reflect.DeepEqual(signers, sortedAddresses(ap, "A", "B")) {
+		t.Fatalf("signers mismatch: have %x, want %x", signers, sortedAddresses(ap, "A", "B"))
+	}
+}
+
+// Tests that the signer set of a contract governed chain follows the contract on
+// checkpoints, rejecting checkpoints that don't match the contract state.
+func TestGovernedCheckpoint(t *testing.T) {
+	ap := newTesterAccountPool()
+	signers := sortedAddresses(ap, "A", "B", "C")
+
+	// Create a chain with the initial signers both in the genesis and the contract
+	config := &params.CliqueConfig{Period: 1, Epoch: 4, Governance: &governanceAddress}
+	genesis := &core.Genesis{
+		Config:     &params.ChainConfig{ChainId: big.NewInt(1), Clique: config},
+		Timestamp:  uint64(time.Now().Unix()) - 100,
+		ExtraData:  make([]byte, extraVanity+len(signers)*common.AddressLength+extraSeal),
+		Difficulty: big.NewInt(1),
+		Alloc: core.GenesisAlloc{
+			governanceAddress: {Code: GovernanceCode, Storage: GovernanceStorage(signers), Balance: new(big.Int)},
+		},
+	}
+	for i, signer := range signers {
+		copy(genesis.ExtraData[extraVanity+i*common.AddressLength:], signer[:])
+	}
+	db, _ := ethdb.NewMemDatabase()
+	genesis.MustCommit(db)
+
+	engine := New(config, db)
+	chain, err := core.NewBlockChain(db, genesis.Config, engine, new(event.TypeMux), vm.Config{}, 0)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// makeBlock assembles a block on top of the head, signed by the given account
+	nonces := make(map[string]uint64)
+	makeBlock := func(signer string, votes ...string) *types.Block {
+		// Authorize the signer for the in-turn difficulty, sealing is done manually
+		engine.Authorize(ap.address(signer), nil)
+		key := ap.accounts[signer]
+
+		parent := chain.CurrentBlock()
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		}
+		if err := engine.Prepare(chain, header); err != nil {
+			t.Fatalf("failed to prepare block: %v", err)
+		}
+		header.Time = new(big.Int).Add(parent.Time(), common.Big1)
+
+		statedb, _ := chain.StateAt(parent.Root())
+
+		var (
+			txs      []*types.Transaction
+			receipts []*types.Receipt
+		)
+		for _, target := range votes {
+			tx, _ := types.SignTx(types.NewTransaction(nonces[signer], governanceAddress, new(big.Int), governanceVote(ap.address(target), true)), types.MakeSigner(genesis.Config, header.Number), key)
+			nonces[signer]++
+
+			statedb.Prepare(tx.Hash(), common.Hash{}, len(txs))
+			receipt, _, err := core.ApplyTransaction(genesis.Config, chain, nil, new(core.GasPool), statedb, header, tx, vm.Config{})
+			if err != nil {
+				t.Fatalf("failed to apply vote: %v", err)
+			}
+			txs, receipts = append(txs, tx), append(receipts, receipt)
+		}
+		block, err := engine.Finalize(chain, header, statedb, txs, receipts)
+		if err != nil {
+			t.Fatalf("failed to finalize block: %v", err)
+		}
+		header = block.Header()
+		ap.sign(header, signer)
+		return block.WithSeal(header)
+	}
+	insert := func(block *types.Block) error {
+		_, err := chain.InsertChain(types.Blocks{block})
+		return err
+	}
+	// Vote in a new signer, which may only sign after the next checkpoint
+	for i, signer := range []string{"A", "B", "C"} {
+		var votes []string
+		if signer != "C" {
+			votes = []string{"D"}
+		}
+		if err := insert(makeBlock(signer, votes...)); err != nil {
+			t.Fatalf("failed to insert block #%d: %v", i+1, err)
+		}
+	}
+	if err := insert(makeBlock("D")); err == nil {
+		t.Fatalf("signer accepted before checkpoint")
+	}
+	// Ensure a checkpoint not matching the contract is rejected
+	checkpoint := makeBlock("A")
+	if have := checkpointSigners(checkpoint.Header()); !reflect.DeepEqual(have, sortedAddresses(ap, "A", "B", "C", "D")) {
+		t.Fatalf("checkpoint signers mismatch: have %x, want %x", have, sortedAddresses(ap, "A", "B", "C", "D"))
+	}
+	forged := checkpoint.Header()
+	forged.Extra = append(forged.Extra[:extraVanity:extraVanity], genesis.ExtraData[extraVanity:]...)
+	ap.sign(forged, "A")
+	if err := insert(checkpoint.WithSeal(forged)); err != errInvalidCheckpointSigners {
+		t.Fatalf("forged checkpoint error mismatch: have %v, want %v", err, errInvalidCheckpointSigners)
+	}
+	// Import the valid checkpoint and ensure the new signer is authorized
+	if err := insert(checkpoint); err != nil {
+		t.Fatalf("failed to insert checkpoint: %v", err)
+	}
+	if err := insert(makeBlock("D")); err != nil {
+		t.Fatalf("failed to insert block of new signer: %v", err)
+	}
+	// Ensure header votes are rejected
+	header := chain.CurrentHeader()
+	copy(header.Nonce[:], nonceAuthVote)
+	if err := engine.VerifyHeader(chain, header, false); err != errGovernedVote {
+		t.Fatalf("header vote error mismatch: have %v, want %v", err, errGovernedVote)
+	}
+}
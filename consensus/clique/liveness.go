@@ -0,0 +1,116 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// livenessWindow is the number of recent blocks over which the signing activity
+// of the signers is tracked.
+const livenessWindow = 1024
+
+var (
+	inturnSlotMeter      = metrics.NewMeter("clique/slots/inturn")       // Blocks sealed by the in-turn signer
+	missedSlotMeter      = metrics.NewMeter("clique/slots/missed")       // Blocks sealed out-of-turn, the in-turn signer missing
+	localMissedSlotMeter = metrics.NewMeter("clique/slots/local/missed") // Blocks sealed out-of-turn, the local signer missing
+)
+
+// Slot is the signing turn of a single block, recording whose turn it was and
+// who actually sealed it.
+type Slot struct {
+	Block  uint64         `json:"block"`  // Block number of the signing turn
+	InTurn common.Address `json:"inturn"` // Signer whose turn it was to seal the block
+	Signer common.Address `json:"signer"` // Signer that actually sealed the block
+}
+
+// SignerStatus is the liveness of a signer over the recent blocks.
+type SignerStatus struct {
+	InTurn     int    `json:"inTurn"`     // Number of recent blocks that were the signer's turn
+	Signed     int    `json:"signed"`     // Number of recent blocks sealed by the signer
+	Missed     int    `json:"missed"`     // Number of recent turns of the signer sealed by someone else
+	LastSigned uint64 `json:"lastSigned"` // Last block sealed by the signer (or its authorization)
+}
+
+// track records the signing turn of a block before it is applied to the snapshot.
+func (s *Snapshot) track(number uint64, signer common.Address) {
+	signers := s.signers()
+	s.Window = append(s.Window, Slot{
+		Block:  number,
+		InTurn: signers[number%uint64(len(signers))],
+		Signer: signer,
+	})
+	if len(s.Window) > livenessWindow {
+		s.Window = s.Window[len(s.Window)-livenessWindow:]
+	}
+	s.Seen[signer] = number
+}
+
+// status returns the liveness of all the current signers over the tracked window.
+func (s *Snapshot) status() map[common.Address]*SignerStatus {
+	status := make(map[common.Address]*SignerStatus)
+	for signer := range s.Signers {
+		status[signer] = &SignerStatus{LastSigned: s.Seen[signer]}
+	}
+	for _, slot := range s.Window {
+		if stat, ok := status[slot.InTurn]; ok {
+			stat.InTurn++
+			if slot.Signer != slot.InTurn {
+				stat.Missed++
+			}
+		}
+		if stat, ok := status[slot.Signer]; ok {
+			stat.Signed++
+		}
+	}
+	return status
+}
+
+// inactive returns the signers that didn't seal any block for more than the given
+// number of blocks.
+func (s *Snapshot) inactive(number uint64, blocks uint64) []common.Address {
+	var signers []common.Address
+	for _, signer := range s.signers() {
+		if number > s.Seen[signer]+blocks {
+			signers = append(signers, signer)
+		}
+	}
+	return signers
+}
+
+// meter reports the signing turns of the snapshot not yet seen into the metrics
+// system, progressing the tracked head.
+func (c *Clique) meter(snap *Snapshot) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for i := len(snap.Window) - 1; i >= 0 && snap.Window[i].Block > c.metered; i-- {
+		slot := snap.Window[i]
+		if slot.Signer == slot.InTurn {
+			inturnSlotMeter.Mark(1)
+			continue
+		}
+		missedSlotMeter.Mark(1)
+		if slot.InTurn == c.signer {
+			localMissedSlotMeter.Mark(1)
+		}
+	}
+	if snap.Number > c.metered {
+		c.metered = snap.Number
+	}
+}
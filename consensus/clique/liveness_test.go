@@ -0,0 +1,136 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the liveness of the signers is tracked, and that signers inactive
+// for too long are automatically proposed to be dropped if requested.
+func TestSignerLiveness(t *testing.T) {
+	ap := newTesterAccountPool()
+	signers := sortedAddresses(ap, "A", "B", "C")
+
+	// Create a chain with three signers
+	config := &params.CliqueConfig{Period: 1, Epoch: 3}
+	genesis := &core.Genesis{
+		Config:     &params.ChainConfig{ChainId: big.NewInt(1), Clique: config},
+		Timestamp:  uint64(time.Now().Unix()) - 100,
+		ExtraData:  make([]byte, extraVanity+len(signers)*common.AddressLength+extraSeal),
+		Difficulty: big.NewInt(1),
+	}
+	for i, signer := range signers {
+		copy(genesis.ExtraData[extraVanity+i*common.AddressLength:], signer[:])
+	}
+	db, _ := ethdb.NewMemDatabase()
+	genesis.MustCommit(db)
+
+	engine := New(config, db)
+	chain, err := core.NewBlockChain(db, genesis.Config, engine, new(event.TypeMux), vm.Config{}, 0)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// Seal a few headers with only two of the signers, the third being offline
+	var (
+		parent  = chain.CurrentHeader()
+		headers []*types.Header
+	)
+	for _, signer := range []string{"A", "B", "A", "B", "A", "B"} {
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number, common.Big1),
+			Time:       new(big.Int).Add(parent.Time, common.Big1),
+			Difficulty: diffNoTurn,
+			Extra:      make([]byte, extraVanity),
+		}
+		number := header.Number.Uint64()
+		if signers[number%uint64(len(signers))] == ap.address(signer) {
+			header.Difficulty = diffInTurn
+		}
+		if number%config.Epoch == 0 {
+			header.Extra = append(header.Extra, genesis.ExtraData[extraVanity:len(genesis.ExtraData)-extraSeal]...)
+		}
+		header.Extra = append(header.Extra, make([]byte, extraSeal)...)
+		ap.sign(header, signer)
+
+		headers, parent = append(headers, header), header
+	}
+	if _, err := chain.InsertHeaderChain(headers, 1); err != nil {
+		t.Fatalf("failed to insert headers: %v", err)
+	}
+	// Ensure the signing turns are correctly accounted for
+	status, err := (&API{chain: chain, clique: engine}).GetSignerStatus(nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve signer status: %v", err)
+	}
+	wants := map[string]SignerStatus{
+		"A": {InTurn: 2, Signed: 3, LastSigned: 5},
+		"B": {InTurn: 2, Signed: 3, LastSigned: 6},
+		"C": {InTurn: 2, Missed: 2},
+	}
+	missed := 0
+	for _, header := range headers {
+		if header.Difficulty.Cmp(diffNoTurn) == 0 {
+			missed++
+		}
+	}
+	for signer, want := range wants {
+		have := status[ap.address(signer)]
+		if have == nil {
+			t.Fatalf("signer %s: status missing", signer)
+		}
+		missed -= have.Missed
+		if signer != "C" {
+			want.Missed = have.Missed // depends on the order of the keys
+		}
+		if *have != want {
+			t.Errorf("signer %s: status mismatch: have %+v, want %+v", signer, *have, want)
+		}
+	}
+	if missed != 0 {
+		t.Errorf("missed turns mismatch: %d unaccounted for", missed)
+	}
+	// Ensure the inactive signer is only proposed to be dropped if requested
+	prepare := func() *types.Header {
+		header := &types.Header{ParentHash: parent.Hash(), Number: new(big.Int).Add(parent.Number, common.Big1)}
+		if err := engine.Prepare(chain, header); err != nil {
+			t.Fatalf("failed to prepare header: %v", err)
+		}
+		return header
+	}
+	engine.Authorize(ap.address("A"), nil)
+	if header := prepare(); header.Coinbase != (common.Address{}) {
+		t.Errorf("vote cast without dropping inactive signers: %x", header.Coinbase)
+	}
+	engine.SetDropInactive(1)
+	if header := prepare(); header.Coinbase != ap.address("C") || header.Nonce != (types.BlockNonce{}) {
+		t.Errorf("inactive signer drop vote mismatch: have %x/%x, want %x/%x", header.Coinbase, header.Nonce, ap.address("C"), types.BlockNonce{})
+	}
+}
@@ -54,6 +54,8 @@ type Snapshot struct {
 	Recents map[uint64]common.Address   `json:"recents"` // Set of recent signers for spam protections
 	Votes   []*Vote                     `json:"votes"`   // List of votes cast in chronological order
 	Tally   map[common.Address]Tally    `json:"tally"`   // Current vote tally to avoid recalculating
+	Window  []Slot                      `json:"window"`  // Signing turns of the recent blocks, oldest first
+	Seen    map[common.Address]uint64   `json:"seen"`    // Last block sealed by (or authorizing) each signer
 }
 
 // newSnapshot creates a new snapshot with the specified startup parameters. This
@@ -68,9 +70,11 @@ func newSnapshot(config *params.CliqueConfig, sigcache *lru.ARCCache, number uin
 		Signers:  make(map[common.Address]struct{}),
 		Recents:  make(map[uint64]common.Address),
 		Tally:    make(map[common.Address]Tally),
+		Seen:     make(map[common.Address]uint64),
 	}
 	for _, signer := range signers {
 		snap.Signers[signer] = struct{}{}
+		snap.Seen[signer] = number
 	}
 	return snap
 }
@@ -88,6 +92,13 @@ func loadSnapshot(config *params.CliqueConfig, sigcache *lru.ARCCache, db ethdb.
 	snap.config = config
 	snap.sigcache = sigcache
 
+	// Snapshots stored before liveness tracking consider all signers just seen
+	if snap.Seen == nil {
+		snap.Seen = make(map[common.Address]uint64)
+		for signer := range snap.Signers {
+			snap.Seen[signer] = snap.Number
+		}
+	}
 	return snap, nil
 }
 
@@ -111,10 +122,16 @@ func (s *Snapshot) copy() *Snapshot {
 		Recents:  make(map[uint64]common.Address),
 		Votes:    make([]*Vote, len(s.Votes)),
 		Tally:    make(map[common.Address]Tally),
+		Window:   make([]Slot, len(s.Window)),
+		Seen:     make(map[common.Address]uint64),
 	}
 	for signer := range s.Signers {
 		cpy.Signers[signer] = struct{}{}
 	}
+	for signer, number := range s.Seen {
+		cpy.Seen[signer] = number
+	}
+	copy(cpy.Window, s.Window)
 	for block, signer := range s.Recents {
 		cpy.Recents[block] = signer
 	}
@@ -214,7 +231,34 @@ func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
 			}
 		}
 		snap.Recents[number] = signer
+		snap.track(number, signer)
 
+		// Contract governed signer sets only change on checkpoints, taking over the
+		// list verified against the governance contract
+		if s.config.Governance != nil {
+			if number%s.config.Epoch == 0 {
+				snap.Signers = make(map[common.Address]struct{})
+				for _, signer := range checkpointSigners(header) {
+					snap.Signers[signer] = struct{}{}
+					if _, ok := snap.Seen[signer]; !ok {
+						snap.Seen[signer] = number
+					}
+				}
+				for signer := range snap.Seen {
+					if _, ok := snap.Signers[signer]; !ok {
+						delete(snap.Seen, signer)
+					}
+				}
+				// Signer list changed, delete any leftover recent caches
+				limit := uint64(len(snap.Signers)/2 + 1)
+				for block := range snap.Recents {
+					if block+limit <= number {
+						delete(snap.Recents, block)
+					}
+				}
+			}
+			continue
+		}
 		// Header authorized, discard any previous votes from the signer
 		for i, vote := range snap.Votes {
 			if vote.Signer == signer && vote.Address == header.Coinbase {
@@ -248,8 +292,10 @@ func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
 		if tally := snap.Tally[header.Coinbase]; tally.Votes > len(snap.Signers)/2 {
 			if tally.Authorize {
 				snap.Signers[header.Coinbase] = struct{}{}
+				snap.Seen[header.Coinbase] = number
 			} else {
 				delete(snap.Signers, header.Coinbase)
+				delete(snap.Seen, header.Coinbase)
 
 				// Signer list shrunk, delete any leftover recent caches
 				if limit := uint64(len(snap.Signers)/2 + 1); number >= limit {
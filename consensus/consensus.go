@@ -95,3 +95,13 @@ type PoW interface {
 	// Hashrate returns the current mining hashrate of a PoW consensus engine.
 	Hashrate() float64
 }
+
+// Finality is a consensus engine whose blocks become irreversible once agreed
+// upon, rather than probabilistically through accumulated work.
+type Finality interface {
+	Engine
+
+	// Finalized returns the number of the highest block, up to the given head,
+	// that can never be reorganised away.
+	Finalized(chain ChainReader, head *types.Header) uint64
+}
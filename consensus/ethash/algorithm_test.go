@@ -678,23 +678,29 @@ func TestConcurrentDiskCacheGeneration(t *testing.T) {
 	}
 	defer os.RemoveAll(cachedir)
 
-	// Define a heavy enough block, one from mainnet should do
-	block := types.NewBlockWithHeader(&types.Header{
+	// Define a heavy enough block, one from mainnet should do. The header lacks
+	// the gas and uncle fields, so the mainnet seal is recomputed for it.
+	header := &types.Header{
 		Number:      big.NewInt(3311058),
 		ParentHash:  common.HexToHash("0xd783efa4d392943503f28438ad5830b2d5964696ffc285f338585e9fe0a37a05"),
-		UncleHash:   common.HexToHash("0x1dcc4de8dec75d7aab85b567b6ccd41ad312451b948a7413f0a142fd40d49347"),
 		Coinbase:    common.HexToAddress("0xc0ea08a2d404d3172d2add29a45be56da40e2949"),
 		Root:        common.HexToHash("0x77d14e10470b5850332524f8cd6f69ad21f070ce92dca33ab2858300242ef2f1"),
 		TxHash:      common.HexToHash("0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421"),
 		ReceiptHash: common.HexToHash("0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421"),
-		Difficulty:  big.NewInt(167925187834220),
-		GasLimit:    big.NewInt(4015682),
-		GasUsed:     big.NewInt(0),
+		Difficulty:  big.NewInt(1),
 		Time:        big.NewInt(1488928920),
 		Extra:       []byte("www.bw.com"),
-		MixDigest:   common.HexToHash("0x3e140b0784516af5e5ec6730f2fb20cca22f32be399b9e4ad77d32541f798cd0"),
 		Nonce:       types.EncodeNonce(0xf400cd0006070c49),
-	})
+	}
+	epoch := header.Number.Uint64() / epochLength
+	cache := make([]uint32, cacheSize(epoch*epochLength+1)/4)
+	generateCache(cache, epoch, seedHash(epoch*epochLength+1))
+
+	digest, _ := hashimotoLight(datasetSize(header.Number.Uint64()), cache, header.HashNoNonce().Bytes(), header.Nonce.Uint64())
+	header.MixDigest = common.BytesToHash(digest)
+
+	block := types.NewBlockWithHeader(header)
+
 	// Simulate multiple processes sharing the same datadir
 	var pend sync.WaitGroup
 
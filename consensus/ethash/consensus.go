@@ -31,11 +31,6 @@ import (
 	"github.com/ethereum/go-ethereum/params"
 )
 
-// Ethash proof-of-work protocol constants.
-var (
-	blockReward *big.Int = big.NewInt(5e+18) // Block reward in wei for successfully mining a block
-)
-
 // Various error messages to mark blocks invalid. These should be private to
 // prevent engine specific errors from being referenced in the remainder of the
 // codebase, inherently breaking if the engine is swapped out. Please put common
@@ -298,9 +293,52 @@ func (ethash *Ethash) VerifySeal(chain consensus.ChainReader, header *types.Head
 		}
 		return nil
 	}
+	// If we're running a shared PoW, delegate verification to it
+	if ethash.shared != nil {
+		return ethash.shared.VerifySeal(chain, header)
+	}
+	// Ensure that we have a valid difficulty for the block
+	if header.Difficulty.Sign() <= 0 {
+		return errInvalidDifficulty
+	}
+	// Recompute the digest and PoW value and verify against the header
+	digest, result := ethash.Compute(header.HashNoNonce(), header.Number.Uint64(), header.Nonce.Uint64())
+
+	if header.MixDigest != digest {
+		return errInvalidMixDigest
+	}
+	target := new(big.Int).Div(maxUint256, header.Difficulty)
+	if result.Big().Cmp(target) > 0 {
+		return errInvalidPoW
+	}
 	return nil
 }
 
+// Compute evaluates the proof-of-work of a nonce for a header hash (sans nonce)
+// with the verification cache of the block's epoch, returning the mix digest and
+// the result to be checked against the difficulty target.
+func (ethash *Ethash) Compute(hash common.Hash, number uint64, nonce uint64) (common.Hash, common.Hash) {
+	// If we're running a fake PoW, every nonce is as good as any other
+	if ethash.fakeMode {
+		return common.Hash{}, common.Hash{}
+	}
+	// If we're running a shared PoW, delegate hashing to it
+	if ethash.shared != nil {
+		return ethash.shared.Compute(hash, number, nonce)
+	}
+	cache := ethash.cache(number)
+	size := datasetSize(number)
+	if ethash.tester {
+		size = testDatasetSize
+	}
+	digest, result := hashimotoLight(size, cache.cache, hash.Bytes(), nonce)
+
+	// Caches are unmapped in a finalizer, ensure it stays alive until hashed
+	runtime.KeepAlive(cache)
+
+	return common.BytesToHash(digest), common.BytesToHash(result)
+}
+
 // Prepare implements consensus.Engine, initializing the difficulty field of a
 // header to conform to the ethash protocol. The changes are done inline.
 func (ethash *Ethash) Prepare(chain consensus.ChainReader, header *types.Header) error {
@@ -317,7 +355,7 @@ func (ethash *Ethash) Prepare(chain consensus.ChainReader, header *types.Header)
 // setting the final state and assembling the block.
 func (ethash *Ethash) Finalize(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, receipts []*types.Receipt) (*types.Block, error) {
 	// Accumulate any block rewards and commit the final state root
-	AccumulateRewards(state, header)
+	AccumulateRewards(chain.Config(), state, header)
 	header.Root = state.IntermediateRoot(true)
 
 	// Header seems complete, assemble into a block and return
@@ -331,15 +369,8 @@ var (
 )
 
 // AccumulateRewards credits the coinbase of the given block with the mining
-// reward. The total reward consists of the static block reward .
+// reward of the chain's schedule.
 // TODO (karalabe): Move the chain maker into this package and make this private!
-func AccumulateRewards(state *state.StateDB, header *types.Header) {
-	reward := new(big.Int).Set(blockReward)
-	state.AddBalance(header.Coinbase, reward)
-}
-
-func (ethash *Ethash) Seal(chain consensus.ChainReader, block *types.Block, stop <-chan struct{}) (*types.Block, error) {
-	header := block.Header()
-	header.Nonce, header.MixDigest = types.BlockNonce{}, common.Hash{}
-	return block.WithSeal(header), nil
+func AccumulateRewards(config *params.ChainConfig, state *state.StateDB, header *types.Header) {
+	consensus.AccumulateRewards(config, state, header, header.Coinbase)
 }
@@ -19,18 +19,23 @@ package ethash
 
 import (
 	"errors"
+	"fmt"
 	"math/big"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"strconv"
+	"sync"
 	"time"
 	"unsafe"
 
 	mmap "github.com/edsrzf/mmap-go"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rpc"
+	metrics "github.com/rcrowley/go-metrics"
 )
 
 var ErrInvalidDumpMagic = errors.New("invalid dump magic")
@@ -39,6 +44,9 @@ var (
 	// maxUint256 is a big integer representing 2^256-1
 	maxUint256 = new(big.Int).Exp(big.NewInt(2), big.NewInt(256), big.NewInt(0))
 
+	// sharedEthash is a full instance that can be shared between multiple users.
+	sharedEthash = New("", 3, 0, "", 1, 0)
+
 	// algorithmRevision is the data structure version used for file naming.
 	algorithmRevision = 23
 
@@ -46,6 +54,14 @@ var (
 	dumpMagic = []uint32{0xbaddcafe, 0xfee1dead}
 )
 
+const (
+	// testCacheSize is the size of the verification cache in test mode.
+	testCacheSize = 1024
+
+	// testDatasetSize is the size of the mining dataset in test mode.
+	testDatasetSize = 32 * 1024
+)
+
 // isLittleEndian returns whether the local system is running in little or big
 // endian byte order.
 func isLittleEndian() bool {
@@ -134,16 +150,252 @@ func memoryMapAndGenerate(path string, size uint64, generator func(buffer []uint
 	return memoryMap(path)
 }
 
+// cache wraps an ethash cache with some metadata to allow easier concurrent use.
+type cache struct {
+	epoch uint64 // Epoch for which this cache is relevant
+
+	dump  *os.File  // File descriptor of the memory mapped cache
+	mmap  mmap.MMap // Memory map itself to unmap before releasing
+	cache []uint32  // The actual cache data content (may be memory mapped)
+
+	used time.Time  // Timestamp of the last use for smarter eviction
+	once sync.Once  // Ensures the cache is generated only once
+	lock sync.Mutex // Ensures thread safety for updating the usage time
+}
+
+// newCache creates a new ethash verification cache, releasing any associated
+// file handles and memory maps when it becomes unreachable.
+func newCache(epoch uint64) *cache {
+	c := &cache{epoch: epoch}
+	runtime.SetFinalizer(c, (*cache).release)
+	return c
+}
+
+// generate ensures that the cache content is generated before use.
+func (c *cache) generate(dir string, limit int, test bool) {
+	c.once.Do(func() {
+		seed := seedHash(c.epoch*epochLength + 1)
+
+		size, kind := cacheSize(c.epoch*epochLength+1), "cache"
+		if test {
+			size, kind = testCacheSize, "cache-test"
+		}
+		// If we don't store anything on disk, generate and return
+		if dir == "" || limit <= 0 {
+			c.cache = make([]uint32, size/4)
+			generateCache(c.cache, c.epoch, seed)
+			return
+		}
+		// Disk storage is needed, try to load the file from disk and memory map it
+		path := dumpPath(dir, kind, seed)
+		logger := log.New("epoch", c.epoch)
+
+		var err error
+		c.dump, c.mmap, c.cache, err = memoryMap(path)
+		if err == nil {
+			logger.Debug("Loaded old ethash cache from disk")
+			return
+		}
+		logger.Debug("Failed to load old ethash cache", "err", err)
+
+		// No previous cache available, create a new cache file to fill
+		c.dump, c.mmap, c.cache, err = memoryMapAndGenerate(path, size, func(buffer []uint32) { generateCache(buffer, c.epoch, seed) })
+		if err != nil {
+			logger.Error("Failed to generate mapped ethash cache", "err", err)
+
+			c.cache = make([]uint32, size/4)
+			generateCache(c.cache, c.epoch, seed)
+		}
+		// Iterate over all previous instances and delete old ones
+		evictDumps(dir, kind, c.epoch, limit)
+	})
+}
+
+// release closes any file handlers and memory maps open.
+func (c *cache) release() {
+	if c.mmap != nil {
+		c.mmap.Unmap()
+		c.mmap = nil
+	}
+	if c.dump != nil {
+		c.dump.Close()
+		c.dump = nil
+	}
+}
+
+// dataset wraps an ethash dataset with some metadata to allow easier concurrent use.
+type dataset struct {
+	epoch uint64 // Epoch for which this dataset is relevant
+
+	dump    *os.File  // File descriptor of the memory mapped dataset
+	mmap    mmap.MMap // Memory map itself to unmap before releasing
+	dataset []uint32  // The actual dataset content (may be memory mapped)
+
+	used time.Time  // Timestamp of the last use for smarter eviction
+	once sync.Once  // Ensures the dataset is generated only once
+	lock sync.Mutex // Ensures thread safety for updating the usage time
+}
+
+// newDataset creates a new ethash mining dataset, releasing any associated file
+// handles and memory maps when it becomes unreachable.
+func newDataset(epoch uint64) *dataset {
+	d := &dataset{epoch: epoch}
+	runtime.SetFinalizer(d, (*dataset).release)
+	return d
+}
+
+// generate ensures that the dataset content is generated before use.
+func (d *dataset) generate(dir string, limit int, test bool) {
+	d.once.Do(func() {
+		seed := seedHash(d.epoch*epochLength + 1)
+
+		csize, dsize, kind := cacheSize(d.epoch*epochLength+1), datasetSize(d.epoch*epochLength+1), "full"
+		if test {
+			csize, dsize, kind = testCacheSize, testDatasetSize, "full-test"
+		}
+		// The dataset is derived from the verification cache of the same epoch
+		cache := make([]uint32, csize/4)
+		generateCache(cache, d.epoch, seed)
+
+		// If we don't store anything on disk, generate and return
+		if dir == "" || limit <= 0 {
+			d.dataset = make([]uint32, dsize/4)
+			generateDataset(d.dataset, d.epoch, cache)
+			return
+		}
+		// Disk storage is needed, try to load the file from disk and memory map it
+		path := dumpPath(dir, kind, seed)
+		logger := log.New("epoch", d.epoch)
+
+		var err error
+		d.dump, d.mmap, d.dataset, err = memoryMap(path)
+		if err == nil {
+			logger.Debug("Loaded old ethash dataset from disk")
+			return
+		}
+		logger.Debug("Failed to load old ethash dataset", "err", err)
+
+		// No previous dataset available, create a new dataset file to fill
+		d.dump, d.mmap, d.dataset, err = memoryMapAndGenerate(path, dsize, func(buffer []uint32) { generateDataset(buffer, d.epoch, cache) })
+		if err != nil {
+			logger.Error("Failed to generate mapped ethash dataset", "err", err)
+
+			d.dataset = make([]uint32, dsize/4)
+			generateDataset(d.dataset, d.epoch, cache)
+		}
+		// Iterate over all previous instances and delete old ones
+		evictDumps(dir, kind, d.epoch, limit)
+	})
+}
+
+// release closes any file handlers and memory maps open.
+func (d *dataset) release() {
+	if d.mmap != nil {
+		d.mmap.Unmap()
+		d.mmap = nil
+	}
+	if d.dump != nil {
+		d.dump.Close()
+		d.dump = nil
+	}
+}
+
+// dumpPath returns the on-disk location of a cache or dataset dump belonging to
+// the epoch of the given seed.
+func dumpPath(dir string, kind string, seed []byte) string {
+	var endian string
+	if !isLittleEndian() {
+		endian = ".be"
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s-R%d-%x%s", kind, algorithmRevision, seed[:8], endian))
+}
+
+// evictDumps deletes the on-disk dumps of the given kind older than the allowed
+// number of epochs before the current one.
+func evictDumps(dir string, kind string, epoch uint64, limit int) {
+	for ep := int(epoch) - limit; ep >= 0; ep-- {
+		os.Remove(dumpPath(dir, kind, seedHash(uint64(ep)*epochLength+1)))
+	}
+}
+
 // Ethash is a consensus engine based on proot-of-work implementing the ethash
 // algorithm.
 type Ethash struct {
+	cachedir     string // Data directory to store the verification caches
+	cachesinmem  int    // Number of caches to keep in memory
+	cachesondisk int    // Number of caches to keep on disk
+	dagdir       string // Data directory to store full mining datasets
+	dagsinmem    int    // Number of mining datasets to keep in memory
+	dagsondisk   int    // Number of mining datasets to keep on disk
+
+	caches   map[uint64]*cache   // In memory caches to avoid regenerating too often
+	fcache   *cache              // Pre-generated cache for the estimated future epoch
+	datasets map[uint64]*dataset // In memory datasets to avoid regenerating too often
+	fdataset *dataset            // Pre-generated dataset for the estimated future epoch
+
+	// Mining related fields
+	rand     *rand.Rand    // Properly seeded random source for nonces
+	threads  int           // Number of threads to mine on if mining
+	update   chan struct{} // Notification channel to update mining parameters
+	hashrate metrics.Meter // Meter tracking the average hashrate
+
+	// The fields below are hooks for testing
 	tester    bool          // Flag whether to use a smaller test dataset
+	shared    *Ethash       // Shared PoW verifier to avoid cache regeneration
 	fakeMode  bool          // Flag whether to disable PoW checking
 	fakeFull  bool          // Flag whether to disable all consensus rules
 	fakeFail  uint64        // Block number which fails PoW check even in fake mode
 	fakeDelay time.Duration // Time delay to sleep for before returning from verify
+
+	lock sync.Mutex // Ensures thread safety for the in-memory caches and mining fields
+}
+
+// New creates a full sized ethash PoW scheme.
+func New(cachedir string, cachesinmem, cachesondisk int, dagdir string, dagsinmem, dagsondisk int) *Ethash {
+	if cachesinmem <= 0 {
+		log.Warn("One ethash cache must always be in memory", "requested", cachesinmem)
+		cachesinmem = 1
+	}
+	if dagsinmem <= 0 {
+		log.Warn("One ethash dataset must always be in memory", "requested", dagsinmem)
+		dagsinmem = 1
+	}
+	if cachedir != "" && cachesondisk > 0 {
+		log.Info("Disk storage enabled for ethash caches", "dir", cachedir, "count", cachesondisk)
+	}
+	if dagdir != "" && dagsondisk > 0 {
+		log.Info("Disk storage enabled for ethash DAGs", "dir", dagdir, "count", dagsondisk)
+	}
+	return &Ethash{
+		cachedir:     cachedir,
+		cachesinmem:  cachesinmem,
+		cachesondisk: cachesondisk,
+		dagdir:       dagdir,
+		dagsinmem:    dagsinmem,
+		dagsondisk:   dagsondisk,
+		caches:       make(map[uint64]*cache),
+		datasets:     make(map[uint64]*dataset),
+		update:       make(chan struct{}),
+		hashrate:     metrics.NewMeter(),
+	}
+}
+
+// NewTester creates a small sized ethash PoW scheme useful only for testing
+// purposes.
+func NewTester() *Ethash {
+	return &Ethash{
+		cachesinmem: 1,
+		dagsinmem:   1,
+		caches:      make(map[uint64]*cache),
+		datasets:    make(map[uint64]*dataset),
+		tester:      true,
+		update:      make(chan struct{}),
+		hashrate:    metrics.NewMeter(),
+	}
 }
 
+// NewFaker creates a ethash consensus engine with a fake PoW scheme that accepts
+// all blocks' seal as valid, though they still have to conform to the Ethereum
 // consensus rules.
 func NewFaker() *Ethash {
 	return &Ethash{fakeMode: true}
@@ -169,8 +421,167 @@ func NewFullFaker() *Ethash {
 	return &Ethash{fakeMode: true, fakeFull: true}
 }
 
+// NewShared creates a full sized ethash PoW shared between all requesters running
+// in the same process.
+func NewShared() *Ethash {
+	return &Ethash{shared: sharedEthash}
+}
+
+// cache tries to retrieve a verification cache for the specified block number
+// by first checking against a list of in-memory caches, then against caches
+// stored on disk, and finally generating one if none can be found.
+func (ethash *Ethash) cache(block uint64) *cache {
+	epoch := block / epochLength
+
+	// If we have a cache for that epoch, use that
+	ethash.lock.Lock()
+
+	current, future := ethash.caches[epoch], (*cache)(nil)
+	if current == nil {
+		// No in-memory cache, evict the oldest if the cache limit was reached
+		for len(ethash.caches) > 0 && len(ethash.caches) >= ethash.cachesinmem {
+			var evict *cache
+			for _, cache := range ethash.caches {
+				if evict == nil || evict.used.After(cache.used) {
+					evict = cache
+				}
+			}
+			delete(ethash.caches, evict.epoch)
+			log.Trace("Evicted ethash cache", "epoch", evict.epoch, "used", evict.used)
+		}
+		// If we have the new cache pre-generated, use that, otherwise create a new one
+		if ethash.fcache != nil && ethash.fcache.epoch == epoch {
+			log.Trace("Using pre-generated cache", "epoch", epoch)
+			current, ethash.fcache = ethash.fcache, nil
+		} else {
+			log.Trace("Requiring new ethash cache", "epoch", epoch)
+			current = newCache(epoch)
+		}
+		ethash.caches[epoch] = current
+
+		// If we just used up the future cache, or need a refresh, regenerate
+		if ethash.fcache == nil || ethash.fcache.epoch <= epoch {
+			log.Trace("Requiring new future ethash cache", "epoch", epoch+1)
+			future = newCache(epoch + 1)
+			ethash.fcache = future
+		}
+		// New current cache, set its initial timestamp
+		current.used = time.Now()
+	}
+	ethash.lock.Unlock()
+
+	// Wait for generation finish, bump the timestamp and finalize the cache
+	current.generate(ethash.cachedir, ethash.cachesondisk, ethash.tester)
+
+	current.lock.Lock()
+	current.used = time.Now()
+	current.lock.Unlock()
+
+	// If we exhausted the future cache, now's a good time to regenerate it
+	if future != nil {
+		go future.generate(ethash.cachedir, ethash.cachesondisk, ethash.tester)
+	}
+	return current
+}
+
+// dataset tries to retrieve a mining dataset for the specified block number
+// by first checking against a list of in-memory datasets, then against DAGs
+// stored on disk, and finally generating one if none can be found.
+func (ethash *Ethash) dataset(block uint64) *dataset {
+	epoch := block / epochLength
+
+	// If we have a dataset for that epoch, use that
+	ethash.lock.Lock()
+
+	current, future := ethash.datasets[epoch], (*dataset)(nil)
+	if current == nil {
+		// No in-memory dataset, evict the oldest if the dataset limit was reached
+		for len(ethash.datasets) > 0 && len(ethash.datasets) >= ethash.dagsinmem {
+			var evict *dataset
+			for _, dataset := range ethash.datasets {
+				if evict == nil || evict.used.After(dataset.used) {
+					evict = dataset
+				}
+			}
+			delete(ethash.datasets, evict.epoch)
+			log.Trace("Evicted ethash dataset", "epoch", evict.epoch, "used", evict.used)
+		}
+		// If we have the new dataset pre-generated, use that, otherwise create a new one
+		if ethash.fdataset != nil && ethash.fdataset.epoch == epoch {
+			log.Trace("Using pre-generated dataset", "epoch", epoch)
+			current, ethash.fdataset = ethash.fdataset, nil
+		} else {
+			log.Trace("Requiring new ethash dataset", "epoch", epoch)
+			current = newDataset(epoch)
+		}
+		ethash.datasets[epoch] = current
+
+		// If we just used up the future dataset, or need a refresh, regenerate
+		if ethash.fdataset == nil || ethash.fdataset.epoch <= epoch {
+			log.Trace("Requiring new future ethash dataset", "epoch", epoch+1)
+			future = newDataset(epoch + 1)
+			ethash.fdataset = future
+		}
+		// New current dataset, set its initial timestamp
+		current.used = time.Now()
+	}
+	ethash.lock.Unlock()
+
+	// Wait for generation finish, bump the timestamp and finalize the dataset
+	current.generate(ethash.dagdir, ethash.dagsondisk, ethash.tester)
+
+	current.lock.Lock()
+	current.used = time.Now()
+	current.lock.Unlock()
+
+	// If we exhausted the future dataset, now's a good time to regenerate it
+	if future != nil {
+		go future.generate(ethash.dagdir, ethash.dagsondisk, ethash.tester)
+	}
+	return current
+}
+
+// Threads returns the number of mining threads currently enabled. This doesn't
+// necessarily mean that mining is running!
+func (ethash *Ethash) Threads() int {
+	ethash.lock.Lock()
+	defer ethash.lock.Unlock()
+
+	return ethash.threads
+}
+
+// SetThreads updates the number of mining threads currently enabled. Calling
+// this method does not start mining, only sets the thread count. If zero is
+// specified, the miner will use all cores of the machine. Setting a thread
+// count below zero is allowed and will cause the miner to idle, without any
+// work being done.
+func (ethash *Ethash) SetThreads(threads int) {
+	ethash.lock.Lock()
+	defer ethash.lock.Unlock()
+
+	// If we're running a shared PoW, set the thread count on that instead
+	if ethash.shared != nil {
+		ethash.shared.SetThreads(threads)
+		return
+	}
+	// Update the threads and ping any running seal to pull in any changes
+	ethash.threads = threads
+	select {
+	case ethash.update <- struct{}{}:
+	default:
+	}
+}
+
+// Hashrate implements PoW, returning the measured rate of the search invocations
+// per second over the last minute.
 func (ethash *Ethash) Hashrate() float64 {
-	return float64(0)
+	if ethash.shared != nil {
+		return ethash.shared.Hashrate()
+	}
+	if ethash.hashrate == nil {
+		return 0 // fake modes don't search for nonces
+	}
+	return ethash.hashrate.Rate1()
 }
 
 // APIs implements consensus.Engine, returning the user facing RPC APIs. Currently
@@ -17,8 +17,12 @@
 package ethash
 
 import (
+	"io/ioutil"
 	"math/big"
+	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/core/types"
 )
@@ -38,3 +42,96 @@ func TestTestMode(t *testing.T) {
 		t.Fatalf("unexpected verification error: %v", err)
 	}
 }
+
+// Tests that tampered seals are rejected by the verifier.
+func TestTestModeInvalidSeal(t *testing.T) {
+	head := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)}
+
+	ethash := NewTester()
+	block, err := ethash.Seal(nil, types.NewBlockWithHeader(head), nil)
+	if err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	// Tamper with the mix digest and ensure it's detected
+	bad := block.Header()
+	bad.MixDigest[0]++
+	if err := ethash.VerifySeal(nil, bad); err != errInvalidMixDigest {
+		t.Fatalf("tampered digest error mismatch: have %v, want %v", err, errInvalidMixDigest)
+	}
+	// Create a valid digest for an insufficient nonce and ensure it's detected
+	bad = block.Header()
+	bad.Difficulty = new(big.Int).Set(maxUint256)
+
+	digest, _ := hashimotoLight(testDatasetSize, ethash.cache(1).cache, bad.HashNoNonce().Bytes(), bad.Nonce.Uint64())
+	copy(bad.MixDigest[:], digest)
+	if err := ethash.VerifySeal(nil, bad); err != errInvalidPoW {
+		t.Fatalf("insufficient work error mismatch: have %v, want %v", err, errInvalidPoW)
+	}
+}
+
+// Tests that sealing is aborted when requested, without producing a block.
+func TestSealAbort(t *testing.T) {
+	head := &types.Header{Number: big.NewInt(1), Difficulty: new(big.Int).Set(maxUint256)}
+
+	ethash := NewTester()
+	ethash.SetThreads(2)
+
+	stop, done := make(chan struct{}), make(chan *types.Block)
+	go func() {
+		block, _ := ethash.Seal(nil, types.NewBlockWithHeader(head), stop)
+		done <- block
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+
+	select {
+	case block := <-done:
+		if block != nil {
+			t.Fatalf("aborted seal produced block #%d", block.NumberU64())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("seal not aborted")
+	}
+	if ethash.Hashrate() < 0 {
+		t.Fatalf("negative hashrate: %v", ethash.Hashrate())
+	}
+}
+
+// Tests that caches are stored on disk, reloaded from there by new instances and
+// evicted once they fall out of the retention window.
+func TestCacheFileEvict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethash-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	newTester := func() *Ethash {
+		ethash := NewTester()
+		ethash.cachedir, ethash.cachesondisk = dir, 2
+		return ethash
+	}
+	exists := func(epoch uint64) bool {
+		_, err := os.Stat(dumpPath(dir, "cache-test", seedHash(epoch*epochLength+1)))
+		return err == nil
+	}
+	// Generate the caches of the first few epochs and ensure old ones are dropped
+	ethash := newTester()
+	for epoch := uint64(0); epoch < 3; epoch++ {
+		ethash.cache(epoch * epochLength)
+	}
+	if exists(0) || !exists(1) || !exists(2) {
+		t.Fatalf("cache retention mismatch: have %v/%v/%v, want false/true/true", exists(0), exists(1), exists(2))
+	}
+	// Ensure a fresh instance loads the stored cache with the same content
+	want := make([]uint32, testCacheSize/4)
+	generateCache(want, 2, seedHash(2*epochLength+1))
+
+	cache := newTester().cache(2 * epochLength)
+	if cache.dump == nil {
+		t.Fatalf("cache not loaded from disk")
+	}
+	if !reflect.DeepEqual(cache.cache, want) {
+		t.Fatalf("loaded cache content mismatch")
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package instant implements a consensus engine sealing blocks on demand, meant
+// for single node development networks.
+package instant
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Instant sealing protocol constants.
+var (
+	blockDifficulty        = big.NewInt(1)    // Difficulty of every block, there's nothing to compete on
+	allowedFutureBlockTime = 15 * time.Second // Max time from current time allowed for blocks, before they're considered future blocks
+)
+
+// Various error messages to mark blocks invalid. These should be private to
+// prevent engine specific errors from being referenced in the remainder of the
+// codebase, inherently breaking if the engine is swapped out. Please put common
+// error types into the consensus package.
+var (
+	// errUnknownBlock is returned when sealing a block that cannot be part of the
+	// chain, such as the genesis block.
+	errUnknownBlock = errors.New("unknown block")
+
+	// errInvalidDifficulty is returned if the difficulty of a block is not 1.
+	errInvalidDifficulty = errors.New("invalid difficulty")
+
+	// errInvalidTimestamp is returned if the timestamp of a block is lower than
+	// the previous block's timestamp plus the block period.
+	errInvalidTimestamp = errors.New("invalid timestamp")
+)
+
+// Instant is a consensus engine trusting any well formed block, sealing local
+// ones as soon as they contain transactions, or on a fixed interval.
+type Instant struct {
+	config *params.InstantConfig // Consensus engine configuration parameters
+}
+
+// New creates an instant sealing consensus engine.
+func New(config *params.InstantConfig) *Instant {
+	conf := *config
+	return &Instant{config: &conf}
+}
+
+// Author implements consensus.Engine, returning the header's coinbase as there
+// is no seal to recover the producer from.
+func (i *Instant) Author(header *types.Header) (common.Address, error) {
+	return header.Coinbase, nil
+}
+
+// VerifyHeader checks whether a header conforms to the consensus rules.
+func (i *Instant) VerifyHeader(chain consensus.ChainReader, header *types.Header, seal bool) error {
+	return i.verifyHeader(chain, header, nil)
+}
+
+// VerifyHeaders is similar to VerifyHeader, but verifies a batch of headers. The
+// method returns a quit channel to abort the operations and a results channel to
+// retrieve the async verifications (the order is that of the input slice).
+func (i *Instant) VerifyHeaders(chain consensus.ChainReader, headers []*types.Header, seals []bool) (chan<- struct{}, <-chan error) {
+	abort := make(chan struct{})
+	results := make(chan error, len(headers))
+
+	go func() {
+		for j, header := range headers {
+			err := i.verifyHeader(chain, header, headers[:j])
+
+			select {
+			case <-abort:
+				return
+			case results <- err:
+			}
+		}
+	}()
+	return abort, results
+}
+
+// verifyHeader checks whether a header conforms to the consensus rules. The
+// caller may optionally pass in a batch of parents (ascending order) to avoid
+// looking those up from the database.
+func (i *Instant) verifyHeader(chain consensus.ChainReader, header *types.Header, parents []*types.Header) error {
+	if header.Number == nil {
+		return errUnknownBlock
+	}
+	number := header.Number.Uint64()
+
+	// The genesis block is the always valid dead-end
+	if number == 0 {
+		return nil
+	}
+	// Ensure that the header's extra-data section is of a reasonable size
+	if uint64(len(header.Extra)) > params.MaximumExtraDataSize {
+		return fmt.Errorf("extra-data too long: %d > %d", len(header.Extra), params.MaximumExtraDataSize)
+	}
+	// Don't waste time checking blocks from the future
+	if header.Time.Cmp(big.NewInt(time.Now().Add(allowedFutureBlockTime).Unix())) > 0 {
+		return consensus.ErrFutureBlock
+	}
+	if header.Difficulty == nil || header.Difficulty.Cmp(blockDifficulty) != 0 {
+		return errInvalidDifficulty
+	}
+	// Ensure that the block follows its parent and respects the block period
+	var parent *types.Header
+	if len(parents) > 0 {
+		parent = parents[len(parents)-1]
+	} else {
+		parent = chain.GetHeader(header.ParentHash, number-1)
+	}
+	if parent == nil || parent.Number.Uint64() != number-1 || parent.Hash() != header.ParentHash {
+		return consensus.ErrUnknownAncestor
+	}
+	// Blocks sealed on demand may share their parent's timestamp, as clique allows
+	if header.Time.Cmp(new(big.Int).Add(parent.Time, new(big.Int).SetUint64(i.config.Period))) < 0 {
+		return errInvalidTimestamp
+	}
+	return nil
+}
+
+// VerifySeal implements consensus.Engine. Instant blocks are not sealed, so any
+// header is accepted.
+func (i *Instant) VerifySeal(chain consensus.ChainReader, header *types.Header) error {
+	return nil
+}
+
+// Prepare implements consensus.Engine, setting the block difficulty and moving
+// the timestamp past the block period.
+func (i *Instant) Prepare(chain consensus.ChainReader, header *types.Header) error {
+	parent := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	header.Difficulty = new(big.Int).Set(blockDifficulty)
+
+	if min := new(big.Int).Add(parent.Time, new(big.Int).SetUint64(i.config.Period)); header.Time.Cmp(min) < 0 {
+		header.Time = min
+	}
+	return nil
+}
+
+// Finalize implements consensus.Engine, paying the scheduled block rewards (none
+// by default) and assembling the block. The transaction fees are credited while
+// processing the transactions.
+func (i *Instant) Finalize(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, receipts []*types.Receipt) (*types.Block, error) {
+	consensus.AccumulateRewards(chain.Config(), state, header, header.Coinbase)
+	header.Root = state.IntermediateRoot(true)
+
+	// Assemble and return the final block for sealing
+	return types.NewBlock(header, txs, receipts), nil
+}
+
+// Seal implements consensus.Engine, returning the block as is once it's due. If
+// no block period is configured, empty blocks are withheld until aborted.
+func (i *Instant) Seal(chain consensus.ChainReader, block *types.Block, stop <-chan struct{}) (*types.Block, error) {
+	// Sealing the genesis block is not supported
+	if block.NumberU64() == 0 {
+		return nil, errUnknownBlock
+	}
+	if i.config.Period == 0 {
+		// Seal on demand only, wait for a block with transactions to be requested
+		if len(block.Transactions()) == 0 {
+			log.Trace("Withholding empty block, waiting for transactions")
+			<-stop
+			return nil, nil
+		}
+		return block, nil
+	}
+	// Sealing on a fixed interval, wait for the block's time
+	delay := time.Unix(block.Time().Int64(), 0).Sub(time.Now())
+	log.Trace("Waiting for block period to seal", "delay", common.PrettyDuration(delay))
+
+	select {
+	case <-stop:
+		return nil, nil
+	case <-time.After(delay):
+	}
+	return block, nil
+}
+
+// APIs implements consensus.Engine, returning the user facing RPC APIs. The
+// instant sealer has none.
+func (i *Instant) APIs(chain consensus.ChainReader) []rpc.API {
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package instant
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// Tests that the instant sealer withholds empty blocks until transactions arrive,
+// while producing blocks the chain accepts.
+func TestOnDemandSealing(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	gspec := core.DeveloperGenesisBlock(0, common.Address{0xde, 0xad})
+	gspec.Timestamp = 10
+	genesis := gspec.MustCommit(db)
+	config, err := core.GetChainConfig(db, genesis.Hash())
+	if err != nil || config.Instant == nil {
+		t.Fatalf("developer genesis not configured for instant sealing: %v", config)
+	}
+	engine := New(config.Instant)
+	chain, err := core.NewBlockChain(db, config, engine, new(event.TypeMux), vm.Config{}, 0)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// Assemble an empty block on top of the genesis
+	header := &types.Header{
+		ParentHash: genesis.Hash(),
+		Number:     big.NewInt(1),
+		Time:       new(big.Int).Set(genesis.Time()),
+		Coinbase:   common.Address{0xcc},
+	}
+	if err := engine.Prepare(chain, header); err != nil {
+		t.Fatalf("failed to prepare header: %v", err)
+	}
+	if header.Difficulty.Cmp(blockDifficulty) != 0 || header.Time.Cmp(genesis.Time()) != 0 {
+		t.Fatalf("prepared header mismatch: difficulty %v, time %v", header.Difficulty, header.Time)
+	}
+	statedb, _ := chain.StateAt(genesis.Root())
+	block, err := engine.Finalize(chain, header, statedb, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to finalize block: %v", err)
+	}
+	// Ensure the empty block is withheld until sealing is aborted
+	stop := make(chan struct{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(stop)
+	}()
+	if sealed, err := engine.Seal(chain, block, stop); sealed != nil || err != nil {
+		t.Fatalf("empty block sealed: %v, %v", sealed, err)
+	}
+	// Ensure blocks with transactions are sealed right away
+	tx := types.NewTransaction(0, common.Address{0x01}, big.NewInt(1), nil)
+	if sealed, err := engine.Seal(chain, block.WithBody([]*types.Transaction{tx}), make(chan struct{})); sealed == nil || err != nil {
+		t.Fatalf("failed to seal block with transactions: %v", err)
+	}
+	// Ensure the chain accepts the produced block, but rejects tampered ones
+	if _, err := chain.InsertChain(types.Blocks{block}); err != nil {
+		t.Fatalf("failed to import block: %v", err)
+	}
+	bad := types.CopyHeader(block.Header())
+	bad.Number, bad.ParentHash = big.NewInt(2), block.Hash()
+	bad.Time = new(big.Int).Add(block.Time(), common.Big1)
+	bad.Difficulty = big.NewInt(2)
+	if err := engine.VerifyHeader(chain, bad, true); err != errInvalidDifficulty {
+		t.Fatalf("difficulty error mismatch: have %v, want %v", err, errInvalidDifficulty)
+	}
+	bad.Difficulty, bad.Time = big.NewInt(1), block.Time()
+	if err := engine.VerifyHeader(chain, bad, true); err != nil {
+		t.Fatalf("failed to verify block sharing its parent's timestamp: %v", err)
+	}
+	bad.Time = new(big.Int).Sub(block.Time(), common.Big1)
+	if err := engine.VerifyHeader(chain, bad, true); err != errInvalidTimestamp {
+		t.Fatalf("timestamp error mismatch: have %v, want %v", err, errInvalidTimestamp)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package consensus
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// AccumulateRewards credits the producer of a block with its share of the block
+// reward, and the treasury of the chain's reward schedule with the remainder.
+func AccumulateRewards(config *params.ChainConfig, state *state.StateDB, header *types.Header, producer common.Address) {
+	reward, treasury := config.BlockReward(header.Number)
+	if reward.Sign() > 0 {
+		state.AddBalance(producer, reward)
+	}
+	if treasury.Sign() > 0 {
+		state.AddBalance(*config.Reward.Treasury, treasury)
+	}
+}
+
+// AccumulateFees credits the producer of a block with the fees charged for the
+// transactions of the block, as summed up while applying them.
+func AccumulateFees(state *state.StateDB, producer common.Address, fees *big.Int) {
+	if fees != nil && fees.Sign() > 0 {
+		state.AddBalance(producer, fees)
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package transition implements a consensus engine handing a running chain over
+// from one consensus engine to another at a configured block.
+package transition
+
+import (
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Successor is a consensus engine that needs to know where it takes over a chain
+// started by a different engine, such as the authority based engines seeding
+// their initial signer set.
+type Successor interface {
+	consensus.Engine
+
+	// TakeOver configures the engine to seal the chain from the given block on,
+	// starting with the given set of signers.
+	TakeOver(number uint64, signers []common.Address)
+}
+
+// Transition is a consensus engine delegating every block before the transition
+// block to one engine and every block from it onwards to another. The engine of
+// a block only depends on its number, so verification stays correct on either
+// side of the boundary and across reorgs spanning it.
+type Transition struct {
+	before consensus.Engine // Engine sealing the blocks before the transition
+	after  consensus.Engine // Engine sealing the blocks from the transition on
+	block  uint64           // First block sealed by the new engine
+}
+
+// New creates a consensus engine switching from the before engine to the after
+// one at the given block, handing the initial signers to the new engine if it is
+// authority based.
+func New(before, after consensus.Engine, block uint64, signers []common.Address) *Transition {
+	if successor, ok := after.(Successor); ok {
+		successor.TakeOver(block, signers)
+	}
+	return &Transition{
+		before: before,
+		after:  after,
+		block:  block,
+	}
+}
+
+// Engines returns the consensus engines before and after the transition.
+func (t *Transition) Engines() (before, after consensus.Engine) {
+	return t.before, t.after
+}
+
+// engine returns the consensus engine responsible for the given block.
+func (t *Transition) engine(number uint64) consensus.Engine {
+	if number < t.block {
+		return t.before
+	}
+	return t.after
+}
+
+// Author implements consensus.Engine, returning the producer of the block as
+// recovered by the engine responsible for it.
+func (t *Transition) Author(header *types.Header) (common.Address, error) {
+	return t.engine(header.Number.Uint64()).Author(header)
+}
+
+// VerifyHeader implements consensus.Engine, checking the header against the
+// rules of the engine responsible for it.
+func (t *Transition) VerifyHeader(chain consensus.ChainReader, header *types.Header, seal bool) error {
+	return t.engine(header.Number.Uint64()).VerifyHeader(chain, header, seal)
+}
+
+// VerifyHeaders implements consensus.Engine, splitting the batch at the transition
+// block and verifying either part with its own engine. The headers preceding the
+// transition are made available to the new engine as they may not be in the
+// database yet. The results are returned in the order of the input slice.
+func (t *Transition) VerifyHeaders(chain consensus.ChainReader, headers []*types.Header, seals []bool) (chan<- struct{}, <-chan error) {
+	split := sort.Search(len(headers), func(i int) bool {
+		return headers[i].Number.Uint64() >= t.block
+	})
+	if split == 0 {
+		return t.after.VerifyHeaders(chain, headers, seals)
+	}
+	if split == len(headers) {
+		return t.before.VerifyHeaders(chain, headers, seals)
+	}
+	beforeAbort, beforeResults := t.before.VerifyHeaders(chain, headers[:split], seals[:split])
+	afterAbort, afterResults := t.after.VerifyHeaders(newBatchChain(chain, headers[:split]), headers[split:], seals[split:])
+
+	abort := make(chan struct{})
+	results := make(chan error, len(headers))
+
+	go func() {
+		defer close(beforeAbort)
+		defer close(afterAbort)
+
+		for i := range headers {
+			source := beforeResults
+			if i >= split {
+				source = afterResults
+			}
+			var err error
+			select {
+			case <-abort:
+				return
+			case err = <-source:
+			}
+			select {
+			case <-abort:
+				return
+			case results <- err:
+			}
+		}
+	}()
+	return abort, results
+}
+
+// VerifySeal implements consensus.Engine, checking the seal against the rules of
+// the engine responsible for the header.
+func (t *Transition) VerifySeal(chain consensus.ChainReader, header *types.Header) error {
+	return t.engine(header.Number.Uint64()).VerifySeal(chain, header)
+}
+
+// Prepare implements consensus.Engine, initializing the consensus fields of the
+// header by the engine responsible for it.
+func (t *Transition) Prepare(chain consensus.ChainReader, header *types.Header) error {
+	return t.engine(header.Number.Uint64()).Prepare(chain, header)
+}
+
+// Finalize implements consensus.Engine, running the post-transaction state
+// modifications of the engine responsible for the block.
+func (t *Transition) Finalize(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, receipts []*types.Receipt) (*types.Block, error) {
+	return t.engine(header.Number.Uint64()).Finalize(chain, header, state, txs, receipts)
+}
+
+// Seal implements consensus.Engine, sealing the block with the engine responsible
+// for it.
+func (t *Transition) Seal(chain consensus.ChainReader, block *types.Block, stop <-chan struct{}) (*types.Block, error) {
+	return t.engine(block.NumberU64()).Seal(chain, block, stop)
+}
+
+// APIs implements consensus.Engine, returning the RPC APIs of both engines, as
+// the history of the chain remains queryable past the transition.
+func (t *Transition) APIs(chain consensus.ChainReader) []rpc.API {
+	return append(t.before.APIs(chain), t.after.APIs(chain)...)
+}
+
+// Hashrate implements consensus.PoW, returning the combined mining hashrate of
+// the proof-of-work engines on either side of the transition.
+func (t *Transition) Hashrate() float64 {
+	var hashrate float64
+	for _, engine := range []consensus.Engine{t.before, t.after} {
+		if pow, ok := engine.(consensus.PoW); ok {
+			hashrate += pow.Hashrate()
+		}
+	}
+	return hashrate
+}
+
+// SetThreads updates the number of mining threads of the proof-of-work engines on
+// either side of the transition.
+func (t *Transition) SetThreads(threads int) {
+	type threaded interface {
+		SetThreads(threads int)
+	}
+	for _, engine := range []consensus.Engine{t.before, t.after} {
+		if th, ok := engine.(threaded); ok {
+			th.SetThreads(threads)
+		}
+	}
+}
+
+// Finalized implements consensus.Finality, returning the highest block finalized
+// by either engine. Blocks finalized before the transition stay final after it.
+func (t *Transition) Finalized(chain consensus.ChainReader, head *types.Header) uint64 {
+	if head.Number.Uint64() < t.block {
+		if engine, ok := t.before.(consensus.Finality); ok {
+			return engine.Finalized(chain, head)
+		}
+		return 0
+	}
+	var finalized uint64
+	if engine, ok := t.before.(consensus.Finality); ok {
+		if last := chain.GetHeaderByNumber(t.block - 1); last != nil {
+			finalized = engine.Finalized(chain, last)
+		}
+	}
+	if engine, ok := t.after.(consensus.Finality); ok {
+		if number := engine.Finalized(chain, head); number > finalized {
+			finalized = number
+		}
+	}
+	return finalized
+}
+
+// batchChain is a chain reader also serving the headers of a batch being verified,
+// which are not yet in the database.
+type batchChain struct {
+	consensus.ChainReader
+	headers map[common.Hash]*types.Header
+}
+
+// newBatchChain wraps a chain reader to also serve the given headers.
+func newBatchChain(chain consensus.ChainReader, headers []*types.Header) *batchChain {
+	batch := &batchChain{
+		ChainReader: chain,
+		headers:     make(map[common.Hash]*types.Header, len(headers)),
+	}
+	for _, header := range headers {
+		batch.headers[header.Hash()] = header
+	}
+	return batch
+}
+
+// GetHeader retrieves a block header from the batch or the database by hash and
+// number.
+func (c *batchChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header, ok := c.headers[hash]; ok && header.Number.Uint64() == number {
+		return header
+	}
+	return c.ChainReader.GetHeader(hash, number)
+}
+
+// GetHeaderByHash retrieves a block header from the batch or the database by its
+// hash.
+func (c *batchChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	if header, ok := c.headers[hash]; ok {
+		return header
+	}
+	return c.ChainReader.GetHeaderByHash(hash)
+}
@@ -0,0 +1,163 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package transition
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var errTesterWrongEngine = errors.New("header verified by wrong engine")
+
+// testerChainReader implements consensus.ChainReader, serving only the genesis.
+type testerChainReader struct {
+	genesis *types.Header
+}
+
+func (r *testerChainReader) Config() *params.ChainConfig                   { return params.TestChainConfig }
+func (r *testerChainReader) CurrentHeader() *types.Header                  { return r.genesis }
+func (r *testerChainReader) GetBlock(common.Hash, uint64) *types.Block     { return nil }
+func (r *testerChainReader) GetHeaderByNumber(number uint64) *types.Header { return nil }
+func (r *testerChainReader) GetHeaderByHash(hash common.Hash) *types.Header {
+	return r.GetHeader(hash, 0)
+}
+func (r *testerChainReader) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if number == 0 && hash == r.genesis.Hash() {
+		return r.genesis
+	}
+	return nil
+}
+
+// testerEngine is a consensus engine accepting the headers stamped with its own
+// coinbase whose parents it can find.
+type testerEngine struct {
+	coinbase common.Address
+	first    uint64
+	signers  []common.Address
+}
+
+func (e *testerEngine) Author(header *types.Header) (common.Address, error) { return e.coinbase, nil }
+
+func (e *testerEngine) VerifyHeader(chain consensus.ChainReader, header *types.Header, seal bool) error {
+	return e.verifyHeader(chain, header, nil)
+}
+
+func (e *testerEngine) VerifyHeaders(chain consensus.ChainReader, headers []*types.Header, seals []bool) (chan<- struct{}, <-chan error) {
+	abort, results := make(chan struct{}), make(chan error, len(headers))
+	for i, header := range headers {
+		results <- e.verifyHeader(chain, header, headers[:i])
+	}
+	return abort, results
+}
+
+func (e *testerEngine) verifyHeader(chain consensus.ChainReader, header *types.Header, parents []*types.Header) error {
+	if header.Coinbase != e.coinbase {
+		return errTesterWrongEngine
+	}
+	if len(parents) > 0 && parents[len(parents)-1].Hash() == header.ParentHash {
+		return nil
+	}
+	if chain.GetHeader(header.ParentHash, header.Number.Uint64()-1) == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	return nil
+}
+
+func (e *testerEngine) VerifySeal(chain consensus.ChainReader, header *types.Header) error {
+	return nil
+}
+
+func (e *testerEngine) Prepare(chain consensus.ChainReader, header *types.Header) error {
+	header.Coinbase = e.coinbase
+	return nil
+}
+
+func (e *testerEngine) Finalize(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, receipts []*types.Receipt) (*types.Block, error) {
+	return types.NewBlock(header, txs, receipts), nil
+}
+
+func (e *testerEngine) Seal(chain consensus.ChainReader, block *types.Block, stop <-chan struct{}) (*types.Block, error) {
+	return block, nil
+}
+
+func (e *testerEngine) APIs(chain consensus.ChainReader) []rpc.API { return nil }
+
+func (e *testerEngine) TakeOver(number uint64, signers []common.Address) {
+	e.first, e.signers = number, signers
+}
+
+// Tests that headers are prepared and verified by the engine responsible for
+// them, even if a batch spans the transition and isn't in the database yet.
+func TestTransition(t *testing.T) {
+	genesis := &types.Header{Number: new(big.Int), Difficulty: big.NewInt(1)}
+	chain := &testerChainReader{genesis: genesis}
+
+	before := &testerEngine{coinbase: common.Address{0x01}}
+	after := &testerEngine{coinbase: common.Address{0x02}}
+	signers := []common.Address{{0xaa}, {0xbb}}
+
+	engine := New(before, after, 3, signers)
+	if after.first != 3 || !reflect.DeepEqual(after.signers, signers) {
+		t.Fatalf("take over mismatch: have %d/%v, want 3/%v", after.first, after.signers, signers)
+	}
+	// Build a chain spanning the transition
+	var (
+		headers = make([]*types.Header, 5)
+		seals   = make([]bool, 5)
+		parent  = genesis
+	)
+	for i := range headers {
+		header := &types.Header{ParentHash: parent.Hash(), Number: big.NewInt(int64(i + 1))}
+		if err := engine.Prepare(chain, header); err != nil {
+			t.Fatalf("header %d: failed to prepare: %v", i+1, err)
+		}
+		want := before
+		if i+1 >= 3 {
+			want = after
+		}
+		if author, _ := engine.Author(header); author != want.coinbase {
+			t.Fatalf("header %d: author mismatch: have %x, want %x", i+1, author, want.coinbase)
+		}
+		headers[i], parent = header, header
+	}
+	// Verify the batch, in full and on either side of the transition
+	for _, batch := range [][2]int{{0, 5}, {0, 2}, {2, 5}} {
+		chain := consensus.ChainReader(chain)
+		if batch[0] > 0 {
+			chain = newBatchChain(chain, headers[:batch[0]])
+		}
+		_, results := engine.VerifyHeaders(chain, headers[batch[0]:batch[1]], seals[batch[0]:batch[1]])
+		for i := batch[0]; i < batch[1]; i++ {
+			if err := <-results; err != nil {
+				t.Errorf("batch %v: header %d: verification failed: %v", batch, i+1, err)
+			}
+		}
+	}
+	// Ensure the new engine can't find headers preceding the transition by itself
+	if err := engine.VerifyHeader(chain, headers[2], true); err != consensus.ErrUnknownAncestor {
+		t.Errorf("unknown ancestor error mismatch: have %v, want %v", err, consensus.ErrUnknownAncestor)
+	}
+}
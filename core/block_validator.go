@@ -18,6 +18,7 @@ package core
 
 import (
 	"fmt"
+	"math/big"
 
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/state"
@@ -61,6 +62,53 @@ func (v *BlockValidator) ValidateBody(block *types.Block) error {
 	if hash := types.DeriveSha(block.Transactions()); hash != header.TxHash {
 		return fmt.Errorf("transaction root hash mismatch: have %x, want %x", hash, header.TxHash)
 	}
+	// Ensure all transactions are within their validity windows
+	rules := v.config.Rules(header.Number, header.Time)
+	for i, tx := range block.Transactions() {
+		if err := ValidateTxWindow(rules, tx, header.Number); err != nil {
+			return fmt.Errorf("transaction %d: %v", i, err)
+		}
+	}
+	// Ensure all transactions pass the admission filters at the parent state
+	if filter := v.bc.TxFilter(); filter != nil && len(block.Transactions()) > 0 {
+		parent := v.bc.GetBlock(block.ParentHash(), block.NumberU64()-1)
+		statedb, err := v.bc.StateAt(parent.Root())
+		if err != nil {
+			return err
+		}
+		signer := types.MakeSigner(v.config, header.Number)
+		for i, tx := range block.Transactions() {
+			from, err := types.Sender(signer, tx)
+			if err != nil {
+				return fmt.Errorf("transaction %d: %v", i, err)
+			}
+			if err := filter.FilterTx(from, tx, statedb); err != nil {
+				return fmt.Errorf("transaction %d: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateTxWindow checks whether a transaction may be included in the block with
+// the given number and rules. Transactions without a validity window are always
+// valid.
+func ValidateTxWindow(rules params.Rules, tx *types.Transaction, number *big.Int) error {
+	if !tx.Windowed() {
+		return nil
+	}
+	if !rules.IsExpiry {
+		return ErrTxWindowNotActive
+	}
+	if tx.ValidFrom() > tx.ValidUntil() {
+		return ErrInvalidTxWindow
+	}
+	if number.Cmp(new(big.Int).SetUint64(tx.ValidUntil())) > 0 {
+		return ErrTxExpired
+	}
+	if number.Cmp(new(big.Int).SetUint64(tx.ValidFrom())) < 0 {
+		return ErrTxNotYetValid
+	}
 	return nil
 }
 
@@ -17,13 +17,17 @@
 package core
 
 import (
+	"math/big"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/params"
@@ -43,7 +47,7 @@ func TestHeaderVerification(t *testing.T) {
 		headers[i] = block.Header()
 	}
 	// Run the header checker for blocks one-by-one, checking for both valid and invalid nonces
-	chain, _ := NewBlockChain(testdb, params.TestChainConfig, ethash.NewFaker(), new(event.TypeMux), vm.Config{})
+	chain, _ := NewBlockChain(testdb, params.TestChainConfig, ethash.NewFaker(), new(event.TypeMux), vm.Config{}, 0)
 
 	for i := 0; i < len(blocks); i++ {
 		for j, valid := range []bool{true, false} {
@@ -106,10 +110,10 @@ func testHeaderConcurrentVerification(t *testing.T, threads int) {
 		var results <-chan error
 
 		if valid {
-			chain, _ := NewBlockChain(testdb, params.TestChainConfig, ethash.NewFaker(), new(event.TypeMux), vm.Config{})
+			chain, _ := NewBlockChain(testdb, params.TestChainConfig, ethash.NewFaker(), new(event.TypeMux), vm.Config{}, 0)
 			_, results = chain.engine.VerifyHeaders(chain, headers, seals)
 		} else {
-			chain, _ := NewBlockChain(testdb, params.TestChainConfig, ethash.NewFakeFailer(uint64(len(headers)-1)), new(event.TypeMux), vm.Config{})
+			chain, _ := NewBlockChain(testdb, params.TestChainConfig, ethash.NewFakeFailer(uint64(len(headers)-1)), new(event.TypeMux), vm.Config{}, 0)
 			_, results = chain.engine.VerifyHeaders(chain, headers, seals)
 		}
 		// Wait for all the verification results
@@ -171,7 +175,7 @@ func testHeaderConcurrentAbortion(t *testing.T, threads int) {
 	defer runtime.GOMAXPROCS(old)
 
 	// Start the verifications and immediately abort
-	chain, _ := NewBlockChain(testdb, params.TestChainConfig, ethash.NewFakeDelayer(time.Millisecond), new(event.TypeMux), vm.Config{})
+	chain, _ := NewBlockChain(testdb, params.TestChainConfig, ethash.NewFakeDelayer(time.Millisecond), new(event.TypeMux), vm.Config{}, 0)
 	abort, results := chain.engine.VerifyHeaders(chain, headers, seals)
 	close(abort)
 
@@ -193,3 +197,83 @@ func testHeaderConcurrentAbortion(t *testing.T, threads int) {
 		t.Errorf("verification count too large: have %d, want below %d", verified, 2*threads)
 	}
 }
+
+// Tests that blocks containing transactions rejected by the admission filters
+// are refused on import, even if the local pool never saw them.
+func TestBlockTxFilter(t *testing.T) {
+	var (
+		key, _    = crypto.GenerateKey()
+		address   = crypto.PubkeyToAddress(key.PublicKey)
+		signer    = types.HomesteadSigner{}
+		testdb, _ = ethdb.NewMemDatabase()
+		gspec     = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{address: {Balance: big.NewInt(1000000)}}}
+		genesis   = gspec.MustCommit(testdb)
+	)
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, testdb, 2, func(i int, block *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x01}, big.NewInt(1), nil), signer, key)
+		block.AddTx(tx)
+	})
+	// Import the chain with the sender not being allowed and ensure it fails
+	chain, _ := NewBlockChain(testdb, params.TestChainConfig, ethash.NewFaker(), new(event.TypeMux), vm.Config{}, 0)
+	defer chain.Stop()
+
+	chain.SetTxFilter(NewTxFilter(TxFilterConfig{AllowedSenders: []common.Address{{0x02}}}))
+	if _, err := chain.InsertChain(blocks); err == nil {
+		t.Fatalf("filtered block imported")
+	}
+	if head := chain.CurrentBlock().NumberU64(); head != 0 {
+		t.Fatalf("chain head mismatch: have %d, want %d", head, 0)
+	}
+	// Allow the sender and ensure the chain is imported
+	chain.SetTxFilter(NewTxFilter(TxFilterConfig{AllowedSenders: []common.Address{address}}))
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+}
+
+// Tests that blocks are only imported if all their transactions are within their
+// validity windows, and windowed transactions only after the fork.
+func TestBlockTxWindow(t *testing.T) {
+	var (
+		key, _  = crypto.GenerateKey()
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		config  = *params.TestChainConfig
+	)
+	config.ExpiryBlock = big.NewInt(2)
+	signer := types.NewEIP155Signer(config.ChainId)
+
+	tests := []struct {
+		number     int    // Block number to include the windowed transaction in
+		from, till uint64 // Validity window of the included transaction
+		err        error  // Expected import error, if any
+	}{
+		{1, 1, 1, ErrTxWindowNotActive},
+		{2, 2, 2, nil},
+		{3, 1, 4, nil},
+		{3, 1, 2, ErrTxExpired},
+		{3, 4, 5, ErrTxNotYetValid},
+		{3, 5, 4, ErrInvalidTxWindow},
+	}
+	for i, tt := range tests {
+		testdb, _ := ethdb.NewMemDatabase()
+		gspec := &Genesis{Config: &config, Alloc: GenesisAlloc{address: {Balance: big.NewInt(1000000)}}}
+		genesis := gspec.MustCommit(testdb)
+
+		blocks, _ := GenerateChain(&config, genesis, testdb, tt.number, func(n int, block *BlockGen) {
+			if n == tt.number-1 {
+				tx, _ := types.SignTx(types.NewWindowedTransaction(block.TxNonce(address), &common.Address{0x01}, big.NewInt(1), nil, tt.from, tt.till), signer, key)
+				block.AddTx(tx)
+			}
+		})
+		chain, _ := NewBlockChain(testdb, &config, ethash.NewFaker(), new(event.TypeMux), vm.Config{}, 0)
+
+		_, err := chain.InsertChain(blocks)
+		switch {
+		case tt.err == nil && err != nil:
+			t.Errorf("test %d: failed to import block: %v", i, err)
+		case tt.err != nil && (err == nil || !strings.Contains(err.Error(), tt.err.Error())):
+			t.Errorf("test %d: import error mismatch: have %v, want %v", i, err, tt.err)
+		}
+		chain.Stop()
+	}
+}
@@ -86,8 +86,9 @@ type BlockChain struct {
 	chainmu sync.RWMutex // blockchain insertion lock
 	procmu  sync.RWMutex // block processor lock
 
-	checkpoint   int          // checkpoint counts towards the new checkpoint
-	currentBlock *types.Block // Current head of the block chain
+	checkpoint       int          // checkpoint counts towards the new checkpoint
+	currentBlock     *types.Block // Current head of the block chain
+	currentFastBlock *types.Block // Current head of the fast-sync chain (may be above the block chain!)
 
 	stateCache   state.Database // State database to reuse between imports (contains state cache)
 	bodyCache    *lru.Cache     // Cache for the most recent block bodies
@@ -104,15 +105,22 @@ type BlockChain struct {
 	engine    consensus.Engine
 	processor Processor // block processor interface
 	validator Validator // block and state validator interface
+	txFilter  TxFilter  // transaction admission filter enforced on imported blocks
 	vmConfig  vm.Config
 
 	badBlocks *lru.Cache // Bad block cache
+
+	txLookupLimit uint64 // Number of recent blocks to keep transaction lookups for (0 = entire chain)
 }
 
 // NewBlockChain returns a fully initialised block chain using information
 // available in the database. It initialises the default Ethereum Validator and
 // Processor.
-func NewBlockChain(chainDb ethdb.Database, config *params.ChainConfig, engine consensus.Engine, mux *event.TypeMux, vmConfig vm.Config) (*BlockChain, error) {
+//
+// If txLookupLimit is non-zero, transaction lookup entries and receipts are only
+// retained for the most recent txLookupLimit blocks, older ones being pruned in
+// the background.
+func NewBlockChain(chainDb ethdb.Database, config *params.ChainConfig, engine consensus.Engine, mux *event.TypeMux, vmConfig vm.Config, txLookupLimit uint64) (*BlockChain, error) {
 	bodyCache, _ := lru.New(bodyCacheLimit)
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
 	blockCache, _ := lru.New(blockCacheLimit)
@@ -120,18 +128,19 @@ func NewBlockChain(chainDb ethdb.Database, config *params.ChainConfig, engine co
 	badBlocks, _ := lru.New(badBlockLimit)
 
 	bc := &BlockChain{
-		config:       config,
-		chainDb:      chainDb,
-		stateCache:   state.NewDatabase(chainDb),
-		eventMux:     mux,
-		quit:         make(chan struct{}),
-		bodyCache:    bodyCache,
-		bodyRLPCache: bodyRLPCache,
-		blockCache:   blockCache,
-		futureBlocks: futureBlocks,
-		engine:       engine,
-		vmConfig:     vmConfig,
-		badBlocks:    badBlocks,
+		config:        config,
+		chainDb:       chainDb,
+		stateCache:    state.NewDatabase(chainDb),
+		eventMux:      mux,
+		quit:          make(chan struct{}),
+		bodyCache:     bodyCache,
+		bodyRLPCache:  bodyRLPCache,
+		blockCache:    blockCache,
+		futureBlocks:  futureBlocks,
+		engine:        engine,
+		vmConfig:      vmConfig,
+		badBlocks:     badBlocks,
+		txLookupLimit: txLookupLimit,
 	}
 	bc.SetValidator(NewBlockValidator(config, bc, engine))
 	bc.SetProcessor(NewStateProcessor(config, bc, engine))
@@ -163,6 +172,9 @@ func NewBlockChain(chainDb ethdb.Database, config *params.ChainConfig, engine co
 	}
 	// Take ownership of this particular state
 	go bc.update()
+
+	bc.wg.Add(1)
+	go bc.maintainTxIndex()
 	return bc, nil
 }
 
@@ -205,12 +217,21 @@ func (bc *BlockChain) loadLastState() error {
 	}
 	bc.hc.SetCurrentHeader(currentHeader)
 
+	// Restore the last known head fast block
+	bc.currentFastBlock = bc.currentBlock
+	if head := GetHeadFastBlockHash(bc.chainDb); head != (common.Hash{}) {
+		if block := bc.GetBlockByHash(head); block != nil {
+			bc.currentFastBlock = block
+		}
+	}
 	// Issue a status log for the user
 	headerTd := bc.GetTd(currentHeader.Hash(), currentHeader.Number.Uint64())
 	blockTd := bc.GetTd(bc.currentBlock.Hash(), bc.currentBlock.NumberU64())
+	fastTd := bc.GetTd(bc.currentFastBlock.Hash(), bc.currentFastBlock.NumberU64())
 
 	log.Info("Loaded most recent local header", "number", currentHeader.Number, "hash", currentHeader.Hash(), "td", headerTd)
 	log.Info("Loaded most recent local full block", "number", bc.currentBlock.Number(), "hash", bc.currentBlock.Hash(), "td", blockTd)
+	log.Info("Loaded most recent local fast block", "number", bc.currentFastBlock.Number(), "hash", bc.currentFastBlock.Hash(), "td", fastTd)
 
 	return nil
 }
@@ -248,13 +269,23 @@ func (bc *BlockChain) SetHead(head uint64) error {
 			bc.currentBlock = nil
 		}
 	}
+	// Rewind the fast block in a simpleton way to the target head
+	if bc.currentFastBlock != nil && currentHeader.Number.Uint64() < bc.currentFastBlock.NumberU64() {
+		bc.currentFastBlock = bc.GetBlock(currentHeader.Hash(), currentHeader.Number.Uint64())
+	}
 	// If either blocks reached nil, reset to the genesis state
 	if bc.currentBlock == nil {
 		bc.currentBlock = bc.genesisBlock
 	}
+	if bc.currentFastBlock == nil {
+		bc.currentFastBlock = bc.genesisBlock
+	}
 	if err := WriteHeadBlockHash(bc.chainDb, bc.currentBlock.Hash()); err != nil {
 		log.Crit("Failed to reset head full block", "err", err)
 	}
+	if err := WriteHeadFastBlockHash(bc.chainDb, bc.currentFastBlock.Hash()); err != nil {
+		log.Crit("Failed to reset head fast block", "err", err)
+	}
 	return bc.loadLastState()
 }
 
@@ -275,6 +306,38 @@ func (bc *BlockChain) CurrentBlock() *types.Block {
 	return bc.currentBlock
 }
 
+// CurrentFastBlock retrieves the current fast-sync head block of the canonical
+// chain. The block is retrieved from the blockchain's internal cache.
+func (bc *BlockChain) CurrentFastBlock() *types.Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	return bc.currentFastBlock
+}
+
+// FastSyncCommitHead sets the current head block to the one defined by the hash
+// irrelevant what the chain contents were prior.
+func (bc *BlockChain) FastSyncCommitHead(hash common.Hash) error {
+	// Make sure that both the block as well at its state trie exists
+	block := bc.GetBlockByHash(hash)
+	if block == nil {
+		return fmt.Errorf("non existent block [%x…]", hash[:4])
+	}
+	if _, err := state.New(block.Root(), bc.stateCache); err != nil {
+		return err
+	}
+	// If all checks out, manually set the head block
+	bc.mu.Lock()
+	bc.currentBlock = block
+	if err := WriteHeadBlockHash(bc.chainDb, block.Hash()); err != nil {
+		log.Crit("Failed to update head block hash", "err", err)
+	}
+	bc.mu.Unlock()
+
+	log.Info("Committed new head block", "number", block.Number(), "hash", hash)
+	return nil
+}
+
 // Status returns status information about the current chain such as the HEAD Td,
 // the HEAD hash and the hash of the genesis block.
 func (bc *BlockChain) Status() (td *big.Int, currentBlock common.Hash, genesisBlock common.Hash) {
@@ -298,6 +361,23 @@ func (bc *BlockChain) SetValidator(validator Validator) {
 	bc.validator = validator
 }
 
+// SetTxFilter sets the transaction admission filter every block's transactions
+// need to pass. The same filter should be used by the transaction pool and the
+// miner to avoid producing or relaying blocks rejected on import.
+func (bc *BlockChain) SetTxFilter(filter TxFilter) {
+	bc.procmu.Lock()
+	defer bc.procmu.Unlock()
+	bc.txFilter = filter
+}
+
+// TxFilter returns the current transaction admission filter, or nil if there's
+// none configured.
+func (bc *BlockChain) TxFilter() TxFilter {
+	bc.procmu.RLock()
+	defer bc.procmu.RUnlock()
+	return bc.txFilter
+}
+
 // Validator returns the current validator.
 func (bc *BlockChain) Validator() Validator {
 	bc.procmu.RLock()
@@ -347,6 +427,7 @@ func (bc *BlockChain) ResetWithGenesisBlock(genesis *types.Block) error {
 	bc.genesisBlock = genesis
 	bc.insert(bc.genesisBlock)
 	bc.currentBlock = bc.genesisBlock
+	bc.currentFastBlock = bc.genesisBlock
 	bc.hc.SetGenesis(bc.genesisBlock.Header())
 	bc.hc.SetCurrentHeader(bc.genesisBlock.Header())
 
@@ -404,6 +485,11 @@ func (bc *BlockChain) insert(block *types.Block) {
 	// If the block is better than out head or is on a different chain, force update heads
 	if updateHeads {
 		bc.hc.SetCurrentHeader(block.Header())
+
+		if err := WriteHeadFastBlockHash(bc.chainDb, block.Hash()); err != nil {
+			log.Crit("Failed to insert head fast block hash", "err", err)
+		}
+		bc.currentFastBlock = block
 	}
 }
 
@@ -563,6 +649,10 @@ func (bc *BlockChain) Rollback(chain []common.Hash) {
 		if currentHeader.Hash() == hash {
 			bc.hc.SetCurrentHeader(bc.GetHeader(currentHeader.ParentHash, currentHeader.Number.Uint64()-1))
 		}
+		if bc.currentFastBlock.Hash() == hash {
+			bc.currentFastBlock = bc.GetBlock(bc.currentFastBlock.ParentHash(), bc.currentFastBlock.NumberU64()-1)
+			WriteHeadFastBlockHash(bc.chainDb, bc.currentFastBlock.Hash())
+		}
 		if bc.currentBlock.Hash() == hash {
 			bc.currentBlock = bc.GetBlock(bc.currentBlock.ParentHash(), bc.currentBlock.NumberU64()-1)
 			WriteHeadBlockHash(bc.chainDb, bc.currentBlock.Hash())
@@ -570,7 +660,9 @@ func (bc *BlockChain) Rollback(chain []common.Hash) {
 	}
 }
 
-// SetReceiptsData computes all the non-consensus fields of the receipts
+// SetReceiptsData computes all the non-consensus fields of the receipts that can
+// be derived from the block. The call results, fee and steps are only known from
+// executing the transactions, so the receipts are marked partial instead.
 func SetReceiptsData(config *params.ChainConfig, block *types.Block, receipts types.Receipts) {
 	signer := types.MakeSigner(config, block.Number())
 
@@ -580,8 +672,15 @@ func SetReceiptsData(config *params.ChainConfig, block *types.Block, receipts ty
 		// The transaction hash can be retrieved from the transaction itself
 		receipts[j].TxHash = transactions[j].Hash()
 
+		// The sponsor was verified when the block was, it's taken from the transaction
+		receipts[j].Sponsor = transactions[j].Sponsor()
+
+		// The execution results can't be derived, flag them as unavailable
+		receipts[j].Calls, receipts[j].Fee, receipts[j].Steps = nil, nil, 0
+		receipts[j].Partial = true
+
 		// The contract address can be derived from the transaction itself
-		if transactions[j].To() == nil {
+		if transactions[j].To() == nil && !transactions[j].Batch() {
 			// Deriving the signer is expensive, only do if it's actually needed
 			from, _ := types.Sender(signer, transactions[j])
 			receipts[j].ContractAddress = crypto.CreateAddress(from, transactions[j].Nonce())
@@ -598,6 +697,91 @@ func SetReceiptsData(config *params.ChainConfig, block *types.Block, receipts ty
 	}
 }
 
+// InsertReceiptChain attempts to complete an already existing header chain with
+// transaction and receipt data. The blocks are not executed, their state is
+// expected to be downloaded separately (fast sync). As the receipts only carry
+// their consensus fields, the stored ones are partial (see SetReceiptsData).
+func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain []types.Receipts) (int, error) {
+	bc.wg.Add(1)
+	defer bc.wg.Done()
+
+	// Do a sanity check that the provided chain is actually ordered and linked
+	for i := 1; i < len(blockChain); i++ {
+		if blockChain[i].NumberU64() != blockChain[i-1].NumberU64()+1 || blockChain[i].ParentHash() != blockChain[i-1].Hash() {
+			log.Error("Non contiguous receipt insert", "number", blockChain[i].Number(), "hash", blockChain[i].Hash(), "parent", blockChain[i].ParentHash(),
+				"prevnumber", blockChain[i-1].Number(), "prevhash", blockChain[i-1].Hash())
+
+			return 0, fmt.Errorf("non contiguous insert: item %d is #%d [%x…], item %d is #%d [%x…] (parent [%x…])", i-1, blockChain[i-1].NumberU64(),
+				blockChain[i-1].Hash().Bytes()[:4], i, blockChain[i].NumberU64(), blockChain[i].Hash().Bytes()[:4], blockChain[i].ParentHash().Bytes()[:4])
+		}
+	}
+	if len(blockChain) != len(receiptChain) {
+		return 0, fmt.Errorf("block and receipt count mismatch: %d != %d", len(blockChain), len(receiptChain))
+	}
+	if len(blockChain) == 0 {
+		return 0, nil
+	}
+	// Pre-checks passed, start the block body and receipt imports
+	var (
+		start   = time.Now()
+		stats   = struct{ processed, ignored int }{}
+		lastIdx = len(blockChain) - 1
+	)
+	for i, block := range blockChain {
+		receipts := receiptChain[i]
+
+		// Short circuit insertion if shutting down or processing failed
+		if atomic.LoadInt32(&bc.procInterrupt) == 1 {
+			return 0, nil
+		}
+		// Short circuit if the owner header is unknown
+		if !bc.HasHeader(block.Hash()) {
+			return i, fmt.Errorf("containing header #%d [%x…] unknown", block.Number(), block.Hash().Bytes()[:4])
+		}
+		// Skip if the entire data is already known
+		if bc.HasBlock(block.Hash()) {
+			stats.ignored++
+			continue
+		}
+		// Compute all the non-consensus fields of the receipts
+		SetReceiptsData(bc.config, block, receipts)
+
+		// Write all the data out into the database
+		if err := WriteBody(bc.chainDb, block.Hash(), block.NumberU64(), block.Body()); err != nil {
+			return i, fmt.Errorf("failed to write block body: %v", err)
+		}
+		if err := WriteBlockReceipts(bc.chainDb, block.Hash(), block.NumberU64(), receipts); err != nil {
+			return i, fmt.Errorf("failed to write block receipts: %v", err)
+		}
+		if err := WriteTransactions(bc.chainDb, block); err != nil {
+			return i, fmt.Errorf("failed to write individual transactions: %v", err)
+		}
+		if err := WriteReceipts(bc.chainDb, receipts); err != nil {
+			return i, fmt.Errorf("failed to write individual receipts: %v", err)
+		}
+		if err := WriteMipmapBloom(bc.chainDb, block.NumberU64(), receipts); err != nil {
+			return i, fmt.Errorf("failed to write log blooms: %v", err)
+		}
+		stats.processed++
+	}
+	// Update the head fast sync block if better
+	bc.mu.Lock()
+	head := blockChain[lastIdx]
+	if td := bc.GetTd(head.Hash(), head.NumberU64()); td != nil { // Rewind may have occurred, skip in that case
+		if bc.GetTd(bc.currentFastBlock.Hash(), bc.currentFastBlock.NumberU64()).Cmp(td) < 0 {
+			if err := WriteHeadFastBlockHash(bc.chainDb, head.Hash()); err != nil {
+				log.Crit("Failed to update head fast block hash", "err", err)
+			}
+			bc.currentFastBlock = head
+		}
+	}
+	bc.mu.Unlock()
+
+	log.Info("Imported new block receipts", "count", stats.processed, "elapsed", common.PrettyDuration(time.Since(start)),
+		"number", head.Number(), "hash", head.Hash(), "ignored", stats.ignored)
+	return 0, nil
+}
+
 // WriteBlock writes the block to the chain.
 func (bc *BlockChain) WriteBlock(block *types.Block) (status WriteStatus, err error) {
 	bc.wg.Add(1)
@@ -696,6 +880,11 @@ func (bc *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 			bc.reportBlock(block, nil, ErrBlacklistedHash)
 			return i, ErrBlacklistedHash
 		}
+		// Competing forks below the finalized block are rejected outright
+		if err := bc.CheckFork(block.Header()); err != nil {
+			bc.reportBlock(block, nil, err)
+			return i, err
+		}
 		// Wait for the block's verification to complete
 		bstart := time.Now()
 
@@ -927,6 +1116,13 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 			return fmt.Errorf("Invalid new chain")
 		}
 	}
+	// Refuse reverting blocks considered irreversible
+	if len(oldChain) > 0 {
+		if finalized := bc.finalized(bc.currentBlock.Header()); commonBlock.NumberU64() < finalized {
+			log.Warn("Refusing reorg below finalized block", "number", commonBlock.Number(), "hash", commonBlock.Hash(), "finalized", finalized)
+			return ErrFinalizedReorg
+		}
+	}
 	// Ensure the user sees large reorgs
 	if len(oldChain) > 0 && len(newChain) > 0 {
 		logFn := log.Debug
@@ -1170,3 +1366,54 @@ func (bc *BlockChain) Config() *params.ChainConfig { return bc.config }
 
 // Engine retrieves the blockchain's consensus engine.
 func (bc *BlockChain) Engine() consensus.Engine { return bc.engine }
+
+// Finalized returns the number of the highest canonical block that can no longer
+// be reorganised away.
+func (bc *BlockChain) Finalized() uint64 {
+	return bc.finalized(bc.CurrentBlock().Header())
+}
+
+// finalized returns the number of the highest block up to the given canonical
+// head that can no longer be reorganised away, being the highest of the block
+// finalized by the consensus engine, the block at the maximum reorg depth and the
+// last trusted checkpoint.
+func (bc *BlockChain) finalized(head *types.Header) uint64 {
+	var finalized uint64
+	if engine, ok := bc.engine.(consensus.Finality); ok {
+		finalized = engine.Finalized(bc, head)
+	}
+	number := head.Number.Uint64()
+	if depth := bc.config.MaxReorgDepth; depth > 0 && number > depth && number-depth > finalized {
+		finalized = number - depth
+	}
+	if checkpoint := bc.config.LastCheckpoint(number); checkpoint != nil && checkpoint.Number > finalized {
+		if GetCanonicalHash(bc.chainDb, checkpoint.Number) == checkpoint.Hash {
+			finalized = checkpoint.Number
+		}
+	}
+	return finalized
+}
+
+// CheckFork returns an error if the given header conflicts with a trusted
+// checkpoint or belongs to a fork leaving the canonical chain below the finalized
+// block. Headers with unknown ancestry are left for the consensus engine to judge.
+func (bc *BlockChain) CheckFork(header *types.Header) error {
+	if checkpoint := bc.config.Checkpoint(header.Number.Uint64()); checkpoint != nil && checkpoint.Hash != header.Hash() {
+		return ErrCheckpointMismatch
+	}
+	// Walk back until the fork joins the canonical chain or drops below finality
+	finalized := bc.Finalized()
+	for header.Number.Uint64() > finalized {
+		number := header.Number.Uint64()
+		if GetCanonicalHash(bc.chainDb, number) == header.Hash() {
+			return nil
+		}
+		if header = bc.GetHeader(header.ParentHash, number-1); header == nil {
+			return nil
+		}
+	}
+	if GetCanonicalHash(bc.chainDb, header.Number.Uint64()) != header.Hash() {
+		return ErrFinalizedReorg
+	}
+	return nil
+}
@@ -32,6 +32,7 @@ import (
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
 )
 
 // newTestBlockChain creates a blockchain without validation.
@@ -43,7 +44,7 @@ func newTestBlockChain(fake bool) *BlockChain {
 	}
 	gspec.MustCommit(db)
 	engine := ethash.NewFullFaker()
-	blockchain, err := NewBlockChain(db, gspec.Config, engine, new(event.TypeMux), vm.Config{})
+	blockchain, err := NewBlockChain(db, gspec.Config, engine, new(event.TypeMux), vm.Config{}, 0)
 	if err != nil {
 		panic(err)
 	}
@@ -132,12 +133,12 @@ func testBlockChainImport(chain types.Blocks, blockchain *BlockChain) error {
 		if err != nil {
 			return err
 		}
-		receipts, _, usedGas, err := blockchain.Processor().Process(block, statedb, vm.Config{})
+		receipts, _, err := blockchain.Processor().Process(block, statedb, vm.Config{})
 		if err != nil {
 			blockchain.reportBlock(block, receipts, err)
 			return err
 		}
-		err = blockchain.validator.ValidateState(block, blockchain.GetBlockByHash(block.ParentHash()), statedb, receipts, usedGas)
+		err = blockchain.validator.ValidateState(block, blockchain.GetBlockByHash(block.ParentHash()), statedb, receipts)
 		if err != nil {
 			blockchain.reportBlock(block, receipts, err)
 			return err
@@ -323,11 +324,11 @@ func testBrokenChain(t *testing.T, full bool) {
 type bproc struct{}
 
 func (bproc) ValidateBody(*types.Block) error { return nil }
-func (bproc) ValidateState(block, parent *types.Block, state *state.StateDB, receipts types.Receipts, usedGas *big.Int) error {
+func (bproc) ValidateState(block, parent *types.Block, state *state.StateDB, receipts types.Receipts) error {
 	return nil
 }
-func (bproc) Process(block *types.Block, statedb *state.StateDB, cfg vm.Config) (types.Receipts, []*types.Log, *big.Int, error) {
-	return nil, nil, new(big.Int), nil
+func (bproc) Process(block *types.Block, statedb *state.StateDB, cfg vm.Config) (types.Receipts, []*types.Log, error) {
+	return nil, nil, nil
 }
 
 func makeHeaderChainWithDiff(genesis *types.Block, d []int, seed byte) []*types.Header {
@@ -346,7 +347,6 @@ func makeBlockChainWithDiff(genesis *types.Block, d []int, seed byte) []*types.B
 			Coinbase:    common.Address{seed},
 			Number:      big.NewInt(int64(i + 1)),
 			Difficulty:  big.NewInt(int64(difficulty)),
-			UncleHash:   types.EmptyUncleHash,
 			TxHash:      types.EmptyRootHash,
 			ReceiptHash: types.EmptyRootHash,
 			Time:        big.NewInt(int64(i) + 1),
@@ -476,7 +476,7 @@ func testReorgBadHashes(t *testing.T, full bool) {
 	}
 
 	// Create a new BlockChain and check that it rolled back the state.
-	ncm, err := NewBlockChain(bc.chainDb, bc.config, ethash.NewFaker(), new(event.TypeMux), vm.Config{})
+	ncm, err := NewBlockChain(bc.chainDb, bc.config, ethash.NewFaker(), new(event.TypeMux), vm.Config{}, 0)
 	if err != nil {
 		t.Fatalf("failed to create new chain manager: %v", err)
 	}
@@ -484,9 +484,6 @@ func testReorgBadHashes(t *testing.T, full bool) {
 		if ncm.CurrentBlock().Hash() != blocks[2].Header().Hash() {
 			t.Errorf("last block hash mismatch: have: %x, want %x", ncm.CurrentBlock().Hash(), blocks[2].Header().Hash())
 		}
-		if blocks[2].Header().GasLimit.Cmp(ncm.GasLimit()) != 0 {
-			t.Errorf("last  block gasLimit mismatch: have: %x, want %x", ncm.GasLimit(), blocks[2].Header().GasLimit)
-		}
 	} else {
 		if ncm.CurrentHeader().Hash() != headers[2].Hash() {
 			t.Errorf("last header hash mismatch: have: %x, want %x", ncm.CurrentHeader().Hash(), headers[2].Hash())
@@ -559,8 +556,7 @@ func TestChainTxReorgs(t *testing.T) {
 		addr3   = crypto.PubkeyToAddress(key3.PublicKey)
 		db, _   = ethdb.NewMemDatabase()
 		gspec   = &Genesis{
-			Config:   params.TestChainConfig,
-			GasLimit: 3141592,
+			Config: params.TestChainConfig,
 			Alloc: GenesisAlloc{
 				addr1: {Balance: big.NewInt(1000000)},
 				addr2: {Balance: big.NewInt(1000000)},
@@ -574,8 +570,8 @@ func TestChainTxReorgs(t *testing.T) {
 	// Create two transactions shared between the chains:
 	//  - postponed: transaction included at a later block in the forked chain
 	//  - swapped: transaction included at the same block number in the forked chain
-	postponed, _ := types.SignTx(types.NewTransaction(0, addr1, big.NewInt(1000), bigTxGas, nil, nil), signer, key1)
-	swapped, _ := types.SignTx(types.NewTransaction(1, addr1, big.NewInt(1000), bigTxGas, nil, nil), signer, key1)
+	postponed, _ := types.SignTx(types.NewTransaction(0, addr1, big.NewInt(1000), nil), signer, key1)
+	swapped, _ := types.SignTx(types.NewTransaction(1, addr1, big.NewInt(1000), nil), signer, key1)
 
 	// Create two transactions that will be dropped by the forked chain:
 	//  - pastDrop: transaction dropped retroactively from a past block
@@ -591,13 +587,13 @@ func TestChainTxReorgs(t *testing.T) {
 	chain, _ := GenerateChain(gspec.Config, genesis, db, 3, func(i int, gen *BlockGen) {
 		switch i {
 		case 0:
-			pastDrop, _ = types.SignTx(types.NewTransaction(gen.TxNonce(addr2), addr2, big.NewInt(1000), bigTxGas, nil, nil), signer, key2)
+			pastDrop, _ = types.SignTx(types.NewTransaction(gen.TxNonce(addr2), addr2, big.NewInt(1000), nil), signer, key2)
 
 			gen.AddTx(pastDrop)  // This transaction will be dropped in the fork from below the split point
 			gen.AddTx(postponed) // This transaction will be postponed till block #3 in the fork
 
 		case 2:
-			freshDrop, _ = types.SignTx(types.NewTransaction(gen.TxNonce(addr2), addr2, big.NewInt(1000), bigTxGas, nil, nil), signer, key2)
+			freshDrop, _ = types.SignTx(types.NewTransaction(gen.TxNonce(addr2), addr2, big.NewInt(1000), nil), signer, key2)
 
 			gen.AddTx(freshDrop) // This transaction will be dropped in the fork from exactly at the split point
 			gen.AddTx(swapped)   // This transaction will be swapped out at the exact height
@@ -607,7 +603,7 @@ func TestChainTxReorgs(t *testing.T) {
 	})
 	// Import the chain. This runs all block validation rules.
 	evmux := &event.TypeMux{}
-	blockchain, _ := NewBlockChain(db, gspec.Config, ethash.NewFaker(), evmux, vm.Config{})
+	blockchain, _ := NewBlockChain(db, gspec.Config, ethash.NewFaker(), evmux, vm.Config{}, 0)
 	if i, err := blockchain.InsertChain(chain); err != nil {
 		t.Fatalf("failed to insert original chain[%d]: %v", i, err)
 	}
@@ -616,18 +612,18 @@ func TestChainTxReorgs(t *testing.T) {
 	chain, _ = GenerateChain(gspec.Config, genesis, db, 5, func(i int, gen *BlockGen) {
 		switch i {
 		case 0:
-			pastAdd, _ = types.SignTx(types.NewTransaction(gen.TxNonce(addr3), addr3, big.NewInt(1000), bigTxGas, nil, nil), signer, key3)
+			pastAdd, _ = types.SignTx(types.NewTransaction(gen.TxNonce(addr3), addr3, big.NewInt(1000), nil), signer, key3)
 			gen.AddTx(pastAdd) // This transaction needs to be injected during reorg
 
 		case 2:
 			gen.AddTx(postponed) // This transaction was postponed from block #1 in the original chain
 			gen.AddTx(swapped)   // This transaction was swapped from the exact current spot in the original chain
 
-			freshAdd, _ = types.SignTx(types.NewTransaction(gen.TxNonce(addr3), addr3, big.NewInt(1000), bigTxGas, nil, nil), signer, key3)
+			freshAdd, _ = types.SignTx(types.NewTransaction(gen.TxNonce(addr3), addr3, big.NewInt(1000), nil), signer, key3)
 			gen.AddTx(freshAdd) // This transaction will be added exactly at reorg time
 
 		case 3:
-			futureAdd, _ = types.SignTx(types.NewTransaction(gen.TxNonce(addr3), addr3, big.NewInt(1000), bigTxGas, nil, nil), signer, key3)
+			futureAdd, _ = types.SignTx(types.NewTransaction(gen.TxNonce(addr3), addr3, big.NewInt(1000), nil), signer, key3)
 			gen.AddTx(futureAdd) // This transaction will be added after a full reorg
 		}
 	})
@@ -678,12 +674,12 @@ func TestLogReorgs(t *testing.T) {
 	)
 
 	var evmux event.TypeMux
-	blockchain, _ := NewBlockChain(db, gspec.Config, ethash.NewFaker(), &evmux, vm.Config{})
+	blockchain, _ := NewBlockChain(db, gspec.Config, ethash.NewFaker(), &evmux, vm.Config{}, 0)
 
 	subs := evmux.Subscribe(RemovedLogsEvent{})
 	chain, _ := GenerateChain(params.TestChainConfig, genesis, db, 2, func(i int, gen *BlockGen) {
 		if i == 1 {
-			tx, err := types.SignTx(types.NewContractCreation(gen.TxNonce(addr1), new(big.Int), big.NewInt(1000000), new(big.Int), code), signer, key1)
+			tx, err := types.SignTx(types.NewContractCreation(gen.TxNonce(addr1), new(big.Int), code), signer, key1)
 			if err != nil {
 				t.Fatalf("failed to create tx: %v", err)
 			}
@@ -719,7 +715,7 @@ func TestReorgSideEvent(t *testing.T) {
 	)
 
 	evmux := &event.TypeMux{}
-	blockchain, _ := NewBlockChain(db, gspec.Config, ethash.NewFaker(), evmux, vm.Config{})
+	blockchain, _ := NewBlockChain(db, gspec.Config, ethash.NewFaker(), evmux, vm.Config{}, 0)
 
 	chain, _ := GenerateChain(gspec.Config, genesis, db, 3, func(i int, gen *BlockGen) {})
 	if _, err := blockchain.InsertChain(chain); err != nil {
@@ -727,7 +723,7 @@ func TestReorgSideEvent(t *testing.T) {
 	}
 
 	replacementBlocks, _ := GenerateChain(gspec.Config, genesis, db, 4, func(i int, gen *BlockGen) {
-		tx, err := types.SignTx(types.NewContractCreation(gen.TxNonce(addr1), new(big.Int), big.NewInt(1000000), new(big.Int), nil), signer, key1)
+		tx, err := types.SignTx(types.NewContractCreation(gen.TxNonce(addr1), new(big.Int), nil), signer, key1)
 		if i == 2 {
 			gen.OffsetTime(-1)
 		}
@@ -817,3 +813,125 @@ func _TestCanonicalBlockRetrieval(t *testing.T) {
 		bc.InsertChain(types.Blocks{chain[i]})
 	}
 }
+
+// Tests that forks reverting more blocks than the maximum reorg depth, or
+// conflicting with a trusted checkpoint, are rejected.
+func TestReorgDepthAndCheckpoints(t *testing.T) {
+	var (
+		db, _   = ethdb.NewMemDatabase()
+		config  = *params.TestChainConfig
+		gspec   = &Genesis{Config: &config}
+		genesis = gspec.MustCommit(db)
+	)
+	config.MaxReorgDepth = 2
+
+	chain, _ := GenerateChain(&config, genesis, db, 5, func(i int, gen *BlockGen) {})
+	fork := func(parent *types.Block, n int) types.Blocks {
+		blocks, _ := GenerateChain(&config, parent, db, n, func(i int, gen *BlockGen) {
+			gen.SetCoinbase(common.Address{0x01})
+		})
+		return blocks
+	}
+	blockchain, _ := NewBlockChain(db, &config, ethash.NewFaker(), new(event.TypeMux), vm.Config{}, 0)
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	// Forks reverting more than two blocks must be rejected, shallower ones accepted
+	if _, err := blockchain.InsertChain(fork(chain[1], 4)); err != ErrFinalizedReorg {
+		t.Fatalf("deep reorg error mismatch: have %v, want %v", err, ErrFinalizedReorg)
+	}
+	shallow := fork(chain[2], 3)
+	if _, err := blockchain.InsertChain(shallow); err != nil {
+		t.Fatalf("failed to insert shallow fork: %v", err)
+	}
+	if head := blockchain.CurrentBlock().Hash(); head != shallow[2].Hash() {
+		t.Fatalf("head mismatch: have %x, want %x", head, shallow[2].Hash())
+	}
+	// Blocks conflicting with a checkpoint must be rejected on a fresh chain too
+	db, _ = ethdb.NewMemDatabase()
+	config.MaxReorgDepth = 0
+	config.Checkpoints = []*params.Checkpoint{{Number: 2, Hash: chain[1].Hash()}}
+	gspec.MustCommit(db)
+
+	blockchain, _ = NewBlockChain(db, &config, ethash.NewFaker(), new(event.TypeMux), vm.Config{}, 0)
+	if n, err := blockchain.InsertChain(fork(genesis, 3)); n != 1 || err != ErrCheckpointMismatch {
+		t.Fatalf("checkpoint error mismatch: have %d/%v, want 1/%v", n, err, ErrCheckpointMismatch)
+	}
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert checkpointed chain: %v", err)
+	}
+	if finalized := blockchain.Finalized(); finalized != 2 {
+		t.Fatalf("finalized block mismatch: have %d, want 2", finalized)
+	}
+}
+
+// Tests that receipts imported along a fast synced chain have all the derivable
+// fields set, and are flagged partial for lacking the execution results.
+func TestReceiptChainPartial(t *testing.T) {
+	var (
+		db, _         = ethdb.NewMemDatabase()
+		key, _        = crypto.GenerateKey()
+		sponsorKey, _ = crypto.GenerateKey()
+		sender        = crypto.PubkeyToAddress(key.PublicKey)
+		sponsor       = crypto.PubkeyToAddress(sponsorKey.PublicKey)
+		config        = *params.TestChainConfig
+	)
+	config.FeeBlock = big.NewInt(0)
+	config.Fee = &params.FeeConfig{Base: big.NewInt(1)}
+
+	gspec := &Genesis{Config: &config, Alloc: GenesisAlloc{sender: {Balance: big.NewInt(1000)}, sponsor: {Balance: big.NewInt(1000)}}}
+	genesis := gspec.MustCommit(db)
+
+	signer := types.NewEIP155Signer(config.ChainId)
+	blocks, receipts := GenerateChain(&config, genesis, db, 1, func(i int, b *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(0, common.Address{0x01}, big.NewInt(1), nil).WithSponsor(sponsor), signer, key)
+		tx, _ = types.SponsorTx(tx, signer, sponsorKey)
+		b.AddTx(tx)
+
+		tx, _ = types.SignTx(types.NewBatchTransaction(0, []*types.Call{{To: common.Address{0x02}, Value: big.NewInt(1)}}), signer, key)
+		b.AddTx(tx)
+	})
+	if receipts[0][0].Sponsor == nil || receipts[0][1].Calls == nil || receipts[0][1].Fee == nil {
+		t.Fatalf("executed receipts incomplete: %v", receipts[0])
+	}
+	// Ship the receipts as a fast syncing peer would receive them
+	blob, err := rlp.EncodeToBytes(receipts[0])
+	if err != nil {
+		t.Fatalf("failed to encode receipts: %v", err)
+	}
+	var shipped types.Receipts
+	if err := rlp.DecodeBytes(blob, &shipped); err != nil {
+		t.Fatalf("failed to decode receipts: %v", err)
+	}
+	db, _ = ethdb.NewMemDatabase()
+	gspec.MustCommit(db)
+
+	chain, _ := NewBlockChain(db, &config, ethash.NewFaker(), new(event.TypeMux), vm.Config{}, 0)
+	defer chain.Stop()
+
+	headers := []*types.Header{blocks[0].Header()}
+	if _, err := chain.InsertHeaderChain(headers, 1); err != nil {
+		t.Fatalf("failed to insert header chain: %v", err)
+	}
+	if _, err := chain.InsertReceiptChain(blocks, []types.Receipts{shipped}); err != nil {
+		t.Fatalf("failed to insert receipt chain: %v", err)
+	}
+	stored := GetBlockReceipts(db, blocks[0].Hash(), blocks[0].NumberU64())
+	if len(stored) != 2 {
+		t.Fatalf("stored receipt count mismatch: have %d, want 2", len(stored))
+	}
+	for i, receipt := range stored {
+		if receipt.TxHash != blocks[0].Transactions()[i].Hash() {
+			t.Errorf("receipt %d: tx hash mismatch: have %x, want %x", i, receipt.TxHash, blocks[0].Transactions()[i].Hash())
+		}
+		if !receipt.Partial || receipt.Calls != nil || receipt.Fee != nil || receipt.Steps != 0 {
+			t.Errorf("receipt %d: execution results not flagged unavailable: partial %v, calls %v, fee %v, steps %d", i, receipt.Partial, receipt.Calls, receipt.Fee, receipt.Steps)
+		}
+	}
+	if stored[0].Sponsor == nil || *stored[0].Sponsor != sponsor {
+		t.Errorf("sponsor mismatch: have %v, want %x", stored[0].Sponsor, sponsor)
+	}
+	if stored[1].Sponsor != nil {
+		t.Errorf("unsponsored receipt has sponsor %x", *stored[1].Sponsor)
+	}
+}
@@ -35,8 +35,10 @@ import (
 )
 
 var (
-	headHeaderKey = []byte("LastHeader")
-	headBlockKey  = []byte("LastBlock")
+	headHeaderKey  = []byte("LastHeader")
+	headBlockKey   = []byte("LastBlock")
+	headFastKey    = []byte("LastFast")
+	txIndexTailKey = []byte("TransactionIndexTail")
 
 	headerPrefix        = []byte("h")   // headerPrefix + num (uint64 big endian) + hash -> header
 	tdSuffix            = []byte("t")   // headerPrefix + num (uint64 big endian) + hash + tdSuffix -> td
@@ -46,8 +48,9 @@ var (
 	blockReceiptsPrefix = []byte("r")   // blockReceiptsPrefix + num (uint64 big endian) + hash -> block receipts
 	preimagePrefix      = "secure-key-" // preimagePrefix + hash -> preimage
 
-	txMetaSuffix   = []byte{0x01}
-	receiptsPrefix = []byte("receipts-")
+	txMetaSuffix      = []byte{0x01}
+	txUnindexedSuffix = []byte{0x02} // hash + txUnindexedSuffix -> num (uint64 big endian) of a pruned transaction
+	receiptsPrefix    = []byte("receipts-")
 
 	mipmapPre    = []byte("mipmap-log-bloom-")
 	MIPMapLevels = []uint64{1000000, 500000, 100000, 50000, 1000}
@@ -134,6 +137,42 @@ func GetHeadBlockHash(db ethdb.Database) common.Hash {
 	return common.BytesToHash(data)
 }
 
+// GetHeadFastBlockHash retrieves the current canonical head block hash during
+// fast synchronization. The difference between this and GetHeadBlockHash is that
+// whereas the last block hash is only updated upon a full block import, the last
+// fast hash is updated when importing pre-processed blocks.
+func GetHeadFastBlockHash(db ethdb.Database) common.Hash {
+	data, _ := db.Get(headFastKey)
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// GetTxIndexTail retrieves the number of the oldest block whose transaction
+// lookup entries and receipts are still indexed. If the tail was never written
+// (i.e. the chain was indexed without a limit), nil is returned.
+func GetTxIndexTail(db ethdb.Database) *uint64 {
+	data, _ := db.Get(txIndexTailKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// GetTxUnindexed retrieves the number of the block a transaction was included in
+// if its lookup entries were pruned by the index limit, or nil if the transaction
+// was never indexed or is still indexed.
+func GetTxUnindexed(db ethdb.Database, hash common.Hash) *uint64 {
+	data, _ := db.Get(append(hash.Bytes(), txUnindexedSuffix...))
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
 // GetHeaderRLP retrieves a block header in its raw RLP database encoding, or nil
 // if the header's not found.
 func GetHeaderRLP(db ethdb.Database, hash common.Hash, number uint64) rlp.RawValue {
@@ -310,6 +349,33 @@ func WriteHeadBlockHash(db ethdb.Database, hash common.Hash) error {
 	return nil
 }
 
+// WriteHeadFastBlockHash stores the fast head block's hash.
+func WriteHeadFastBlockHash(db ethdb.Database, hash common.Hash) error {
+	if err := db.Put(headFastKey, hash.Bytes()); err != nil {
+		log.Crit("Failed to store last fast block's hash", "err", err)
+	}
+	return nil
+}
+
+// WriteTxIndexTail stores the number of the oldest block whose transactions
+// are indexed.
+func WriteTxIndexTail(db ethdb.Database, number uint64) error {
+	if err := db.Put(txIndexTailKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store transaction index tail", "err", err)
+	}
+	return nil
+}
+
+// WriteTxUnindexed stores the number of the block a transaction was included in
+// when its lookup entries get pruned, so that lookups can tell pruned transactions
+// apart from unknown ones. Markers are kept until the transaction is re-indexed.
+func WriteTxUnindexed(db ethdb.Database, hash common.Hash, number uint64) error {
+	if err := db.Put(append(hash.Bytes(), txUnindexedSuffix...), encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store pruned transaction marker", "err", err)
+	}
+	return nil
+}
+
 // WriteHeader serializes a block header into the database.
 func WriteHeader(db ethdb.Database, header *types.Header) error {
 	data, err := rlp.EncodeToBytes(header)
@@ -509,6 +575,11 @@ func DeleteTransaction(db ethdb.Database, hash common.Hash) {
 	db.Delete(append(hash.Bytes(), txMetaSuffix...))
 }
 
+// DeleteTxUnindexed removes the pruned marker of a transaction.
+func DeleteTxUnindexed(db ethdb.Database, hash common.Hash) {
+	db.Delete(append(hash.Bytes(), txUnindexedSuffix...))
+}
+
 // DeleteReceipt removes all receipt data associated with a transaction hash.
 func DeleteReceipt(db ethdb.Database, hash common.Hash) {
 	db.Delete(append(receiptsPrefix, hash.Bytes()...))
@@ -28,4 +28,36 @@ var (
 
 	// ErrBlacklistedHash is returned if a block to import is on the blacklist.
 	ErrBlacklistedHash = errors.New("blacklisted hash")
+
+	// ErrTxWindowNotActive is returned if a transaction with a validity window
+	// is included before the fork introducing them.
+	ErrTxWindowNotActive = errors.New("transaction validity windows not yet activated")
+
+	// ErrInvalidTxWindow is returned if the validity window of a transaction
+	// ends before it starts.
+	ErrInvalidTxWindow = errors.New("invalid transaction validity window")
+
+	// ErrTxNotYetValid is returned if a transaction is included before the
+	// start of its validity window.
+	ErrTxNotYetValid = errors.New("transaction not yet valid")
+
+	// ErrTxExpired is returned if a transaction is included after the end of
+	// its validity window.
+	ErrTxExpired = errors.New("transaction expired")
+
+	// ErrSponsoredCreation is returned if a sponsored transaction attempts to
+	// create a contract.
+	ErrSponsoredCreation = errors.New("sponsored contract creation")
+
+	// ErrInsufficientFee is returned if the account sequencing a transaction
+	// can't afford its flat fee.
+	ErrInsufficientFee = errors.New("insufficient funds for transaction fee")
+
+	// ErrFinalizedReorg is returned if a chain reorganisation would revert blocks
+	// finalized by the consensus engine, the maximum reorg depth or a checkpoint.
+	ErrFinalizedReorg = errors.New("reorg below finalized block")
+
+	// ErrCheckpointMismatch is returned if a block conflicts with a trusted
+	// checkpoint of the chain config.
+	ErrCheckpointMismatch = errors.New("block conflicts with checkpoint")
 )
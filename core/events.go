@@ -17,6 +17,8 @@
 package core
 
 import (
+	"time"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 )
@@ -24,6 +26,42 @@ import (
 // TxPreEvent is posted when a transaction enters the transaction pool.
 type TxPreEvent struct{ Tx *types.Transaction }
 
+// TxPoolEventKind is the lifecycle change a pooled transaction went through.
+type TxPoolEventKind string
+
+const (
+	TxAdded    TxPoolEventKind = "added"    // Accepted into the pool
+	TxPromoted TxPoolEventKind = "promoted" // Moved into the executable pending set
+	TxReplaced TxPoolEventKind = "replaced" // Superseded by a transaction with the same nonce
+	TxDropped  TxPoolEventKind = "dropped"  // Removed from the pool for the given reason
+	TxIncluded TxPoolEventKind = "included" // Removed from the pool after being included in a block
+)
+
+// Reasons for a transaction being dropped from the pool.
+const (
+	TxDropStale     = "nonce too low"          // Nonce used by another transaction on chain
+	TxDropUnpayable = "insufficient funds"     // Sender can't pay for the transaction anymore
+	TxDropAccount   = "account queue limit"    // Exceeded the per account queue allowance
+	TxDropFairness  = "pending fairness limit" // Evicted to equalize executable slots
+	TxDropQueue     = "global queue limit"     // Evicted to make room in the future queue
+	TxDropSize      = "pool size limit"        // Evicted to fit into the pool byte allowance
+	TxDropExpired   = "queue lifetime expired" // Queued for longer than the allowed lifetime
+	TxDropFiltered  = "admission filter"       // Rejected by the admission filters
+	TxDropRemoved   = "removed"                // Explicitly removed (e.g. failed execution)
+)
+
+// TxPoolEvent is posted for every lifecycle change of a transaction in the pool.
+type TxPoolEvent struct {
+	Kind        TxPoolEventKind `json:"kind"`
+	Hash        common.Hash     `json:"hash"`
+	From        common.Address  `json:"from"` // Account sequencing the transaction (sponsor if sponsored)
+	Nonce       uint64          `json:"nonce"`
+	Reason      string          `json:"reason,omitempty"`      // Cause of a drop
+	Replacement *common.Hash    `json:"replacement,omitempty"` // Transaction superseding a replaced one
+	Block       *common.Hash    `json:"block,omitempty"`       // Block including the transaction
+	Time        time.Time       `json:"time"`
+}
+
 // PendingLogsEvent is posted pre mining and notifies of pending logs.
 type PendingLogsEvent struct {
 	Logs []*types.Log
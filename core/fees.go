@@ -18,6 +18,37 @@ package core
 
 import (
 	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
 )
 
-var BlockReward = big.NewInt(5e+18)
+// IntrinsicFee computes the flat fee of a message with the given payload, which
+// is charged before its execution: the base fee plus the per byte fee of the
+// payload, being the input of all calls for batches.
+func IntrinsicFee(fees *params.FeeConfig, data []byte, calls []*types.Call) *big.Int {
+	fee := new(big.Int)
+	if fees == nil {
+		return fee
+	}
+	if fees.Base != nil {
+		fee.Set(fees.Base)
+	}
+	if fees.PerByte != nil {
+		size := len(data)
+		for _, call := range calls {
+			size += len(call.Data)
+		}
+		fee.Add(fee, new(big.Int).Mul(fees.PerByte, big.NewInt(int64(size))))
+	}
+	return fee
+}
+
+// StepFee computes the fee charged after the execution of a message for the
+// number of instructions it executed.
+func StepFee(fees *params.FeeConfig, steps uint64) *big.Int {
+	if fees == nil || fees.PerStep == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Mul(fees.PerStep, new(big.Int).SetUint64(steps))
+}
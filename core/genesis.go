@@ -148,6 +148,11 @@ func SetupGenesisBlock(db ethdb.Database, genesis *Genesis) (*params.ChainConfig
 	if genesis != nil && genesis.Config == nil {
 		return params.AllProtocolChanges, common.Hash{}, errGenesisNoConfig
 	}
+	if genesis != nil {
+		if err := genesis.Config.CheckConfig(); err != nil {
+			return genesis.Config, common.Hash{}, err
+		}
+	}
 
 	// Just commit the new block if there is no stored genesis block.
 	stored := GetCanonicalHash(db, 0)
@@ -191,17 +196,37 @@ func SetupGenesisBlock(db ethdb.Database, genesis *Genesis) (*params.ChainConfig
 
 	// Check config compatibility and write the config. Compatibility errors
 	// are returned to the caller unless we're already at block zero.
-	height := GetBlockNumber(db, GetHeadHeaderHash(db))
+	headHash := GetHeadHeaderHash(db)
+	height := GetBlockNumber(db, headHash)
 	if height == missingNumber {
 		return newcfg, stored, fmt.Errorf("missing block number for head header hash")
 	}
-	compatErr := storedcfg.CheckCompatible(newcfg, height)
+	head := GetHeader(db, headHash, height)
+	if head == nil {
+		return newcfg, stored, fmt.Errorf("missing head header %x", headHash)
+	}
+	compatErr := storedcfg.CheckCompatible(newcfg, height, head.Time.Uint64())
+	if compatErr != nil && compatErr.RewindToTime > 0 {
+		compatErr.RewindTo = rewindTargetByTime(db, head, compatErr.RewindToTime)
+	}
 	if compatErr != nil && height != 0 && compatErr.RewindTo != 0 {
 		return newcfg, stored, compatErr
 	}
 	return newcfg, stored, WriteChainConfig(db, stored, newcfg)
 }
 
+// rewindTargetByTime returns the number of the newest canonical block, starting
+// from head, with a timestamp not past the given one.
+func rewindTargetByTime(db ethdb.Database, head *types.Header, time uint64) uint64 {
+	for header := head; header != nil && header.Number.Sign() > 0; {
+		if header.Time.Uint64() <= time {
+			return header.Number.Uint64()
+		}
+		header = GetHeader(db, header.ParentHash, header.Number.Uint64()-1)
+	}
+	return 0
+}
+
 func (g *Genesis) configOrDefault(ghash common.Hash) *params.ChainConfig {
 	switch {
 	case g != nil:
@@ -329,7 +354,7 @@ func DefaultRinkebyGenesisBlock() *Genesis {
 	}
 }
 
-// DevGenesisBlock returns the 'geth --dev' genesis block.
+// DevGenesisBlock returns a proof-of-work development genesis block.
 func DevGenesisBlock() *Genesis {
 	return &Genesis{
 		Config:     params.AllProtocolChanges,
@@ -339,6 +364,25 @@ func DevGenesisBlock() *Genesis {
 	}
 }
 
+// DeveloperGenesisBlock returns the 'geth --dev' genesis block, sealed on demand
+// or at the given period and pre-funding the developer account.
+func DeveloperGenesisBlock(period uint64, faucet common.Address) *Genesis {
+	// Override the default period to the user requested one
+	config := *params.AllProtocolChanges
+	config.Ethash = nil
+	config.Instant = &params.InstantConfig{Period: period}
+
+	// Assemble and return the genesis with the precompiles and faucet pre-funded
+	alloc := decodePrealloc(devAllocData)
+	alloc[faucet] = GenesisAccount{Balance: new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(9))}
+
+	return &Genesis{
+		Config:     &config,
+		Difficulty: big.NewInt(1),
+		Alloc:      alloc,
+	}
+}
+
 func decodePrealloc(data string) GenesisAlloc {
 	var p []struct{ Addr, Balance *big.Int }
 	if err := rlp.NewStream(strings.NewReader(data), 0).Decode(&p); err != nil {
@@ -239,6 +239,10 @@ func (hc *HeaderChain) ValidateHeaderChain(chain []*types.Header, checkFreq int)
 		if BadHashes[header.Hash()] {
 			return i, ErrBlacklistedHash
 		}
+		// Headers conflicting with a trusted checkpoint belong to a rogue chain
+		if checkpoint := hc.config.Checkpoint(header.Number.Uint64()); checkpoint != nil && checkpoint.Hash != header.Hash() {
+			return i, ErrCheckpointMismatch
+		}
 		// Otherwise wait for headers checks and ensure they pass
 		if err := <-results; err != nil {
 			return i, err
@@ -21,6 +21,7 @@ import (
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/log"
 )
@@ -52,14 +53,18 @@ type StateTransition struct {
 	data  []byte
 	state vm.StateDB
 
-	evm *vm.EVM
+	evm   *vm.EVM
+	calls []*types.CallResult
+	fee   *big.Int
 }
 
 // Message represents a message sent to a contract.
 type Message interface {
 	From() common.Address
 	//FromFrontier() (common.Address, error)
+	Sponsor() *common.Address // Account sequencing a sponsored message, nil otherwise
 	To() *common.Address
+	Calls() []*types.Call // Calls executed atomically by a batch message, nil otherwise
 
 	Value() *big.Int
 
@@ -116,13 +121,27 @@ func (st *StateTransition) to() vm.AccountRef {
 	return reference
 }
 
+// payer returns the account whose nonce sequences the message: the sponsor of a
+// sponsored message or the sender otherwise.
+func (st *StateTransition) payer() common.Address {
+	if sponsor := st.msg.Sponsor(); sponsor != nil {
+		return *sponsor
+	}
+	return st.msg.From()
+}
+
 func (st *StateTransition) preCheck() error {
 	msg := st.msg
-	sender := st.from()
+	st.from()
 
+	// Sponsored messages can't create contracts, those are sequenced by the
+	// nonce of the creator which the sponsor doesn't control
+	if msg.Sponsor() != nil && msg.To() == nil && msg.Calls() == nil {
+		return ErrSponsoredCreation
+	}
 	// Make sure this transaction's nonce is correct
 	if msg.CheckNonce() {
-		if n := st.state.GetNonce(sender.Address()); n != msg.Nonce() {
+		if n := st.state.GetNonce(st.payer()); n != msg.Nonce() {
 			return fmt.Errorf("invalid nonce: have %d, expected %d", msg.Nonce(), n)
 		}
 	}
@@ -136,11 +155,12 @@ func (st *StateTransition) TransitionDb() (ret []byte, failed bool, err error) {
 	if err = st.preCheck(); err != nil {
 		return
 	}
+	if err = st.buyFee(); err != nil {
+		return
+	}
 	msg := st.msg
 	sender := st.from() // err checked in preCheck
 
-	contractCreation := msg.To() == nil
-
 	var (
 		evm = st.evm
 		// vm errors do not effect consensus and are therefor
@@ -148,11 +168,29 @@ func (st *StateTransition) TransitionDb() (ret []byte, failed bool, err error) {
 		// error.
 		vmerr error
 	)
-	if contractCreation {
+	switch {
+	case msg.Calls() != nil:
+		// The batch as a whole must be affordable upfront, so that only the
+		// calls themselves may fail
+		value := new(big.Int)
+		for _, call := range msg.Calls() {
+			value.Add(value, call.Value)
+		}
+		if st.state.GetBalance(sender.Address()).Cmp(value) < 0 {
+			return nil, false, vm.ErrInsufficientBalance
+		}
+		// Increment the nonce for the next transaction
+		payer := st.payer()
+		st.state.SetNonce(payer, st.state.GetNonce(payer)+1)
+		vmerr = st.callBatch(sender)
+
+	case msg.To() == nil:
 		ret, _, vmerr = evm.Create(sender, st.data, st.value)
-	} else {
+
+	default:
 		// Increment the nonce for the next transaction
-		st.state.SetNonce(sender.Address(), st.state.GetNonce(sender.Address())+1)
+		payer := st.payer()
+		st.state.SetNonce(payer, st.state.GetNonce(payer)+1)
 		ret, vmerr = evm.Call(sender, st.to().Address(), st.data, st.value)
 	}
 	if vmerr != nil {
@@ -163,7 +201,80 @@ func (st *StateTransition) TransitionDb() (ret []byte, failed bool, err error) {
 		if vmerr == vm.ErrInsufficientBalance {
 			return nil, false, vmerr
 		}
+		// An execution aborted due to its step budget has no meaningful
+		// result, it's not a failed transaction but a failed run.
+		if vmerr == vm.ErrStepLimitReached {
+			return nil, false, vmerr
+		}
 	}
+	st.chargeSteps()
 
 	return ret, vmerr != nil, err
 }
+
+// buyFee debits the intrinsic fee of the message from its payer once flat fees
+// are active, failing if the payer can't afford it. Messages not checking their
+// nonce are local calls instead of transactions and aren't charged.
+func (st *StateTransition) buyFee() error {
+	if !st.evm.ChainRules().IsFee || !st.msg.CheckNonce() {
+		return nil
+	}
+	st.fee = IntrinsicFee(st.evm.ChainConfig().Fee, st.data, st.msg.Calls())
+
+	payer := st.payer()
+	if st.state.GetBalance(payer).Cmp(st.fee) < 0 {
+		return ErrInsufficientFee
+	}
+	st.state.SubBalance(payer, st.fee)
+	return nil
+}
+
+// chargeSteps debits the fee of the instructions executed by the message from
+// its payer, as far as its remaining balance covers it.
+func (st *StateTransition) chargeSteps() {
+	if st.fee == nil {
+		return
+	}
+	fee := StepFee(st.evm.ChainConfig().Fee, st.evm.Steps())
+
+	payer := st.payer()
+	if balance := st.state.GetBalance(payer); balance.Cmp(fee) < 0 {
+		fee = balance
+	}
+	st.state.SubBalance(payer, fee)
+	st.fee.Add(st.fee, fee)
+}
+
+// Fee returns the total fee charged for the message, to be credited to the
+// producer of the block, or nil if flat fees aren't active.
+func (st *StateTransition) Fee() *big.Int {
+	return st.fee
+}
+
+// callBatch executes the calls of a batch message in order, reverting the effects
+// of all of them if any fails. The results of the executed calls are recorded,
+// the last one being the failed call if the batch was reverted.
+func (st *StateTransition) callBatch(sender vm.AccountRef) error {
+	snapshot := st.state.Snapshot()
+	for _, call := range st.msg.Calls() {
+		ret, err := st.evm.Call(sender, call.To, call.Data, call.Value)
+
+		result := &types.CallResult{Status: types.ReceiptStatusSuccessful, ReturnData: ret}
+		if err != nil {
+			result.Status = types.ReceiptStatusFailed
+		}
+		st.calls = append(st.calls, result)
+
+		if err != nil {
+			st.state.RevertToSnapshot(snapshot)
+			return err
+		}
+	}
+	return nil
+}
+
+// CallResults returns the outcome of the calls executed by a batch message, or
+// nil if the message isn't a batch.
+func (st *StateTransition) CallResults() []*types.CallResult {
+	return st.calls
+}
@@ -0,0 +1,218 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the calls of batch transactions are executed atomically, either all
+// of them taking effect or none, with the outcome of each reported in the receipt.
+func TestBatchTransaction(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	key, _ := crypto.GenerateKey()
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	recipient, returner, reverter := common.Address{0x01}, common.Address{0xaa}, common.Address{0xbb}
+
+	statedb.SetBalance(sender, big.NewInt(100))
+	statedb.SetCode(returner, []byte{byte(vm.PUSH1), 0x2a, byte(vm.PUSH1), 0x00, byte(vm.MSTORE), byte(vm.PUSH1), 0x20, byte(vm.PUSH1), 0x00, byte(vm.RETURN)})
+	statedb.SetCode(reverter, []byte{0xfe}) // designated invalid opcode
+
+	var (
+		chain  = &testPoolChain{}
+		header = &types.Header{Number: big.NewInt(1), Time: big.NewInt(0), Difficulty: big.NewInt(1)}
+		signer = types.NewEIP155Signer(params.TestChainConfig.ChainId)
+	)
+	apply := func(nonce uint64, calls ...*types.Call) (*types.Receipt, error) {
+		tx, _ := types.SignTx(types.NewBatchTransaction(nonce, calls), signer, key)
+		receipt, _, err := ApplyTransaction(params.TestChainConfig, chain, &common.Address{}, new(GasPool), statedb, header, tx, vm.Config{})
+		return receipt, err
+	}
+	// Ensure a successful batch applies all its calls and reports their results
+	receipt, err := apply(0,
+		&types.Call{To: recipient, Value: big.NewInt(10)},
+		&types.Call{To: returner, Value: big.NewInt(5)},
+	)
+	if err != nil {
+		t.Fatalf("failed to apply batch: %v", err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful || len(receipt.Calls) != 2 {
+		t.Fatalf("receipt mismatch: have status %d with %d calls, want %d with %d", receipt.Status, len(receipt.Calls), types.ReceiptStatusSuccessful, 2)
+	}
+	if want := common.LeftPadBytes([]byte{0x2a}, 32); !bytes.Equal(receipt.Calls[1].ReturnData, want) {
+		t.Fatalf("return data mismatch: have %x, want %x", receipt.Calls[1].ReturnData, want)
+	}
+	if receipt.ContractAddress != (common.Address{}) {
+		t.Fatalf("batch reported contract creation at %x", receipt.ContractAddress)
+	}
+	if balance := statedb.GetBalance(sender); balance.Cmp(big.NewInt(85)) != 0 {
+		t.Fatalf("sender balance mismatch: have %v, want %v", balance, 85)
+	}
+	// Ensure a failing call reverts the entire batch, but consumes the nonce
+	receipt, err = apply(1,
+		&types.Call{To: recipient, Value: big.NewInt(10)},
+		&types.Call{To: reverter, Value: big.NewInt(0)},
+		&types.Call{To: returner, Value: big.NewInt(0)},
+	)
+	if err != nil {
+		t.Fatalf("failed to apply reverting batch: %v", err)
+	}
+	if receipt.Status != types.ReceiptStatusFailed || len(receipt.Calls) != 2 {
+		t.Fatalf("receipt mismatch: have status %d with %d calls, want %d with %d", receipt.Status, len(receipt.Calls), types.ReceiptStatusFailed, 2)
+	}
+	if receipt.Calls[0].Status != types.ReceiptStatusSuccessful || receipt.Calls[1].Status != types.ReceiptStatusFailed {
+		t.Fatalf("call status mismatch: have %d/%d", receipt.Calls[0].Status, receipt.Calls[1].Status)
+	}
+	if balance := statedb.GetBalance(recipient); balance.Cmp(big.NewInt(10)) != 0 {
+		t.Fatalf("recipient balance mismatch: have %v, want %v", balance, 10)
+	}
+	if nonce := statedb.GetNonce(sender); nonce != 2 {
+		t.Fatalf("sender nonce mismatch: have %d, want %d", nonce, 2)
+	}
+	// Ensure unaffordable batches are invalid altogether
+	if _, err := apply(2,
+		&types.Call{To: recipient, Value: big.NewInt(50)},
+		&types.Call{To: recipient, Value: big.NewInt(50)},
+	); err != vm.ErrInsufficientBalance {
+		t.Fatalf("unaffordable batch error mismatch: have %v, want %v", err, vm.ErrInsufficientBalance)
+	}
+}
+
+// Tests that flat fees are charged from the account sequencing a transaction once
+// the fee fork activated, and credited to the block producer.
+func TestTransactionFees(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	key, _ := crypto.GenerateKey()
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	returner, coinbase := common.Address{0xaa}, common.Address{0xcc}
+
+	statedb.SetBalance(sender, big.NewInt(1000))
+	statedb.SetCode(returner, []byte{byte(vm.PUSH1), 0x2a, byte(vm.PUSH1), 0x00, byte(vm.MSTORE), byte(vm.PUSH1), 0x20, byte(vm.PUSH1), 0x00, byte(vm.RETURN)})
+
+	config := *params.TestChainConfig
+	config.FeeBlock = big.NewInt(2)
+	config.Fee = &params.FeeConfig{Base: big.NewInt(100), PerByte: big.NewInt(10), PerStep: big.NewInt(1)}
+
+	var (
+		chain  = &testPoolChain{}
+		signer = types.NewEIP155Signer(config.ChainId)
+	)
+	apply := func(number int64, nonce uint64, value int64) (*types.Receipt, *big.Int, error) {
+		header := &types.Header{Number: big.NewInt(number), Time: big.NewInt(0), Difficulty: big.NewInt(1), Coinbase: coinbase}
+		tx, _ := types.SignTx(types.NewTransaction(nonce, returner, big.NewInt(value), []byte{0x01, 0x02, 0x03}), signer, key)
+		return ApplyTransaction(&config, chain, &coinbase, new(GasPool), statedb, header, tx, vm.Config{})
+	}
+	// Ensure no fee is charged before the fork
+	receipt, fee, err := apply(1, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to apply pre-fork transaction: %v", err)
+	}
+	if fee != nil || receipt.Fee != nil || statedb.GetBalance(sender).Cmp(big.NewInt(1000)) != 0 {
+		t.Fatalf("pre-fork fee charged: have %v, balance %v", fee, statedb.GetBalance(sender))
+	}
+	// Ensure the base, payload and step fees are charged after the fork
+	if receipt, fee, err = apply(2, 1, 10); err != nil {
+		t.Fatalf("failed to apply transaction: %v", err)
+	}
+	if receipt.Steps != 6 || fee.Cmp(big.NewInt(136)) != 0 || receipt.Fee.Cmp(fee) != 0 {
+		t.Fatalf("fee mismatch: have %v (receipt %v) for %d steps, want %v for %d", fee, receipt.Fee, receipt.Steps, 136, 6)
+	}
+	if balance := statedb.GetBalance(sender); balance.Cmp(big.NewInt(854)) != 0 {
+		t.Fatalf("sender balance mismatch: have %v, want %v", balance, 854)
+	}
+	// Ensure the step fee is capped by the remaining balance, but the upfront fee
+	// needs to be affordable
+	if receipt, fee, err = apply(3, 2, 724); err != nil {
+		t.Fatalf("failed to apply draining transaction: %v", err)
+	}
+	if fee.Cmp(big.NewInt(130)) != 0 || statedb.GetBalance(sender).Sign() != 0 {
+		t.Fatalf("capped fee mismatch: have %v, balance %v", fee, statedb.GetBalance(sender))
+	}
+	if _, _, err := apply(4, 3, 0); err != ErrInsufficientFee {
+		t.Fatalf("unaffordable fee error mismatch: have %v, want %v", err, ErrInsufficientFee)
+	}
+}
+
+// Tests that the fees charged by the transactions of a block are credited to its
+// producer when the block is processed, independent of the receipts.
+func TestTransactionFeeCredit(t *testing.T) {
+	var (
+		db, _    = ethdb.NewMemDatabase()
+		key, _   = crypto.GenerateKey()
+		sender   = crypto.PubkeyToAddress(key.PublicKey)
+		coinbase = common.Address{0xcc}
+		config   = *params.TestChainConfig
+	)
+	config.FeeBlock = big.NewInt(1)
+	config.Fee = &params.FeeConfig{Base: big.NewInt(100), PerByte: big.NewInt(10), PerStep: big.NewInt(1)}
+
+	gspec := &Genesis{Config: &config, Alloc: GenesisAlloc{sender: {Balance: big.NewInt(10000)}}}
+	genesis := gspec.MustCommit(db)
+
+	signer := types.NewEIP155Signer(config.ChainId)
+	blocks, receipts := GenerateChain(&config, genesis, db, 2, func(i int, b *BlockGen) {
+		b.SetCoinbase(coinbase)
+		for j := 0; j < 2; j++ {
+			tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(sender), common.Address{0x01}, big.NewInt(1), []byte{0x01}), signer, key)
+			b.AddTx(tx)
+		}
+	})
+	want := new(big.Int)
+	for _, list := range receipts {
+		for _, receipt := range list {
+			want.Add(want, receipt.Fee)
+		}
+	}
+	if want.Sign() == 0 {
+		t.Fatalf("no fees charged")
+	}
+	for _, block := range blocks {
+		reward, _ := config.BlockReward(block.Number())
+		want.Add(want, reward)
+	}
+	// Import the chain into a fresh database and ensure the processor credits the
+	// same fees as the chain maker did
+	db, _ = ethdb.NewMemDatabase()
+	gspec.MustCommit(db)
+
+	chain, _ := NewBlockChain(db, &config, ethash.NewFaker(), new(event.TypeMux), vm.Config{}, 0)
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import fee chain: %v", err)
+	}
+	statedb, _ := chain.State()
+	if balance := statedb.GetBalance(coinbase); balance.Cmp(want) != 0 {
+		t.Fatalf("producer fee credit mismatch: have %v, want %v", balance, want)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// ErrSenderNotAllowed is returned if the sender of a transaction is not
+	// permitted to submit transactions by the admission filters.
+	ErrSenderNotAllowed = errors.New("sender not allowed")
+
+	// ErrRecipientNotAllowed is returned if the recipient of a transaction is
+	// forbidden to be called by the admission filters.
+	ErrRecipientNotAllowed = errors.New("recipient not allowed")
+)
+
+// TxFilterError is returned if a transaction is rejected by an admission filter.
+// It carries the offending account and implements the RPC error interface, so
+// the rejection reason is surfaced to API callers with a dedicated error code.
+type TxFilterError struct {
+	Reason  error          // ErrSenderNotAllowed or ErrRecipientNotAllowed
+	Account common.Address // Account the transaction was rejected for
+}
+
+// Error implements the error interface.
+func (e *TxFilterError) Error() string {
+	return fmt.Sprintf("%v: %x", e.Reason, e.Account)
+}
+
+// ErrorCode returns the JSON-RPC error code of a rejected transaction.
+func (e *TxFilterError) ErrorCode() int { return -32003 }
+
+// TxFilter is an admission rule deciding whether a transaction may enter the
+// transaction pool or a block. The same filter is enforced by the pool, the
+// miner and the block validator so that peers can't bypass it.
+type TxFilter interface {
+	// FilterTx returns an error if the transaction sent by the given account is
+	// not admissible on top of the given state.
+	FilterTx(from common.Address, tx *types.Transaction, statedb *state.StateDB) error
+}
+
+// TxFilters is a chain of admission filters, a transaction is only admitted if
+// all of them accept it.
+type TxFilters []TxFilter
+
+// FilterTx runs the transaction through all the filters in order, returning the
+// first rejection.
+func (filters TxFilters) FilterTx(from common.Address, tx *types.Transaction, statedb *state.StateDB) error {
+	for _, filter := range filters {
+		if err := filter.FilterTx(from, tx, statedb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TxFilterConfig are the configuration parameters of the admission filters.
+type TxFilterConfig struct {
+	AllowedSenders    []common.Address `toml:",omitempty"` // Accounts permitted to send transactions (empty = anyone)
+	DeniedRecipients  []common.Address `toml:",omitempty"` // Accounts forbidden to be called or transferred to
+	AllowlistContract *common.Address  `toml:",omitempty"` // Contract maintaining the on-chain sender allowlist
+}
+
+// NewTxFilter assembles the admission filter chain described by the config, or
+// nil if no filtering was requested.
+func NewTxFilter(config TxFilterConfig) TxFilter {
+	var filters TxFilters
+
+	if len(config.AllowedSenders) > 0 {
+		filters = append(filters, newSenderFilter(config.AllowedSenders))
+	}
+	if len(config.DeniedRecipients) > 0 {
+		filters = append(filters, newRecipientFilter(config.DeniedRecipients))
+	}
+	if config.AllowlistContract != nil {
+		filters = append(filters, allowlistFilter(*config.AllowlistContract))
+	}
+	if len(filters) == 0 {
+		return nil
+	}
+	return filters
+}
+
+// senderFilter only admits transactions from a static set of senders.
+type senderFilter map[common.Address]struct{}
+
+// newSenderFilter creates a sender filter allowing the given accounts.
+func newSenderFilter(allowed []common.Address) senderFilter {
+	filter := make(senderFilter)
+	for _, addr := range allowed {
+		filter[addr] = struct{}{}
+	}
+	return filter
+}
+
+// FilterTx implements TxFilter, rejecting any sender not in the set.
+func (filter senderFilter) FilterTx(from common.Address, tx *types.Transaction, statedb *state.StateDB) error {
+	if _, ok := filter[from]; !ok {
+		return &TxFilterError{Reason: ErrSenderNotAllowed, Account: from}
+	}
+	return nil
+}
+
+// recipientFilter rejects transactions to a static set of recipients.
+type recipientFilter map[common.Address]struct{}
+
+// newRecipientFilter creates a recipient filter denying the given accounts.
+func newRecipientFilter(denied []common.Address) recipientFilter {
+	filter := make(recipientFilter)
+	for _, addr := range denied {
+		filter[addr] = struct{}{}
+	}
+	return filter
+}
+
+// FilterTx implements TxFilter, rejecting any transaction to a denied account.
+func (filter recipientFilter) FilterTx(from common.Address, tx *types.Transaction, statedb *state.StateDB) error {
+	if to := tx.To(); to != nil {
+		if _, ok := filter[*to]; ok {
+			return &TxFilterError{Reason: ErrRecipientNotAllowed, Account: *to}
+		}
+	}
+	return nil
+}
+
+// allowlistFilter only admits transactions from senders marked in the allowlist
+// contract at the given address. The contract is expected to keep its allowlist
+// as the first declared state variable:
+//
+//	mapping(address => bool) allowed;
+//
+// The storage is read directly instead of calling into the contract, so checks
+// are cheap and don't depend on the header being built. Until the contract is
+// deployed the filter admits everyone, allowing it to be created after genesis.
+type allowlistFilter common.Address
+
+// FilterTx implements TxFilter, rejecting senders not marked in the contract.
+func (filter allowlistFilter) FilterTx(from common.Address, tx *types.Transaction, statedb *state.StateDB) error {
+	contract := common.Address(filter)
+	if statedb.GetCodeSize(contract) == 0 {
+		return nil
+	}
+	if statedb.GetState(contract, AllowlistSlot(from)) == (common.Hash{}) {
+		return &TxFilterError{Reason: ErrSenderNotAllowed, Account: from}
+	}
+	return nil
+}
+
+// AllowlistSlot returns the storage slot of the allowlist contract holding the
+// permission flag of the given account, i.e. the Solidity location of a mapping
+// entry at slot zero: keccak256(account . 0).
+func AllowlistSlot(account common.Address) common.Hash {
+	return crypto.Keccak256Hash(common.LeftPadBytes(account[:], 32), make([]byte, 32))
+}
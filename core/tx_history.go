@@ -0,0 +1,108 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/hashicorp/golang-lru"
+)
+
+// txHistoryLimit is the number of most recently seen transactions whose pool
+// events are retained for later inspection.
+const txHistoryLimit = 4096
+
+// txHistory records the lifecycle events of pooled transactions. Events are
+// retained per transaction hash for a limited number of transactions and are
+// delivered to the event mux in the exact order they were recorded.
+//
+// Recording never blocks, so it's safe to do with the pool lock held, delivery
+// is done on a separate goroutine.
+type txHistory struct {
+	mux    *event.TypeMux
+	events *lru.Cache // Recorded events of the recently seen transactions
+
+	queue []*TxPoolEvent // Events recorded but not yet delivered
+	wake  chan struct{}  // Notification channel for newly queued events
+	lock  sync.Mutex
+}
+
+// newTxHistory creates a new transaction event history delivering its events
+// into the given mux.
+func newTxHistory(mux *event.TypeMux) *txHistory {
+	events, _ := lru.New(txHistoryLimit)
+	return &txHistory{
+		mux:    mux,
+		events: events,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// record appends an event to the history of its transaction and queues it up
+// for delivery.
+func (h *txHistory) record(ev *TxPoolEvent) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	var events []*TxPoolEvent
+	if cached, ok := h.events.Get(ev.Hash); ok {
+		events = cached.([]*TxPoolEvent)
+	}
+	h.events.Add(ev.Hash, append(events, ev))
+
+	h.queue = append(h.queue, ev)
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+}
+
+// get retrieves all the retained events of a transaction, oldest first.
+func (h *txHistory) get(hash common.Hash) []*TxPoolEvent {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	cached, ok := h.events.Get(hash)
+	if !ok {
+		return nil
+	}
+	events := make([]*TxPoolEvent, len(cached.([]*TxPoolEvent)))
+	copy(events, cached.([]*TxPoolEvent))
+	return events
+}
+
+// loop delivers the queued events to the event mux until quit is closed.
+func (h *txHistory) loop(quit chan struct{}) {
+	for {
+		select {
+		case <-h.wake:
+			h.lock.Lock()
+			queue := h.queue
+			h.queue = nil
+			h.lock.Unlock()
+
+			for _, ev := range queue {
+				h.mux.Post(*ev)
+			}
+
+		case <-quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// txIndexBatch is the number of blocks processed between two persisted updates
+// of the transaction index tail, bounding the work lost on an interruption.
+const txIndexBatch = 1000
+
+// indexTransactions writes the transaction lookup entries and the receipts of
+// the canonical blocks in the range [from, to), dropping any pruned markers.
+// Blocks are processed from the newest to the oldest, moving the index tail
+// backwards as progress is made so that an interrupted run can be resumed.
+//
+// The function returns false if it was interrupted before reaching from.
+func indexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}) bool {
+	var (
+		start  = time.Now()
+		txs    int
+		number = to
+	)
+	for number > from {
+		select {
+		case <-interrupt:
+			WriteTxIndexTail(db, number)
+			return false
+		default:
+		}
+		number--
+
+		hash := GetCanonicalHash(db, number)
+		if hash == (common.Hash{}) {
+			log.Error("Missing canonical hash for transaction indexing", "number", number)
+			WriteTxIndexTail(db, number+1)
+			return false
+		}
+		block := GetBlock(db, hash, number)
+		if block == nil {
+			log.Error("Missing block for transaction indexing", "number", number, "hash", hash)
+			WriteTxIndexTail(db, number+1)
+			return false
+		}
+		if err := WriteTransactions(db, block); err != nil {
+			log.Error("Failed to index block transactions", "number", number, "err", err)
+			WriteTxIndexTail(db, number+1)
+			return false
+		}
+		if err := WriteReceipts(db, GetBlockReceipts(db, hash, number)); err != nil {
+			log.Error("Failed to index block receipts", "number", number, "err", err)
+			WriteTxIndexTail(db, number+1)
+			return false
+		}
+		for _, tx := range block.Transactions() {
+			DeleteTxUnindexed(db, tx.Hash())
+		}
+		txs += len(block.Transactions())
+
+		if (to-number)%txIndexBatch == 0 {
+			WriteTxIndexTail(db, number)
+		}
+	}
+	WriteTxIndexTail(db, from)
+	log.Info("Indexed transactions", "blocks", to-from, "txs", txs, "tail", from, "elapsed", common.PrettyDuration(time.Since(start)))
+	return true
+}
+
+// unindexTransactions removes the transaction lookup entries and the receipts
+// of the canonical blocks in the range [from, to), leaving only a small marker
+// with the block number behind for each pruned transaction. Blocks are processed
+// from the oldest to the newest, moving the index tail forward as progress is
+// made.
+//
+// The markers are only dropped if the blocks get indexed again, so the database
+// still grows by about 41 bytes (a 33 byte key and an 8 byte number) for every
+// pruned transaction, instead of its lookup entry and receipt.
+//
+// The function returns false if it was interrupted before reaching to.
+func unindexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}) bool {
+	var (
+		start  = time.Now()
+		txs    int
+		number = from
+	)
+	for ; number < to; number++ {
+		select {
+		case <-interrupt:
+			WriteTxIndexTail(db, number)
+			return false
+		default:
+		}
+		hash := GetCanonicalHash(db, number)
+		if hash == (common.Hash{}) {
+			break
+		}
+		if body := GetBody(db, hash, number); body != nil {
+			for _, tx := range body.Transactions {
+				DeleteTransaction(db, tx.Hash())
+				DeleteReceipt(db, tx.Hash())
+				WriteTxUnindexed(db, tx.Hash(), number)
+			}
+			txs += len(body.Transactions)
+		}
+		if (number-from+1)%txIndexBatch == 0 {
+			WriteTxIndexTail(db, number+1)
+		}
+	}
+	WriteTxIndexTail(db, number)
+	log.Info("Unindexed transactions", "blocks", number-from, "txs", txs, "tail", number, "elapsed", common.PrettyDuration(time.Since(start)))
+	return number == to
+}
+
+// updateTxIndex moves the transaction index tail so that exactly the blocks
+// within the configured lookup limit of the given head are indexed. If the limit
+// was raised (or removed) since the last run, the missing blocks are re-indexed.
+func (bc *BlockChain) updateTxIndex(head uint64, done chan struct{}, interrupt chan struct{}) {
+	defer close(done)
+
+	// A missing tail means the entire chain was indexed without any limit
+	tail := GetTxIndexTail(bc.chainDb)
+	if tail == nil {
+		if bc.txLookupLimit == 0 {
+			return
+		}
+		tail = new(uint64)
+	}
+	// Calculate the oldest block that should retain its lookup entries
+	var wanted uint64
+	if bc.txLookupLimit != 0 && head >= bc.txLookupLimit {
+		wanted = head - bc.txLookupLimit + 1
+	}
+	switch {
+	case wanted < *tail:
+		indexTransactions(bc.chainDb, wanted, *tail, interrupt)
+	case wanted > *tail:
+		unindexTransactions(bc.chainDb, *tail, wanted, interrupt)
+	}
+}
+
+// maintainTxIndex is responsible for the construction and deletion of the
+// transaction index in the background, keeping the lookup entries of the most
+// recent txLookupLimit blocks only.
+//
+// Head events are received from the chain's own event mux, the actual indexing
+// is done on a separate goroutine so that event delivery is never blocked.
+func (bc *BlockChain) maintainTxIndex() {
+	defer bc.wg.Done()
+
+	var (
+		done      chan struct{} // Non-nil if an indexing run is in progress
+		interrupt chan struct{} // Channel to abort the running indexer
+		pending   uint64        // Head to reindex at once the current run is done
+		queued    bool          // Whether a head update arrived during a run
+	)
+	run := func(head uint64) {
+		done, interrupt = make(chan struct{}), make(chan struct{})
+		go bc.updateTxIndex(head, done, interrupt)
+	}
+	sub := bc.eventMux.Subscribe(ChainHeadEvent{})
+	defer sub.Unsubscribe()
+
+	// Bring the index in line with the configured limit right away
+	run(bc.CurrentBlock().NumberU64())
+
+	for {
+		select {
+		case ev, ok := <-sub.Chan():
+			if !ok {
+				return
+			}
+			head := ev.Data.(ChainHeadEvent).Block.NumberU64()
+			if done == nil {
+				run(head)
+			} else {
+				pending, queued = head, true
+			}
+
+		case <-done:
+			done = nil
+			if queued {
+				queued = false
+				run(pending)
+			}
+
+		case <-bc.quit:
+			if done != nil {
+				close(interrupt)
+				<-done
+			}
+			return
+		}
+	}
+}
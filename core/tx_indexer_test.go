@@ -0,0 +1,130 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// newIndexerTestChain creates a database with a canonical chain of n blocks,
+// each containing a single value transfer.
+func newIndexerTestChain(t *testing.T, n int) (ethdb.Database, []*types.Block) {
+	var (
+		key, _  = crypto.GenerateKey()
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		signer  = types.HomesteadSigner{}
+		db, _   = ethdb.NewMemDatabase()
+		gspec   = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{address: {Balance: big.NewInt(1000000)}}}
+		genesis = gspec.MustCommit(db)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, db, n, func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x01}, big.NewInt(1), nil), signer, key)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		block.AddTx(tx)
+	})
+	return db, blocks
+}
+
+// waitTxIndexTail waits until the transaction index tail reaches the expected
+// block number.
+func waitTxIndexTail(t *testing.T, db ethdb.Database, want uint64) {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if tail := GetTxIndexTail(db); tail != nil && *tail == want {
+			return
+		}
+	}
+	tail := GetTxIndexTail(db)
+	if tail == nil {
+		t.Fatalf("index tail missing, want %d", want)
+	}
+	t.Fatalf("index tail mismatch: have %d, want %d", *tail, want)
+}
+
+// checkTxIndex verifies that only the transactions of the blocks from tail on
+// are retrievable via their lookup entries and receipts, and that the older ones
+// are marked as pruned.
+func checkTxIndex(t *testing.T, db ethdb.Database, blocks []*types.Block, tail uint64) {
+	for _, block := range blocks {
+		for _, tx := range block.Transactions() {
+			indexed := block.NumberU64() >= tail
+			if have, _, _, _ := GetTransaction(db, tx.Hash()); (have != nil) != indexed {
+				t.Errorf("block #%d: transaction lookup mismatch: have %v, want indexed %v", block.NumberU64(), have != nil, indexed)
+			}
+			if have := GetReceipt(db, tx.Hash()); (have != nil) != indexed {
+				t.Errorf("block #%d: receipt lookup mismatch: have %v, want indexed %v", block.NumberU64(), have != nil, indexed)
+			}
+			number := GetTxUnindexed(db, tx.Hash())
+			switch {
+			case indexed && number != nil:
+				t.Errorf("block #%d: indexed transaction marked as pruned", block.NumberU64())
+			case !indexed && number == nil:
+				t.Errorf("block #%d: pruned transaction not marked", block.NumberU64())
+			case !indexed && *number != block.NumberU64():
+				t.Errorf("block #%d: pruned marker mismatch: have #%d", block.NumberU64(), *number)
+			}
+		}
+	}
+}
+
+// Tests that the transaction index is pruned to the configured limit, and that
+// raising the limit afterwards re-indexes the missing blocks.
+func TestTxIndexLimit(t *testing.T) {
+	db, blocks := newIndexerTestChain(t, 16)
+
+	// Import the chain with a limit and check that old entries are pruned
+	chain, err := NewBlockChain(db, params.TestChainConfig, ethash.NewFaker(), new(event.TypeMux), vm.Config{}, 4)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	waitTxIndexTail(t, db, 13)
+	chain.Stop()
+	checkTxIndex(t, db, blocks, 13)
+
+	// Raise the limit and check that the missing blocks are indexed again
+	chain, err = NewBlockChain(db, params.TestChainConfig, ethash.NewFaker(), new(event.TypeMux), vm.Config{}, 10)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	waitTxIndexTail(t, db, 7)
+	chain.Stop()
+	checkTxIndex(t, db, blocks, 7)
+
+	// Drop the limit altogether and check that the entire chain is indexed
+	chain, err = NewBlockChain(db, params.TestChainConfig, ethash.NewFaker(), new(event.TypeMux), vm.Config{}, 0)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	waitTxIndexTail(t, db, 0)
+	chain.Stop()
+	checkTxIndex(t, db, blocks, 0)
+}
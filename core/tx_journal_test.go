@@ -0,0 +1,145 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// newTestJournal creates a transaction journal in a fresh temporary directory,
+// returning a cleanup function removing it.
+func newTestJournal(t *testing.T) (*txJournal, func()) {
+	dir, err := ioutil.TempDir("", "txjournal-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	return newTxJournal(filepath.Join(dir, "transactions.rlp")), func() { os.RemoveAll(dir) }
+}
+
+// loadJournal loads all the transactions from a journal, in order.
+func loadJournal(journal *txJournal) (types.Transactions, error) {
+	var txs types.Transactions
+	err := journal.load(func(tx *types.Transaction) error {
+		txs = append(txs, tx)
+		return nil
+	})
+	return txs, err
+}
+
+// Tests that loading a non-existent journal is a noop.
+func TestTxJournalMissing(t *testing.T) {
+	journal, cleanup := newTestJournal(t)
+	defer cleanup()
+
+	txs, err := loadJournal(journal)
+	if err != nil {
+		t.Fatalf("failed to load missing journal: %v", err)
+	}
+	if len(txs) != 0 {
+		t.Fatalf("transactions loaded from missing journal: %d", len(txs))
+	}
+}
+
+// Tests that transactions can't be journaled before the journal is rotated open.
+func TestTxJournalInactive(t *testing.T) {
+	journal, cleanup := newTestJournal(t)
+	defer cleanup()
+
+	key, _ := crypto.GenerateKey()
+	if err := journal.insert(transaction(0, big.NewInt(1), key)); err != errNoActiveJournal {
+		t.Fatalf("insert error mismatch: have %v, want %v", err, errNoActiveJournal)
+	}
+}
+
+// Tests that rotating the journal replaces its contents with the given pool
+// contents, and that transactions inserted afterwards are appended.
+func TestTxJournalRotate(t *testing.T) {
+	journal, cleanup := newTestJournal(t)
+	defer cleanup()
+
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+
+	stale := transaction(0, big.NewInt(1), key)
+	if err := journal.rotate(map[common.Address]types.Transactions{addr: {stale}}); err != nil {
+		t.Fatalf("failed to rotate journal: %v", err)
+	}
+	if err := journal.insert(transaction(1, big.NewInt(1), key)); err != nil {
+		t.Fatalf("failed to journal transaction: %v", err)
+	}
+	// Rotate with a fresh pool content and append a new transaction
+	want := types.Transactions{transaction(1, big.NewInt(1), key), transaction(2, big.NewInt(1), key)}
+	if err := journal.rotate(map[common.Address]types.Transactions{addr: want[:1]}); err != nil {
+		t.Fatalf("failed to rotate journal: %v", err)
+	}
+	if err := journal.insert(want[1]); err != nil {
+		t.Fatalf("failed to journal transaction: %v", err)
+	}
+	if err := journal.close(); err != nil {
+		t.Fatalf("failed to close journal: %v", err)
+	}
+	// Reload the journal and ensure only the live transactions remain
+	txs, err := loadJournal(journal)
+	if err != nil {
+		t.Fatalf("failed to load journal: %v", err)
+	}
+	if len(txs) != len(want) {
+		t.Fatalf("journaled transaction count mismatch: have %d, want %d", len(txs), len(want))
+	}
+	for i, tx := range txs {
+		if tx.Hash() != want[i].Hash() {
+			t.Errorf("transaction %d: hash mismatch: have %x, want %x", i, tx.Hash(), want[i].Hash())
+		}
+	}
+}
+
+// Tests that a journal with a corrupted tail still yields the transactions in
+// front of the corruption, but reports the failure.
+func TestTxJournalCorrupt(t *testing.T) {
+	journal, cleanup := newTestJournal(t)
+	defer cleanup()
+
+	key, _ := crypto.GenerateKey()
+	tx := transaction(0, big.NewInt(1), key)
+	if err := journal.rotate(map[common.Address]types.Transactions{crypto.PubkeyToAddress(key.PublicKey): {tx}}); err != nil {
+		t.Fatalf("failed to rotate journal: %v", err)
+	}
+	journal.close()
+
+	file, err := os.OpenFile(journal.path, os.O_WRONLY|os.O_APPEND, 0755)
+	if err != nil {
+		t.Fatalf("failed to open journal: %v", err)
+	}
+	file.Write([]byte{0xf8, 0xff, 0x00})
+	file.Close()
+
+	txs, err := loadJournal(journal)
+	if err == nil {
+		t.Fatalf("corrupted journal loaded without error")
+	}
+	if len(txs) != 1 || txs[0].Hash() != tx.Hash() {
+		t.Fatalf("transactions before the corruption not loaded: %v", txs)
+	}
+}
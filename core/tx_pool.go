@@ -18,7 +18,7 @@ package core
 
 import (
 	"errors"
-	"fmt"
+	"math/big"
 	"sort"
 	"sync"
 	"time"
@@ -26,6 +26,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
@@ -34,9 +35,17 @@ import (
 )
 
 var (
+	// ErrKnownTransaction is returned if a transaction is already contained in
+	// the pool.
+	ErrKnownTransaction = errors.New("known transaction")
+
 	// ErrInvalidSender is returned if the transaction contains an invalid signature.
 	ErrInvalidSender = errors.New("invalid sender")
 
+	// ErrInvalidSponsor is returned if a sponsored transaction contains an invalid
+	// sponsor signature.
+	ErrInvalidSponsor = errors.New("invalid sponsor")
+
 	// ErrNonceTooLow is returned if the nonce of a transaction is lower than the
 	// one present in the local chain.
 	ErrNonceTooLow = errors.New("nonce too low")
@@ -53,6 +62,26 @@ var (
 	// than some meaningful limit a user might use. This is not a consensus error
 	// making the transaction invalid, rather a DOS protection.
 	ErrOversizedData = errors.New("oversized data")
+
+	// ErrRateLimited is returned if the sender of a transaction already had more
+	// transactions accepted within the current rate window than permitted.
+	ErrRateLimited = errors.New("sender rate limit exceeded")
+
+	// ErrReplaceTooSoon is returned if a transaction attempts to replace another
+	// one with the same nonce before the minimum replacement delay has passed.
+	ErrReplaceTooSoon = errors.New("replacement transaction too soon")
+
+	// ErrSimulationReverted is returned if a transaction fails when executed on
+	// top of the pending state during admission.
+	ErrSimulationReverted = errors.New("transaction reverted in simulation")
+
+	// ErrSimulationBudget is returned if a transaction doesn't finish executing
+	// within the simulation budget during admission.
+	ErrSimulationBudget = errors.New("transaction exceeded simulation budget")
+
+	// ErrSimulationQuota is returned if the sender of a transaction already had
+	// more failed simulations within the current rate window than permitted.
+	ErrSimulationQuota = errors.New("sender exceeded failed simulation quota")
 )
 
 var (
@@ -60,6 +89,10 @@ var (
 	statsReportInterval = 8 * time.Second // Time interval to report transaction pool stats
 )
 
+// simulationCacheLimit is the maximum number of simulation results retained
+// between two chain head events.
+const simulationCacheLimit = 4096
+
 var (
 	// Metrics for the pending pool
 	pendingDiscardCounter   = metrics.NewCounter("txpool/pending/discard")
@@ -76,18 +109,42 @@ var (
 	// General tx metrics
 	invalidTxCounter     = metrics.NewCounter("txpool/invalid")
 	underpricedTxCounter = metrics.NewCounter("txpool/underpriced")
+	ratelimitTxCounter   = metrics.NewCounter("txpool/ratelimit") // Rejected due to the sender rate limit
+	evictedTxCounter     = metrics.NewCounter("txpool/evicted")   // Dropped due to the pool byte limit
+	simfailTxCounter     = metrics.NewCounter("txpool/simfail")   // Rejected due to a failed simulation
 )
 
 type stateFn func() (*state.StateDB, error)
 
+// TxPoolChain is the chain access needed by the pool to check transactions in
+// the context of the upcoming block.
+type TxPoolChain interface {
+	ChainContext
+
+	// CurrentBlock retrieves the current head block of the canonical chain.
+	CurrentBlock() *types.Block
+}
+
 // TxPoolConfig are the configuration parameters of the transaction pool.
 type TxPoolConfig struct {
-	NoLocals bool // Whether local transaction handling should be disabled
+	Locals    []common.Address // Addresses that should be treated by default as local
+	NoLocals  bool             // Whether local transaction handling should be disabled
+	Journal   string           // Journal of local transactions to survive node restarts
+	Rejournal time.Duration    // Time interval to regenerate the local transaction journal
 
 	AccountSlots uint64 // Minimum number of executable transaction slots guaranteed per account
 	GlobalSlots  uint64 // Maximum number of executable transaction slots for all accounts
 	AccountQueue uint64 // Maximum number of non-executable transaction slots permitted per account
 	GlobalQueue  uint64 // Maximum number of non-executable transaction slots for all accounts
+	GlobalBytes  uint64 // Maximum total size of all pooled transactions in bytes (0 = unlimited)
+
+	AccountRate  uint64        // Maximum number of transactions accepted per account within a rate window (0 = unlimited)
+	RateWindow   time.Duration // Time window over which the per account rate limit is enforced
+	ReplaceDelay time.Duration // Minimum time a transaction is pooled before it can be replaced
+
+	Simulate        bool   // Whether to execute remote transactions on the pending state before admission
+	SimulationSteps uint64 // Execution budget of a simulated transaction in VM steps
+	SimulationQuota uint64 // Maximum number of failed simulations per account within a rate window (0 = unlimited)
 
 	Lifetime time.Duration // Maximum amount of time non-executable transaction are queued
 }
@@ -95,10 +152,21 @@ type TxPoolConfig struct {
 // DefaultTxPoolConfig contains the default configurations for the transaction
 // pool.
 var DefaultTxPoolConfig = TxPoolConfig{
+	Journal:   "transactions.rlp",
+	Rejournal: time.Hour,
+
 	AccountSlots: 16,
 	GlobalSlots:  4096,
 	AccountQueue: 64,
 	GlobalQueue:  1024,
+	GlobalBytes:  64 * 1024 * 1024,
+
+	AccountRate:  64,
+	RateWindow:   time.Minute,
+	ReplaceDelay: 10 * time.Second,
+
+	SimulationSteps: 1000000,
+	SimulationQuota: 8,
 
 	Lifetime: 3 * time.Hour,
 }
@@ -106,7 +174,20 @@ var DefaultTxPoolConfig = TxPoolConfig{
 // sanitize checks the provided user configurations and changes anything that's
 // unreasonable or unworkable.
 func (config *TxPoolConfig) sanitize() TxPoolConfig {
-	return *config
+	conf := *config
+	if conf.Rejournal < time.Second {
+		log.Warn("Sanitizing invalid txpool journal time", "provided", conf.Rejournal, "updated", time.Second)
+		conf.Rejournal = time.Second
+	}
+	if (conf.AccountRate > 0 || conf.SimulationQuota > 0) && conf.RateWindow <= 0 {
+		log.Warn("Sanitizing invalid txpool rate window", "provided", conf.RateWindow, "updated", DefaultTxPoolConfig.RateWindow)
+		conf.RateWindow = DefaultTxPoolConfig.RateWindow
+	}
+	if conf.Simulate && conf.SimulationSteps == 0 {
+		log.Warn("Sanitizing invalid txpool simulation budget", "provided", conf.SimulationSteps, "updated", DefaultTxPoolConfig.SimulationSteps)
+		conf.SimulationSteps = DefaultTxPoolConfig.SimulationSteps
+	}
+	return conf
 }
 
 // TxPool contains all currently known transactions. Transactions
@@ -123,14 +204,26 @@ type TxPool struct {
 	pendingState *state.ManagedState
 	eventMux     *event.TypeMux
 	events       *event.TypeMuxSubscription
-	locals       *accountSet
+	locals       *accountSet // Set of local transaction to exempt from eviction rules
+	journal      *txJournal  // Journal of local transaction to back up to disk
+	filter       TxFilter    // Admission filter chain transactions need to pass
+	history      *txHistory  // Recent lifecycle events of the pooled transactions
+	chain        TxPoolChain // Chain to check validity windows and simulate transactions on
 	signer       types.Signer
 	mu           sync.RWMutex
 
-	pending map[common.Address]*txList         // All currently processable transactions
-	queue   map[common.Address]*txList         // Queued but non-processable transactions
-	beats   map[common.Address]time.Time       // Last heartbeat from each known account
-	all     map[common.Hash]*types.Transaction // All transactions to allow lookups
+	pending  map[common.Address]*txList         // All currently processable transactions
+	queue    map[common.Address]*txList         // Queued but non-processable transactions
+	beats    map[common.Address]time.Time       // Last heartbeat from each known account
+	rates    map[common.Address]*rateWindow     // Admission counters of the non-local accounts
+	all      map[common.Hash]*types.Transaction // All transactions to allow lookups
+	allBytes uint64                             // Total size of all the transactions in the pool
+	arrivals map[common.Hash]time.Time          // Time each transaction was admitted into the pool
+	mined    map[common.Hash]common.Hash        // Pooled transactions included in recent blocks, until reset
+
+	simulated map[common.Hash]error          // Simulation results on top of the current head, until reset
+	simfails  map[common.Address]*rateWindow // Failed simulation counters of the non-local accounts
+	simepoch  uint64                         // Number of resets, to discard results of outdated simulations
 
 	wg   sync.WaitGroup // for shutdown sync
 	quit chan struct{}
@@ -149,20 +242,46 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, eventMux *e
 		pending:      make(map[common.Address]*txList),
 		queue:        make(map[common.Address]*txList),
 		beats:        make(map[common.Address]time.Time),
+		rates:        make(map[common.Address]*rateWindow),
 		all:          make(map[common.Hash]*types.Transaction),
+		arrivals:     make(map[common.Hash]time.Time),
+		mined:        make(map[common.Hash]common.Hash),
+		simulated:    make(map[common.Hash]error),
+		simfails:     make(map[common.Address]*rateWindow),
+		history:      newTxHistory(eventMux),
 		eventMux:     eventMux,
 		currentState: currentStateFn,
 		pendingState: nil,
-		events:       eventMux.Subscribe(ChainHeadEvent{}, RemovedTransactionEvent{}),
+		events:       eventMux.Subscribe(ChainEvent{}, ChainHeadEvent{}, RemovedTransactionEvent{}),
 		quit:         make(chan struct{}),
 	}
 	pool.locals = newAccountSet(pool.signer)
+	for _, addr := range config.Locals {
+		log.Info("Setting new local account", "address", addr)
+		pool.locals.add(addr)
+	}
 	pool.resetState()
 
+	// If local transactions and journaling is enabled, load from disk
+	if !config.NoLocals && config.Journal != "" {
+		pool.journal = newTxJournal(config.Journal)
+
+		if err := pool.journal.load(pool.AddLocal); err != nil {
+			log.Warn("Failed to load transaction journal", "err", err)
+		}
+		if err := pool.journal.rotate(pool.local()); err != nil {
+			log.Warn("Failed to rotate transaction journal", "err", err)
+		}
+	}
+
 	// Start the various events loops and return
-	pool.wg.Add(2)
+	pool.wg.Add(3)
 	go pool.eventLoop()
 	go pool.expirationLoop()
+	go func() {
+		defer pool.wg.Done()
+		pool.history.loop(pool.quit)
+	}()
 
 	return pool
 }
@@ -176,6 +295,9 @@ func (pool *TxPool) eventLoop() {
 	report := time.NewTicker(statsReportInterval)
 	defer report.Stop()
 
+	journal := time.NewTicker(pool.config.Rejournal)
+	defer journal.Stop()
+
 	// Track chain events. When a chain events occurs (new chain canon block)
 	// we need to know the new state. The new state will help us determine
 	// the nonces in the managed state
@@ -187,9 +309,16 @@ func (pool *TxPool) eventLoop() {
 				return
 			}
 			switch ev := ev.Data.(type) {
+			case ChainEvent:
+				pool.mu.Lock()
+				pool.markMined(ev.Block)
+				pool.mu.Unlock()
+
 			case ChainHeadEvent:
 				pool.mu.Lock()
+				pool.markMined(ev.Block)
 				pool.resetState()
+				pool.mined = make(map[common.Hash]common.Hash)
 				pool.mu.Unlock()
 
 			//the event, is caused by during detected chain fork
@@ -209,6 +338,31 @@ func (pool *TxPool) eventLoop() {
 				log.Debug("Transaction pool status report", "executable", pending, "queued", queued)
 				prevPending, prevQueued = pending, queued
 			}
+
+		// Handle local transaction journal rotation
+		case <-journal.C:
+			if pool.journal != nil {
+				pool.mu.Lock()
+				if err := pool.journal.rotate(pool.local()); err != nil {
+					log.Warn("Failed to rotate local tx journal", "err", err)
+				}
+				pool.mu.Unlock()
+			}
+		}
+	}
+}
+
+// markMined records the pooled transactions included in a canonical block, so
+// their removal on the next reset is reported as inclusion instead of a drop.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) markMined(block *types.Block) {
+	if block == nil {
+		return
+	}
+	for _, tx := range block.Transactions() {
+		if hash := tx.Hash(); pool.all[hash] != nil {
+			pool.mined[hash] = block.Hash()
 		}
 	}
 }
@@ -221,12 +375,22 @@ func (pool *TxPool) resetState() {
 	}
 	pool.pendingState = state.ManageState(currentState)
 
+	// Simulation results are only meaningful on top of the head they ran on
+	pool.simulated = make(map[common.Hash]error)
+	pool.simepoch++
+
 	// validate the pool of pending transactions, this will remove
 	// any transactions that have been included in the block or
 	// have been invalidated because of another transaction (e.g.
 	// higher gas price)
 	pool.demoteUnexecutables(currentState)
 
+	// Drop any transactions no longer admitted by the filters (e.g. revoked sender)
+	pool.filterTxs(currentState)
+
+	// Drop any transactions whose validity window ended
+	pool.expireTxs()
+
 	// Update all accounts to the latest known pending nonce
 	for addr, list := range pool.pending {
 		txs := list.Flatten() // Heavy but will be cached and is needed by the miner anyway
@@ -237,12 +401,110 @@ func (pool *TxPool) resetState() {
 	pool.promoteExecutables(currentState, nil)
 }
 
+// SetTxFilter sets the admission filter chain all new transactions need to pass,
+// and drops any already pooled ones that it rejects.
+func (pool *TxPool) SetTxFilter(filter TxFilter) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.filter = filter
+
+	currentState, err := pool.currentState()
+	if err != nil {
+		log.Error("Failed to filter txpool", "err", err)
+		return
+	}
+	pool.filterTxs(currentState)
+}
+
+// SetChain sets the chain used to check the validity windows of transactions and
+// to simulate them on top of the pending state. Simulation is only done if it is
+// enabled in the pool configuration.
+func (pool *TxPool) SetChain(chain TxPoolChain) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.chain = chain
+	pool.expireTxs()
+}
+
+// pendingNumber returns the number of the upcoming block, or nil if the pool is
+// not attached to a chain.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) pendingNumber() *big.Int {
+	if pool.chain == nil {
+		return nil
+	}
+	return new(big.Int).Add(pool.chain.CurrentBlock().Number(), common.Big1)
+}
+
+// pendingRules returns the protocol rules of the upcoming block with the given
+// number, assuming it is sealed no earlier than now.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) pendingRules(number *big.Int) params.Rules {
+	stamp := big.NewInt(time.Now().Unix())
+	if head := pool.chain.CurrentBlock().Time(); head.Cmp(stamp) >= 0 {
+		stamp = new(big.Int).Add(head, common.Big1)
+	}
+	return pool.chainconfig.Rules(number, stamp)
+}
+
+// txFee returns the flat fee charged upfront for the transaction if included in
+// the upcoming block, which is zero before the fee fork.
+func (pool *TxPool) txFee(tx *types.Transaction) *big.Int {
+	if number := pool.pendingNumber(); number == nil || !pool.pendingRules(number).IsFee {
+		return new(big.Int)
+	}
+	return IntrinsicFee(pool.chainconfig.Fee, tx.Data(), tx.Calls())
+}
+
+// expireTxs removes all the transactions from the pool whose validity window
+// ended before the upcoming block.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) expireTxs() {
+	number := pool.pendingNumber()
+	if number == nil {
+		return
+	}
+	rules := pool.pendingRules(number)
+	for hash, tx := range pool.all {
+		if ValidateTxWindow(rules, tx, number) == ErrTxExpired {
+			log.Trace("Removed expired transaction", "hash", hash, "until", tx.ValidUntil())
+			pool.removeTx(hash, TxDropExpired)
+		}
+	}
+}
+
+// filterTxs removes all the transactions from the pool that are rejected by the
+// admission filters at the given state.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) filterTxs(state *state.StateDB) {
+	if pool.filter == nil {
+		return
+	}
+	for hash, tx := range pool.all {
+		from, _ := types.Sender(pool.signer, tx) // already validated
+		if err := pool.filter.FilterTx(from, tx, state); err != nil {
+			log.Trace("Removed filtered transaction", "hash", hash, "err", err)
+			pool.removeTx(hash, TxDropFiltered)
+		}
+	}
+}
+
 // Stop terminates the transaction pool.
 func (pool *TxPool) Stop() {
 	pool.events.Unsubscribe()
 	close(pool.quit)
 	pool.wg.Wait()
 
+	if pool.journal != nil {
+		pool.journal.close()
+	}
+
 	log.Info("Transaction pool stopped")
 }
 
@@ -308,6 +570,22 @@ func (pool *TxPool) Pending() (map[common.Address]types.Transactions, error) {
 	return pending, nil
 }
 
+// local retrieves all currently known local transactions, groupped by origin
+// account and sorted by nonce. The returned transaction set is a copy and can be
+// freely modified by calling code.
+func (pool *TxPool) local() map[common.Address]types.Transactions {
+	txs := make(map[common.Address]types.Transactions)
+	for addr := range pool.locals.accounts {
+		if pending := pool.pending[addr]; pending != nil {
+			txs[addr] = append(txs[addr], pending.Flatten()...)
+		}
+		if queued := pool.queue[addr]; queued != nil {
+			txs[addr] = append(txs[addr], queued.Flatten()...)
+		}
+	}
+	return txs
+}
+
 // validateTx checks whether a transaction is valid according to the consensus
 // rules and adheres to some heuristic limits of the local node (price and size).
 func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
@@ -320,11 +598,31 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	if tx.Value().Sign() < 0 {
 		return ErrNegativeValue
 	}
-	// Make sure the transaction is signed properly
-	from, err := types.Sender(pool.signer, tx)
+	for _, call := range tx.Calls() {
+		if call.Value.Sign() < 0 {
+			return ErrNegativeValue
+		}
+	}
+	// Make sure the transaction is signed properly, both by the sender and if
+	// sponsored, by the sponsor sequencing and paying for it
+	sender, err := types.Sender(pool.signer, tx)
 	if err != nil {
 		return ErrInvalidSender
 	}
+	from, err := types.Payer(pool.signer, tx)
+	if err != nil {
+		return ErrInvalidSponsor
+	}
+	if tx.Sponsored() && tx.To() == nil && !tx.Batch() {
+		return ErrSponsoredCreation
+	}
+	// Ensure the transaction may still be included in the upcoming blocks, but
+	// keep ones not yet valid around until their window opens
+	if number := pool.pendingNumber(); number != nil {
+		if err := ValidateTxWindow(pool.pendingRules(number), tx, number); err != nil && err != ErrTxNotYetValid {
+			return err
+		}
+	}
 
 	// Ensure the transaction adheres to nonce ordering
 	currentState, err := pool.currentState()
@@ -334,10 +632,257 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	if currentState.GetNonce(from) > tx.Nonce() {
 		return ErrNonceTooLow
 	}
+	// Ensure the transaction passes the admission filters, evaluated against the
+	// same state the block validator uses for the next block
+	if pool.filter != nil {
+		if err := pool.filter.FilterTx(sender, tx, currentState); err != nil {
+			return err
+		}
+	}
 
-	if currentState.GetBalance(from).Cmp(tx.Cost()) < 0 {
+	balance, cost := currentState.GetBalance(from), tx.Cost()
+	if balance.Cmp(cost) < 0 {
 		return ErrInsufficientFunds
 	}
+	if balance.Cmp(cost.Add(cost, pool.txFee(tx))) < 0 {
+		return ErrInsufficientFee
+	}
+	if tx.Sponsored() && currentState.GetBalance(sender).Cmp(tx.TotalValue()) < 0 {
+		return ErrInsufficientFunds
+	}
+	// Local accounts are exempt from the fair-share admission rules
+	if local || pool.locals.contains(from) {
+		return nil
+	}
+	// Ensure the sender doesn't exceed its admission rate
+	if rate := pool.rates[from]; rate != nil && pool.config.AccountRate > 0 {
+		if time.Since(rate.start) < pool.config.RateWindow && rate.count >= pool.config.AccountRate {
+			ratelimitTxCounter.Inc(1)
+			return ErrRateLimited
+		}
+	}
+	// Replacements (always by the same sender as nonces are per account) are only
+	// allowed after the previous transaction had some time to propagate
+	for _, list := range []*txList{pool.pending[from], pool.queue[from]} {
+		if list == nil {
+			continue
+		}
+		if old := list.txs.Get(tx.Nonce()); old != nil && time.Since(pool.arrivals[old.Hash()]) < pool.config.ReplaceDelay {
+			return ErrReplaceTooSoon
+		}
+	}
+	// Ensure the transaction executes successfully on top of the pending state
+	if pool.config.Simulate && pool.chain != nil {
+		if err := pool.simulate(from, tx); err != nil {
+			simfailTxCounter.Inc(1)
+			return err
+		}
+	}
+	return nil
+}
+
+// presimulate executes the remote transactions of a batch that weren't simulated
+// yet on a copy of the pending state, caching the results for the admission
+// checks. Only the state snapshot is taken under the pool lock, the transactions
+// themselves run without it so the pool isn't blocked for the simulation budget.
+// Results are discarded if the pool was reset to a new head in the meantime.
+func (pool *TxPool) presimulate(txs []*types.Transaction) {
+	if !pool.config.Simulate {
+		return
+	}
+	// Derive the payers up front, invalid ones are rejected by the admission checks
+	var (
+		payers  = make(map[common.Hash]common.Address, len(txs))
+		batches = make(map[common.Address]map[uint64]*types.Transaction)
+	)
+	for _, tx := range txs {
+		if from, err := types.Payer(pool.signer, tx); err == nil {
+			payers[tx.Hash()] = from
+			if batches[from] == nil {
+				batches[from] = make(map[uint64]*types.Transaction)
+			}
+			batches[from][tx.Nonce()] = tx
+		}
+	}
+	// Snapshot the pending state along with the transactions needing a run
+	pool.mu.Lock()
+	if pool.chain == nil {
+		pool.mu.Unlock()
+		return
+	}
+	var (
+		chain = pool.chain
+		epoch = pool.simepoch
+		fails = make(map[common.Address]uint64)
+		queue []*types.Transaction
+		preds = make(map[common.Hash]types.Transactions)
+	)
+	for _, tx := range txs {
+		hash := tx.Hash()
+		from, ok := payers[hash]
+		if !ok || pool.all[hash] != nil || pool.locals.contains(from) {
+			continue
+		}
+		if _, ok := pool.simulated[hash]; ok {
+			continue
+		}
+		if _, ok := fails[from]; !ok {
+			if window := pool.simfails[from]; window != nil && time.Since(window.start) < pool.config.RateWindow {
+				fails[from] = window.count
+			} else {
+				fails[from] = 0
+			}
+		}
+		queue = append(queue, tx)
+		preds[hash] = pool.predecessors(from, tx.Nonce(), batches[from])
+	}
+	if len(queue) == 0 {
+		pool.mu.Unlock()
+		return
+	}
+	statedb := pool.pendingState.StateDB.Copy()
+	pool.mu.Unlock()
+
+	// Execute the transactions without holding the lock, skipping senders over quota
+	results := make(map[common.Hash]error, len(queue))
+	for _, tx := range queue {
+		hash, from := tx.Hash(), payers[tx.Hash()]
+		if _, ok := results[hash]; ok {
+			continue
+		}
+		if pool.config.SimulationQuota > 0 && fails[from] >= pool.config.SimulationQuota {
+			continue
+		}
+		err := pool.execute(chain, from, preds[hash], tx, statedb)
+		if err != nil {
+			fails[from]++
+		}
+		results[hash] = err
+	}
+	// Cache the results unless they were computed on an outdated pending state
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if pool.simepoch != epoch {
+		return
+	}
+	for hash, err := range results {
+		pool.recordSimulation(payers[hash], hash, err)
+	}
+}
+
+// simulate checks whether a remote transaction executes successfully on a
+// throwaway copy of the pending state in the context of the next block, rejecting
+// it if it fails or exceeds the simulation budget. Results are cached until the
+// next chain head, and senders with too many failed simulations are refused
+// without executing anything. Transactions are normally simulated by presimulate
+// before the pool lock is taken, executing here is only a fallback.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) simulate(from common.Address, tx *types.Transaction) error {
+	hash := tx.Hash()
+	if err, ok := pool.simulated[hash]; ok {
+		return err
+	}
+	fails := pool.simfails[from]
+	if fails != nil && time.Since(fails.start) >= pool.config.RateWindow {
+		delete(pool.simfails, from)
+		fails = nil
+	}
+	if fails != nil && pool.config.SimulationQuota > 0 && fails.count >= pool.config.SimulationQuota {
+		return ErrSimulationQuota
+	}
+	err := pool.execute(pool.chain, from, pool.predecessors(from, tx.Nonce(), nil), tx, pool.pendingState.StateDB)
+	pool.recordSimulation(from, hash, err)
+
+	return err
+}
+
+// recordSimulation caches the simulation result of a transaction and charges a
+// failure against the quota of its sender.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) recordSimulation(from common.Address, hash common.Hash, err error) {
+	if len(pool.simulated) >= simulationCacheLimit {
+		pool.simulated = make(map[common.Hash]error)
+	}
+	pool.simulated[hash] = err
+
+	if err == nil {
+		return
+	}
+	now := time.Now()
+
+	fails := pool.simfails[from]
+	if fails == nil || now.Sub(fails.start) >= pool.config.RateWindow {
+		fails = &rateWindow{start: now}
+		pool.simfails[from] = fails
+	}
+	fails.count++
+}
+
+// predecessors gathers the consecutive transactions of a payer preceding the
+// given nonce, in nonce order, looking them up in the pool and the optional batch
+// being added. Gathering stops at the first nonce gap.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) predecessors(from common.Address, nonce uint64, batch map[uint64]*types.Transaction) types.Transactions {
+	var txs types.Transactions
+	for prev := nonce; prev > 0; prev-- {
+		var tx *types.Transaction
+		for _, list := range []*txList{pool.pending[from], pool.queue[from]} {
+			if tx == nil && list != nil {
+				tx = list.txs.Get(prev - 1)
+			}
+		}
+		if tx == nil {
+			tx = batch[prev-1]
+		}
+		if tx == nil {
+			break
+		}
+		txs = append(types.Transactions{tx}, txs...)
+	}
+	return txs
+}
+
+// execute runs a transaction on a copy of the given state on top of the current
+// head, after running the preceding transactions of its payer so that dependent
+// transactions see their effects. Failures of the predecessors are not charged
+// against the transaction.
+func (pool *TxPool) execute(chain TxPoolChain, from common.Address, preds types.Transactions, tx *types.Transaction, statedb *state.StateDB) error {
+	head := chain.CurrentBlock()
+
+	timestamp := new(big.Int).SetInt64(time.Now().Unix())
+	if timestamp.Cmp(head.Time()) <= 0 {
+		timestamp = new(big.Int).Add(head.Time(), common.Big1)
+	}
+	header := &types.Header{
+		ParentHash: head.Hash(),
+		Number:     new(big.Int).Add(head.Number(), common.Big1),
+		Time:       timestamp,
+		Difficulty: head.Difficulty(),
+	}
+	statedb = statedb.Copy()
+	config := vm.Config{StepLimit: pool.config.SimulationSteps}
+
+	for i, pred := range preds {
+		statedb.SetNonce(from, pred.Nonce())
+		statedb.Prepare(pred.Hash(), common.Hash{}, i)
+		ApplyTransaction(pool.chainconfig, chain, &common.Address{}, new(GasPool), statedb, header, pred, config)
+	}
+	statedb.SetNonce(from, tx.Nonce())
+	statedb.Prepare(tx.Hash(), common.Hash{}, len(preds))
+
+	receipt, _, err := ApplyTransaction(pool.chainconfig, chain, &common.Address{}, new(GasPool), statedb, header, tx, config)
+	switch {
+	case err == vm.ErrStepLimitReached:
+		return ErrSimulationBudget
+	case err != nil:
+		return err
+	case receipt.Status == types.ReceiptStatusFailed:
+		return ErrSimulationReverted
+	}
 	return nil
 }
 
@@ -354,7 +899,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 	hash := tx.Hash()
 	if pool.all[hash] != nil {
 		log.Trace("Discarding already known transaction", "hash", hash)
-		return false, fmt.Errorf("known transaction: %x", hash)
+		return false, ErrKnownTransaction
 	}
 	// If the transaction fails basic validation, discard it
 	if err := pool.validateTx(tx, local); err != nil {
@@ -363,16 +908,21 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 		return false, err
 	}
 	// If the transaction is replacing an already pending one, do directly
-	from, _ := types.Sender(pool.signer, tx) // already validated
+	from, _ := types.Payer(pool.signer, tx) // already validated
 	if list := pool.pending[from]; list != nil && list.Overlaps(tx) {
 		// Nonce already pending, check if required price bump is met
 		old := list.Add(tx)
 		// New transaction is better, replace old one
 		if old != nil {
-			delete(pool.all, old.Hash())
+			pool.supersede(old, tx)
 			pendingReplaceCounter.Inc(1)
 		}
-		pool.all[tx.Hash()] = tx
+		pool.track(hash, tx)
+		pool.admitTx(from, tx, local)
+		pool.journalTx(from, tx)
+
+		pool.notify(TxAdded, tx, "")
+		pool.notify(TxPromoted, tx, "")
 
 		log.Trace("Pooled new executable transaction", "hash", hash, "from", from, "to", tx.To())
 		return old != nil, nil
@@ -385,6 +935,10 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 	if local {
 		pool.locals.add(from)
 	}
+	pool.admitTx(from, tx, local)
+	pool.journalTx(from, tx)
+	pool.notify(TxAdded, tx, "")
+
 	log.Trace("Pooled new future transaction", "hash", hash, "from", from, "to", tx.To())
 	return replace, nil
 }
@@ -394,20 +948,128 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 // Note, this method assumes the pool lock is held!
 func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction) (bool, error) {
 	// Try to insert the transaction into the future queue
-	from, _ := types.Sender(pool.signer, tx) // already validated
+	from, _ := types.Payer(pool.signer, tx) // already validated
 	if pool.queue[from] == nil {
 		pool.queue[from] = newTxList(false)
 	}
 	old := pool.queue[from].Add(tx)
 	// Discard any previous transaction and mark this
 	if old != nil {
-		delete(pool.all, old.Hash())
+		pool.supersede(old, tx)
 		queuedReplaceCounter.Inc(1)
 	}
-	pool.all[hash] = tx
+	pool.track(hash, tx)
 	return old != nil, nil
 }
 
+// admitTx records the admission time of a newly accepted transaction and charges
+// it against the rate allowance of its sender, unless the sender is local.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) admitTx(from common.Address, tx *types.Transaction, local bool) {
+	now := time.Now()
+	pool.arrivals[tx.Hash()] = now
+
+	if pool.config.AccountRate == 0 || local || pool.locals.contains(from) {
+		return
+	}
+	rate := pool.rates[from]
+	if rate == nil || now.Sub(rate.start) >= pool.config.RateWindow {
+		rate = &rateWindow{start: now}
+		pool.rates[from] = rate
+	}
+	rate.count++
+}
+
+// track inserts a transaction into the global lookup table of the pool, charging
+// its size against the pool's memory allowance if it wasn't known yet.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) track(hash common.Hash, tx *types.Transaction) {
+	if pool.all[hash] == nil {
+		pool.allBytes += uint64(tx.Size())
+	}
+	pool.all[hash] = tx
+}
+
+// forget removes a transaction from the global lookup tables of the pool. The
+// caller is responsible for removing it from the pending or queued lists.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) forget(hash common.Hash) {
+	if tx := pool.all[hash]; tx != nil {
+		pool.allBytes -= uint64(tx.Size())
+		delete(pool.all, hash)
+	}
+	delete(pool.arrivals, hash)
+}
+
+// drop forgets about a transaction removed from the pool and reports it with
+// the given reason. Stale transactions included in a recently announced block
+// are reported as included instead.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) drop(tx *types.Transaction, reason string) {
+	hash := tx.Hash()
+	pool.forget(hash)
+
+	if block, ok := pool.mined[hash]; ok && reason == TxDropStale {
+		ev := pool.newEvent(TxIncluded, tx)
+		ev.Block = &block
+		pool.history.record(ev)
+		return
+	}
+	ev := pool.newEvent(TxDropped, tx)
+	ev.Reason = reason
+	pool.history.record(ev)
+}
+
+// supersede forgets about a transaction replaced by another one with the same
+// nonce and reports the replacement.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) supersede(old *types.Transaction, tx *types.Transaction) {
+	pool.forget(old.Hash())
+
+	replacement := tx.Hash()
+	ev := pool.newEvent(TxReplaced, old)
+	ev.Replacement = &replacement
+	pool.history.record(ev)
+}
+
+// notify reports a lifecycle change of a pooled transaction.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) notify(kind TxPoolEventKind, tx *types.Transaction, reason string) {
+	ev := pool.newEvent(kind, tx)
+	ev.Reason = reason
+	pool.history.record(ev)
+}
+
+// newEvent assembles a pool event of the given kind for a transaction.
+func (pool *TxPool) newEvent(kind TxPoolEventKind, tx *types.Transaction) *TxPoolEvent {
+	from, _ := types.Payer(pool.signer, tx) // already validated
+	return &TxPoolEvent{
+		Kind:  kind,
+		Hash:  tx.Hash(),
+		From:  from,
+		Nonce: tx.Nonce(),
+		Time:  time.Now(),
+	}
+}
+
+// journalTx adds the specified transaction to the local disk journal if it is
+// deemed to have been sent from a local account.
+func (pool *TxPool) journalTx(from common.Address, tx *types.Transaction) {
+	// Only journal if it's enabled and the transaction is local
+	if pool.journal == nil || !pool.locals.contains(from) {
+		return
+	}
+	if err := pool.journal.insert(tx); err != nil {
+		log.Warn("Failed to journal local transaction", "err", err)
+	}
+}
+
 // promoteTx adds a transaction to the pending (processable) list of transactions.
 //
 // Note, this method assumes the pool lock is held!
@@ -420,16 +1082,15 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 
 	old := list.Add(tx)
 	if old != nil {
-		delete(pool.all, old.Hash())
+		pool.supersede(old, tx)
 		pendingReplaceCounter.Inc(1)
 	}
 	// Failsafe to work around direct pending inserts (tests)
-	if pool.all[hash] == nil {
-		pool.all[hash] = tx
-	}
+	pool.track(hash, tx)
 	// Set the potentially new pending nonce and notify any subsystems of the new tx
 	pool.beats[addr] = time.Now()
 	pool.pendingState.SetNonce(addr, tx.Nonce()+1)
+	pool.notify(TxPromoted, tx, "")
 	go pool.eventMux.Post(TxPreEvent{tx})
 }
 
@@ -449,20 +1110,25 @@ func (pool *TxPool) AddRemote(tx *types.Transaction) error {
 
 // AddLocals enqueues a batch of transactions into the pool if they are valid,
 // marking the senders as a local ones in the mean time, ensuring they go around
-// the local pricing constraints.
-func (pool *TxPool) AddLocals(txs []*types.Transaction) error {
+// the local pricing constraints. The returned errors correspond to the input
+// transactions, nil for the accepted ones.
+func (pool *TxPool) AddLocals(txs []*types.Transaction) []error {
 	return pool.addTxs(txs, !pool.config.NoLocals)
 }
 
 // AddRemotes enqueues a batch of transactions into the pool if they are valid.
 // If the senders are not among the locally tracked ones, full pricing constraints
-// will apply.
-func (pool *TxPool) AddRemotes(txs []*types.Transaction) error {
+// will apply. The returned errors correspond to the input transactions, nil for
+// the accepted ones.
+func (pool *TxPool) AddRemotes(txs []*types.Transaction) []error {
 	return pool.addTxs(txs, false)
 }
 
 // addTx enqueues a single transaction into the pool if it is valid.
 func (pool *TxPool) addTx(tx *types.Transaction, local bool) error {
+	if !local {
+		pool.presimulate([]*types.Transaction{tx})
+	}
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
@@ -477,23 +1143,29 @@ func (pool *TxPool) addTx(tx *types.Transaction, local bool) error {
 		if err != nil {
 			return err
 		}
-		from, _ := types.Sender(pool.signer, tx) // already validated
+		from, _ := types.Payer(pool.signer, tx) // already validated
 		pool.promoteExecutables(state, []common.Address{from})
 	}
 	return nil
 }
 
-// addTxs attempts to queue a batch of transactions if they are valid.
-func (pool *TxPool) addTxs(txs []*types.Transaction, local bool) error {
+// addTxs attempts to queue a batch of transactions if they are valid, returning
+// the individual errors of the rejected ones.
+func (pool *TxPool) addTxs(txs []*types.Transaction, local bool) []error {
+	if !local {
+		pool.presimulate(txs)
+	}
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
 	// Add the batch of transaction, tracking the accepted ones
 	dirty := make(map[common.Address]struct{})
-	for _, tx := range txs {
-		if replace, err := pool.add(tx, local); err == nil {
+	errs := make([]error, len(txs))
+	for i, tx := range txs {
+		var replace bool
+		if replace, errs[i] = pool.add(tx, local); errs[i] == nil {
 			if !replace {
-				from, _ := types.Sender(pool.signer, tx) // already validated
+				from, _ := types.Payer(pool.signer, tx) // already validated
 				dirty[from] = struct{}{}
 			}
 		}
@@ -502,7 +1174,8 @@ func (pool *TxPool) addTxs(txs []*types.Transaction, local bool) error {
 	if len(dirty) > 0 {
 		state, err := pool.currentState()
 		if err != nil {
-			return err
+			log.Error("Failed to retrieve pending state", "err", err)
+			return errs
 		}
 		addrs := make([]common.Address, 0, len(dirty))
 		for addr, _ := range dirty {
@@ -510,7 +1183,7 @@ func (pool *TxPool) addTxs(txs []*types.Transaction, local bool) error {
 		}
 		pool.promoteExecutables(state, addrs)
 	}
-	return nil
+	return errs
 }
 
 // Get returns a transaction if it is contained in the pool
@@ -522,12 +1195,49 @@ func (pool *TxPool) Get(hash common.Hash) *types.Transaction {
 	return pool.all[hash]
 }
 
+// Arrivals retrieves the time each of the given transactions was admitted into
+// the pool. Transactions not pooled any more are omitted from the result.
+func (pool *TxPool) Arrivals(txs map[common.Address]types.Transactions) map[common.Hash]time.Time {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	arrivals := make(map[common.Hash]time.Time)
+	for _, list := range txs {
+		for _, tx := range list {
+			hash := tx.Hash()
+			if arrival, ok := pool.arrivals[hash]; ok {
+				arrivals[hash] = arrival
+			}
+		}
+	}
+	return arrivals
+}
+
+// Locals retrieves the accounts currently considered local by the pool.
+func (pool *TxPool) Locals() []common.Address {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	locals := make([]common.Address, 0, len(pool.locals.accounts))
+	for addr := range pool.locals.accounts {
+		locals = append(locals, addr)
+	}
+	return locals
+}
+
+// History retrieves the recently recorded lifecycle events of a transaction,
+// oldest first. Events are retained even after the transaction left the pool,
+// but only for a limited number of recently seen transactions.
+func (pool *TxPool) History(hash common.Hash) []*TxPoolEvent {
+	return pool.history.get(hash)
+}
+
 // Remove removes the transaction with the given hash from the pool.
 func (pool *TxPool) Remove(hash common.Hash) {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
-	pool.removeTx(hash)
+	pool.removeTx(hash, TxDropRemoved)
 }
 
 // RemoveBatch removes all given transactions from the pool.
@@ -536,35 +1246,35 @@ func (pool *TxPool) RemoveBatch(txs types.Transactions) {
 	defer pool.mu.Unlock()
 
 	for _, tx := range txs {
-		pool.removeTx(tx.Hash())
+		pool.removeTx(tx.Hash(), TxDropRemoved)
 	}
 }
 
 // removeTx removes a single transaction from the queue, moving all subsequent
-// transactions back to the future queue.
-func (pool *TxPool) removeTx(hash common.Hash) {
+// transactions back to the future queue. The removal is reported with the given
+// drop reason.
+func (pool *TxPool) removeTx(hash common.Hash, reason string) {
 	// Fetch the transaction we wish to delete
 	tx, ok := pool.all[hash]
 	if !ok {
 		return
 	}
-	addr, _ := types.Sender(pool.signer, tx) // already validated during insertion
+	addr, _ := types.Payer(pool.signer, tx) // already validated during insertion
 
 	// Remove it from the list of known transactions
-	delete(pool.all, hash)
+	pool.drop(tx, reason)
 
 	// Remove the transaction from the pending lists and reset the account nonce
 	if pending := pool.pending[addr]; pending != nil {
 		if removed, invalids := pending.Remove(tx); removed {
-			// If no more transactions are left, remove the list
+			// If no more pending transactions are left, remove the list
 			if pending.Empty() {
 				delete(pool.pending, addr)
 				delete(pool.beats, addr)
-			} else {
-				// Otherwise postpone any invalidated transactions
-				for _, tx := range invalids {
-					pool.enqueueTx(tx.Hash(), tx)
-				}
+			}
+			// Postpone any invalidated transactions
+			for _, tx := range invalids {
+				pool.enqueueTx(tx.Hash(), tx)
 			}
 			// Update the account nonce if needed
 			if nonce := tx.Nonce(); pool.pendingState.GetNonce(addr) > nonce {
@@ -603,14 +1313,14 @@ func (pool *TxPool) promoteExecutables(state *state.StateDB, accounts []common.A
 		for _, tx := range list.Forward(state.GetNonce(addr)) {
 			hash := tx.Hash()
 			log.Trace("Removed old queued transaction", "hash", hash)
-			delete(pool.all, hash)
+			pool.drop(tx, TxDropStale)
 		}
 		// Drop all transactions that are too costly (low balance or out of gas)
 		drops, _ := list.Filter(state.GetBalance(addr))
 		for _, tx := range drops {
 			hash := tx.Hash()
 			log.Trace("Removed unpayable queued transaction", "hash", hash)
-			delete(pool.all, hash)
+			pool.drop(tx, TxDropUnpayable)
 			queuedNofundsCounter.Inc(1)
 		}
 		// Gather all executable transactions and promote them
@@ -623,7 +1333,7 @@ func (pool *TxPool) promoteExecutables(state *state.StateDB, accounts []common.A
 		if !pool.locals.contains(addr) {
 			for _, tx := range list.Cap(int(pool.config.AccountQueue)) {
 				hash := tx.Hash()
-				delete(pool.all, hash)
+				pool.drop(tx, TxDropAccount)
 				queuedRateLimitCounter.Inc(1)
 				log.Trace("Removed cap-exceeding queued transaction", "hash", hash)
 			}
@@ -667,7 +1377,7 @@ func (pool *TxPool) promoteExecutables(state *state.StateDB, accounts []common.A
 						for _, tx := range list.Cap(list.Len() - 1) {
 							// Drop the transaction from the global pools too
 							hash := tx.Hash()
-							delete(pool.all, hash)
+							pool.drop(tx, TxDropFairness)
 
 							// Update the account nonce to the dropped transaction
 							if nonce := tx.Nonce(); pool.pendingState.GetNonce(offenders[i]) > nonce {
@@ -688,7 +1398,7 @@ func (pool *TxPool) promoteExecutables(state *state.StateDB, accounts []common.A
 					for _, tx := range list.Cap(list.Len() - 1) {
 						// Drop the transaction from the global pools too
 						hash := tx.Hash()
-						delete(pool.all, hash)
+						pool.drop(tx, TxDropFairness)
 
 						// Update the account nonce to the dropped transaction
 						if nonce := tx.Nonce(); pool.pendingState.GetNonce(addr) > nonce {
@@ -727,7 +1437,7 @@ func (pool *TxPool) promoteExecutables(state *state.StateDB, accounts []common.A
 			// Drop all transactions if they are less than the overflow
 			if size := uint64(list.Len()); size <= drop {
 				for _, tx := range list.Flatten() {
-					pool.removeTx(tx.Hash())
+					pool.removeTx(tx.Hash(), TxDropQueue)
 				}
 				drop -= size
 				queuedRateLimitCounter.Inc(int64(size))
@@ -736,12 +1446,69 @@ func (pool *TxPool) promoteExecutables(state *state.StateDB, accounts []common.A
 			// Otherwise drop only last few transactions
 			txs := list.Flatten()
 			for i := len(txs) - 1; i >= 0 && drop > 0; i-- {
-				pool.removeTx(txs[i].Hash())
+				pool.removeTx(txs[i].Hash(), TxDropQueue)
 				drop--
 				queuedRateLimitCounter.Inc(1)
 			}
 		}
 	}
+	// If the pool outgrew its memory allowance, evict from the heaviest accounts
+	if pool.config.GlobalBytes > 0 {
+		pool.capBytes()
+	}
+}
+
+// capBytes drops transactions from the non-local accounts occupying the most
+// space until the total size of the pool fits into the configured byte limit.
+// The highest nonce transactions of an account are dropped first, draining the
+// future queue before touching any executable ones.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) capBytes() {
+	if pool.allBytes <= pool.config.GlobalBytes {
+		return
+	}
+	// Calculate the share of each non-local account from its pooled lists
+	usage := make(map[common.Address]uint64)
+	for _, lists := range []map[common.Address]*txList{pool.pending, pool.queue} {
+		for addr, list := range lists {
+			if pool.locals.contains(addr) {
+				continue
+			}
+			for _, tx := range list.txs.items {
+				usage[addr] += uint64(tx.Size())
+			}
+		}
+	}
+	// Assemble a spam order to penalize the largest accounts first
+	spammers := prque.New()
+	for addr, size := range usage {
+		spammers.Push(addr, float32(size))
+	}
+	for pool.allBytes > pool.config.GlobalBytes && !spammers.Empty() {
+		addr := spammers.PopItem().(common.Address)
+
+		var txs types.Transactions
+		if list := pool.queue[addr]; list != nil {
+			txs = list.Flatten()
+		} else if list := pool.pending[addr]; list != nil {
+			txs = list.Flatten()
+		}
+		if len(txs) == 0 {
+			continue
+		}
+		// Drop the last transaction and requeue the account if it has any left
+		tx := txs[len(txs)-1]
+		size := uint64(tx.Size())
+
+		pool.removeTx(tx.Hash(), TxDropSize)
+		evictedTxCounter.Inc(1)
+		log.Trace("Removed size-exceeding transaction", "hash", tx.Hash(), "size", size)
+
+		if usage[addr] -= size; usage[addr] > 0 {
+			spammers.Push(addr, float32(usage[addr]))
+		}
+	}
 }
 
 // demoteUnexecutables removes invalid and processed transactions from the pools
@@ -756,7 +1523,7 @@ func (pool *TxPool) demoteUnexecutables(state *state.StateDB) {
 		for _, tx := range list.Forward(nonce) {
 			hash := tx.Hash()
 			log.Trace("Removed old pending transaction", "hash", hash)
-			delete(pool.all, hash)
+			pool.drop(tx, TxDropStale)
 		}
 
 		// Drop all transactions that are too costly (low balance or out of gas), and queue any invalids back for later
@@ -764,7 +1531,7 @@ func (pool *TxPool) demoteUnexecutables(state *state.StateDB) {
 		for _, tx := range drops {
 			hash := tx.Hash()
 			log.Trace("Removed unpayable pending transaction", "hash", hash)
-			delete(pool.all, hash)
+			pool.drop(tx, TxDropUnpayable)
 			pendingNofundsCounter.Inc(1)
 		}
 		for _, tx := range invalids {
@@ -801,10 +1568,21 @@ func (pool *TxPool) expirationLoop() {
 				// Any non-locals old enough should be removed
 				if time.Since(pool.beats[addr]) > pool.config.Lifetime {
 					for _, tx := range pool.queue[addr].Flatten() {
-						pool.removeTx(tx.Hash())
+						pool.removeTx(tx.Hash(), TxDropExpired)
 					}
 				}
 			}
+			// Forget about any rate windows that already elapsed
+			for addr, rate := range pool.rates {
+				if time.Since(rate.start) >= pool.config.RateWindow {
+					delete(pool.rates, addr)
+				}
+			}
+			for addr, fails := range pool.simfails {
+				if time.Since(fails.start) >= pool.config.RateWindow {
+					delete(pool.simfails, addr)
+				}
+			}
 			pool.mu.Unlock()
 
 		case <-pool.quit:
@@ -825,6 +1603,13 @@ func (a addresssByHeartbeat) Len() int           { return len(a) }
 func (a addresssByHeartbeat) Less(i, j int) bool { return a[i].heartbeat.Before(a[j].heartbeat) }
 func (a addresssByHeartbeat) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 
+// rateWindow tracks the number of transactions accepted from an account since
+// the start of its current rate limiting window.
+type rateWindow struct {
+	start time.Time // Time the current window was opened
+	count uint64    // Number of transactions accepted within the window
+}
+
 // accountSet is simply a set of addresses to check for existance, and a signer
 // capable of deriving addresses from transactions.
 type accountSet struct {
@@ -847,10 +1632,10 @@ func (as *accountSet) contains(addr common.Address) bool {
 	return exist
 }
 
-// containsTx checks if the sender of a given tx is within the set. If the sender
-// cannot be derived, this method returns false.
+// containsTx checks if the payer (i.e. sender or sponsor) of a given tx is within
+// the set. If the payer cannot be derived, this method returns false.
 func (as *accountSet) containsTx(tx *types.Transaction) bool {
-	if addr, err := types.Sender(as.signer, tx); err == nil {
+	if addr, err := types.Payer(as.signer, tx); err == nil {
 		return as.contains(addr)
 	}
 	return false
@@ -19,22 +19,38 @@ package core
 import (
 	"crypto/ecdsa"
 	"fmt"
+	"io/ioutil"
 	"math/big"
 	"math/rand"
+	"os"
 	"testing"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/params"
 )
 
+// testTxPoolConfig is a transaction pool configuration without stateful disk
+// sideeffects used during testing. The fair-share admission rules are disabled
+// so that the slot limits can be tested in isolation.
+var testTxPoolConfig TxPoolConfig
+
+func init() {
+	testTxPoolConfig = DefaultTxPoolConfig
+	testTxPoolConfig.Journal = ""
+	testTxPoolConfig.AccountRate = 0
+	testTxPoolConfig.ReplaceDelay = 0
+}
+
 func transaction(nonce uint64, amount *big.Int, key *ecdsa.PrivateKey) *types.Transaction {
-	tx, _ := types.SignTx(types.NewTransaction(nonce, common.Address{}, amount, big.NewInt(0), big.NewInt(0), nil), types.HomesteadSigner{}, key)
+	tx, _ := types.SignTx(types.NewTransaction(nonce, common.Address{}, amount, nil), types.HomesteadSigner{}, key)
 	return tx
 }
 
@@ -43,7 +59,7 @@ func setupTxPool() (*TxPool, *ecdsa.PrivateKey) {
 	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
 
 	key, _ := crypto.GenerateKey()
-	pool := NewTxPool(DefaultTxPoolConfig, params.TestChainConfig, new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil })
+	pool := NewTxPool(testTxPoolConfig, params.TestChainConfig, new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil })
 	pool.resetState()
 
 	return pool, key
@@ -59,6 +75,14 @@ func validateTxPoolInternals(pool *TxPool) error {
 	if total := len(pool.all); total != pending+queued {
 		return fmt.Errorf("total transaction count %d != %d pending + %d queued", total, pending, queued)
 	}
+	// Ensure the tracked pool size matches the transactions contained
+	size := uint64(0)
+	for _, tx := range pool.all {
+		size += uint64(tx.Size())
+	}
+	if size != pool.allBytes {
+		return fmt.Errorf("total transaction size %d != %d tracked", size, pool.allBytes)
+	}
 
 	// Ensure the next nonce to assign is the correct one
 	for addr, txs := range pool.pending {
@@ -117,7 +141,7 @@ func TestStateChangeDuringPoolReset(t *testing.T) {
 		return stdb, nil
 	}
 
-	pool := NewTxPool(DefaultTxPoolConfig, params.TestChainConfig, mux, stateFunc)
+	pool := NewTxPool(testTxPoolConfig, params.TestChainConfig, mux, stateFunc)
 	defer pool.Stop()
 	pool.resetState()
 
@@ -297,8 +321,8 @@ func TestTransactionDoubleNonce(t *testing.T) {
 	resetState()
 
 	signer := types.HomesteadSigner{}
-	tx1, _ := types.SignTx(types.NewTransaction(0, common.Address{}, big.NewInt(100), big.NewInt(100000), big.NewInt(1), nil), signer, key)
-	tx2, _ := types.SignTx(types.NewTransaction(0, common.Address{}, big.NewInt(100), big.NewInt(1000000), big.NewInt(2), nil), signer, key)
+	tx1, _ := types.SignTx(types.NewTransaction(0, common.Address{}, big.NewInt(100), nil), signer, key)
+	tx2, _ := types.SignTx(types.NewTransaction(0, common.Address{}, big.NewInt(200), nil), signer, key)
 
 	// Add the first two transaction, ensure higher priced stays only
 	if replace, err := pool.add(tx1, false); err != nil || replace {
@@ -461,6 +485,44 @@ func TestTransactionDropping(t *testing.T) {
 	}
 }
 
+// Tests that removing the first pending transaction of an account postpones its
+// now gapped successors into the future queue, even if no executable ones remain,
+// instead of leaking them in the lookup table.
+func TestTransactionRemovalPostponing(t *testing.T) {
+	// Create a test account and fund it
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	account, _ := deriveSender(transaction(0, big.NewInt(0), key))
+
+	state, _ := pool.currentState()
+	state.AddBalance(account, big.NewInt(1000))
+
+	// Add a few pending transactions and remove the first one
+	txs := types.Transactions{
+		transaction(0, big.NewInt(100), key),
+		transaction(1, big.NewInt(100), key),
+		transaction(2, big.NewInt(100), key),
+	}
+	for _, tx := range txs {
+		pool.promoteTx(account, tx.Hash(), tx)
+	}
+	pool.Remove(txs[0].Hash())
+
+	if _, ok := pool.pending[account]; ok {
+		t.Errorf("pending transactions left after removing the first one")
+	}
+	if queued := pool.queue[account]; queued == nil || queued.Len() != 2 {
+		t.Errorf("successors not postponed into the queue")
+	}
+	if len(pool.all) != 2 {
+		t.Errorf("total transaction mismatch: have %d, want %d", len(pool.all), 2)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
 // Tests that if a transaction is dropped from the current pending pool (e.g. out
 // of fund), all consecutive (still valid, but not executable) transactions are
 // postponed back into the future queue to prevent broadcasting them.
@@ -591,7 +653,7 @@ func testTransactionQueueGlobalLimiting(t *testing.T, nolocals bool) {
 	db, _ := ethdb.NewMemDatabase()
 	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
 
-	config := DefaultTxPoolConfig
+	config := testTxPoolConfig
 	config.NoLocals = nolocals
 	config.GlobalQueue = config.AccountQueue*3 - 1 // reduce the queue limits to shorten test time (-1 to make it non divisible)
 
@@ -684,7 +746,7 @@ func testTransactionQueueTimeLimiting(t *testing.T, nolocals bool) {
 	db, _ := ethdb.NewMemDatabase()
 	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
 
-	config := DefaultTxPoolConfig
+	config := testTxPoolConfig
 	config.Lifetime = 250 * time.Millisecond
 	config.NoLocals = nolocals
 
@@ -826,7 +888,7 @@ func TestTransactionPendingGlobalLimiting(t *testing.T) {
 	db, _ := ethdb.NewMemDatabase()
 	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
 
-	config := DefaultTxPoolConfig
+	config := testTxPoolConfig
 	config.GlobalSlots = config.AccountSlots * 10
 
 	pool := NewTxPool(config, params.TestChainConfig, new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil })
@@ -873,7 +935,7 @@ func TestTransactionCapClearsFromAll(t *testing.T) {
 	db, _ := ethdb.NewMemDatabase()
 	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
 
-	config := DefaultTxPoolConfig
+	config := testTxPoolConfig
 	config.AccountSlots = 2
 	config.AccountQueue = 2
 	config.GlobalSlots = 8
@@ -908,7 +970,7 @@ func TestTransactionPendingMinimumAllowance(t *testing.T) {
 	db, _ := ethdb.NewMemDatabase()
 	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
 
-	config := DefaultTxPoolConfig
+	config := testTxPoolConfig
 	config.GlobalSlots = 0
 
 	pool := NewTxPool(config, params.TestChainConfig, new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil })
@@ -947,6 +1009,726 @@ func TestTransactionPendingMinimumAllowance(t *testing.T) {
 	}
 }
 
+// Tests that local transactions are journaled to disk, but remote transactions
+// get discarded between restarts.
+func TestTransactionJournaling(t *testing.T)         { testTransactionJournaling(t, false) }
+func TestTransactionJournalingNoLocals(t *testing.T) { testTransactionJournaling(t, true) }
+
+func testTransactionJournaling(t *testing.T, nolocals bool) {
+	// Create a temporary file for the journal
+	file, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary journal: %v", err)
+	}
+	journal := file.Name()
+	defer os.Remove(journal)
+
+	// Clean up the temporary file, we only need the path for now
+	file.Close()
+	os.Remove(journal)
+
+	// Create the original pool to inject transaction into the journal
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	stateFn := func() (*state.StateDB, error) { return statedb, nil }
+
+	config := testTxPoolConfig
+	config.NoLocals = nolocals
+	config.Journal = journal
+	config.Rejournal = time.Second
+
+	pool := NewTxPool(config, params.TestChainConfig, new(event.TypeMux), stateFn)
+
+	// Create two test accounts to ensure remotes expire but locals do not
+	local, _ := crypto.GenerateKey()
+	remote, _ := crypto.GenerateKey()
+
+	statedb.SetBalance(crypto.PubkeyToAddress(local.PublicKey), big.NewInt(1000000000))
+	statedb.SetBalance(crypto.PubkeyToAddress(remote.PublicKey), big.NewInt(1000000000))
+
+	// Add three local and a remote transactions and ensure they are queued up
+	if err := pool.AddLocal(transaction(0, big.NewInt(1), local)); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	if err := pool.AddLocal(transaction(1, big.NewInt(1), local)); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	if err := pool.AddLocal(transaction(2, big.NewInt(1), local)); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	if err := pool.AddRemote(transaction(0, big.NewInt(1), remote)); err != nil {
+		t.Fatalf("failed to add remote transaction: %v", err)
+	}
+	pending, queued := pool.Stats()
+	if pending != 4 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 4)
+	}
+	if queued != 0 {
+		t.Fatalf("queued transactions mismatched: have %d, want %d", queued, 0)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+	// Terminate the old pool, bump the local nonce, create a new pool and ensure relevant transaction survive
+	pool.Stop()
+	statedb.SetNonce(crypto.PubkeyToAddress(local.PublicKey), 1)
+	pool = NewTxPool(config, params.TestChainConfig, new(event.TypeMux), stateFn)
+
+	pending, queued = pool.Stats()
+	if queued != 0 {
+		t.Fatalf("queued transactions mismatched: have %d, want %d", queued, 0)
+	}
+	if nolocals {
+		if pending != 0 {
+			t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 0)
+		}
+	} else {
+		if pending != 2 {
+			t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 2)
+		}
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+	// Bump the nonce temporarily and ensure the newly invalidated transaction is removed
+	statedb.SetNonce(crypto.PubkeyToAddress(local.PublicKey), 2)
+	pool.mu.Lock()
+	pool.resetState()
+	pool.mu.Unlock()
+	time.Sleep(2 * config.Rejournal)
+	pool.Stop()
+
+	statedb.SetNonce(crypto.PubkeyToAddress(local.PublicKey), 1)
+	pool = NewTxPool(config, params.TestChainConfig, new(event.TypeMux), stateFn)
+
+	pending, queued = pool.Stats()
+	if pending != 0 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 0)
+	}
+	if nolocals {
+		if queued != 0 {
+			t.Fatalf("queued transactions mismatched: have %d, want %d", queued, 0)
+		}
+	} else {
+		if queued != 1 {
+			t.Fatalf("queued transactions mismatched: have %d, want %d", queued, 1)
+		}
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+	pool.Stop()
+}
+
+// Tests that remote senders are rate limited within a rate window, whereas local
+// and explicitly whitelisted accounts are exempt from the limit.
+func TestTransactionRateLimiting(t *testing.T) {
+	// Create the pool to test the rate limiting with
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	remote, _ := crypto.GenerateKey()
+	local, _ := crypto.GenerateKey()
+	whitelisted, _ := crypto.GenerateKey()
+
+	config := testTxPoolConfig
+	config.AccountRate = 2
+	config.RateWindow = time.Hour
+	config.Locals = []common.Address{crypto.PubkeyToAddress(whitelisted.PublicKey)}
+
+	pool := NewTxPool(config, params.TestChainConfig, new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil })
+	defer pool.Stop()
+
+	for _, key := range []*ecdsa.PrivateKey{remote, local, whitelisted} {
+		statedb.SetBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000))
+	}
+	// Exhaust the rate allowance of the remote account and ensure it's enforced
+	for i := uint64(0); i < config.AccountRate; i++ {
+		if err := pool.AddRemote(transaction(i, big.NewInt(1), remote)); err != nil {
+			t.Fatalf("tx %d: failed to add remote transaction: %v", i, err)
+		}
+	}
+	if err := pool.AddRemote(transaction(config.AccountRate, big.NewInt(1), remote)); err != ErrRateLimited {
+		t.Fatalf("rate limit exceeding transaction error mismatch: have %v, want %v", err, ErrRateLimited)
+	}
+	// Ensure local and whitelisted accounts are not limited
+	for i := uint64(0); i < 2*config.AccountRate; i++ {
+		if err := pool.AddLocal(transaction(i, big.NewInt(1), local)); err != nil {
+			t.Fatalf("tx %d: failed to add local transaction: %v", i, err)
+		}
+		if err := pool.AddRemote(transaction(i, big.NewInt(1), whitelisted)); err != nil {
+			t.Fatalf("tx %d: failed to add whitelisted transaction: %v", i, err)
+		}
+	}
+	// Expire the rate window of the remote account and ensure it's accepted again
+	pool.mu.Lock()
+	pool.rates[crypto.PubkeyToAddress(remote.PublicKey)].start = time.Now().Add(-config.RateWindow)
+	pool.mu.Unlock()
+
+	if err := pool.AddRemote(transaction(config.AccountRate, big.NewInt(1), remote)); err != nil {
+		t.Fatalf("failed to add remote transaction after rate window: %v", err)
+	}
+	pending, queued := pool.Stats()
+	if want := int(5*config.AccountRate + 1); pending != want {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, want)
+	}
+	if queued != 0 {
+		t.Fatalf("queued transactions mismatched: have %d, want %d", queued, 0)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that remote transactions can only be replaced after they spent at least
+// the minimum replacement delay in the pool, whereas local ones at any time.
+func TestTransactionReplaceDelay(t *testing.T) {
+	// Create the pool to test the replacement rules with
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	config := testTxPoolConfig
+	config.ReplaceDelay = time.Hour
+
+	pool := NewTxPool(config, params.TestChainConfig, new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil })
+	defer pool.Stop()
+
+	remote, _ := crypto.GenerateKey()
+	local, _ := crypto.GenerateKey()
+
+	statedb.SetBalance(crypto.PubkeyToAddress(remote.PublicKey), big.NewInt(1000000))
+	statedb.SetBalance(crypto.PubkeyToAddress(local.PublicKey), big.NewInt(1000000))
+
+	// Add an executable and a future remote transaction and try to replace them
+	pending, queued := transaction(0, big.NewInt(100), remote), transaction(2, big.NewInt(100), remote)
+	for i, err := range pool.AddRemotes([]*types.Transaction{pending, queued}) {
+		if err != nil {
+			t.Fatalf("transaction %d: failed to add remote transaction: %v", i, err)
+		}
+	}
+	for _, tx := range []*types.Transaction{pending, queued} {
+		if err := pool.AddRemote(transaction(tx.Nonce(), big.NewInt(200), remote)); err != ErrReplaceTooSoon {
+			t.Fatalf("nonce %d: early replacement error mismatch: have %v, want %v", tx.Nonce(), err, ErrReplaceTooSoon)
+		}
+	}
+	// Age the original transactions and ensure they can be replaced
+	pool.mu.Lock()
+	for _, tx := range []*types.Transaction{pending, queued} {
+		pool.arrivals[tx.Hash()] = time.Now().Add(-config.ReplaceDelay)
+	}
+	pool.mu.Unlock()
+
+	for _, tx := range []*types.Transaction{pending, queued} {
+		replacement := transaction(tx.Nonce(), big.NewInt(200), remote)
+		if err := pool.AddRemote(replacement); err != nil {
+			t.Fatalf("nonce %d: failed to replace transaction: %v", tx.Nonce(), err)
+		}
+		if pool.Get(tx.Hash()) != nil || pool.Get(replacement.Hash()) == nil {
+			t.Fatalf("nonce %d: transaction not replaced", tx.Nonce())
+		}
+	}
+	// Ensure local transactions can be replaced right away
+	if err := pool.AddLocal(transaction(0, big.NewInt(100), local)); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	if err := pool.AddLocal(transaction(0, big.NewInt(200), local)); err != nil {
+		t.Fatalf("failed to replace local transaction: %v", err)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that if the pool exceeds its byte allowance, transactions are evicted
+// from the remote accounts occupying the most space, highest nonces first.
+func TestTransactionByteLimiting(t *testing.T) {
+	// Create the pool to test the byte limitation with
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	spammer, _ := crypto.GenerateKey()
+	remote, _ := crypto.GenerateKey()
+	local, _ := crypto.GenerateKey()
+
+	config := testTxPoolConfig
+	config.GlobalBytes = 8 * uint64(transaction(0, big.NewInt(1), spammer).Size())
+
+	pool := NewTxPool(config, params.TestChainConfig, new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil })
+	defer pool.Stop()
+
+	for _, key := range []*ecdsa.PrivateKey{spammer, remote, local} {
+		statedb.SetBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000))
+	}
+	// Fill the pool beyond its limit from a heavy, a light and a local account
+	for i := uint64(0); i < 2; i++ {
+		if err := pool.AddRemote(transaction(i, big.NewInt(1), remote)); err != nil {
+			t.Fatalf("tx %d: failed to add remote transaction: %v", i, err)
+		}
+		if err := pool.AddLocal(transaction(i, big.NewInt(1), local)); err != nil {
+			t.Fatalf("tx %d: failed to add local transaction: %v", i, err)
+		}
+	}
+	for i := uint64(0); i < 10; i++ {
+		if err := pool.AddRemote(transaction(i, big.NewInt(1), spammer)); err != nil {
+			t.Fatalf("tx %d: failed to add spammer transaction: %v", i, err)
+		}
+	}
+	// Ensure only the heavy account was trimmed and the pool fits into its limit
+	pool.mu.RLock()
+	size := uint64(0)
+	for _, tx := range pool.all {
+		size += uint64(tx.Size())
+	}
+	pending := make(map[common.Address]int)
+	for addr, list := range pool.pending {
+		pending[addr] = list.Len()
+	}
+	pool.mu.RUnlock()
+
+	if size > config.GlobalBytes {
+		t.Errorf("pool size overflow: have %d, want at most %d", size, config.GlobalBytes)
+	}
+	if have := pending[crypto.PubkeyToAddress(spammer.PublicKey)]; have >= 10 || have <= 2 {
+		t.Errorf("spammer pending transactions mismatch: have %d, want between 2 and 10", have)
+	}
+	for _, key := range []*ecdsa.PrivateKey{remote, local} {
+		if have := pending[crypto.PubkeyToAddress(key.PublicKey)]; have != 2 {
+			t.Errorf("account pending transactions mismatch: have %d, want %d", have, 2)
+		}
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that the admission filters reject transactions from unknown senders and
+// to forbidden recipients, both statically configured and via the on-chain
+// allowlist contract, surfacing typed errors.
+func TestTransactionFilters(t *testing.T) {
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	allowed, _ := crypto.GenerateKey()
+	unknown, _ := crypto.GenerateKey()
+	contract := common.Address{0xa1}
+	denied := common.Address{0xde}
+
+	statedb, _ := pool.currentState()
+	for _, key := range []*ecdsa.PrivateKey{key, allowed, unknown} {
+		statedb.SetBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000))
+	}
+	pool.SetTxFilter(NewTxFilter(TxFilterConfig{
+		AllowedSenders:    []common.Address{crypto.PubkeyToAddress(key.PublicKey), crypto.PubkeyToAddress(allowed.PublicKey)},
+		DeniedRecipients:  []common.Address{denied},
+		AllowlistContract: &contract,
+	}))
+	// Ensure unknown senders and forbidden recipients are rejected
+	if err, ok := pool.AddRemote(transaction(0, big.NewInt(1), unknown)).(*TxFilterError); !ok || err.Reason != ErrSenderNotAllowed {
+		t.Fatalf("unknown sender error mismatch: have %v, want %v", err, ErrSenderNotAllowed)
+	}
+	tx, _ := types.SignTx(types.NewTransaction(0, denied, big.NewInt(1), nil), types.HomesteadSigner{}, key)
+	if err, ok := pool.AddRemote(tx).(*TxFilterError); !ok || err.Reason != ErrRecipientNotAllowed {
+		t.Fatalf("forbidden recipient error mismatch: have %v, want %v", err, ErrRecipientNotAllowed)
+	}
+	// Ensure the allowlist contract is ignored until deployed
+	if err := pool.AddRemote(transaction(0, big.NewInt(1), key)); err != nil {
+		t.Fatalf("failed to add transaction before allowlist deployment: %v", err)
+	}
+	// Deploy the allowlist, permitting only one of the accounts, and check that
+	// pooled transactions of the other are dropped on the next reset
+	statedb.SetCode(contract, []byte{0x00})
+	statedb.SetState(contract, AllowlistSlot(crypto.PubkeyToAddress(allowed.PublicKey)), common.BytesToHash([]byte{0x01}))
+
+	pool.mu.Lock()
+	pool.resetState()
+	pool.mu.Unlock()
+
+	if pending, _ := pool.Stats(); pending != 0 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 0)
+	}
+	if err, ok := pool.AddRemote(transaction(0, big.NewInt(1), key)).(*TxFilterError); !ok || err.Reason != ErrSenderNotAllowed {
+		t.Fatalf("revoked sender error mismatch: have %v, want %v", err, ErrSenderNotAllowed)
+	}
+	if err := pool.AddRemote(transaction(0, big.NewInt(1), allowed)); err != nil {
+		t.Fatalf("failed to add allowlisted transaction: %v", err)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that the lifecycle events of pooled transactions are recorded in their
+// histories and delivered in order to event subscribers.
+func TestTransactionEvents(t *testing.T) {
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	sub := pool.eventMux.Subscribe(TxPoolEvent{})
+	defer sub.Unsubscribe()
+
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	statedb, _ := pool.currentState()
+	statedb.SetBalance(from, big.NewInt(1000))
+
+	// Add a future and an executable transaction, replace the first, include the
+	// second and make the replacement unpayable
+	future, replacement, pending := transaction(1, big.NewInt(100), key), transaction(1, big.NewInt(200), key), transaction(0, big.NewInt(100), key)
+	for _, tx := range []*types.Transaction{future, pending, replacement} {
+		if err := pool.AddRemote(tx); err != nil {
+			t.Fatalf("failed to add transaction %x: %v", tx.Hash(), err)
+		}
+	}
+	block := types.NewBlock(&types.Header{Number: big.NewInt(1)}, types.Transactions{pending}, nil)
+
+	pool.mu.Lock()
+	pool.markMined(block)
+	statedb.SetNonce(from, 1)
+	statedb.SetBalance(from, big.NewInt(100))
+	pool.resetState()
+	pool.mu.Unlock()
+
+	// Ensure the histories of all the transactions are correct
+	histories := []struct {
+		tx    *types.Transaction
+		kinds []TxPoolEventKind
+	}{
+		{future, []TxPoolEventKind{TxAdded, TxPromoted, TxReplaced}},
+		{pending, []TxPoolEventKind{TxAdded, TxPromoted, TxIncluded}},
+		{replacement, []TxPoolEventKind{TxAdded, TxPromoted, TxDropped}},
+	}
+	for i, tt := range histories {
+		events := pool.History(tt.tx.Hash())
+		if len(events) != len(tt.kinds) {
+			t.Fatalf("history %d: event count mismatch: have %d, want %d", i, len(events), len(tt.kinds))
+		}
+		for j, ev := range events {
+			if ev.Kind != tt.kinds[j] || ev.Hash != tt.tx.Hash() || ev.From != from {
+				t.Errorf("history %d, event %d: mismatch: have %s/%x/%x, want %s/%x/%x", i, j, ev.Kind, ev.Hash, ev.From, tt.kinds[j], tt.tx.Hash(), from)
+			}
+		}
+	}
+	if ev := pool.History(future.Hash())[2]; ev.Replacement == nil || *ev.Replacement != replacement.Hash() {
+		t.Errorf("replacement mismatch: have %v, want %x", ev.Replacement, replacement.Hash())
+	}
+	if ev := pool.History(pending.Hash())[2]; ev.Block == nil || *ev.Block != block.Hash() {
+		t.Errorf("inclusion block mismatch: have %v, want %x", ev.Block, block.Hash())
+	}
+	if ev := pool.History(replacement.Hash())[2]; ev.Reason != TxDropUnpayable {
+		t.Errorf("drop reason mismatch: have %q, want %q", ev.Reason, TxDropUnpayable)
+	}
+	// Ensure the events were also delivered in the order they happened
+	want := []struct {
+		kind TxPoolEventKind
+		hash common.Hash
+	}{
+		{TxAdded, future.Hash()},
+		{TxAdded, pending.Hash()},
+		{TxPromoted, pending.Hash()},
+		{TxPromoted, future.Hash()},
+		{TxReplaced, future.Hash()},
+		{TxAdded, replacement.Hash()},
+		{TxPromoted, replacement.Hash()},
+		{TxIncluded, pending.Hash()},
+		{TxDropped, replacement.Hash()},
+	}
+	for i, w := range want {
+		select {
+		case ev := <-sub.Chan():
+			if have := ev.Data.(TxPoolEvent); have.Kind != w.kind || have.Hash != w.hash {
+				t.Fatalf("event %d: mismatch: have %s/%x, want %s/%x", i, have.Kind, have.Hash, w.kind, w.hash)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d: timeout", i)
+		}
+	}
+}
+
+// testPoolChain is a single block chain to simulate pooled transactions on.
+type testPoolChain struct {
+	head *types.Block
+}
+
+func (c *testPoolChain) Engine() consensus.Engine                    { return nil }
+func (c *testPoolChain) GetHeader(common.Hash, uint64) *types.Header { return nil }
+func (c *testPoolChain) CurrentBlock() *types.Block                  { return c.head }
+
+// Tests that if simulation is enabled, remote transactions failing or running
+// out of the execution budget on the pending state are rejected, that results
+// are cached until the next reset and that senders are cut off after too many
+// failed simulations.
+func TestTransactionSimulation(t *testing.T) {
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	pool.config.Simulate = true
+	pool.config.SimulationSteps = 1000
+	pool.config.SimulationQuota = 2
+	pool.SetChain(&testPoolChain{head: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(0), Time: big.NewInt(0), Difficulty: big.NewInt(1)})})
+
+	other, _ := crypto.GenerateKey()
+	reverter, looper := common.Address{0xaa}, common.Address{0xbb}
+
+	statedb, _ := pool.currentState()
+	statedb.SetBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000))
+	statedb.SetBalance(crypto.PubkeyToAddress(other.PublicKey), big.NewInt(1000000))
+	statedb.SetCode(reverter, []byte{0xfe}) // designated invalid opcode
+	statedb.SetCode(looper, []byte{byte(vm.JUMPDEST), byte(vm.PUSH1), 0x00, byte(vm.JUMP)})
+
+	pool.mu.Lock()
+	pool.resetState()
+	pool.mu.Unlock()
+
+	call := func(nonce uint64, to common.Address, key *ecdsa.PrivateKey) *types.Transaction {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, to, big.NewInt(1), nil), types.HomesteadSigner{}, key)
+		return tx
+	}
+	// Ensure failing calls are rejected and the result cached until a reset
+	revert := call(0, reverter, key)
+	if err := pool.AddRemote(revert); err != ErrSimulationReverted {
+		t.Fatalf("reverting transaction error mismatch: have %v, want %v", err, ErrSimulationReverted)
+	}
+	statedb.SetCode(reverter, []byte{byte(vm.STOP)})
+	if err := pool.AddRemote(revert); err != ErrSimulationReverted {
+		t.Fatalf("cached transaction error mismatch: have %v, want %v", err, ErrSimulationReverted)
+	}
+	pool.mu.Lock()
+	pool.resetState()
+	pool.mu.Unlock()
+
+	if err := pool.AddRemote(revert); err != nil {
+		t.Fatalf("failed to add fixed transaction: %v", err)
+	}
+	// Ensure endless executions are aborted and count towards the sender quota
+	if err := pool.AddRemote(call(1, looper, key)); err != ErrSimulationBudget {
+		t.Fatalf("looping transaction error mismatch: have %v, want %v", err, ErrSimulationBudget)
+	}
+	if err := pool.AddRemote(call(1, common.Address{}, key)); err != ErrSimulationQuota {
+		t.Fatalf("quota exceeding transaction error mismatch: have %v, want %v", err, ErrSimulationQuota)
+	}
+	// Ensure other senders and local transactions are unaffected
+	if err := pool.AddRemote(call(0, common.Address{}, other)); err != nil {
+		t.Fatalf("failed to add transaction of other sender: %v", err)
+	}
+	if err := pool.AddLocal(call(1, looper, key)); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	if pending, _ := pool.Stats(); pending != 3 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 3)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that remote transactions depending on the effects of preceding ones of
+// the same payer are simulated on top of those, whether the predecessors are
+// already pooled or arrive in the same batch.
+func TestTransactionSimulationDependencies(t *testing.T) {
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	pool.config.Simulate = true
+	pool.config.SimulationSteps = 1000
+	pool.config.SimulationQuota = 2
+	pool.SetChain(&testPoolChain{head: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(0), Time: big.NewInt(0), Difficulty: big.NewInt(1)})})
+
+	other, _ := crypto.GenerateKey()
+	gate := common.Address{0xaa}
+
+	// The gate opens when called with any data and reverts plain calls until then
+	statedb, _ := pool.currentState()
+	statedb.SetBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000))
+	statedb.SetBalance(crypto.PubkeyToAddress(other.PublicKey), big.NewInt(1000000))
+	statedb.SetCode(gate, []byte{
+		byte(vm.CALLDATASIZE), byte(vm.PUSH1), 0x0d, byte(vm.JUMPI),
+		byte(vm.PUSH1), 0x00, byte(vm.SLOAD), byte(vm.PUSH1), 0x0b, byte(vm.JUMPI), 0xfe,
+		byte(vm.JUMPDEST), byte(vm.STOP),
+		byte(vm.JUMPDEST), byte(vm.PUSH1), 0x01, byte(vm.PUSH1), 0x00, byte(vm.SSTORE), byte(vm.STOP),
+	})
+	pool.mu.Lock()
+	pool.resetState()
+	pool.mu.Unlock()
+
+	call := func(nonce uint64, data []byte, key *ecdsa.PrivateKey) *types.Transaction {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, gate, big.NewInt(1), data), types.HomesteadSigner{}, key)
+		return tx
+	}
+	// Ensure a plain call alone is rejected, but not once the opener is pooled
+	if err := pool.AddRemote(call(0, nil, other)); err != ErrSimulationReverted {
+		t.Fatalf("closed gate error mismatch: have %v, want %v", err, ErrSimulationReverted)
+	}
+	if err := pool.AddRemote(call(0, []byte{0x01}, key)); err != nil {
+		t.Fatalf("failed to add opening transaction: %v", err)
+	}
+	if err := pool.AddRemote(call(1, nil, key)); err != nil {
+		t.Fatalf("failed to add dependent transaction: %v", err)
+	}
+	// Ensure the opener is also taken into account within the same batch
+	for i, err := range pool.AddRemotes([]*types.Transaction{call(0, []byte{0x01}, other), call(1, nil, other)}) {
+		if err != nil {
+			t.Fatalf("batch transaction %d: failed to add: %v", i, err)
+		}
+	}
+	if pending, _ := pool.Stats(); pending != 4 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 4)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that the validity windows of transactions are enforced on admission and
+// that pooled transactions are dropped once their window ends.
+func TestTransactionValidityWindow(t *testing.T) {
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	chain := &testPoolChain{head: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(10), Time: big.NewInt(0), Difficulty: big.NewInt(1)})}
+	pool.SetChain(chain)
+
+	statedb, _ := pool.currentState()
+	statedb.SetBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000))
+
+	signer := types.NewEIP155Signer(params.TestChainConfig.ChainId)
+	windowed := func(nonce uint64, from, until uint64) *types.Transaction {
+		tx, _ := types.SignTx(types.NewWindowedTransaction(nonce, &common.Address{}, big.NewInt(1), nil, from, until), signer, key)
+		return tx
+	}
+	// Ensure expired and malformed windows are rejected, but future ones accepted
+	if err := pool.AddRemote(windowed(0, 1, 10)); err != ErrTxExpired {
+		t.Fatalf("expired transaction error mismatch: have %v, want %v", err, ErrTxExpired)
+	}
+	if err := pool.AddRemote(windowed(0, 20, 12)); err != ErrInvalidTxWindow {
+		t.Fatalf("malformed window error mismatch: have %v, want %v", err, ErrInvalidTxWindow)
+	}
+	if err := pool.AddRemote(windowed(0, 5, 11)); err != nil {
+		t.Fatalf("failed to add valid transaction: %v", err)
+	}
+	if err := pool.AddRemote(windowed(1, 20, 30)); err != nil {
+		t.Fatalf("failed to add future transaction: %v", err)
+	}
+	if err := pool.AddRemote(transaction(2, big.NewInt(1), key)); err != nil {
+		t.Fatalf("failed to add legacy transaction: %v", err)
+	}
+	if pending, _ := pool.Stats(); pending != 3 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 3)
+	}
+	// Advance the chain past the first window and ensure it's dropped on reset,
+	// taking its dependent transactions with it into the queue
+	chain.head = types.NewBlockWithHeader(&types.Header{Number: big.NewInt(11), Time: big.NewInt(0), Difficulty: big.NewInt(1)})
+
+	pool.mu.Lock()
+	pool.resetState()
+	pool.mu.Unlock()
+
+	if pending, queued := pool.Stats(); pending != 0 || queued != 2 {
+		t.Fatalf("pool stats mismatch: have %d/%d, want %d/%d", pending, queued, 0, 2)
+	}
+	// Ensure windowed transactions are rejected before the fork
+	config := *params.TestChainConfig
+	config.ExpiryBlock = big.NewInt(100)
+	pool.chainconfig = &config
+
+	if err := pool.AddRemote(windowed(0, 5, 30)); err != ErrTxWindowNotActive {
+		t.Fatalf("pre-fork transaction error mismatch: have %v, want %v", err, ErrTxWindowNotActive)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that sponsored transactions are sequenced by the nonce of their sponsor,
+// while the transferred value is still charged to the sender.
+func TestTransactionSponsorship(t *testing.T) {
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	sponsorKey, _ := crypto.GenerateKey()
+	sender, sponsor := crypto.PubkeyToAddress(key.PublicKey), crypto.PubkeyToAddress(sponsorKey.PublicKey)
+
+	statedb, _ := pool.currentState()
+	statedb.SetBalance(sender, big.NewInt(100))
+	statedb.SetNonce(sponsor, 5)
+
+	pool.mu.Lock()
+	pool.resetState()
+	pool.mu.Unlock()
+
+	signer := types.NewEIP155Signer(params.TestChainConfig.ChainId)
+	sponsored := func(nonce uint64, to *common.Address, amount int64, key *ecdsa.PrivateKey) *types.Transaction {
+		var tx *types.Transaction
+		if to == nil {
+			tx = types.NewContractCreation(nonce, big.NewInt(amount), nil)
+		} else {
+			tx = types.NewTransaction(nonce, *to, big.NewInt(amount), nil)
+		}
+		tx, _ = types.SignTx(tx.WithSponsor(sponsor), signer, key)
+		tx, _ = types.SponsorTx(tx, signer, sponsorKey)
+		return tx
+	}
+	// Ensure the sponsor's nonce is used, not the sender's
+	if err := pool.AddRemote(sponsored(0, &common.Address{}, 1, key)); err != ErrNonceTooLow {
+		t.Fatalf("stale sponsor nonce error mismatch: have %v, want %v", err, ErrNonceTooLow)
+	}
+	if err := pool.AddRemote(sponsored(5, &common.Address{}, 1, key)); err != nil {
+		t.Fatalf("failed to add sponsored transaction: %v", err)
+	}
+	if nonce := pool.State().GetNonce(sponsor); nonce != 6 {
+		t.Fatalf("sponsor pending nonce mismatch: have %d, want %d", nonce, 6)
+	}
+	if nonce := pool.State().GetNonce(sender); nonce != 0 {
+		t.Fatalf("sender pending nonce mismatch: have %d, want %d", nonce, 0)
+	}
+	// Ensure the value is still funded by the sender
+	if err := pool.AddRemote(sponsored(6, &common.Address{}, 101, key)); err != ErrInsufficientFunds {
+		t.Fatalf("unfunded transfer error mismatch: have %v, want %v", err, ErrInsufficientFunds)
+	}
+	// Ensure forged sponsor signatures and sponsored creations are rejected
+	forger, _ := crypto.GenerateKey()
+	forged, _ := types.SignTx(types.NewTransaction(6, common.Address{}, big.NewInt(1), nil).WithSponsor(sponsor), signer, key)
+	forged, _ = types.SponsorTx(forged, signer, forger)
+	if err := pool.AddRemote(forged); err != ErrInvalidSponsor {
+		t.Fatalf("forged sponsor error mismatch: have %v, want %v", err, ErrInvalidSponsor)
+	}
+	if err := pool.AddRemote(sponsored(6, nil, 1, key)); err != ErrSponsoredCreation {
+		t.Fatalf("sponsored creation error mismatch: have %v, want %v", err, ErrSponsoredCreation)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that the upfront flat fee of transactions needs to be affordable by the
+// account sequencing them once the fee fork activated.
+func TestTransactionFeeAdmission(t *testing.T) {
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	config := *params.TestChainConfig
+	config.FeeBlock = big.NewInt(2)
+	config.Fee = &params.FeeConfig{Base: big.NewInt(100), PerByte: big.NewInt(10)}
+	pool.chainconfig = &config
+
+	chain := &testPoolChain{head: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(0), Time: big.NewInt(0), Difficulty: big.NewInt(1)})}
+	pool.SetChain(chain)
+
+	statedb, _ := pool.currentState()
+	statedb.SetBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(105))
+
+	// Ensure no fee is required before the fork, but is afterwards
+	if err := pool.AddRemote(transaction(0, big.NewInt(10), key)); err != nil {
+		t.Fatalf("failed to add pre-fork transaction: %v", err)
+	}
+	chain.head = types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1), Time: big.NewInt(0), Difficulty: big.NewInt(1)})
+
+	if err := pool.AddRemote(transaction(1, big.NewInt(10), key)); err != ErrInsufficientFee {
+		t.Fatalf("unaffordable fee error mismatch: have %v, want %v", err, ErrInsufficientFee)
+	}
+	if err := pool.AddRemote(transaction(1, big.NewInt(5), key)); err != nil {
+		t.Fatalf("failed to add affordable transaction: %v", err)
+	}
+}
+
 // Benchmarks the speed of validating the contents of the pending queue of the
 // transaction pool.
 func BenchmarkPendingDemotion100(b *testing.B)   { benchmarkPendingDemotion(b, 100) }
@@ -0,0 +1,59 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+//go:generate gencodec -type Call -field-override callMarshaling -out gen_call_json.go
+//go:generate gencodec -type CallResult -field-override callResultMarshaling -out gen_call_result_json.go
+
+// Call is a single message call of a batch transaction.
+type Call struct {
+	To    common.Address `json:"to"    gencodec:"required"`
+	Value *big.Int       `json:"value" gencodec:"required"`
+	Data  []byte         `json:"input" gencodec:"required"`
+}
+
+type callMarshaling struct {
+	Value *hexutil.Big
+	Data  hexutil.Bytes
+}
+
+// copy returns a deep copy of the call.
+func (c *Call) copy() *Call {
+	cpy := &Call{To: c.To, Value: new(big.Int), Data: common.CopyBytes(c.Data)}
+	if c.Value != nil {
+		cpy.Value.Set(c.Value)
+	}
+	return cpy
+}
+
+// CallResult is the outcome of a single call of a batch transaction.
+type CallResult struct {
+	Status     uint   `json:"status"`
+	ReturnData []byte `json:"returnData"`
+}
+
+type callResultMarshaling struct {
+	Status     hexutil.Uint
+	ReturnData hexutil.Bytes
+}
@@ -5,6 +5,7 @@ package types
 import (
 	"encoding/json"
 	"errors"
+	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -14,12 +15,17 @@ var _ = (*receiptMarshaling)(nil)
 
 func (r Receipt) MarshalJSON() ([]byte, error) {
 	type Receipt struct {
-		PostState       hexutil.Bytes  `json:"root"`
-		Status          hexutil.Uint   `json:"status"`
-		Bloom           Bloom          `json:"logsBloom"         gencodec:"required"`
-		Logs            []*Log         `json:"logs"              gencodec:"required"`
-		TxHash          common.Hash    `json:"transactionHash" gencodec:"required"`
-		ContractAddress common.Address `json:"contractAddress"`
+		PostState       hexutil.Bytes   `json:"root"`
+		Status          hexutil.Uint    `json:"status"`
+		Bloom           Bloom           `json:"logsBloom"         gencodec:"required"`
+		Logs            []*Log          `json:"logs"              gencodec:"required"`
+		TxHash          common.Hash     `json:"transactionHash" gencodec:"required"`
+		ContractAddress common.Address  `json:"contractAddress"`
+		Sponsor         *common.Address `json:"sponsor,omitempty"`
+		Calls           []*CallResult   `json:"calls,omitempty"`
+		Fee             *hexutil.Big    `json:"fee,omitempty"`
+		Steps           hexutil.Uint64  `json:"steps,omitempty"`
+		Partial         bool            `json:"partial,omitempty"`
 	}
 	var enc Receipt
 	enc.PostState = r.PostState
@@ -28,6 +34,11 @@ func (r Receipt) MarshalJSON() ([]byte, error) {
 	enc.Logs = r.Logs
 	enc.TxHash = r.TxHash
 	enc.ContractAddress = r.ContractAddress
+	enc.Sponsor = r.Sponsor
+	enc.Calls = r.Calls
+	enc.Fee = (*hexutil.Big)(r.Fee)
+	enc.Steps = hexutil.Uint64(r.Steps)
+	enc.Partial = r.Partial
 	return json.Marshal(&enc)
 }
 
@@ -39,6 +50,11 @@ func (r *Receipt) UnmarshalJSON(input []byte) error {
 		Logs            []*Log          `json:"logs"              gencodec:"required"`
 		TxHash          *common.Hash    `json:"transactionHash" gencodec:"required"`
 		ContractAddress *common.Address `json:"contractAddress"`
+		Sponsor         *common.Address `json:"sponsor,omitempty"`
+		Calls           []*CallResult   `json:"calls,omitempty"`
+		Fee             *hexutil.Big    `json:"fee,omitempty"`
+		Steps           *hexutil.Uint64 `json:"steps,omitempty"`
+		Partial         *bool           `json:"partial,omitempty"`
 	}
 	var dec Receipt
 	if err := json.Unmarshal(input, &dec); err != nil {
@@ -65,5 +81,20 @@ func (r *Receipt) UnmarshalJSON(input []byte) error {
 	if dec.ContractAddress != nil {
 		r.ContractAddress = *dec.ContractAddress
 	}
+	if dec.Sponsor != nil {
+		r.Sponsor = dec.Sponsor
+	}
+	if dec.Calls != nil {
+		r.Calls = dec.Calls
+	}
+	if dec.Fee != nil {
+		r.Fee = (*big.Int)(dec.Fee)
+	}
+	if dec.Steps != nil {
+		r.Steps = uint64(*dec.Steps)
+	}
+	if dec.Partial != nil {
+		r.Partial = *dec.Partial
+	}
 	return nil
 }
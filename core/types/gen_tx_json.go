@@ -19,9 +19,16 @@ func (t txdata) MarshalJSON() ([]byte, error) {
 		Recipient    *common.Address `json:"to"       rlp:"nil"`
 		Amount       *hexutil.Big    `json:"value"    gencodec:"required"`
 		Payload      hexutil.Bytes   `json:"input"    gencodec:"required"`
+		Calls        []*Call         `json:"calls,omitempty" rlp:"-"`
+		ValidFrom    *hexutil.Uint64 `json:"validFrom,omitempty"  rlp:"-"`
+		ValidUntil   *hexutil.Uint64 `json:"validUntil,omitempty" rlp:"-"`
+		Sponsor      *common.Address `json:"sponsor,omitempty" rlp:"-"`
 		V            *hexutil.Big    `json:"v" gencodec:"required"`
 		R            *hexutil.Big    `json:"r" gencodec:"required"`
 		S            *hexutil.Big    `json:"s" gencodec:"required"`
+		SponsorV     *hexutil.Big    `json:"sponsorV,omitempty" rlp:"-"`
+		SponsorR     *hexutil.Big    `json:"sponsorR,omitempty" rlp:"-"`
+		SponsorS     *hexutil.Big    `json:"sponsorS,omitempty" rlp:"-"`
 		Hash         *common.Hash    `json:"hash" rlp:"-"`
 	}
 	var enc txdata
@@ -29,9 +36,16 @@ func (t txdata) MarshalJSON() ([]byte, error) {
 	enc.Recipient = t.Recipient
 	enc.Amount = (*hexutil.Big)(t.Amount)
 	enc.Payload = t.Payload
+	enc.Calls = t.Calls
+	enc.ValidFrom = (*hexutil.Uint64)(t.ValidFrom)
+	enc.ValidUntil = (*hexutil.Uint64)(t.ValidUntil)
+	enc.Sponsor = t.Sponsor
 	enc.V = (*hexutil.Big)(t.V)
 	enc.R = (*hexutil.Big)(t.R)
 	enc.S = (*hexutil.Big)(t.S)
+	enc.SponsorV = (*hexutil.Big)(t.SponsorV)
+	enc.SponsorR = (*hexutil.Big)(t.SponsorR)
+	enc.SponsorS = (*hexutil.Big)(t.SponsorS)
 	enc.Hash = t.Hash
 	return json.Marshal(&enc)
 }
@@ -42,9 +56,16 @@ func (t *txdata) UnmarshalJSON(input []byte) error {
 		Recipient    *common.Address `json:"to"       rlp:"nil"`
 		Amount       *hexutil.Big    `json:"value"    gencodec:"required"`
 		Payload      *hexutil.Bytes  `json:"input"    gencodec:"required"`
+		Calls        []*Call         `json:"calls,omitempty" rlp:"-"`
+		ValidFrom    *hexutil.Uint64 `json:"validFrom,omitempty"  rlp:"-"`
+		ValidUntil   *hexutil.Uint64 `json:"validUntil,omitempty" rlp:"-"`
+		Sponsor      *common.Address `json:"sponsor,omitempty" rlp:"-"`
 		V            *hexutil.Big    `json:"v" gencodec:"required"`
 		R            *hexutil.Big    `json:"r" gencodec:"required"`
 		S            *hexutil.Big    `json:"s" gencodec:"required"`
+		SponsorV     *hexutil.Big    `json:"sponsorV,omitempty" rlp:"-"`
+		SponsorR     *hexutil.Big    `json:"sponsorR,omitempty" rlp:"-"`
+		SponsorS     *hexutil.Big    `json:"sponsorS,omitempty" rlp:"-"`
 		Hash         *common.Hash    `json:"hash" rlp:"-"`
 	}
 	var dec txdata
@@ -66,6 +87,18 @@ func (t *txdata) UnmarshalJSON(input []byte) error {
 		return errors.New("missing required field 'input' for txdata")
 	}
 	t.Payload = *dec.Payload
+	if dec.Calls != nil {
+		t.Calls = dec.Calls
+	}
+	if dec.ValidFrom != nil {
+		t.ValidFrom = (*uint64)(dec.ValidFrom)
+	}
+	if dec.ValidUntil != nil {
+		t.ValidUntil = (*uint64)(dec.ValidUntil)
+	}
+	if dec.Sponsor != nil {
+		t.Sponsor = dec.Sponsor
+	}
 	if dec.V == nil {
 		return errors.New("missing required field 'v' for txdata")
 	}
@@ -78,6 +111,15 @@ func (t *txdata) UnmarshalJSON(input []byte) error {
 		return errors.New("missing required field 's' for txdata")
 	}
 	t.S = (*big.Int)(dec.S)
+	if dec.SponsorV != nil {
+		t.SponsorV = (*big.Int)(dec.SponsorV)
+	}
+	if dec.SponsorR != nil {
+		t.SponsorR = (*big.Int)(dec.SponsorR)
+	}
+	if dec.SponsorS != nil {
+		t.SponsorS = (*big.Int)(dec.SponsorS)
+	}
 	if dec.Hash != nil {
 		t.Hash = dec.Hash
 	}
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -50,13 +51,20 @@ type Receipt struct {
 	Logs      []*Log `json:"logs"              gencodec:"required"`
 
 	// Implementation fields (don't reorder!)
-	TxHash          common.Hash    `json:"transactionHash" gencodec:"required"`
-	ContractAddress common.Address `json:"contractAddress"`
+	TxHash          common.Hash     `json:"transactionHash" gencodec:"required"`
+	ContractAddress common.Address  `json:"contractAddress"`
+	Sponsor         *common.Address `json:"sponsor,omitempty"`
+	Calls           []*CallResult   `json:"calls,omitempty"`
+	Fee             *big.Int        `json:"fee,omitempty"`
+	Steps           uint64          `json:"steps,omitempty"`
+	Partial         bool            `json:"partial,omitempty"` // Receipt derived without executing the tx, lacking the calls, fee and steps
 }
 
 type receiptMarshaling struct {
 	PostState hexutil.Bytes
 	Status    hexutil.Uint
+	Fee       *hexutil.Big
+	Steps     hexutil.Uint64
 }
 
 // receiptRLP is the consensus encoding of a receipt.
@@ -72,6 +80,7 @@ type receiptStorageRLP struct {
 	TxHash            common.Hash
 	ContractAddress   common.Address
 	Logs              []*LogForStorage
+	Extra             []rlp.RawValue `rlp:"tail"` // Optional sponsor, call results, fee, steps and partial flag, omitted for compatibility
 }
 
 // NewReceipt creates a barebone transaction receipt, copying the init fields.
@@ -154,6 +163,25 @@ func (r *ReceiptForStorage) EncodeRLP(w io.Writer) error {
 	for i, log := range r.Logs {
 		enc.Logs[i] = (*LogForStorage)(log)
 	}
+	// Append the optional fields up to the last one set, leaving the preceding
+	// unset ones empty
+	var sponsor []byte
+	if r.Sponsor != nil {
+		sponsor = r.Sponsor[:]
+	}
+	extra, set := []interface{}{sponsor, r.Calls, r.Fee, r.Steps, r.Partial}, 0
+	for i, ok := range []bool{r.Sponsor != nil, r.Calls != nil, r.Fee != nil, r.Steps != 0, r.Partial} {
+		if ok {
+			set = i + 1
+		}
+	}
+	for _, field := range extra[:set] {
+		blob, err := rlp.EncodeToBytes(field)
+		if err != nil {
+			return err
+		}
+		enc.Extra = append(enc.Extra, blob)
+	}
 	return rlp.Encode(w, enc)
 }
 
@@ -175,6 +203,47 @@ func (r *ReceiptForStorage) DecodeRLP(s *rlp.Stream) error {
 	}
 	// Assign the implementation fields
 	r.TxHash, r.ContractAddress = dec.TxHash, dec.ContractAddress
+	if len(dec.Extra) > 0 {
+		var sponsor []byte
+		if err := rlp.DecodeBytes(dec.Extra[0], &sponsor); err != nil {
+			return err
+		}
+		switch len(sponsor) {
+		case 0:
+		case common.AddressLength:
+			r.Sponsor = new(common.Address)
+			copy(r.Sponsor[:], sponsor)
+		default:
+			return fmt.Errorf("invalid receipt sponsor %x", sponsor)
+		}
+	}
+	if len(dec.Extra) > 1 {
+		if err := rlp.DecodeBytes(dec.Extra[1], &r.Calls); err != nil {
+			return err
+		}
+		if len(r.Calls) == 0 {
+			r.Calls = nil
+		}
+	}
+	if len(dec.Extra) > 2 {
+		if err := rlp.DecodeBytes(dec.Extra[2], &r.Fee); err != nil {
+			return err
+		}
+	}
+	if len(dec.Extra) > 3 {
+		if err := rlp.DecodeBytes(dec.Extra[3], &r.Steps); err != nil {
+			return err
+		}
+	}
+	if len(dec.Extra) > 4 {
+		if err := rlp.DecodeBytes(dec.Extra[4], &r.Partial); err != nil {
+			return err
+		}
+	}
+	// Partial receipts have no execution results, the fee is only a placeholder
+	if r.Partial {
+		r.Fee = nil
+	}
 	return nil
 }
 
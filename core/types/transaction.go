@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"math/big"
 	"sync/atomic"
 
@@ -33,8 +34,24 @@ import (
 //go:generate gencodec -type txdata -field-override txdataMarshaling -out gen_tx_json.go
 
 var (
-	ErrInvalidSig = errors.New("invalid transaction v, r, s values")
-	errNoSigner   = errors.New("missing signing methods")
+	ErrInvalidSig          = errors.New("invalid transaction v, r, s values")
+	ErrTxTypeNotSupported  = errors.New("transaction type not supported")
+	errNoSigner            = errors.New("missing signing methods")
+	ErrInvalidSponsor      = errors.New("invalid transaction sponsor")
+	errInvalidTxFieldCount = errors.New("invalid transaction field count")
+	errInvalidTxRecipient  = errors.New("invalid transaction recipient")
+	errIncompleteTxWindow  = errors.New("incomplete transaction validity window")
+	errInvalidBatch        = errors.New("invalid batch transaction")
+)
+
+// Number of RLP list items of the transaction encodings. Batch transactions carry
+// their call list as one extra item on top of any of these, so their number of
+// items is always even.
+const (
+	legacyTxFields            = 7  // Number of RLP list items of a legacy transaction
+	windowedTxFields          = 9  // Number of RLP list items of a transaction with a validity window
+	sponsoredTxFields         = 11 // Number of RLP list items of a sponsored transaction
+	windowedSponsoredTxFields = 13 // Number of RLP list items of a sponsored transaction with a validity window
 )
 
 // deriveSigner makes a *best* guess about which signer to use.
@@ -49,9 +66,10 @@ func deriveSigner(V *big.Int) Signer {
 type Transaction struct {
 	data txdata
 	// caches
-	hash atomic.Value
-	size atomic.Value
-	from atomic.Value
+	hash    atomic.Value
+	size    atomic.Value
+	from    atomic.Value
+	sponsor atomic.Value
 }
 
 type txdata struct {
@@ -60,11 +78,26 @@ type txdata struct {
 	Amount       *big.Int        `json:"value"    gencodec:"required"`
 	Payload      []byte          `json:"input"    gencodec:"required"`
 
+	// Batched calls, only set on batch transactions
+	Calls []*Call `json:"calls,omitempty" rlp:"-"`
+
+	// Validity window, only set on windowed transactions
+	ValidFrom  *uint64 `json:"validFrom,omitempty"  rlp:"-"` // First block number the transaction may be included in
+	ValidUntil *uint64 `json:"validUntil,omitempty" rlp:"-"` // Last block number the transaction may be included in
+
+	// Sponsor account, only set on sponsored transactions
+	Sponsor *common.Address `json:"sponsor,omitempty" rlp:"-"`
+
 	// Signature values
 	V *big.Int `json:"v" gencodec:"required"`
 	R *big.Int `json:"r" gencodec:"required"`
 	S *big.Int `json:"s" gencodec:"required"`
 
+	// Sponsor signature values, only set on sponsored transactions
+	SponsorV *big.Int `json:"sponsorV,omitempty" rlp:"-"`
+	SponsorR *big.Int `json:"sponsorR,omitempty" rlp:"-"`
+	SponsorS *big.Int `json:"sponsorS,omitempty" rlp:"-"`
+
 	// This is only used when marshaling to JSON.
 	Hash *common.Hash `json:"hash" rlp:"-"`
 }
@@ -73,9 +106,14 @@ type txdataMarshaling struct {
 	AccountNonce hexutil.Uint64
 	Amount       *hexutil.Big
 	Payload      hexutil.Bytes
+	ValidFrom    *hexutil.Uint64
+	ValidUntil   *hexutil.Uint64
 	V            *hexutil.Big
 	R            *hexutil.Big
 	S            *hexutil.Big
+	SponsorV     *hexutil.Big
+	SponsorR     *hexutil.Big
+	SponsorS     *hexutil.Big
 }
 
 func NewTransaction(nonce uint64, to common.Address, amount *big.Int, data []byte) *Transaction {
@@ -86,6 +124,39 @@ func NewContractCreation(nonce uint64, amount *big.Int, data []byte) *Transactio
 	return newTransaction(nonce, nil, amount, data)
 }
 
+// NewWindowedTransaction creates a transaction that may only be included in the
+// blocks numbered from validFrom to validUntil (inclusive). A nil recipient is a
+// contract creation.
+//
+// Windowed transactions are only valid once the validity window fork activated
+// and must be signed with replay protection.
+func NewWindowedTransaction(nonce uint64, to *common.Address, amount *big.Int, data []byte, validFrom, validUntil uint64) *Transaction {
+	tx := newTransaction(nonce, to, amount, data)
+	tx.data.ValidFrom, tx.data.ValidUntil = &validFrom, &validUntil
+	return tx
+}
+
+// NewBatchTransaction creates a transaction executing the given calls in order,
+// atomically: if any of them fails, the effects of all of them are reverted.
+//
+// Batch transactions must be signed with replay protection.
+func NewBatchTransaction(nonce uint64, calls []*Call) *Transaction {
+	tx := newTransaction(nonce, nil, nil, nil)
+	tx.data.Calls = make([]*Call, len(calls))
+	for i, call := range calls {
+		tx.data.Calls[i] = call.copy()
+	}
+	return tx
+}
+
+// NewWindowedBatchTransaction creates a batch transaction that may only be
+// included in the blocks numbered from validFrom to validUntil (inclusive).
+func NewWindowedBatchTransaction(nonce uint64, calls []*Call, validFrom, validUntil uint64) *Transaction {
+	tx := NewBatchTransaction(nonce, calls)
+	tx.data.ValidFrom, tx.data.ValidUntil = &validFrom, &validUntil
+	return tx
+}
+
 func newTransaction(nonce uint64, to *common.Address, amount *big.Int, data []byte) *Transaction {
 	if len(data) > 0 {
 		data = common.CopyBytes(data)
@@ -106,6 +177,21 @@ func newTransaction(nonce uint64, to *common.Address, amount *big.Int, data []by
 	return &Transaction{data: d}
 }
 
+// WithSponsor returns an unsigned copy of the transaction to be paid for and
+// sequenced by the given sponsor account. The nonce of a sponsored transaction
+// is the sponsor's, whereas the sender remains the origin of the execution.
+//
+// Sponsored transactions need to be signed first by the sender, committing to
+// the sponsor, then by the sponsor, committing to the signature of the sender.
+// They must be replay protected and can't create contracts.
+func (tx *Transaction) WithSponsor(sponsor common.Address) *Transaction {
+	cpy := &Transaction{data: tx.data}
+	cpy.data.Sponsor = &sponsor
+	cpy.data.V, cpy.data.R, cpy.data.S = new(big.Int), new(big.Int), new(big.Int)
+	cpy.data.SponsorV, cpy.data.SponsorR, cpy.data.SponsorS = new(big.Int), new(big.Int), new(big.Int)
+	return cpy
+}
+
 // ChainId returns which chain id this transaction was signed for (if at all)
 func (tx *Transaction) ChainId() *big.Int {
 	return deriveChainId(tx.data.V)
@@ -125,20 +211,142 @@ func isProtectedV(V *big.Int) bool {
 	return true
 }
 
-// DecodeRLP implements rlp.Encoder
+// rlpFields returns the list items of the RLP encoding of the transaction. The
+// optional extensions are inserted in a fixed order around the signature, so
+// that every combination of them has a distinct number of fields.
+func (tx *Transaction) rlpFields() []interface{} {
+	fields := append(tx.sigFields(), tx.data.V, tx.data.R, tx.data.S)
+	if tx.Sponsored() {
+		fields = append(fields, tx.data.SponsorV, tx.data.SponsorR, tx.data.SponsorS)
+	}
+	return fields
+}
+
+// sigFields returns the fields of the transaction covered by the signature of
+// its sender.
+func (tx *Transaction) sigFields() []interface{} {
+	fields := []interface{}{tx.data.AccountNonce, tx.data.Recipient, tx.data.Amount, tx.data.Payload}
+	if tx.Batch() {
+		fields = append(fields, tx.data.Calls)
+	}
+	if tx.Windowed() {
+		fields = append(fields, *tx.data.ValidFrom, *tx.data.ValidUntil)
+	}
+	if tx.Sponsored() {
+		fields = append(fields, tx.data.Sponsor)
+	}
+	return fields
+}
+
+// EncodeRLP implements rlp.Encoder
 func (tx *Transaction) EncodeRLP(w io.Writer) error {
-	return rlp.Encode(w, &tx.data)
+	if !tx.Windowed() && !tx.Sponsored() && !tx.Batch() {
+		return rlp.Encode(w, &tx.data)
+	}
+	return rlp.Encode(w, tx.rlpFields())
 }
 
 // DecodeRLP implements rlp.Decoder
 func (tx *Transaction) DecodeRLP(s *rlp.Stream) error {
-	_, size, _ := s.Kind()
-	err := s.Decode(&tx.data)
-	if err == nil {
-		tx.size.Store(common.StorageSize(rlp.ListSize(size)))
+	raw, err := s.Raw()
+	if err != nil {
+		return err
 	}
+	var items []rlp.RawValue
+	if err := rlp.DecodeBytes(raw, &items); err != nil {
+		return err
+	}
+	var windowed, sponsored bool
 
-	return err
+	fields, batch := len(items), len(items)%2 == 0
+	if batch {
+		fields--
+	}
+	switch fields {
+	case legacyTxFields:
+		if batch {
+			break
+		}
+		if err := rlp.DecodeBytes(raw, &tx.data); err != nil {
+			return err
+		}
+		tx.size.Store(common.StorageSize(len(raw)))
+		return nil
+
+	case windowedTxFields:
+		windowed = true
+	case sponsoredTxFields:
+		sponsored = true
+	case windowedSponsoredTxFields:
+		windowed, sponsored = true, true
+	default:
+		return errInvalidTxFieldCount
+	}
+	// Decode the extended transaction field by field in the order of rlpFields
+	var (
+		dec txdata
+		to  []byte
+	)
+	decode := func(val interface{}) {
+		if err == nil {
+			err, items = rlp.DecodeBytes(items[0], val), items[1:]
+		}
+	}
+	decode(&dec.AccountNonce)
+	decode(&to)
+	decode(&dec.Amount)
+	decode(&dec.Payload)
+	if batch {
+		decode(&dec.Calls)
+	}
+	if windowed {
+		dec.ValidFrom, dec.ValidUntil = new(uint64), new(uint64)
+		decode(dec.ValidFrom)
+		decode(dec.ValidUntil)
+	}
+	if sponsored {
+		dec.Sponsor = new(common.Address)
+		decode(dec.Sponsor)
+	}
+	decode(&dec.V)
+	decode(&dec.R)
+	decode(&dec.S)
+	if sponsored {
+		decode(&dec.SponsorV)
+		decode(&dec.SponsorR)
+		decode(&dec.SponsorS)
+	}
+	if err != nil {
+		return err
+	}
+	switch len(to) {
+	case 0:
+	case common.AddressLength:
+		dec.Recipient = new(common.Address)
+		copy(dec.Recipient[:], to)
+	default:
+		return errInvalidTxRecipient
+	}
+	if batch && !dec.validBatch() {
+		return errInvalidBatch
+	}
+	tx.data = dec
+	tx.size.Store(common.StorageSize(len(raw)))
+	return nil
+}
+
+// validBatch checks that a batch transaction carries at least one call and
+// leaves its own recipient, value and payload empty.
+func (d *txdata) validBatch() bool {
+	if len(d.Calls) == 0 || d.Recipient != nil || d.Amount.Sign() != 0 || len(d.Payload) != 0 {
+		return false
+	}
+	for _, call := range d.Calls {
+		if call == nil || call.Value == nil {
+			return false
+		}
+	}
+	return true
 }
 
 func (tx *Transaction) MarshalJSON() ([]byte, error) {
@@ -154,6 +362,21 @@ func (tx *Transaction) UnmarshalJSON(input []byte) error {
 	if err := dec.UnmarshalJSON(input); err != nil {
 		return err
 	}
+	if (dec.ValidFrom == nil) != (dec.ValidUntil == nil) {
+		return errIncompleteTxWindow
+	}
+	if dec.Calls != nil && !dec.validBatch() {
+		return errInvalidBatch
+	}
+	if dec.Sponsor != nil {
+		if dec.SponsorV == nil || dec.SponsorR == nil || dec.SponsorS == nil {
+			return ErrInvalidSig
+		}
+		chainId := deriveChainId(dec.SponsorV).Uint64()
+		if !crypto.ValidateSignatureValues(byte(dec.SponsorV.Uint64()-35-2*chainId), dec.SponsorR, dec.SponsorS, false) {
+			return ErrInvalidSig
+		}
+	}
 	var V byte
 	if isProtectedV(dec.V) {
 		chainId := deriveChainId(dec.V).Uint64()
@@ -173,6 +396,57 @@ func (tx *Transaction) Value() *big.Int  { return new(big.Int).Set(tx.data.Amoun
 func (tx *Transaction) Nonce() uint64    { return tx.data.AccountNonce }
 func (tx *Transaction) CheckNonce() bool { return true }
 
+// Windowed returns whether the transaction carries a validity window.
+func (tx *Transaction) Windowed() bool { return tx.data.ValidUntil != nil }
+
+// Batch returns whether the transaction executes a list of calls atomically
+// instead of a single message call or contract creation.
+func (tx *Transaction) Batch() bool { return len(tx.data.Calls) > 0 }
+
+// Calls returns a copy of the calls of a batch transaction, or nil otherwise.
+func (tx *Transaction) Calls() []*Call {
+	if !tx.Batch() {
+		return nil
+	}
+	calls := make([]*Call, len(tx.data.Calls))
+	for i, call := range tx.data.Calls {
+		calls[i] = call.copy()
+	}
+	return calls
+}
+
+// TotalValue returns the value transferred from the sender by the transaction,
+// summed over all calls of a batch transaction.
+func (tx *Transaction) TotalValue() *big.Int {
+	total := new(big.Int).Set(tx.data.Amount)
+	for _, call := range tx.data.Calls {
+		total.Add(total, call.Value)
+	}
+	return total
+}
+
+// Sponsored returns whether the transaction is paid for and sequenced by a
+// sponsor account instead of its sender.
+func (tx *Transaction) Sponsored() bool { return tx.data.Sponsor != nil }
+
+// ValidFrom returns the first block number the transaction may be included in,
+// which is zero for transactions without a validity window.
+func (tx *Transaction) ValidFrom() uint64 {
+	if tx.data.ValidFrom == nil {
+		return 0
+	}
+	return *tx.data.ValidFrom
+}
+
+// ValidUntil returns the last block number the transaction may be included in,
+// which is unbounded for transactions without a validity window.
+func (tx *Transaction) ValidUntil() uint64 {
+	if tx.data.ValidUntil == nil {
+		return math.MaxUint64
+	}
+	return *tx.data.ValidUntil
+}
+
 // To returns the recipient address of the transaction.
 // It returns nil if the transaction is a contract creation.
 func (tx *Transaction) To() *common.Address {
@@ -184,6 +458,17 @@ func (tx *Transaction) To() *common.Address {
 	}
 }
 
+// Sponsor returns the declared sponsor of the transaction, or nil if it isn't
+// sponsored. The address is not verified against the sponsor signature, use
+// the package level Sponsor function for that.
+func (tx *Transaction) Sponsor() *common.Address {
+	if tx.data.Sponsor == nil {
+		return nil
+	}
+	sponsor := *tx.data.Sponsor
+	return &sponsor
+}
+
 // Hash hashes the RLP encoding of tx.
 // It uniquely identifies the transaction.
 func (tx *Transaction) Hash() common.Hash {
@@ -206,7 +491,7 @@ func (tx *Transaction) Size() common.StorageSize {
 		return size.(common.StorageSize)
 	}
 	c := writeCounter(0)
-	rlp.Encode(&c, &tx.data)
+	rlp.Encode(&c, tx)
 	tx.size.Store(common.StorageSize(c))
 	return common.StorageSize(c)
 }
@@ -222,11 +507,18 @@ func (tx *Transaction) AsMessage(s Signer) (Message, error) {
 		to:         tx.data.Recipient,
 		amount:     tx.data.Amount,
 		data:       tx.data.Payload,
+		calls:      tx.Calls(),
 		checkNonce: true,
 	}
 
 	var err error
 	msg.from, err = Sender(s, tx)
+	if err == nil && tx.Sponsored() {
+		var sponsor common.Address
+		if sponsor, err = Sponsor(s, tx); err == nil {
+			msg.sponsor = &sponsor
+		}
+	}
 	return msg, err
 }
 
@@ -236,9 +528,21 @@ func (tx *Transaction) WithSignature(signer Signer, sig []byte) (*Transaction, e
 	return signer.WithSignature(tx, sig)
 }
 
-// Cost returns amount.
+// Cost returns the amount charged to the account sequencing the transaction,
+// i.e. its total value, unless the transaction is sponsored, in which case the
+// value is transferred from the sender and the sponsor is only charged the fees.
+// Fees depend on the chain configuration and are not included.
 func (tx *Transaction) Cost() *big.Int {
-	return tx.data.Amount
+	if tx.Sponsored() {
+		return new(big.Int)
+	}
+	return tx.TotalValue()
+}
+
+// RawSponsorSignatureValues returns the sponsor signature of the transaction,
+// which is nil unless the transaction is sponsored.
+func (tx *Transaction) RawSponsorSignatureValues() (*big.Int, *big.Int, *big.Int) {
+	return tx.data.SponsorV, tx.data.SponsorR, tx.data.SponsorS
 }
 
 func (tx *Transaction) RawSignatureValues() (*big.Int, *big.Int, *big.Int) {
@@ -265,7 +569,7 @@ func (tx *Transaction) String() string {
 	} else {
 		to = fmt.Sprintf("%x", tx.data.Recipient[:])
 	}
-	enc, _ := rlp.EncodeToBytes(&tx.data)
+	enc, _ := rlp.EncodeToBytes(tx)
 	return fmt.Sprintf(`
 	TX(%x)
 	Contract: %v
@@ -392,7 +696,7 @@ func (t *TransactionsByPriceAndNonce) Peek() *Transaction {
 func (t *TransactionsByPriceAndNonce) Shift() {
 	signer := deriveSigner(t.heads[0].data.V)
 	// derive signer but don't cache.
-	acc, _ := Sender(signer, t.heads[0]) // we only sort valid txs so this cannot fail
+	acc, _ := Payer(signer, t.heads[0]) // we only sort valid txs so this cannot fail
 	if txs, ok := t.txs[acc]; ok && len(txs) > 0 {
 		t.heads[0], t.txs[acc] = txs[0], txs[1:]
 		heap.Fix(&t.heads, 0)
@@ -414,6 +718,8 @@ func (t *TransactionsByPriceAndNonce) Pop() {
 type Message struct {
 	to         *common.Address
 	from       common.Address
+	sponsor    *common.Address
+	calls      []*Call
 	nonce      uint64
 	amount     *big.Int
 	data       []byte
@@ -431,9 +737,11 @@ func NewMessage(from common.Address, to *common.Address, nonce uint64, amount *b
 	}
 }
 
-func (m Message) From() common.Address { return m.from }
-func (m Message) To() *common.Address  { return m.to }
-func (m Message) Value() *big.Int      { return m.amount }
-func (m Message) Nonce() uint64        { return m.nonce }
-func (m Message) Data() []byte         { return m.data }
-func (m Message) CheckNonce() bool     { return m.checkNonce }
+func (m Message) From() common.Address     { return m.from }
+func (m Message) Sponsor() *common.Address { return m.sponsor }
+func (m Message) Calls() []*Call           { return m.calls }
+func (m Message) To() *common.Address      { return m.to }
+func (m Message) Value() *big.Int          { return m.amount }
+func (m Message) Nonce() uint64            { return m.nonce }
+func (m Message) Data() []byte             { return m.data }
+func (m Message) CheckNonce() bool         { return m.checkNonce }
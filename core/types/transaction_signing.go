@@ -87,6 +87,54 @@ func Sender(signer Signer, tx *Transaction) (common.Address, error) {
 	return addr, nil
 }
 
+// Sponsor returns the address of the sponsor of a transaction derived from its
+// sponsor signature, and an error if the transaction isn't sponsored or wasn't
+// signed by the sponsor the sender committed to.
+//
+// Sponsor may cache the address, the same way Sender does.
+func Sponsor(signer Signer, tx *Transaction) (common.Address, error) {
+	if !tx.Sponsored() {
+		return common.Address{}, ErrTxTypeNotSupported
+	}
+	if sc := tx.sponsor.Load(); sc != nil {
+		sigCache := sc.(sigCache)
+		if sigCache.signer.Equal(signer) {
+			return sigCache.from, nil
+		}
+	}
+	pubkey, err := signer.SponsorPublicKey(tx)
+	if err != nil {
+		return common.Address{}, err
+	}
+	var addr common.Address
+	copy(addr[:], crypto.Keccak256(pubkey[1:])[12:])
+	if addr != *tx.data.Sponsor {
+		return common.Address{}, ErrInvalidSponsor
+	}
+	tx.sponsor.Store(sigCache{signer: signer, from: addr})
+	return addr, nil
+}
+
+// Payer returns the account paying for and sequencing a transaction, which is
+// the sponsor of sponsored transactions and the sender of any others.
+func Payer(signer Signer, tx *Transaction) (common.Address, error) {
+	if tx.Sponsored() {
+		return Sponsor(signer, tx)
+	}
+	return Sender(signer, tx)
+}
+
+// SponsorTx signs a sponsored transaction already signed by its sender, using
+// the given signer and the private key of the sponsor.
+func SponsorTx(tx *Transaction, s Signer, prv *ecdsa.PrivateKey) (*Transaction, error) {
+	h := s.SponsorHash(tx)
+	sig, err := crypto.Sign(h[:], prv)
+	if err != nil {
+		return nil, err
+	}
+	return s.WithSponsorSignature(tx, sig)
+}
+
 type Signer interface {
 	// Hash returns the rlp encoded hash for signatures
 	Hash(tx *Transaction) common.Hash
@@ -95,6 +143,13 @@ type Signer interface {
 	// WithSignature returns a copy of the transaction with the given signature.
 	// The signature must be encoded in [R || S || V] format where V is 0 or 1.
 	WithSignature(tx *Transaction, sig []byte) (*Transaction, error)
+	// SponsorHash returns the rlp encoded hash for sponsor signatures
+	SponsorHash(tx *Transaction) common.Hash
+	// SponsorPublicKey returns the public key derived from the sponsor signature
+	SponsorPublicKey(tx *Transaction) ([]byte, error)
+	// WithSponsorSignature returns a copy of the transaction with the given
+	// sponsor signature, encoded the same way as for WithSignature.
+	WithSponsorSignature(tx *Transaction, sig []byte) (*Transaction, error)
 	// Checks for equality on the signers
 	Equal(Signer) bool
 }
@@ -176,13 +231,65 @@ func (s EIP155Signer) WithSignature(tx *Transaction, sig []byte) (*Transaction,
 // Hash returns the hash to be signed by the sender.
 // It does not uniquely identify the transaction.
 func (s EIP155Signer) Hash(tx *Transaction) common.Hash {
-	return rlpHash([]interface{}{
-		tx.data.AccountNonce,
-		tx.data.Recipient,
-		tx.data.Amount,
-		tx.data.Payload,
-		s.chainId, uint(0), uint(0),
-	})
+	return rlpHash(append(tx.sigFields(), s.chainId, uint(0), uint(0)))
+}
+
+// SponsorHash returns the hash to be signed by the sponsor. It commits to the
+// signature of the sender, so the sponsor signs off the exact transaction.
+func (s EIP155Signer) SponsorHash(tx *Transaction) common.Hash {
+	return rlpHash(append(tx.sigFields(), tx.data.V, tx.data.R, tx.data.S, s.chainId, uint(0), uint(0)))
+}
+
+// SponsorPublicKey returns the public key derived from the sponsor signature,
+// which is always replay protected.
+func (s EIP155Signer) SponsorPublicKey(tx *Transaction) ([]byte, error) {
+	if !tx.Sponsored() {
+		return nil, ErrTxTypeNotSupported
+	}
+	if tx.data.SponsorV == nil || tx.data.SponsorR == nil || tx.data.SponsorS == nil {
+		return nil, ErrInvalidSig
+	}
+	if deriveChainId(tx.data.SponsorV).Cmp(s.chainId) != 0 {
+		return nil, ErrInvalidChainId
+	}
+	V := byte(new(big.Int).Sub(tx.data.SponsorV, s.chainIdMul).Uint64() - 35)
+	if !crypto.ValidateSignatureValues(V, tx.data.SponsorR, tx.data.SponsorS, true) {
+		return nil, ErrInvalidSig
+	}
+	// encode the signature in uncompressed format
+	R, S := tx.data.SponsorR.Bytes(), tx.data.SponsorS.Bytes()
+	sig := make([]byte, 65)
+	copy(sig[32-len(R):32], R)
+	copy(sig[64-len(S):64], S)
+	sig[64] = V
+
+	// recover the public key from the signature
+	hash := s.SponsorHash(tx)
+	pub, err := crypto.Ecrecover(hash[:], sig)
+	if err != nil {
+		return nil, err
+	}
+	if len(pub) == 0 || pub[0] != 4 {
+		return nil, errors.New("invalid public key")
+	}
+	return pub, nil
+}
+
+// WithSponsorSignature returns a new transaction with the given sponsor signature.
+// This signature needs to be in the [R || S || V] format where V is 0 or 1.
+func (s EIP155Signer) WithSponsorSignature(tx *Transaction, sig []byte) (*Transaction, error) {
+	if !tx.Sponsored() {
+		return nil, ErrTxTypeNotSupported
+	}
+	if len(sig) != 65 {
+		panic(fmt.Sprintf("wrong size for signature: got %d, want 65", len(sig)))
+	}
+	cpy := &Transaction{data: tx.data}
+	cpy.data.SponsorR = new(big.Int).SetBytes(sig[:32])
+	cpy.data.SponsorS = new(big.Int).SetBytes(sig[32:64])
+	cpy.data.SponsorV = big.NewInt(int64(sig[64] + 35))
+	cpy.data.SponsorV.Add(cpy.data.SponsorV, s.chainIdMul)
+	return cpy, nil
 }
 
 // HomesteadTransaction implements TransactionInterface using the
@@ -208,6 +315,10 @@ func (hs HomesteadSigner) WithSignature(tx *Transaction, sig []byte) (*Transacti
 }
 
 func (hs HomesteadSigner) PublicKey(tx *Transaction) ([]byte, error) {
+	// Validity windows, sponsors and batches are only supported on replay protected transactions
+	if tx.Windowed() || tx.Sponsored() || tx.Batch() {
+		return nil, ErrTxTypeNotSupported
+	}
 	if tx.data.V.BitLen() > 8 {
 		return nil, ErrInvalidSig
 	}
@@ -257,15 +368,30 @@ func (fs FrontierSigner) WithSignature(tx *Transaction, sig []byte) (*Transactio
 // Hash returns the hash to be sned by the sender.
 // It does not uniquely identify the transaction.
 func (fs FrontierSigner) Hash(tx *Transaction) common.Hash {
-	return rlpHash([]interface{}{
-		tx.data.AccountNonce,
-		tx.data.Recipient,
-		tx.data.Amount,
-		tx.data.Payload,
-	})
+	return rlpHash(tx.sigFields())
+}
+
+// SponsorHash returns the hash to be signed by the sponsor. Sponsored transactions
+// need replay protection, so it's only provided for the sake of completeness.
+func (fs FrontierSigner) SponsorHash(tx *Transaction) common.Hash {
+	return rlpHash(append(tx.sigFields(), tx.data.V, tx.data.R, tx.data.S))
+}
+
+// SponsorPublicKey always fails, sponsored transactions need replay protection.
+func (fs FrontierSigner) SponsorPublicKey(tx *Transaction) ([]byte, error) {
+	return nil, ErrTxTypeNotSupported
+}
+
+// WithSponsorSignature always fails, sponsored transactions need replay protection.
+func (fs FrontierSigner) WithSponsorSignature(tx *Transaction, sig []byte) (*Transaction, error) {
+	return nil, ErrTxTypeNotSupported
 }
 
 func (fs FrontierSigner) PublicKey(tx *Transaction) ([]byte, error) {
+	// Validity windows, sponsors and batches are only supported on replay protected transactions
+	if tx.Windowed() || tx.Sponsored() || tx.Batch() {
+		return nil, ErrTxTypeNotSupported
+	}
 	if tx.data.V.BitLen() > 8 {
 		return nil, ErrInvalidSig
 	}
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"crypto/ecdsa"
 	"encoding/json"
+	"math"
 	"math/big"
 	"testing"
 
@@ -28,8 +29,8 @@ import (
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
-// The values in those tests are from the Transaction Tests
-// at github.com/ethereum/tests.
+// The values in those tests are derived from the Transaction Tests at
+// github.com/ethereum/tests, re-encoded without the gas price and gas limit.
 var (
 	emptyTx = NewTransaction(
 		0,
@@ -50,10 +51,10 @@ var (
 )
 
 func TestTransactionSigHash(t *testing.T) {
-	if emptyTx.SigHash(HomesteadSigner{}) != common.HexToHash("c775b99e7ad12f50d819fcd602390467e28141316969f4b57f0626f74fe3b386") {
+	if emptyTx.SigHash(HomesteadSigner{}) != common.HexToHash("e5c1425b12bc2c451b75f275b4e53ca9879caa89665555d5700e687b88212ccd") {
 		t.Errorf("empty transaction hash mismatch, got %x", emptyTx.Hash())
 	}
-	if rightvrsTx.SigHash(HomesteadSigner{}) != common.HexToHash("fe7a79529ed5f7c3375d06b26b186a8644e0e16c373d7a12be41c62d6042b77a") {
+	if rightvrsTx.SigHash(HomesteadSigner{}) != common.HexToHash("f1d3e03e872488787eb3f90420b338e04eab2a5e2860adfe51fb4fcd03ed9f88") {
 		t.Errorf("RightVRS transaction hash mismatch, got %x", rightvrsTx.Hash())
 	}
 }
@@ -63,7 +64,7 @@ func TestTransactionEncode(t *testing.T) {
 	if err != nil {
 		t.Fatalf("encode error: %v", err)
 	}
-	should := common.FromHex("f86103018207d094b94f5374fce5edbc8e2a8697c15331677e6ebf0b0a8255441ca098ff921201554726367d2be8c804a7ff89ccf285ebc57dff8ae4c44b9c19ac4aa08887321be575c8095f789dd4c743dfe42c1820f9231f98a962b210e3ac2452a3")
+	should := common.FromHex("f85d0394b94f5374fce5edbc8e2a8697c15331677e6ebf0b0a8255441ca098ff921201554726367d2be8c804a7ff89ccf285ebc57dff8ae4c44b9c19ac4aa08887321be575c8095f789dd4c743dfe42c1820f9231f98a962b210e3ac2452a3")
 	if !bytes.Equal(txb, should) {
 		t.Errorf("encoded RLP mismatch, got %x", txb)
 	}
@@ -84,7 +85,7 @@ func defaultTestKey() (*ecdsa.PrivateKey, common.Address) {
 
 func TestRecipientEmpty(t *testing.T) {
 	_, addr := defaultTestKey()
-	tx, err := decodeTx(common.Hex2Bytes("f8498080808080011ca09b16de9d5bdee2cf56c28d16275a4da68cd30273e2525f3959f5d62557489921a0372ebd8fb3345f7db7b5a86d42e24d36e983e259b0664ceb8c227ec9af572f3d"))
+	tx, err := decodeTx(common.Hex2Bytes("f847808080011ca0c831e4fc044b89a601156818c0925862290c768a3caeba588c0ca798abd48b2ba02897b7f585e96948e4756c674bf51c01e8de3228464955fff2b4565844d7f52c"))
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
@@ -103,7 +104,7 @@ func TestRecipientEmpty(t *testing.T) {
 func TestRecipientNormal(t *testing.T) {
 	_, addr := defaultTestKey()
 
-	tx, err := decodeTx(common.Hex2Bytes("f85d80808094000000000000000000000000000000000000000080011ca0527c0d8f5c63f7b9f41324a7c8a563ee1190bcbf0dac8ab446291bdbf32f5c79a0552c4ef0a09a04395074dab9ed34d3fbfb843c2f2546cc30fe89ec143ca94ca6"))
+	tx, err := decodeTx(common.Hex2Bytes("f85b8094000000000000000000000000000000000000000080011ba0be351077688d0956d3061616fe95ec5b6c18bd34f0a0b443eb6ea7a5d023592ba05ab3141815b1912eee90dc605f1b02340eac8f61d09f5aab7af739d27687d594"))
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
@@ -120,9 +121,295 @@ func TestRecipientNormal(t *testing.T) {
 	}
 }
 
-// Tests that transactions can be correctly sorted according to their price in
-// decreasing order, but at the same time with increasing nonces when issued by
-// the same account.
+// Tests that transactions with a validity window survive RLP and JSON round
+// trips, that the window is covered by the signature and that only replay
+// protected signers accept them.
+func TestWindowedTransaction(t *testing.T) {
+	key, addr := defaultTestKey()
+	to := common.HexToAddress("b94f5374fce5edbc8e2a8697c15331677e6ebf0b")
+
+	signer := NewEIP155Signer(big.NewInt(18))
+	tx, err := SignTx(NewWindowedTransaction(3, &to, big.NewInt(10), common.FromHex("5544"), 100, 200), signer, key)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	// Ensure the RLP encoding round trips and is distinct from the legacy one
+	enc, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	if fields := countFields(enc); fields != windowedTxFields {
+		t.Fatalf("encoded field count mismatch: have %d, want %d", fields, windowedTxFields)
+	}
+	dec, err := decodeTx(enc)
+	if err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if dec.Hash() != tx.Hash() || dec.ValidFrom() != 100 || dec.ValidUntil() != 200 || dec.Size() != common.StorageSize(len(enc)) {
+		t.Fatalf("decoded transaction mismatch: have %x [%d, %d], want %x [100, 200]", dec.Hash(), dec.ValidFrom(), dec.ValidUntil(), tx.Hash())
+	}
+	if from, err := Sender(signer, dec); err != nil || from != addr {
+		t.Fatalf("sender mismatch: have %x (%v), want %x", from, err, addr)
+	}
+	// Ensure the JSON encoding round trips
+	blob, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatalf("json encode error: %v", err)
+	}
+	var parsed Transaction
+	if err := json.Unmarshal(blob, &parsed); err != nil {
+		t.Fatalf("json decode error: %v", err)
+	}
+	if parsed.Hash() != tx.Hash() {
+		t.Fatalf("json decoded hash mismatch: have %x, want %x", parsed.Hash(), tx.Hash())
+	}
+	// Ensure tampering with the window invalidates the signature
+	tampered := *tx.data.ValidUntil + 1
+	forged := &Transaction{data: tx.data}
+	forged.data.ValidUntil = &tampered
+	if from, err := Sender(signer, forged); err == nil && from == addr {
+		t.Fatalf("tampered window retained sender")
+	}
+	// Ensure unprotected signatures are rejected
+	unprotected, _ := SignTx(NewWindowedTransaction(3, &to, big.NewInt(10), nil, 100, 200), HomesteadSigner{}, key)
+	if _, err := Sender(HomesteadSigner{}, unprotected); err != ErrTxTypeNotSupported {
+		t.Fatalf("unprotected sender error mismatch: have %v, want %v", err, ErrTxTypeNotSupported)
+	}
+	// Ensure legacy transactions are encoded as before
+	legacy, _ := SignTx(NewTransaction(3, to, big.NewInt(10), nil), signer, key)
+	enc, _ = rlp.EncodeToBytes(legacy)
+	if fields := countFields(enc); fields != legacyTxFields {
+		t.Fatalf("legacy field count mismatch: have %d, want %d", fields, legacyTxFields)
+	}
+	if legacy.Windowed() || legacy.ValidFrom() != 0 || legacy.ValidUntil() != math.MaxUint64 {
+		t.Fatalf("legacy transaction window mismatch: have [%d, %d]", legacy.ValidFrom(), legacy.ValidUntil())
+	}
+}
+
+// Tests that sponsored transactions round trip through their encodings and that
+// both the sender and the sponsor signatures are verified.
+func TestSponsoredTransaction(t *testing.T) {
+	key, addr := defaultTestKey()
+	sponsorKey, _ := crypto.GenerateKey()
+	sponsor := crypto.PubkeyToAddress(sponsorKey.PublicKey)
+	to := common.HexToAddress("b94f5374fce5edbc8e2a8697c15331677e6ebf0b")
+
+	signer := NewEIP155Signer(big.NewInt(18))
+	for i, unsigned := range []*Transaction{
+		NewTransaction(3, to, big.NewInt(10), common.FromHex("5544")),
+		NewWindowedTransaction(3, &to, big.NewInt(10), common.FromHex("5544"), 100, 200),
+	} {
+		tx, err := SignTx(unsigned.WithSponsor(sponsor), signer, key)
+		if err != nil {
+			t.Fatalf("test %d: failed to sign transaction: %v", i, err)
+		}
+		if tx, err = SponsorTx(tx, signer, sponsorKey); err != nil {
+			t.Fatalf("test %d: failed to sponsor transaction: %v", i, err)
+		}
+		// Ensure the RLP encoding round trips with both signatures intact
+		enc, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			t.Fatalf("test %d: encode error: %v", i, err)
+		}
+		want := sponsoredTxFields
+		if tx.Windowed() {
+			want = windowedSponsoredTxFields
+		}
+		if fields := countFields(enc); fields != want {
+			t.Fatalf("test %d: encoded field count mismatch: have %d, want %d", i, fields, want)
+		}
+		dec, err := decodeTx(enc)
+		if err != nil {
+			t.Fatalf("test %d: decode error: %v", i, err)
+		}
+		if dec.Hash() != tx.Hash() || dec.Windowed() != tx.Windowed() || dec.Size() != common.StorageSize(len(enc)) {
+			t.Fatalf("test %d: decoded transaction mismatch: have %x, want %x", i, dec.Hash(), tx.Hash())
+		}
+		if from, err := Sender(signer, dec); err != nil || from != addr {
+			t.Fatalf("test %d: sender mismatch: have %x (%v), want %x", i, from, err, addr)
+		}
+		if payer, err := Payer(signer, dec); err != nil || payer != sponsor {
+			t.Fatalf("test %d: payer mismatch: have %x (%v), want %x", i, payer, err, sponsor)
+		}
+		// Ensure the JSON encoding round trips
+		blob, err := json.Marshal(tx)
+		if err != nil {
+			t.Fatalf("test %d: json encode error: %v", i, err)
+		}
+		var parsed Transaction
+		if err := json.Unmarshal(blob, &parsed); err != nil {
+			t.Fatalf("test %d: json decode error: %v", i, err)
+		}
+		if parsed.Hash() != tx.Hash() || *parsed.Sponsor() != sponsor {
+			t.Fatalf("test %d: json decoded mismatch: have %x, want %x", i, parsed.Hash(), tx.Hash())
+		}
+		// Ensure swapping the sponsor invalidates both signatures
+		other := common.HexToAddress("0x01")
+		forged := &Transaction{data: dec.data}
+		forged.data.Sponsor = &other
+		if from, err := Sender(signer, forged); err == nil && from == addr {
+			t.Fatalf("test %d: swapped sponsor retained sender", i)
+		}
+		if _, err := Sponsor(signer, forged); err != ErrInvalidSponsor {
+			t.Fatalf("test %d: swapped sponsor error mismatch: have %v, want %v", i, err, ErrInvalidSponsor)
+		}
+	}
+	// Ensure sponsorship requires replay protection
+	unprotected, _ := SignTx(NewTransaction(3, to, big.NewInt(10), nil).WithSponsor(sponsor), HomesteadSigner{}, key)
+	if _, err := Sender(HomesteadSigner{}, unprotected); err != ErrTxTypeNotSupported {
+		t.Fatalf("unprotected sender error mismatch: have %v, want %v", err, ErrTxTypeNotSupported)
+	}
+}
+
+// Tests that batch transactions round trip through their encodings, combined
+// with the other transaction extensions, and that malformed batches are rejected.
+func TestBatchTransaction(t *testing.T) {
+	key, addr := defaultTestKey()
+	sponsorKey, _ := crypto.GenerateKey()
+	sponsor := crypto.PubkeyToAddress(sponsorKey.PublicKey)
+
+	calls := []*Call{
+		{To: common.HexToAddress("b94f5374fce5edbc8e2a8697c15331677e6ebf0b"), Value: big.NewInt(10), Data: common.FromHex("5544")},
+		{To: common.HexToAddress("0x01"), Value: big.NewInt(0)},
+	}
+	signer := NewEIP155Signer(big.NewInt(18))
+
+	sponsored, _ := SignTx(NewWindowedBatchTransaction(3, calls, 100, 200).WithSponsor(sponsor), signer, key)
+	sponsored, _ = SponsorTx(sponsored, signer, sponsorKey)
+
+	for i, test := range []struct {
+		tx     *Transaction
+		fields int
+	}{
+		{NewBatchTransaction(3, calls), legacyTxFields + 1},
+		{sponsored, windowedSponsoredTxFields + 1},
+	} {
+		tx := test.tx
+		if !tx.Sponsored() {
+			tx, _ = SignTx(tx, signer, key)
+		}
+		// Ensure the RLP encoding round trips
+		enc, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			t.Fatalf("test %d: encode error: %v", i, err)
+		}
+		if fields := countFields(enc); fields != test.fields {
+			t.Fatalf("test %d: encoded field count mismatch: have %d, want %d", i, fields, test.fields)
+		}
+		dec, err := decodeTx(enc)
+		if err != nil {
+			t.Fatalf("test %d: decode error: %v", i, err)
+		}
+		if dec.Hash() != tx.Hash() || !dec.Batch() || len(dec.Calls()) != len(calls) || dec.Windowed() != tx.Windowed() || dec.Sponsored() != tx.Sponsored() {
+			t.Fatalf("test %d: decoded transaction mismatch: have %x, want %x", i, dec.Hash(), tx.Hash())
+		}
+		if from, err := Sender(signer, dec); err != nil || from != addr {
+			t.Fatalf("test %d: sender mismatch: have %x (%v), want %x", i, from, err, addr)
+		}
+		if value := dec.TotalValue(); value.Cmp(big.NewInt(10)) != 0 {
+			t.Fatalf("test %d: total value mismatch: have %v, want %v", i, value, 10)
+		}
+		// Ensure the JSON encoding round trips
+		blob, err := json.Marshal(tx)
+		if err != nil {
+			t.Fatalf("test %d: json encode error: %v", i, err)
+		}
+		var parsed Transaction
+		if err := json.Unmarshal(blob, &parsed); err != nil {
+			t.Fatalf("test %d: json decode error: %v", i, err)
+		}
+		if parsed.Hash() != tx.Hash() {
+			t.Fatalf("test %d: json decoded hash mismatch: have %x, want %x", i, parsed.Hash(), tx.Hash())
+		}
+	}
+	// Ensure tampering with the calls invalidates the signature
+	tx, _ := SignTx(NewBatchTransaction(3, calls), signer, key)
+	forged := &Transaction{data: tx.data}
+	forged.data.Calls = []*Call{calls[1], calls[0]}
+	if from, err := Sender(signer, forged); err == nil && from == addr {
+		t.Fatalf("reordered calls retained sender")
+	}
+	// Ensure batches with a top level recipient are rejected
+	invalid := &Transaction{data: tx.data}
+	invalid.data.Recipient = &calls[0].To
+	enc, _ := rlp.EncodeToBytes(invalid)
+	if _, err := decodeTx(enc); err != errInvalidBatch {
+		t.Fatalf("invalid batch error mismatch: have %v, want %v", err, errInvalidBatch)
+	}
+	// Ensure unprotected signatures are rejected
+	unprotected, _ := SignTx(NewBatchTransaction(3, calls), HomesteadSigner{}, key)
+	if _, err := Sender(HomesteadSigner{}, unprotected); err != ErrTxTypeNotSupported {
+		t.Fatalf("unprotected sender error mismatch: have %v, want %v", err, ErrTxTypeNotSupported)
+	}
+	// Ensure stored receipts retain the call results and remain compatible
+	// with ones storing only a sponsor
+	receipt := &Receipt{
+		Logs:    []*Log{},
+		Sponsor: &sponsor,
+		Calls:   []*CallResult{{Status: ReceiptStatusSuccessful, ReturnData: []byte{0x2a}}, {Status: ReceiptStatusFailed}},
+	}
+	for _, want := range []*Receipt{receipt, {Logs: []*Log{}, Sponsor: &sponsor}, {Logs: []*Log{}, Calls: receipt.Calls}} {
+		enc, err := rlp.EncodeToBytes((*ReceiptForStorage)(want))
+		if err != nil {
+			t.Fatalf("receipt encode error: %v", err)
+		}
+		var have ReceiptForStorage
+		if err := rlp.DecodeBytes(enc, &have); err != nil {
+			t.Fatalf("receipt decode error: %v", err)
+		}
+		if (have.Sponsor == nil) != (want.Sponsor == nil) || len(have.Calls) != len(want.Calls) {
+			t.Fatalf("receipt mismatch: have sponsor %v with %d calls, want %v with %d", have.Sponsor, len(have.Calls), want.Sponsor, len(want.Calls))
+		}
+		for i := range want.Calls {
+			if have.Calls[i].Status != want.Calls[i].Status || !bytes.Equal(have.Calls[i].ReturnData, want.Calls[i].ReturnData) {
+				t.Fatalf("receipt call %d mismatch: have %+v, want %+v", i, have.Calls[i], want.Calls[i])
+			}
+		}
+	}
+}
+
+// Tests that lists of transactions decode from a size limited stream, as done for
+// network messages, even if the last transaction is too large to be buffered.
+func TestTransactionStreamDecoding(t *testing.T) {
+	key, _ := defaultTestKey()
+	to := common.HexToAddress("b94f5374fce5edbc8e2a8697c15331677e6ebf0b")
+	signer := NewEIP155Signer(big.NewInt(18))
+
+	for _, size := range []int{100, 10 * 1024} {
+		legacy, _ := SignTx(NewTransaction(0, to, big.NewInt(10), make([]byte, size)), signer, key)
+		windowed, _ := SignTx(NewWindowedTransaction(1, &to, big.NewInt(10), make([]byte, size), 100, 200), signer, key)
+
+		for _, txs := range [][]*Transaction{{windowed, legacy}, {legacy, windowed}} {
+			n, r, err := rlp.EncodeToReader(txs)
+			if err != nil {
+				t.Fatalf("encode error: %v", err)
+			}
+			var dec []*Transaction
+			if err := rlp.NewStream(r, uint64(n)).Decode(&dec); err != nil {
+				t.Fatalf("payload %d: decode error: %v", size, err)
+			}
+			if len(dec) != len(txs) {
+				t.Fatalf("payload %d: transaction count mismatch: have %d, want %d", size, len(dec), len(txs))
+			}
+			for i, tx := range txs {
+				if dec[i].Hash() != tx.Hash() {
+					t.Errorf("payload %d: transaction %d mismatch: have %x, want %x", size, i, dec[i].Hash(), tx.Hash())
+				}
+			}
+		}
+	}
+}
+
+// countFields returns the number of items in an RLP encoded list.
+func countFields(enc []byte) int {
+	content, _, _ := rlp.SplitList(enc)
+	fields, _ := rlp.CountValues(content)
+	return fields
+}
+
+// Tests that transactions can be correctly sorted according to their nonce across
+// accounts, but at the same time with increasing nonces when issued by the same
+// account.
 func TestTransactionPriceNonceSort(t *testing.T) {
 	// Generate a batch of accounts to start with
 	keys := make([]*ecdsa.PrivateKey, 25)
@@ -136,7 +423,7 @@ func TestTransactionPriceNonceSort(t *testing.T) {
 	for start, key := range keys {
 		addr := crypto.PubkeyToAddress(key.PublicKey)
 		for i := 0; i < 25; i++ {
-			tx, _ := SignTx(NewTransaction(uint64(start+i), common.Address{}, big.NewInt(100), big.NewInt(100), big.NewInt(int64(start+i)), nil), signer, key)
+			tx, _ := SignTx(NewTransaction(uint64(start+i), common.Address{}, big.NewInt(100), nil), signer, key)
 			groups[addr] = append(groups[addr], tx)
 		}
 	}
@@ -144,12 +431,12 @@ func TestTransactionPriceNonceSort(t *testing.T) {
 	txset := NewTransactionsByPriceAndNonce(groups)
 
 	txs := Transactions{}
-	for {
-		if tx := txset.Peek(); tx != nil {
-			txs = append(txs, tx)
-			txset.Shift()
-		}
-		break
+	for tx := txset.Peek(); tx != nil; tx = txset.Peek() {
+		txs = append(txs, tx)
+		txset.Shift()
+	}
+	if len(txs) != 25*25 {
+		t.Errorf("transaction count mismatch: have %d, want %d", len(txs), 25*25)
 	}
 	for i, txi := range txs {
 		fromi, _ := Sender(signer, txi)
@@ -176,14 +463,14 @@ func TestTransactionPriceNonceSort(t *testing.T) {
 				break
 			}
 		}
-		// Make sure that in between the neighbor nonces, the transaction is correctly positioned price wise
+		// Make sure that in between the neighbor nonces, the transaction is correctly positioned nonce wise
 		for j := prev + 1; j < next; j++ {
 			fromj, _ := Sender(signer, txs[j])
-			if j < i && txs[j].GasPrice().Cmp(txi.GasPrice()) < 0 {
-				t.Errorf("invalid gasprice ordering: tx #%d (A=%x P=%v) < tx #%d (A=%x P=%v)", j, fromj[:4], txs[j].GasPrice(), i, fromi[:4], txi.GasPrice())
+			if j < i && txs[j].Nonce() > txi.Nonce() {
+				t.Errorf("invalid nonce ordering: tx #%d (A=%x N=%v) > tx #%d (A=%x N=%v)", j, fromj[:4], txs[j].Nonce(), i, fromi[:4], txi.Nonce())
 			}
-			if j > i && txs[j].GasPrice().Cmp(txi.GasPrice()) > 0 {
-				t.Errorf("invalid gasprice ordering: tx #%d (A=%x P=%v) > tx #%d (A=%x P=%v)", j, fromj[:4], txs[j].GasPrice(), i, fromi[:4], txi.GasPrice())
+			if j > i && txs[j].Nonce() < txi.Nonce() {
+				t.Errorf("invalid nonce ordering: tx #%d (A=%x N=%v) < tx #%d (A=%x N=%v)", j, fromj[:4], txs[j].Nonce(), i, fromi[:4], txi.Nonce())
 			}
 		}
 	}
@@ -201,9 +488,9 @@ func TestTransactionJSON(t *testing.T) {
 		var tx *Transaction
 		switch i % 2 {
 		case 0:
-			tx = NewTransaction(i, common.Address{1}, common.Big0, common.Big1, common.Big2, []byte("abcdef"))
+			tx = NewTransaction(i, common.Address{1}, common.Big0, []byte("abcdef"))
 		case 1:
-			tx = NewContractCreation(i, common.Big0, common.Big1, common.Big2, []byte("abcdef"))
+			tx = NewContractCreation(i, common.Big0, []byte("abcdef"))
 		}
 
 		tx, err := SignTx(tx, signer, key)
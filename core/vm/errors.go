@@ -24,4 +24,5 @@ var (
 	ErrDepth               = errors.New("max call depth exceeded")
 	ErrTraceLimitReached   = errors.New("the number of logs reached the specified limit")
 	ErrInsufficientBalance = errors.New("insufficient balance for transfer")
+	ErrStepLimitReached    = errors.New("execution step limit reached")
 )
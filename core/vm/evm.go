@@ -96,6 +96,8 @@ type EVM struct {
 	// abort is used to abort the EVM calling operations
 	// NOTE: must be set atomically
 	abort int32
+	// steps counts the instructions executed across all call frames
+	steps uint64
 }
 
 // NewEVM retutrns a new EVM evmironment. The returned EVM is not thread safe
@@ -106,13 +108,18 @@ func NewEVM(ctx Context, statedb StateDB, chainConfig *params.ChainConfig, vmCon
 		StateDB:     statedb,
 		vmConfig:    vmConfig,
 		chainConfig: chainConfig,
-		chainRules:  chainConfig.Rules(ctx.BlockNumber),
+		chainRules:  chainConfig.Rules(ctx.BlockNumber, ctx.Time),
 	}
 
 	evm.interpreter = NewInterpreter(evm, vmConfig)
 	return evm
 }
 
+// Steps returns the number of instructions executed so far across all call frames.
+func (evm *EVM) Steps() uint64 {
+	return evm.steps
+}
+
 // Cancel cancels any running EVM operation. This may be called concurrently and
 // it's safe to be called multiple times.
 func (evm *EVM) Cancel() {
@@ -268,7 +275,7 @@ func (evm *EVM) Create(caller ContractRef, code []byte, value *big.Int) (ret []b
 
 	ret, err = run(evm, snapshot, contract, nil)
 	// check whether the max code size has been exceeded
-	maxCodeSizeExceeded := len(ret) > params.MaxCodeSize
+	maxCodeSizeExceeded := uint64(len(ret)) > evm.chainRules.MaxCodeSize
 	// When an error was returned by the EVM or when setting the creation code
 	// above we revert to the snapshot and consume any gas remaining. Additionally
 	// when we're in homestead this also counts for code storage gas errors.
@@ -290,5 +297,8 @@ func (evm *EVM) Create(caller ContractRef, code []byte, value *big.Int) (ret []b
 // ChainConfig returns the evmironment's chain configuration
 func (evm *EVM) ChainConfig() *params.ChainConfig { return evm.chainConfig }
 
+// ChainRules returns the protocol rules in force for the evmironment's block
+func (evm *EVM) ChainRules() params.Rules { return evm.chainRules }
+
 // Interpreter returns the EVM interpreter
 func (evm *EVM) Interpreter() *Interpreter { return evm.interpreter }
@@ -45,6 +45,10 @@ type Config struct {
 	DisableGasMetering bool
 	// Enable recording of SHA3/keccak preimages
 	EnablePreimageRecording bool
+	// StepLimit is the maximum number of instructions executed across all the
+	// call frames of the EVM (0 = unlimited). It is not a consensus rule, but an
+	// execution budget for speculative runs.
+	StepLimit uint64
 	// JumpTable contains the EVM instruction table. This
 	// may me left uninitialised and will be set the default
 	// table.
@@ -68,9 +72,14 @@ type Interpreter struct {
 func NewInterpreter(evm *EVM, cfg Config) *Interpreter {
 	// We use the STOP instruction whether to see
 	// the jump table was initialised. If it was not
-	// we'll set the default jump table.
+	// we'll set the jump table of the current rules.
 	if !cfg.JumpTable[STOP].valid {
-		cfg.JumpTable = frontierInstructionSet
+		switch {
+		case evm.ChainRules().Enabled(params.FeatureDelegateCall):
+			cfg.JumpTable = homesteadInstructionSet
+		default:
+			cfg.JumpTable = frontierInstructionSet
+		}
 	}
 
 	return &Interpreter{
@@ -143,6 +152,10 @@ func (in *Interpreter) Run(snapshot int, contract *Contract, input []byte) (ret
 		if err := in.enforceRestrictions(op, operation, stack); err != nil {
 			return nil, err
 		}
+		// abort the execution if it exhausted the step budget
+		if in.evm.steps++; in.cfg.StepLimit > 0 && in.evm.steps > in.cfg.StepLimit {
+			return nil, ErrStepLimitReached
+		}
 
 		// if the op is invalid abort the process and return an error
 		if !operation.valid {
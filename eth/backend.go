@@ -27,7 +27,11 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/bft"
 	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/consensus/instant"
+	"github.com/ethereum/go-ethereum/consensus/transition"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
@@ -53,6 +57,7 @@ type LesServer interface {
 
 // Ethereum implements the Ethereum full node service.
 type Ethereum struct {
+	config      *Config
 	chainConfig *params.ChainConfig
 	// Channel for shutting down the service
 	shutdownChan  chan bool // Channel for shutting down the ethereum
@@ -72,6 +77,8 @@ type Ethereum struct {
 	ApiBackend *EthApiBackend
 
 	miner     *miner.Miner
+	remote    *miner.RemoteAgent   // Agent serving work to external miners
+	stratum   *miner.StratumServer // Stratum server pushing the remote work (nil if disabled)
 	etherbase common.Address
 
 	networkId     uint64
@@ -99,6 +106,7 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 	log.Info("Initialised chain configuration", "config", chainConfig)
 
 	eth := &Ethereum{
+		config:         config,
 		chainDb:        chainDb,
 		chainConfig:    chainConfig,
 		eventMux:       ctx.EventMux,
@@ -124,7 +132,7 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 	}
 
 	vmConfig := vm.Config{EnablePreimageRecording: config.EnablePreimageRecording}
-	eth.blockchain, err = core.NewBlockChain(chainDb, eth.chainConfig, eth.engine, eth.eventMux, vmConfig)
+	eth.blockchain, err = core.NewBlockChain(chainDb, eth.chainConfig, eth.engine, eth.eventMux, vmConfig, config.TxLookupLimit)
 	if err != nil {
 		return nil, err
 	}
@@ -135,18 +143,45 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 		core.WriteChainConfig(chainDb, genesisHash, chainConfig)
 	}
 
+	if config.TxPool.Journal != "" {
+		config.TxPool.Journal = ctx.ResolvePath(config.TxPool.Journal)
+	}
 	newPool := core.NewTxPool(config.TxPool, eth.chainConfig, eth.EventMux(), eth.blockchain.State)
 	eth.txPool = newPool
+	eth.txPool.SetChain(eth.blockchain)
+
+	// Enforce the same admission filters on block import, mining and the pool
+	if filter := core.NewTxFilter(config.TxFilter); filter != nil {
+		eth.blockchain.SetTxFilter(filter)
+		eth.txPool.SetTxFilter(filter)
+	}
 
 	maxPeers := config.MaxPeers
+	if config.LightServ > 0 {
+		// if we are running a light server, limit the number of ETH peers so that we reserve some space for incoming LES connections
+		// temporary solution until the new peer connectivity API is finished
+		halfPeers := maxPeers / 2
+		maxPeers -= config.LightPeers
+		if maxPeers < halfPeers {
+			maxPeers = halfPeers
+		}
+	}
 
-	if eth.protocolManager, err = NewProtocolManager(eth.chainConfig, config.NetworkId, maxPeers, eth.eventMux, eth.txPool, eth.engine, eth.blockchain, chainDb); err != nil {
+	if eth.protocolManager, err = NewProtocolManager(eth.chainConfig, config.SyncMode, config.NetworkId, maxPeers, eth.eventMux, eth.txPool, eth.engine, eth.blockchain, chainDb); err != nil {
 		return nil, err
 	}
 
-	eth.miner = miner.New(eth, eth.chainConfig, eth.EventMux(), eth.engine)
+	eth.miner = miner.New(eth, eth.chainConfig, eth.EventMux(), eth.engine, config.Miner)
 	eth.miner.SetExtra(makeExtraData(config.ExtraData))
 
+	eth.remote = miner.NewRemoteAgent(eth.BlockChain(), eth.engine)
+	eth.miner.Register(eth.remote)
+
+	// Run the consensus rounds if the engine agrees on blocks before sealing
+	if bft := eth.bft(); bft != nil {
+		bft.Start(eth.blockchain, eth.eventMux)
+	}
+
 	eth.ApiBackend = &EthApiBackend{eth}
 	return eth, nil
 }
@@ -182,8 +217,50 @@ func CreateDB(ctx *node.ServiceContext, config *Config, name string) (ethdb.Data
 
 // CreateConsensusEngine creates the required type of consensus engine instance for an Ethereum service
 func CreateConsensusEngine(ctx *node.ServiceContext, config *Config, chainConfig *params.ChainConfig, db ethdb.Database) consensus.Engine {
-	return clique.New(chainConfig.Clique, db)
+	engine := createConsensusEngine(ctx, config, chainConfig, db)
+
+	// If the chain switches engines at some block, hand it over there
+	if t := chainConfig.Transition; t != nil {
+		after := createConsensusEngine(ctx, config, chainConfig.AfterTransition(), db)
+		return transition.New(engine, after, t.Block.Uint64(), t.Signers)
+	}
+	return engine
+}
 
+// createConsensusEngine creates the consensus engine configured at the top level
+// of the chain config.
+func createConsensusEngine(ctx *node.ServiceContext, config *Config, chainConfig *params.ChainConfig, db ethdb.Database) consensus.Engine {
+	// If proof-of-authority is requested, set it up
+	if chainConfig.Clique != nil {
+		engine := clique.New(chainConfig.Clique, db)
+		engine.SetDropInactive(config.CliqueDropInactive)
+		return engine
+	}
+	// If on demand sealing is requested, set it up
+	if chainConfig.Instant != nil {
+		return instant.New(chainConfig.Instant)
+	}
+	// If byzantine fault tolerance is requested, set it up
+	if chainConfig.BFT != nil {
+		return bft.New(chainConfig.BFT, db)
+	}
+	// Otherwise assume proof-of-work
+	switch {
+	case config.PowFake:
+		log.Warn("Ethash used in fake mode")
+		return ethash.NewFaker()
+	case config.PowTest:
+		log.Warn("Ethash used in test mode")
+		return ethash.NewTester()
+	case config.PowShared:
+		log.Warn("Ethash used in shared mode")
+		return ethash.NewShared()
+	default:
+		engine := ethash.New(ctx.ResolvePath(config.EthashCacheDir), config.EthashCachesInMem, config.EthashCachesOnDisk,
+			config.EthashDatasetDir, config.EthashDatasetsInMem, config.EthashDatasetsOnDisk)
+		engine.SetThreads(-1) // Disable CPU mining
+		return engine
+	}
 }
 
 // APIs returns the collection of RPC services the ethereum package offers.
@@ -278,7 +355,7 @@ func (s *Ethereum) StartMining(local bool) error {
 		log.Error("Cannot start mining without etherbase", "err", err)
 		return fmt.Errorf("etherbase missing: %v", err)
 	}
-	if clique, ok := s.engine.(*clique.Clique); ok {
+	if clique := s.clique(); clique != nil {
 		wallet, err := s.accountManager.Find(accounts.Account{Address: eb})
 		if wallet == nil || err != nil {
 			log.Error("Etherbase account unavailable locally", "err", err)
@@ -286,6 +363,14 @@ func (s *Ethereum) StartMining(local bool) error {
 		}
 		clique.Authorize(eb, wallet.SignHash)
 	}
+	if bft := s.bft(); bft != nil {
+		wallet, err := s.accountManager.Find(accounts.Account{Address: eb})
+		if wallet == nil || err != nil {
+			log.Error("Etherbase account unavailable locally", "err", err)
+			return fmt.Errorf("signer missing: %v", err)
+		}
+		bft.Authorize(eb, wallet.SignHash)
+	}
 	if local {
 		// If local (CPU) mining is started, we can disable the transaction rejection
 		// mechanism introduced to speed sync times. CPU mining on mainnet is ludicrous
@@ -297,6 +382,47 @@ func (s *Ethereum) StartMining(local bool) error {
 	return nil
 }
 
+// engines returns the consensus engines sealing the chain, being the ones on
+// either side of the switch if the chain transitions between engines.
+func (s *Ethereum) engines() []consensus.Engine {
+	if t, ok := s.engine.(*transition.Transition); ok {
+		before, after := t.Engines()
+		return []consensus.Engine{before, after}
+	}
+	return []consensus.Engine{s.engine}
+}
+
+// clique returns the proof-of-authority engine sealing the chain, if any.
+func (s *Ethereum) clique() *clique.Clique {
+	for _, engine := range s.engines() {
+		if clique, ok := engine.(*clique.Clique); ok {
+			return clique
+		}
+	}
+	return nil
+}
+
+// bft returns the byzantine fault tolerant engine sealing the chain, if any.
+func (s *Ethereum) bft() *bft.BFT {
+	for _, engine := range s.engines() {
+		if bft, ok := engine.(*bft.BFT); ok {
+			return bft
+		}
+	}
+	return nil
+}
+
+// powEngine returns the proof-of-work engine sealing the chain, falling back to
+// the chain's engine if none does.
+func (s *Ethereum) powEngine() consensus.Engine {
+	for _, engine := range s.engines() {
+		if _, ok := engine.(consensus.PoW); ok {
+			return engine
+		}
+	}
+	return s.engine
+}
+
 func (s *Ethereum) StopMining()         { s.miner.Stop() }
 func (s *Ethereum) IsMining() bool      { return s.miner.Mining() }
 func (s *Ethereum) Miner() *miner.Miner { return s.miner }
@@ -315,11 +441,14 @@ func (s *Ethereum) Downloader() *downloader.Downloader { return s.protocolManage
 // Protocols implements node.Service, returning all the currently configured
 // network protocols to start.
 func (s *Ethereum) Protocols() []p2p.Protocol {
-	if s.lesServer == nil {
-		return s.protocolManager.SubProtocols
-	} else {
-		return append(s.protocolManager.SubProtocols, s.lesServer.Protocols()...)
+	protocols := s.protocolManager.SubProtocols
+	if s.lesServer != nil {
+		protocols = append(protocols, s.lesServer.Protocols()...)
 	}
+	if bft := s.bft(); bft != nil {
+		protocols = append(protocols, bft.Protocols()...)
+	}
+	return protocols
 }
 
 // Start implements node.Service, starting all internal goroutines needed by the
@@ -331,6 +460,13 @@ func (s *Ethereum) Start(srvr *p2p.Server) error {
 	if s.lesServer != nil {
 		s.lesServer.Start(srvr)
 	}
+	if s.config.Stratum.Addr != "" {
+		stratum, err := miner.NewStratumServer(s.remote, s.powEngine(), s.config.Stratum)
+		if err != nil {
+			return err
+		}
+		s.stratum = stratum
+	}
 	return nil
 }
 
@@ -340,12 +476,18 @@ func (s *Ethereum) Stop() error {
 	if s.stopDbUpgrade != nil {
 		s.stopDbUpgrade()
 	}
+	if bft := s.bft(); bft != nil {
+		bft.Stop()
+	}
 	s.blockchain.Stop()
 	s.protocolManager.Stop()
 	if s.lesServer != nil {
 		s.lesServer.Stop()
 	}
 	s.txPool.Stop()
+	if s.stratum != nil {
+		s.stratum.Stop()
+	}
 	s.miner.Stop()
 	s.eventMux.Stop()
 
@@ -26,6 +26,8 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/miner"
 	"github.com/ethereum/go-ethereum/params"
 )
 
@@ -37,11 +39,14 @@ var DefaultConfig = Config{
 	EthashDatasetsInMem:  1,
 	EthashDatasetsOnDisk: 2,
 	NetworkId:            1,
+	SyncMode:             downloader.FastSync,
 	LightPeers:           20,
 	DatabaseCache:        128,
 	GasPrice:             big.NewInt(18 * params.Shannon),
 
-	TxPool: core.DefaultTxPoolConfig,
+	Miner:   miner.DefaultConfig,
+	Stratum: miner.DefaultStratumConfig,
+	TxPool:  core.DefaultTxPoolConfig,
 }
 
 func init() {
@@ -67,6 +72,7 @@ type Config struct {
 
 	// Protocol options
 	NetworkId uint64 // Network ID to use for selecting peers to connect to
+	SyncMode  downloader.SyncMode
 
 	// Light client options
 	LightServ  int `toml:",omitempty"` // Maximum percentage of time allowed for serving LES requests
@@ -78,11 +84,17 @@ type Config struct {
 	DatabaseHandles    int  `toml:"-"`
 	DatabaseCache      int
 
+	// Number of recent blocks to maintain transaction lookups for (0 = entire chain).
+	// Older transactions keep a small marker so lookups can report them as pruned.
+	TxLookupLimit uint64 `toml:",omitempty"`
+
 	// Mining-related options
 	Etherbase    common.Address `toml:",omitempty"`
 	MinerThreads int            `toml:",omitempty"`
 	ExtraData    []byte         `toml:",omitempty"`
 	GasPrice     *big.Int
+	Miner        miner.Config
+	Stratum      miner.StratumConfig
 
 	// Ethash options
 	EthashCacheDir       string
@@ -92,8 +104,12 @@ type Config struct {
 	EthashDatasetsInMem  int
 	EthashDatasetsOnDisk int
 
+	// Clique options
+	CliqueDropInactive uint64 `toml:",omitempty"`
+
 	// Transaction pool options
-	TxPool core.TxPoolConfig
+	TxPool   core.TxPoolConfig
+	TxFilter core.TxFilterConfig
 
 	// Enables tracking of SHA3 preimages in the VM
 	EnablePreimageRecording bool
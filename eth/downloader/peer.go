@@ -75,12 +75,58 @@ type peerConnection struct {
 	lock    sync.RWMutex
 }
 
-// Peer encapsulates the methods required to synchronise with a remote full peer.
-type Peer interface {
+// LightPeer encapsulates the methods required to synchronise with a remote light peer.
+type LightPeer interface {
 	Head() (common.Hash, *big.Int)
 	RequestHeadersByHash(common.Hash, int, int, bool) error
 	RequestHeadersByNumber(uint64, int, int, bool) error
+}
+
+// Peer encapsulates the methods required to synchronise with a remote full peer.
+type Peer interface {
+	LightPeer
 	RequestBodies([]common.Hash) error
+	RequestReceipts([]common.Hash) error
+	RequestNodeData([]common.Hash) error
+}
+
+// MisbehaviourReporter is optionally implemented by peers tracking the reputation
+// of the remote node, letting the downloader report the failures it detects.
+type MisbehaviourReporter interface {
+	RequestTimedOut()       // A data retrieval request expired unanswered
+	DeliveredInvalidChain() // The delivered chain segment failed validation
+}
+
+// lightPeerWrapper wraps a LightPeer struct, stubbing out the Peer-only methods.
+type lightPeerWrapper struct {
+	peer LightPeer
+}
+
+func (w *lightPeerWrapper) Head() (common.Hash, *big.Int) { return w.peer.Head() }
+func (w *lightPeerWrapper) RequestHeadersByHash(h common.Hash, amount int, skip int, reverse bool) error {
+	return w.peer.RequestHeadersByHash(h, amount, skip, reverse)
+}
+func (w *lightPeerWrapper) RequestHeadersByNumber(i uint64, amount int, skip int, reverse bool) error {
+	return w.peer.RequestHeadersByNumber(i, amount, skip, reverse)
+}
+func (w *lightPeerWrapper) RequestBodies([]common.Hash) error {
+	panic("RequestBodies not supported in light client mode sync")
+}
+func (w *lightPeerWrapper) RequestReceipts([]common.Hash) error {
+	panic("RequestReceipts not supported in light client mode sync")
+}
+func (w *lightPeerWrapper) RequestNodeData([]common.Hash) error {
+	panic("RequestNodeData not supported in light client mode sync")
+}
+func (w *lightPeerWrapper) RequestTimedOut() {
+	if reporter, ok := w.peer.(MisbehaviourReporter); ok {
+		reporter.RequestTimedOut()
+	}
+}
+func (w *lightPeerWrapper) DeliveredInvalidChain() {
+	if reporter, ok := w.peer.(MisbehaviourReporter); ok {
+		reporter.DeliveredInvalidChain()
+	}
 }
 
 // newPeerConnection creates a new downloader peer.
@@ -154,6 +200,45 @@ func (p *peerConnection) FetchBodies(request *fetchRequest) error {
 	return nil
 }
 
+// FetchReceipts sends a receipt retrieval request to the remote peer.
+func (p *peerConnection) FetchReceipts(request *fetchRequest) error {
+	// Sanity check the protocol version
+	if p.version < 63 {
+		panic(fmt.Sprintf("receipt fetch [eth/63+] requested on eth/%d", p.version))
+	}
+	// Short circuit if the peer is already fetching
+	if !atomic.CompareAndSwapInt32(&p.receiptIdle, 0, 1) {
+		return errAlreadyFetching
+	}
+	p.receiptStarted = time.Now()
+
+	// Convert the header set to a retrievable slice
+	hashes := make([]common.Hash, 0, len(request.Headers))
+	for _, header := range request.Headers {
+		hashes = append(hashes, header.Hash())
+	}
+	go p.peer.RequestReceipts(hashes)
+
+	return nil
+}
+
+// FetchNodeData sends a node state data retrieval request to the remote peer.
+func (p *peerConnection) FetchNodeData(hashes []common.Hash) error {
+	// Sanity check the protocol version
+	if p.version < 63 {
+		panic(fmt.Sprintf("node data fetch [eth/63+] requested on eth/%d", p.version))
+	}
+	// Short circuit if the peer is already fetching
+	if !atomic.CompareAndSwapInt32(&p.stateIdle, 0, 1) {
+		return errAlreadyFetching
+	}
+	p.stateStarted = time.Now()
+
+	go p.peer.RequestNodeData(hashes)
+
+	return nil
+}
+
 // SetHeadersIdle sets the peer to idle, allowing it to execute new header retrieval
 // requests. Its estimated header retrieval throughput is updated with that measured
 // just now.
@@ -278,6 +363,22 @@ func (p *peerConnection) Lacks(hash common.Hash) bool {
 	return ok
 }
 
+// TimedOut reports an expired request of the peer to its reputation tracker, if
+// the peer has any.
+func (p *peerConnection) TimedOut() {
+	if reporter, ok := p.peer.(MisbehaviourReporter); ok {
+		reporter.RequestTimedOut()
+	}
+}
+
+// InvalidChain reports a chain segment of the peer failing validation to its
+// reputation tracker, if the peer has any.
+func (p *peerConnection) InvalidChain() {
+	if reporter, ok := p.peer.(MisbehaviourReporter); ok {
+		reporter.DeliveredInvalidChain()
+	}
+}
+
 // peerSet represents the collection of active peer participating in the chain
 // download procedure.
 type peerSet struct {
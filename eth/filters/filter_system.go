@@ -49,6 +49,8 @@ const (
 	PendingTransactionsSubscription
 	// BlocksSubscription queries hashes for blocks that are imported
 	BlocksSubscription
+	// TxPoolEventsSubscription queries lifecycle events of pooled transactions
+	TxPoolEventsSubscription
 	// LastSubscription keeps track of the last index
 	LastIndexSubscription
 )
@@ -65,6 +67,7 @@ type subscription struct {
 	logs      chan []*types.Log
 	hashes    chan common.Hash
 	headers   chan *types.Header
+	txEvents  chan core.TxPoolEvent
 	installed chan struct{} // closed when the filter is installed
 	err       chan error    // closed when the filter is uninstalled
 }
@@ -127,6 +130,7 @@ func (sub *Subscription) Unsubscribe() {
 			case <-sub.f.logs:
 			case <-sub.f.hashes:
 			case <-sub.f.headers:
+			case <-sub.f.txEvents:
 			}
 		}
 
@@ -194,6 +198,7 @@ func (es *EventSystem) subscribeMinedPendingLogs(crit FilterCriteria, logs chan
 		logs:      logs,
 		hashes:    make(chan common.Hash),
 		headers:   make(chan *types.Header),
+		txEvents:  make(chan core.TxPoolEvent),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -212,6 +217,7 @@ func (es *EventSystem) subscribeLogs(crit FilterCriteria, logs chan []*types.Log
 		logs:      logs,
 		hashes:    make(chan common.Hash),
 		headers:   make(chan *types.Header),
+		txEvents:  make(chan core.TxPoolEvent),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -230,6 +236,7 @@ func (es *EventSystem) subscribePendingLogs(crit FilterCriteria, logs chan []*ty
 		logs:      logs,
 		hashes:    make(chan common.Hash),
 		headers:   make(chan *types.Header),
+		txEvents:  make(chan core.TxPoolEvent),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -247,6 +254,7 @@ func (es *EventSystem) SubscribeNewHeads(headers chan *types.Header) *Subscripti
 		logs:      make(chan []*types.Log),
 		hashes:    make(chan common.Hash),
 		headers:   headers,
+		txEvents:  make(chan core.TxPoolEvent),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -264,6 +272,26 @@ func (es *EventSystem) SubscribePendingTxEvents(hashes chan common.Hash) *Subscr
 		logs:      make(chan []*types.Log),
 		hashes:    hashes,
 		headers:   make(chan *types.Header),
+		txEvents:  make(chan core.TxPoolEvent),
+		installed: make(chan struct{}),
+		err:       make(chan error),
+	}
+
+	return es.subscribe(sub)
+}
+
+// SubscribeTxPoolEvents creates a subscription that writes the lifecycle events
+// of transactions in the transaction pool (added, promoted, replaced, dropped and
+// included).
+func (es *EventSystem) SubscribeTxPoolEvents(events chan core.TxPoolEvent) *Subscription {
+	sub := &subscription{
+		id:        rpc.NewID(),
+		typ:       TxPoolEventsSubscription,
+		created:   time.Now(),
+		logs:      make(chan []*types.Log),
+		hashes:    make(chan common.Hash),
+		headers:   make(chan *types.Header),
+		txEvents:  events,
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -312,6 +340,12 @@ func (es *EventSystem) broadcast(filters filterIndex, ev *event.TypeMuxEvent) {
 				f.hashes <- e.Tx.Hash()
 			}
 		}
+	case core.TxPoolEvent:
+		for _, f := range filters[TxPoolEventsSubscription] {
+			if ev.Time.After(f.created) {
+				f.txEvents <- e
+			}
+		}
 	case core.ChainEvent:
 		for _, f := range filters[BlocksSubscription] {
 			if ev.Time.After(f.created) {
@@ -325,7 +359,7 @@ func (es *EventSystem) broadcast(filters filterIndex, ev *event.TypeMuxEvent) {
 func (es *EventSystem) eventLoop() {
 	var (
 		index = make(filterIndex)
-		sub   = es.mux.Subscribe(core.PendingLogsEvent{}, core.RemovedLogsEvent{}, []*types.Log{}, core.TxPreEvent{}, core.ChainEvent{})
+		sub   = es.mux.Subscribe(core.PendingLogsEvent{}, core.RemovedLogsEvent{}, []*types.Log{}, core.TxPreEvent{}, core.TxPoolEvent{}, core.ChainEvent{})
 	)
 
 	for i := UnknownSubscription; i < LastIndexSubscription; i++ {
@@ -59,7 +59,7 @@ func newTestProtocolManager(mode downloader.SyncMode, blocks int, generator func
 			Alloc:  core.GenesisAlloc{testBank: {Balance: big.NewInt(1000000)}},
 		}
 		genesis       = gspec.MustCommit(db)
-		blockchain, _ = core.NewBlockChain(db, gspec.Config, engine, evmux, vm.Config{})
+		blockchain, _ = core.NewBlockChain(db, gspec.Config, engine, evmux, vm.Config{}, 0)
 	)
 	chain, _ := core.GenerateChain(gspec.Config, genesis, db, blocks, generator)
 	if _, err := blockchain.InsertChain(chain); err != nil {
@@ -88,24 +88,31 @@ func newTestProtocolManagerMust(t *testing.T, mode downloader.SyncMode, blocks i
 
 // testTxPool is a fake, helper transaction pool for testing purposes
 type testTxPool struct {
-	pool  []*types.Transaction        // Collection of all transactions
-	added chan<- []*types.Transaction // Notification channel for new transactions
+	pool    []*types.Transaction        // Collection of all transactions
+	added   chan<- []*types.Transaction // Notification channel for new transactions
+	rejects map[common.Hash]error       // Transactions to reject with a preset error
 
 	lock sync.RWMutex // Protects the transaction pool
 }
 
 // AddRemotes appends a batch of transactions to the pool, and notifies any
-// listeners if the addition channel is non nil
-func (p *testTxPool) AddRemotes(txs []*types.Transaction) error {
+// listeners if the addition channel is non nil. Transactions with a preset
+// rejection are not added, returning their error instead.
+func (p *testTxPool) AddRemotes(txs []*types.Transaction) []error {
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
-	p.pool = append(p.pool, txs...)
+	errs := make([]error, len(txs))
+	for i, tx := range txs {
+		if errs[i] = p.rejects[tx.Hash()]; errs[i] == nil {
+			p.pool = append(p.pool, tx)
+		}
+	}
 	if p.added != nil {
 		p.added <- txs
 	}
 
-	return nil
+	return errs
 }
 
 // Pending returns all the transactions known to the pool
@@ -126,7 +133,7 @@ func (p *testTxPool) Pending() (map[common.Address]types.Transactions, error) {
 
 // newTestTransaction create a new dummy transaction.
 func newTestTransaction(from *ecdsa.PrivateKey, nonce uint64, datasize int) *types.Transaction {
-	tx := types.NewTransaction(nonce, common.Address{}, big.NewInt(0), big.NewInt(100000), big.NewInt(0), make([]byte, datasize))
+	tx := types.NewTransaction(nonce, common.Address{}, big.NewInt(0), make([]byte, datasize))
 	tx, _ = types.SignTx(tx, types.HomesteadSigner{}, from)
 	return tx
 }
@@ -23,10 +23,12 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover"
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
@@ -116,6 +118,67 @@ func testRecvTransactions(t *testing.T, protocol int) {
 	}
 }
 
+// Tests that relayed transactions rejected due to local policy or chain timing
+// don't lower the reputation of the peer, but invalid ones do.
+func TestRecvUselessTransactions62(t *testing.T) { testRecvUselessTransactions(t, 62) }
+func TestRecvUselessTransactions63(t *testing.T) { testRecvUselessTransactions(t, 63) }
+
+func testRecvUselessTransactions(t *testing.T, protocol int) {
+	txAdded := make(chan []*types.Transaction, 3)
+	pm := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, txAdded)
+	pm.acceptTxs = 1 // mark synced to accept transactions
+	defer pm.Stop()
+
+	var (
+		limited = newTestTransaction(testAccount, 0, 0)
+		expired = newTestTransaction(testAccount, 1, 0)
+		invalid = newTestTransaction(testAccount, 2, 0)
+	)
+	pm.txpool.(*testTxPool).rejects = map[common.Hash]error{
+		limited.Hash(): core.ErrRateLimited,
+		expired.Hash(): core.ErrTxExpired,
+		invalid.Hash(): core.ErrInvalidSender,
+	}
+	// Connect a peer recording its penalties instead of reporting them
+	app, net := p2p.MsgPipe()
+	defer app.Close()
+
+	penalties := make(chan p2p.Misbehaviour, 3)
+	peer := pm.newPeer(protocol, p2p.NewPeer(discover.NodeID{1}, "peer", nil), net)
+	peer.penalise = func(m p2p.Misbehaviour) { penalties <- m }
+
+	go func() {
+		pm.newPeerCh <- peer
+		pm.handle(peer)
+	}()
+	tp := &testPeer{app: app, net: net, peer: peer}
+	td, head, genesis := pm.blockchain.Status()
+	tp.handshake(t, td, head, genesis)
+
+	// Relay the transactions one by one, only the invalid one may be penalised.
+	// Messages are handled in order, so by the time the penalty arrives the
+	// previous ones were already processed.
+	for _, tx := range []*types.Transaction{limited, expired, invalid} {
+		if err := p2p.Send(app, TxMsg, []interface{}{tx}); err != nil {
+			t.Fatalf("send error: %v", err)
+		}
+	}
+	select {
+	case m := <-penalties:
+		if m != p2p.UselessTransaction {
+			t.Errorf("penalty mismatch: have %v, want %v", m, p2p.UselessTransaction)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("invalid transaction not penalised")
+	}
+	if len(txAdded) != 3 {
+		t.Errorf("relayed transaction count mismatch: have %d, want %d", len(txAdded), 3)
+	}
+	if len(penalties) != 0 {
+		t.Errorf("rate limited or expired transaction penalised: %v", <-penalties)
+	}
+}
+
 // This test checks that pending transactions are sent.
 func TestSendTransactions62(t *testing.T) { testSendTransactions(t, 62) }
 func TestSendTransactions63(t *testing.T) { testSendTransactions(t, 63) }
@@ -21,9 +21,16 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 // Tests that fast sync gets disabled as soon as a real block is successfully
@@ -53,3 +60,22 @@ func TestFastSyncDisabling(t *testing.T) {
 		t.Fatalf("fast sync not disabled after successful synchronisation")
 	}
 }
+
+// Tests that fast sync is disabled on chains whose signer set is governed by a
+// contract, as their checkpoint headers can't be verified without the state.
+func TestFastSyncGovernedDisabling(t *testing.T) {
+	config := *params.TestChainConfig
+	config.Clique = &params.CliqueConfig{Period: 1, Epoch: 30000, Governance: &common.Address{0x01}}
+
+	db, _ := ethdb.NewMemDatabase()
+	(&core.Genesis{Config: &config}).MustCommit(db)
+	blockchain, _ := core.NewBlockChain(db, &config, ethash.NewFaker(), new(event.TypeMux), vm.Config{}, 0)
+
+	pm, err := NewProtocolManager(&config, downloader.FastSync, DefaultConfig.NetworkId, 1000, new(event.TypeMux), &testTxPool{}, ethash.NewFaker(), blockchain, db)
+	if err != nil {
+		t.Fatalf("failed to create protocol manager: %v", err)
+	}
+	if atomic.LoadUint32(&pm.fastSync) == 1 {
+		t.Fatalf("fast sync not disabled on contract governed chain")
+	}
+}
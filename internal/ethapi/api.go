@@ -125,13 +125,20 @@ func (s *PublicTxPoolAPI) Content() map[string]map[string]map[string]*RPCTransac
 	return content
 }
 
-// Status returns the number of pending and queued transaction in the pool.
-func (s *PublicTxPoolAPI) Status() map[string]hexutil.Uint {
+// Status returns the number of pending and queued transaction in the pool. If a
+// transaction hash is given, the recorded lifecycle events of that transaction
+// are returned too, oldest first, explaining e.g. why and when it was dropped.
+// The history is only retained for a limited number of recently seen ones.
+func (s *PublicTxPoolAPI) Status(hash *common.Hash) map[string]interface{} {
 	pending, queue := s.b.Stats()
-	return map[string]hexutil.Uint{
+	status := map[string]interface{}{
 		"pending": hexutil.Uint(pending),
 		"queued":  hexutil.Uint(queue),
 	}
+	if hash != nil {
+		status["history"] = s.b.TxPoolHistory(*hash)
+	}
+	return status
 }
 
 // Inspect retrieves the content of the transaction pool and flattens it into an
@@ -320,8 +327,8 @@ func (s *PrivateAccountAPI) SendTransaction(ctx context.Context, args SendTxArgs
 	if args.Nonce == nil {
 		// Hold the addresse's mutex around signing to prevent concurrent assignment of
 		// the same nonce to multiple accounts.
-		s.nonceLock.LockAddr(args.From)
-		defer s.nonceLock.UnlockAddr(args.From)
+		s.nonceLock.LockAddr(args.payer())
+		defer s.nonceLock.UnlockAddr(args.payer())
 	}
 
 	// Set some sanity defaults and terminate on failure
@@ -335,6 +342,11 @@ func (s *PrivateAccountAPI) SendTransaction(ctx context.Context, args SendTxArgs
 	if err != nil {
 		return common.Hash{}, err
 	}
+	if signed.Sponsored() {
+		if signed, err = sponsorTransaction(s.b, signed); err != nil {
+			return common.Hash{}, err
+		}
+	}
 	return submitTransaction(ctx, s.b, signed)
 }
 
@@ -439,6 +451,38 @@ func (s *PublicBlockChainAPI) GetBalance(ctx context.Context, address common.Add
 	return b, state.Error()
 }
 
+// Issuance is the block reward minted by a block and the coins issued by block
+// rewards up to it, according to the chain's reward schedule.
+type Issuance struct {
+	Number   *hexutil.Big `json:"number"`
+	Reward   *hexutil.Big `json:"reward"`   // Reward minted for the block producer, excluding fees
+	Treasury *hexutil.Big `json:"treasury"` // Reward minted for the treasury
+	Issuance *hexutil.Big `json:"issuance"` // Total coins minted by block rewards up to and including the block
+}
+
+// GetIssuance returns the block reward and the total issuance expected at the
+// given block number, which may also be in the future. The rpc.LatestBlockNumber
+// and rpc.PendingBlockNumber meta block numbers are also allowed.
+func (s *PublicBlockChainAPI) GetIssuance(ctx context.Context, blockNr rpc.BlockNumber) (*Issuance, error) {
+	number := big.NewInt(blockNr.Int64())
+	if blockNr < 0 {
+		header, err := s.b.HeaderByNumber(ctx, blockNr)
+		if header == nil || err != nil {
+			return nil, err
+		}
+		number = header.Number
+	}
+	config := s.b.ChainConfig()
+	reward, treasury := config.BlockReward(number)
+
+	return &Issuance{
+		Number:   (*hexutil.Big)(number),
+		Reward:   (*hexutil.Big)(reward),
+		Treasury: (*hexutil.Big)(treasury),
+		Issuance: (*hexutil.Big)(config.Issuance(number)),
+	}, nil
+}
+
 // GetBlockByNumber returns the requested block. When blockNr is -1 the chain head is returned. When fullTx is true all
 // transactions in the block are returned in full detail, otherwise only the transaction hash is returned.
 func (s *PublicBlockChainAPI) GetBlockByNumber(ctx context.Context, blockNr rpc.BlockNumber, fullTx bool) (map[string]interface{}, error) {
@@ -578,6 +622,18 @@ func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr r
 	return (hexutil.Bytes)(result), err
 }
 
+// EstimateFee returns the flat fee the given transaction would be charged upfront
+// if included in the next block. The fee of the instructions executed by it, if
+// any, is charged on top.
+func (s *PublicBlockChainAPI) EstimateFee(ctx context.Context, args SendTxArgs) (*hexutil.Big, error) {
+	head := s.b.CurrentBlock()
+	config, number := s.b.ChainConfig(), new(big.Int).Add(head.Number(), common.Big1)
+	if !config.Rules(number, new(big.Int).Add(head.Time(), common.Big1)).IsFee {
+		return new(hexutil.Big), nil
+	}
+	return (*hexutil.Big)(core.IntrinsicFee(config.Fee, args.Data, args.Calls)), nil
+}
+
 // ExecutionResult groups all structured logs emitted by the EVM
 // while replaying a transaction in debug mode as well as the amount of
 // gas used and the return value
@@ -686,11 +742,35 @@ type RPCTransaction struct {
 	To               *common.Address `json:"to"`
 	TransactionIndex hexutil.Uint    `json:"transactionIndex"`
 	Value            *hexutil.Big    `json:"value"`
+	Calls            []*types.Call   `json:"calls,omitempty"`
+	ValidFrom        *hexutil.Uint64 `json:"validFrom,omitempty"`
+	ValidUntil       *hexutil.Uint64 `json:"validUntil,omitempty"`
+	Sponsor          *common.Address `json:"sponsor,omitempty"`
 	V                *hexutil.Big    `json:"v"`
 	R                *hexutil.Big    `json:"r"`
 	S                *hexutil.Big    `json:"s"`
 }
 
+// rpcTxWindow returns the validity window bounds of a transaction for its RPC
+// representation, or nils if it doesn't have any.
+func rpcTxWindow(tx *types.Transaction) (*hexutil.Uint64, *hexutil.Uint64) {
+	if !tx.Windowed() {
+		return nil, nil
+	}
+	validFrom, validUntil := hexutil.Uint64(tx.ValidFrom()), hexutil.Uint64(tx.ValidUntil())
+	return &validFrom, &validUntil
+}
+
+// rpcTxSponsor returns the verified sponsor of a transaction for its RPC
+// representation, or nil if it isn't sponsored.
+func rpcTxSponsor(signer types.Signer, tx *types.Transaction) *common.Address {
+	if !tx.Sponsored() {
+		return nil
+	}
+	sponsor, _ := types.Sponsor(signer, tx)
+	return &sponsor
+}
+
 // newRPCPendingTransaction returns a pending transaction that will serialize to the RPC representation
 func newRPCPendingTransaction(tx *types.Transaction) *RPCTransaction {
 	var signer types.Signer = types.FrontierSigner{}
@@ -699,16 +779,21 @@ func newRPCPendingTransaction(tx *types.Transaction) *RPCTransaction {
 	}
 	from, _ := types.Sender(signer, tx)
 	v, r, s := tx.RawSignatureValues()
+	validFrom, validUntil := rpcTxWindow(tx)
 	return &RPCTransaction{
-		From:  from,
-		Hash:  tx.Hash(),
-		Input: hexutil.Bytes(tx.Data()),
-		Nonce: hexutil.Uint64(tx.Nonce()),
-		To:    tx.To(),
-		Value: (*hexutil.Big)(tx.Value()),
-		V:     (*hexutil.Big)(v),
-		R:     (*hexutil.Big)(r),
-		S:     (*hexutil.Big)(s),
+		From:       from,
+		Hash:       tx.Hash(),
+		Input:      hexutil.Bytes(tx.Data()),
+		Nonce:      hexutil.Uint64(tx.Nonce()),
+		To:         tx.To(),
+		Value:      (*hexutil.Big)(tx.Value()),
+		Calls:      tx.Calls(),
+		ValidFrom:  validFrom,
+		ValidUntil: validUntil,
+		Sponsor:    rpcTxSponsor(signer, tx),
+		V:          (*hexutil.Big)(v),
+		R:          (*hexutil.Big)(r),
+		S:          (*hexutil.Big)(s),
 	}
 }
 
@@ -722,6 +807,7 @@ func newRPCTransactionFromBlockIndex(b *types.Block, txIndex uint) (*RPCTransact
 		}
 		from, _ := types.Sender(signer, tx)
 		v, r, s := tx.RawSignatureValues()
+		validFrom, validUntil := rpcTxWindow(tx)
 		return &RPCTransaction{
 			BlockHash:        b.Hash(),
 			BlockNumber:      (*hexutil.Big)(b.Number()),
@@ -732,6 +818,10 @@ func newRPCTransactionFromBlockIndex(b *types.Block, txIndex uint) (*RPCTransact
 			To:               tx.To(),
 			TransactionIndex: hexutil.Uint(txIndex),
 			Value:            (*hexutil.Big)(tx.Value()),
+			Calls:            tx.Calls(),
+			ValidFrom:        validFrom,
+			ValidUntil:       validUntil,
+			Sponsor:          rpcTxSponsor(signer, tx),
 			V:                (*hexutil.Big)(v),
 			R:                (*hexutil.Big)(r),
 			S:                (*hexutil.Big)(s),
@@ -791,6 +881,21 @@ func getTransaction(chainDb ethdb.Database, b Backend, txHash common.Hash) (*typ
 	return tx, isPending, nil
 }
 
+// errTxOutsideIndexRange returns an error describing the indexed block range if
+// the lookup entries of the given transaction were pruned by the index limit, or
+// nil if a lookup miss means the transaction is simply unknown.
+func errTxOutsideIndexRange(chainDb ethdb.Database, hash common.Hash) error {
+	number := core.GetTxUnindexed(chainDb, hash)
+	if number == nil {
+		return nil
+	}
+	tail := core.GetTxIndexTail(chainDb)
+	if tail == nil || *number >= *tail {
+		return nil
+	}
+	return fmt.Errorf("transaction outside index range: included in block #%d, only blocks from #%d onwards are indexed", *number, *tail)
+}
+
 // GetBlockTransactionCountByNumber returns the number of transactions in the block with the given block number.
 func (s *PublicTransactionPoolAPI) GetBlockTransactionCountByNumber(ctx context.Context, blockNr rpc.BlockNumber) *hexutil.Uint {
 	if block, _ := s.b.BlockByNumber(ctx, blockNr); block != nil {
@@ -883,7 +988,7 @@ func (s *PublicTransactionPoolAPI) GetTransactionByHash(ctx context.Context, has
 		log.Debug("Failed to retrieve transaction", "hash", hash, "err", err)
 		return nil, nil
 	} else if tx == nil {
-		return nil, nil
+		return nil, errTxOutsideIndexRange(s.b.ChainDb(), hash)
 	}
 	if isPending {
 		return newRPCPendingTransaction(tx), nil
@@ -910,7 +1015,7 @@ func (s *PublicTransactionPoolAPI) GetRawTransactionByHash(ctx context.Context,
 		log.Debug("Failed to retrieve transaction", "hash", hash, "err", err)
 		return nil, nil
 	} else if tx == nil {
-		return nil, nil
+		return nil, errTxOutsideIndexRange(s.b.ChainDb(), hash)
 	}
 
 	return rlp.EncodeToBytes(tx)
@@ -921,7 +1026,10 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(hash common.Hash) (map[
 	receipt := core.GetReceipt(s.b.ChainDb(), hash)
 	if receipt == nil {
 		log.Debug("Receipt not found for transaction", "hash", hash)
-		return nil, nil
+		if s.b.GetPoolTransaction(hash) != nil {
+			return nil, nil
+		}
+		return nil, errTxOutsideIndexRange(s.b.ChainDb(), hash)
 	}
 
 	tx, _, err := getTransaction(s.b.ChainDb(), s.b, hash)
@@ -967,6 +1075,25 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(hash common.Hash) (map[
 	if receipt.ContractAddress != (common.Address{}) {
 		fields["contractAddress"] = receipt.ContractAddress
 	}
+	if receipt.Sponsor != nil {
+		fields["sponsor"] = receipt.Sponsor
+	}
+	if receipt.Calls != nil {
+		fields["calls"] = receipt.Calls
+	}
+	if receipt.Fee != nil {
+		fields["fee"] = (*hexutil.Big)(receipt.Fee)
+		fields["steps"] = hexutil.Uint64(receipt.Steps)
+	}
+	// Receipts of fast synced blocks lack the execution results, report them as
+	// unknown rather than leaving them out as if there were none
+	if receipt.Partial {
+		if tx.Batch() {
+			fields["calls"] = nil
+		}
+		fields["fee"], fields["steps"] = nil, nil
+		fields["partial"] = true
+	}
 	return fields, nil
 }
 
@@ -983,6 +1110,26 @@ func (s *PublicTransactionPoolAPI) sign(addr common.Address, tx *types.Transacti
 	return wallet.SignTx(account, tx, s.b.ChainConfig().ChainId)
 }
 
+// sponsorTransaction is a helper function that adds the sponsor signature to a
+// sponsored transaction already signed by its sender, using the wallet holding
+// the key of the sponsor.
+func sponsorTransaction(b Backend, tx *types.Transaction) (*types.Transaction, error) {
+	// Look up the wallet containing the requested sponsor
+	account := accounts.Account{Address: *tx.Sponsor()}
+
+	wallet, err := b.AccountManager().Find(account)
+	if err != nil {
+		return nil, err
+	}
+	// Sponsor signatures are only defined for replay protected transactions
+	signer := types.NewEIP155Signer(b.ChainConfig().ChainId)
+	sig, err := wallet.SignHash(account, signer.SponsorHash(tx).Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return signer.WithSponsorSignature(tx, sig)
+}
+
 // SendTxArgs represents the arguments to sumbit a new transaction into the transaction pool.
 type SendTxArgs struct {
 	From  common.Address  `json:"from"`
@@ -990,6 +1137,24 @@ type SendTxArgs struct {
 	Value *hexutil.Big    `json:"value"`
 	Data  hexutil.Bytes   `json:"data"`
 	Nonce *hexutil.Uint64 `json:"nonce"`
+
+	// Optional calls executed atomically, replacing to, value and data
+	Calls []*types.Call `json:"calls"`
+
+	// Optional validity window, both bounds need to be set
+	ValidFrom  *hexutil.Uint64 `json:"validFrom"`
+	ValidUntil *hexutil.Uint64 `json:"validUntil"`
+
+	// Optional sponsor paying for and sequencing the transaction
+	Sponsor *common.Address `json:"sponsor"`
+}
+
+// payer returns the account whose nonce sequences the transaction.
+func (args *SendTxArgs) payer() common.Address {
+	if args.Sponsor != nil {
+		return *args.Sponsor
+	}
+	return args.From
 }
 
 // prepareSendTxArgs is a helper function that fills in default values for unspecified tx fields.
@@ -998,20 +1163,48 @@ func (args *SendTxArgs) setDefaults(ctx context.Context, b Backend) error {
 		args.Value = new(hexutil.Big)
 	}
 	if args.Nonce == nil {
-		nonce, err := b.GetPoolNonce(ctx, args.From)
+		nonce, err := b.GetPoolNonce(ctx, args.payer())
 		if err != nil {
 			return err
 		}
 		args.Nonce = (*hexutil.Uint64)(&nonce)
 	}
+	if (args.ValidFrom == nil) != (args.ValidUntil == nil) {
+		return errors.New("validFrom and validUntil must be specified together")
+	}
+	if args.Calls != nil {
+		if len(args.Calls) == 0 {
+			return errors.New("batch transactions need at least one call")
+		}
+		if args.To != nil || args.Value.ToInt().Sign() != 0 || len(args.Data) > 0 {
+			return errors.New("batch transactions can't specify to, value or data")
+		}
+		return nil
+	}
+	if args.Sponsor != nil && args.To == nil {
+		return core.ErrSponsoredCreation
+	}
 	return nil
 }
 
 func (args *SendTxArgs) toTransaction() *types.Transaction {
-	if args.To == nil {
-		return types.NewContractCreation(uint64(*args.Nonce), (*big.Int)(args.Value), args.Data)
+	var tx *types.Transaction
+	switch {
+	case args.Calls != nil && args.ValidUntil != nil:
+		tx = types.NewWindowedBatchTransaction(uint64(*args.Nonce), args.Calls, uint64(*args.ValidFrom), uint64(*args.ValidUntil))
+	case args.Calls != nil:
+		tx = types.NewBatchTransaction(uint64(*args.Nonce), args.Calls)
+	case args.ValidUntil != nil:
+		tx = types.NewWindowedTransaction(uint64(*args.Nonce), args.To, (*big.Int)(args.Value), args.Data, uint64(*args.ValidFrom), uint64(*args.ValidUntil))
+	case args.To == nil:
+		tx = types.NewContractCreation(uint64(*args.Nonce), (*big.Int)(args.Value), args.Data)
+	default:
+		tx = types.NewTransaction(uint64(*args.Nonce), *args.To, (*big.Int)(args.Value), args.Data)
 	}
-	return types.NewTransaction(uint64(*args.Nonce), *args.To, (*big.Int)(args.Value), args.Data)
+	if args.Sponsor != nil {
+		tx = tx.WithSponsor(*args.Sponsor)
+	}
+	return tx
 }
 
 // submitTransaction is a helper function that submits tx to txPool and logs a message.
@@ -1019,7 +1212,9 @@ func submitTransaction(ctx context.Context, b Backend, tx *types.Transaction) (c
 	if err := b.SendTx(ctx, tx); err != nil {
 		return common.Hash{}, err
 	}
-	if tx.To() == nil {
+	if tx.Batch() {
+		log.Info("Submitted batch transaction", "fullhash", tx.Hash().Hex(), "calls", len(tx.Calls()))
+	} else if tx.To() == nil {
 		signer := types.MakeSigner(b.ChainConfig(), b.CurrentBlock().Number())
 		from, _ := types.Sender(signer, tx)
 		addr := crypto.CreateAddress(from, tx.Nonce())
@@ -1045,8 +1240,8 @@ func (s *PublicTransactionPoolAPI) SendTransaction(ctx context.Context, args Sen
 	if args.Nonce == nil {
 		// Hold the addresse's mutex around signing to prevent concurrent assignment of
 		// the same nonce to multiple accounts.
-		s.nonceLock.LockAddr(args.From)
-		defer s.nonceLock.UnlockAddr(args.From)
+		s.nonceLock.LockAddr(args.payer())
+		defer s.nonceLock.UnlockAddr(args.payer())
 	}
 
 	// Set some sanity defaults and terminate on failure
@@ -1060,6 +1255,11 @@ func (s *PublicTransactionPoolAPI) SendTransaction(ctx context.Context, args Sen
 	if err != nil {
 		return common.Hash{}, err
 	}
+	if signed.Sponsored() {
+		if signed, err = sponsorTransaction(s.b, signed); err != nil {
+			return common.Hash{}, err
+		}
+	}
 	return submitTransaction(ctx, s.b, signed)
 }
 
@@ -1076,7 +1276,9 @@ func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, encod
 	}
 
 	signer := types.MakeSigner(s.b.ChainConfig(), s.b.CurrentBlock().Number())
-	if tx.To() == nil {
+	if tx.Batch() {
+		log.Info("Submitted batch transaction", "fullhash", tx.Hash().Hex(), "calls", len(tx.Calls()))
+	} else if tx.To() == nil {
 		from, err := types.Sender(signer, tx)
 		if err != nil {
 			return "", err
@@ -1128,8 +1330,8 @@ func (s *PublicTransactionPoolAPI) SignTransaction(ctx context.Context, args Sen
 	if args.Nonce == nil {
 		// Hold the addresse's mutex around signing to prevent concurrent assignment of
 		// the same nonce to multiple accounts.
-		s.nonceLock.LockAddr(args.From)
-		defer s.nonceLock.UnlockAddr(args.From)
+		s.nonceLock.LockAddr(args.payer())
+		defer s.nonceLock.UnlockAddr(args.payer())
 	}
 	if err := args.setDefaults(ctx, s.b); err != nil {
 		return nil, err
@@ -1138,6 +1340,37 @@ func (s *PublicTransactionPoolAPI) SignTransaction(ctx context.Context, args Sen
 	if err != nil {
 		return nil, err
 	}
+	if tx.Sponsored() {
+		if tx, err = sponsorTransaction(s.b, tx); err != nil {
+			return nil, err
+		}
+	}
+	data, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		return nil, err
+	}
+	return &SignTransactionResult{data, tx}, nil
+}
+
+// SponsorTransaction adds the sponsor signature to the given RLP encoded
+// sponsored transaction, which needs to be signed by its sender already.
+// The node needs to have the private key of the declared sponsor and it
+// needs to be unlocked.
+func (s *PublicTransactionPoolAPI) SponsorTransaction(ctx context.Context, encodedTx hexutil.Bytes) (*SignTransactionResult, error) {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(encodedTx, tx); err != nil {
+		return nil, err
+	}
+	if !tx.Sponsored() {
+		return nil, errors.New("transaction is not sponsored")
+	}
+	if _, err := types.Sender(types.NewEIP155Signer(s.b.ChainConfig().ChainId), tx); err != nil {
+		return nil, err
+	}
+	tx, err := sponsorTransaction(s.b, tx)
+	if err != nil {
+		return nil, err
+	}
 	data, err := rlp.EncodeToBytes(tx)
 	if err != nil {
 		return nil, err
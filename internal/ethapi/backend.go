@@ -61,6 +61,7 @@ type Backend interface {
 	GetPoolNonce(ctx context.Context, addr common.Address) (uint64, error)
 	Stats() (pending int, queued int)
 	TxPoolContent() (map[common.Address]types.Transactions, map[common.Address]types.Transactions)
+	TxPoolHistory(txHash common.Hash) []*core.TxPoolEvent
 
 	ChainConfig() *params.ChainConfig
 	CurrentBlock() *types.Block
@@ -0,0 +1,216 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/light"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/p2p/discv5"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// errUnverifiableHeaders is returned if a light client is started on a chain whose
+// headers can't be verified without the state, such as contract governed clique.
+var errUnverifiableHeaders = errors.New("light client unsupported: chain headers not verifiable without state")
+
+// LightEthereum implements the light Ethereum client service, following the
+// header chain and retrieving everything else on demand from light servers.
+type LightEthereum struct {
+	config      *eth.Config
+	chainConfig *params.ChainConfig
+
+	odr             *LesOdr
+	relay           *LesTxRelay
+	peers           *peerSet
+	txPool          *light.TxPool
+	blockchain      *light.LightChain
+	protocolManager *ProtocolManager
+	stopTopic       chan struct{}
+
+	// DB interfaces
+	chainDb ethdb.Database // Block chain database
+
+	ApiBackend *LesApiBackend
+
+	eventMux       *event.TypeMux
+	engine         consensus.Engine
+	accountManager *accounts.Manager
+
+	networkId     uint64
+	netRPCService *ethapi.PublicNetAPI
+}
+
+// New creates a new light Ethereum service.
+func New(ctx *node.ServiceContext, config *eth.Config) (*LightEthereum, error) {
+	chainDb, err := eth.CreateDB(ctx, config, "lightchaindata")
+	if err != nil {
+		return nil, err
+	}
+	chainConfig, genesisHash, genesisErr := core.SetupGenesisBlock(chainDb, config.Genesis)
+	if _, isCompat := genesisErr.(*params.ConfigCompatError); genesisErr != nil && !isCompat {
+		return nil, genesisErr
+	}
+	log.Info("Initialised chain configuration", "config", chainConfig)
+	if !chainConfig.HeaderVerifiable() {
+		return nil, errUnverifiableHeaders
+	}
+
+	peers := newPeerSet()
+	leth := &LightEthereum{
+		config:         config,
+		chainConfig:    chainConfig,
+		chainDb:        chainDb,
+		eventMux:       ctx.EventMux,
+		peers:          peers,
+		relay:          NewLesTxRelay(peers),
+		odr:            NewLesOdr(chainDb, peers),
+		accountManager: ctx.AccountManager,
+		engine:         eth.CreateConsensusEngine(ctx, config, chainConfig, chainDb),
+		networkId:      config.NetworkId,
+	}
+	if leth.blockchain, err = light.NewLightChain(leth.odr, leth.chainConfig, leth.engine, leth.eventMux); err != nil {
+		return nil, err
+	}
+	// Rewind the chain in case of an incompatible config upgrade.
+	if compat, ok := genesisErr.(*params.ConfigCompatError); ok {
+		log.Warn("Rewinding chain to upgrade configuration", "err", compat)
+		leth.blockchain.SetHead(compat.RewindTo)
+		core.WriteChainConfig(chainDb, genesisHash, chainConfig)
+	}
+	leth.txPool = light.NewTxPool(leth.chainConfig, leth.eventMux, leth.blockchain, leth.relay)
+	if leth.protocolManager, err = NewProtocolManager(leth.chainConfig, true, config.NetworkId, config.MaxPeers, leth.eventMux, leth.peers, leth.blockchain, nil, chainDb, leth.odr, make(chan struct{})); err != nil {
+		return nil, err
+	}
+	leth.ApiBackend = &LesApiBackend{leth}
+	return leth, nil
+}
+
+// APIs returns the collection of RPC services the light ethereum package offers.
+func (s *LightEthereum) APIs() []rpc.API {
+	apis := ethapi.GetAPIs(s.ApiBackend)
+
+	// Append any APIs exposed explicitly by the consensus engine
+	apis = append(apis, s.engine.APIs(s.blockchain.HeaderChain())...)
+
+	// Append all the local APIs and return
+	return append(apis, []rpc.API{
+		{
+			Namespace: "eth",
+			Version:   "1.0",
+			Service:   downloader.NewPublicDownloaderAPI(s.protocolManager.downloader, s.eventMux),
+			Public:    true,
+		}, {
+			Namespace: "net",
+			Version:   "1.0",
+			Service:   s.netRPCService,
+			Public:    true,
+		},
+	}...)
+}
+
+func (s *LightEthereum) ResetWithGenesisBlock(gb *types.Block) {
+	s.blockchain.ResetWithGenesisBlock(gb)
+}
+
+func (s *LightEthereum) BlockChain() *light.LightChain      { return s.blockchain }
+func (s *LightEthereum) TxPool() *light.TxPool              { return s.txPool }
+func (s *LightEthereum) Engine() consensus.Engine           { return s.engine }
+func (s *LightEthereum) EventMux() *event.TypeMux           { return s.eventMux }
+func (s *LightEthereum) ChainDb() ethdb.Database            { return s.chainDb }
+func (s *LightEthereum) LesVersion() int                    { return int(s.protocolManager.SubProtocols[0].Version) }
+func (s *LightEthereum) NetVersion() uint64                 { return s.networkId }
+func (s *LightEthereum) Downloader() *downloader.Downloader { return s.protocolManager.downloader }
+
+// Protocols implements node.Service, returning all the currently configured
+// network protocols to start.
+func (s *LightEthereum) Protocols() []p2p.Protocol {
+	return s.protocolManager.SubProtocols
+}
+
+// Start implements node.Service, starting all internal goroutines needed by the
+// light Ethereum protocol implementation.
+func (s *LightEthereum) Start(srvr *p2p.Server) error {
+	log.Warn("Light client mode is an experimental feature")
+	s.netRPCService = ethapi.NewPublicNetAPI(srvr, s.networkId)
+	s.protocolManager.Start()
+
+	if srvr.DiscV5 != nil {
+		s.stopTopic = make(chan struct{})
+		go s.searchServers(srvr, lesTopic(s.blockchain.Genesis().Hash()))
+	}
+	return nil
+}
+
+// searchServers looks up the light servers of our chain through the topic
+// discovery, dialing every one found.
+func (s *LightEthereum) searchServers(srvr *p2p.Server, topic discv5.Topic) {
+	logger := log.New("topic", topic)
+	logger.Info("Starting topic search")
+	defer logger.Info("Terminated topic search")
+
+	var (
+		setPeriod = make(chan time.Duration, 1)
+		found     = make(chan *discv5.Node, 16)
+		lookup    = make(chan bool, 16)
+	)
+	setPeriod <- time.Second
+	go srvr.DiscV5.SearchTopic(topic, setPeriod, found, lookup)
+
+	for {
+		select {
+		case n := <-found:
+			srvr.AddPeer(discover.NewNode(discover.NodeID(n.ID), n.IP, n.UDP, n.TCP))
+		case <-lookup:
+		case <-s.stopTopic:
+			close(setPeriod)
+			return
+		}
+	}
+}
+
+// Stop implements node.Service, terminating all internal goroutines used by the
+// light Ethereum protocol.
+func (s *LightEthereum) Stop() error {
+	if s.stopTopic != nil {
+		close(s.stopTopic)
+	}
+	s.odr.Stop()
+	s.blockchain.Stop()
+	s.protocolManager.Stop()
+	s.txPool.Stop()
+
+	s.eventMux.Stop()
+
+	s.chainDb.Close()
+	return nil
+}
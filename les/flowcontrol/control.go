@@ -0,0 +1,196 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package flowcontrol implements the buffer based flow control mechanism of the
+// light client protocol, both on the serving and on the requesting side.
+package flowcontrol
+
+import (
+	"sync"
+	"time"
+)
+
+// fcTimeConst is the time unit the minimum recharge rate is specified in.
+const fcTimeConst = time.Millisecond
+
+// ServerParams are the flow control parameters a server assigns to its clients.
+// Each client owns a buffer of at most BufLimit cost units, which is recharged
+// at a rate of MinRecharge units per millisecond. Every request deducts its cost
+// from the buffer and is rejected if the buffer does not cover it.
+type ServerParams struct {
+	BufLimit, MinRecharge uint64
+}
+
+// recharge returns the given buffer value recharged for the elapsed time, capped
+// at the buffer limit.
+func (params *ServerParams) recharge(value uint64, dt time.Duration) uint64 {
+	if value >= params.BufLimit {
+		return params.BufLimit
+	}
+	if dt <= 0 || params.MinRecharge == 0 {
+		return value
+	}
+	// Avoid overflowing on long idle periods, the buffer is full by then anyway
+	if full := time.Duration((params.BufLimit-value)/params.MinRecharge+1) * fcTimeConst; dt >= full {
+		return params.BufLimit
+	}
+	value += params.MinRecharge * uint64(dt) / uint64(fcTimeConst)
+	if value > params.BufLimit {
+		value = params.BufLimit
+	}
+	return value
+}
+
+// ClientNode is the flow control system's representation of a client
+// (used in server mode only)
+type ClientNode struct {
+	params   *ServerParams
+	bufValue uint64
+	lastTime time.Time
+	lock     sync.Mutex
+}
+
+// NewClientNode creates the server side bookkeeping of a new client, starting
+// with a full buffer.
+func NewClientNode(params *ServerParams) *ClientNode {
+	return &ClientNode{
+		params:   params,
+		bufValue: params.BufLimit,
+		lastTime: time.Now(),
+	}
+}
+
+// recalcBV recharges the buffer value according to the time elapsed since the
+// last update.
+func (peer *ClientNode) recalcBV(now time.Time) {
+	peer.bufValue = peer.params.recharge(peer.bufValue, now.Sub(peer.lastTime))
+	peer.lastTime = now
+}
+
+// AcceptRequest deducts the cost of a request from the buffer of the client if
+// it can be afforded, returning the remaining buffer value and whether the
+// request was accepted.
+func (peer *ClientNode) AcceptRequest(cost uint64) (uint64, bool) {
+	peer.lock.Lock()
+	defer peer.lock.Unlock()
+
+	peer.recalcBV(time.Now())
+	if peer.bufValue < cost {
+		return peer.bufValue, false
+	}
+	peer.bufValue -= cost
+	return peer.bufValue, true
+}
+
+// ServerNode is the flow control system's representation of a server
+// (used in client mode only)
+type ServerNode struct {
+	params      *ServerParams
+	bufEstimate uint64
+	lastTime    time.Time
+	sumCost     uint64            // sum of req costs sent to this server
+	pending     map[uint64]uint64 // value = sumCost after sending the given req
+	lock        sync.Mutex
+}
+
+// NewServerNode creates the client side estimate of the buffer a server keeps
+// for us, starting with a full buffer.
+func NewServerNode(params *ServerParams) *ServerNode {
+	return &ServerNode{
+		params:      params,
+		bufEstimate: params.BufLimit,
+		lastTime:    time.Now(),
+		pending:     make(map[uint64]uint64),
+	}
+}
+
+// recalcBLE recharges the buffer estimate according to the time elapsed since
+// the last update.
+func (peer *ServerNode) recalcBLE(now time.Time) {
+	peer.bufEstimate = peer.params.recharge(peer.bufEstimate, now.Sub(peer.lastTime))
+	peer.lastTime = now
+}
+
+// canSend returns the time to wait until a request of the given cost fits into
+// the estimated buffer. It assumes the lock is held.
+func (peer *ServerNode) canSend(cost uint64) time.Duration {
+	if cost > peer.params.BufLimit {
+		cost = peer.params.BufLimit
+	}
+	if peer.bufEstimate >= cost {
+		return 0
+	}
+	if peer.params.MinRecharge == 0 {
+		return time.Hour
+	}
+	return time.Duration((cost - peer.bufEstimate) * uint64(fcTimeConst) / peer.params.MinRecharge)
+}
+
+// CanSend returns the minimum waiting time required before sending a request
+// with the given cost.
+func (peer *ServerNode) CanSend(cost uint64) time.Duration {
+	peer.lock.Lock()
+	defer peer.lock.Unlock()
+
+	peer.recalcBLE(time.Now())
+	return peer.canSend(cost)
+}
+
+// QueueRequest should be called when the request has been assigned to the given
+// server node, before putting it in the send queue. It is mandatory that requests
+// are sent in the same order as the QueueRequest calls are made. Requests which
+// are never replied to should be queued with a zero reqID.
+func (peer *ServerNode) QueueRequest(reqID, cost uint64) {
+	peer.lock.Lock()
+	defer peer.lock.Unlock()
+
+	peer.recalcBLE(time.Now())
+	if peer.bufEstimate >= cost {
+		peer.bufEstimate -= cost
+	} else {
+		peer.bufEstimate = 0
+	}
+	peer.sumCost += cost
+	if reqID != 0 {
+		peer.pending[reqID] = peer.sumCost
+	}
+}
+
+// GotReply adjusts estimated buffer value according to the value included in
+// the latest request reply.
+func (peer *ServerNode) GotReply(reqID, bv uint64) {
+	peer.lock.Lock()
+	defer peer.lock.Unlock()
+
+	sc, ok := peer.pending[reqID]
+	if !ok {
+		return
+	}
+	delete(peer.pending, reqID)
+
+	// Account for the requests sent after this one, which the server did not
+	// yet deduct from the reported buffer value
+	cc := peer.sumCost - sc
+	if bv > cc {
+		peer.bufEstimate = bv - cc
+	} else {
+		peer.bufEstimate = 0
+	}
+	if peer.bufEstimate > peer.params.BufLimit {
+		peer.bufEstimate = peer.params.BufLimit
+	}
+	peer.lastTime = time.Now()
+}
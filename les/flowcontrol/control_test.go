@@ -0,0 +1,75 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package flowcontrol
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests that the buffer recharges linearly and saturates at the limit without
+// overflowing on long idle periods.
+func TestRecharge(t *testing.T) {
+	params := &ServerParams{BufLimit: 1000, MinRecharge: 10}
+
+	tests := []struct {
+		value uint64
+		dt    time.Duration
+		want  uint64
+	}{
+		{0, 0, 0},
+		{0, 10 * time.Millisecond, 100},
+		{500, 25 * time.Millisecond, 750},
+		{900, 50 * time.Millisecond, 1000},
+		{0, 1000000 * time.Hour, 1000},
+		{1000, time.Second, 1000},
+	}
+	for i, tt := range tests {
+		if have := params.recharge(tt.value, tt.dt); have != tt.want {
+			t.Errorf("test %d: recharge mismatch: have %d, want %d", i, have, tt.want)
+		}
+	}
+}
+
+// Tests that a client is rejected once its buffer is exhausted, and that the
+// server side estimate follows the buffer value reported in the replies.
+func TestBufferAccounting(t *testing.T) {
+	params := &ServerParams{BufLimit: 1000, MinRecharge: 1}
+
+	client := NewClientNode(params)
+	if bv, ok := client.AcceptRequest(600); !ok || bv > 400 {
+		t.Fatalf("first request: have bv %d ok %v, want bv <= 400 accepted", bv, ok)
+	}
+	if _, ok := client.AcceptRequest(600); ok {
+		t.Fatalf("second request accepted beyond the buffer limit")
+	}
+	server := NewServerNode(params)
+	if wait := server.CanSend(600); wait != 0 {
+		t.Fatalf("wait with full buffer: have %v, want 0", wait)
+	}
+	server.QueueRequest(1, 600)
+	server.QueueRequest(2, 300)
+	if wait := server.CanSend(600); wait < 400*time.Millisecond {
+		t.Fatalf("wait with depleted buffer: have %v, want >= 400ms", wait)
+	}
+	// The server reports its value after the first request, the second one
+	// is still to be deducted
+	server.GotReply(1, 900)
+	if wait := server.CanSend(600); wait != 0 {
+		t.Fatalf("wait after reply: have %v, want 0", wait)
+	}
+}
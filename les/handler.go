@@ -0,0 +1,743 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+const (
+	softResponseLimit = 2 * 1024 * 1024 // Target maximum size of returned blocks, headers or node data.
+	estHeaderRlpSize  = 500             // Approximate size of an RLP encoded block header
+
+	MaxHeaderFetch  = 192 // Amount of block headers to be fetched per retrieval request
+	MaxBodyFetch    = 32  // Amount of block bodies to be fetched per retrieval request
+	MaxReceiptFetch = 128 // Amount of transaction receipts to allow fetching per request
+	MaxCodeFetch    = 64  // Amount of contract codes to allow fetching per request
+	MaxProofsFetch  = 64  // Amount of merkle proofs to be fetched per retrieval request
+	MaxTxSend       = 64  // Amount of transactions to be send per request
+
+	ethVersion = 62 // equivalent eth version for the downloader
+)
+
+func errResp(code errCode, format string, v ...interface{}) error {
+	return fmt.Errorf("%v - %v", code, fmt.Sprintf(format, v...))
+}
+
+// BlockChain is the chain access needed by the protocol manager, satisfied by
+// both the full chain of a server and the header chain of a light client.
+type BlockChain interface {
+	downloader.LightChain
+
+	GetHeader(hash common.Hash, number uint64) *types.Header
+	GetHeaderByNumber(number uint64) *types.Header
+	GetTd(hash common.Hash, number uint64) *big.Int
+	GetBlockHashesFromHash(hash common.Hash, max uint64) []common.Hash
+	Status() (td *big.Int, currentBlock common.Hash, genesisBlock common.Hash)
+	Genesis() *types.Block
+}
+
+type txPool interface {
+	// AddRemotes should add the given transactions to the pool.
+	AddRemotes([]*types.Transaction) []error
+}
+
+type ProtocolManager struct {
+	lightSync   bool
+	txpool      txPool
+	networkId   uint64
+	chainConfig *params.ChainConfig
+	blockchain  BlockChain
+	chainDb     ethdb.Database
+	odr         *LesOdr
+	server      *LesServer
+
+	downloader *downloader.Downloader
+	peers      *peerSet
+	maxPeers   int
+
+	SubProtocols []p2p.Protocol
+
+	eventMux *event.TypeMux
+
+	// channels for fetcher, syncer, txsyncLoop
+	newPeerCh   chan *peer
+	syncCh      chan struct{}
+	quitSync    chan struct{}
+	noMorePeers chan struct{}
+
+	// wait group is used for graceful shutdowns during downloading
+	// and processing
+	wg sync.WaitGroup
+}
+
+// NewProtocolManager returns a new light ethereum sub protocol manager. The Light
+// Ethereum sub protocol manages peers capable of serving light clients or being
+// served as one, depending on lightSync.
+func NewProtocolManager(chainConfig *params.ChainConfig, lightSync bool, networkId uint64, maxPeers int, mux *event.TypeMux, peers *peerSet, blockchain BlockChain, txpool txPool, chainDb ethdb.Database, odr *LesOdr, quitSync chan struct{}) (*ProtocolManager, error) {
+	// Create the protocol manager with the base fields
+	manager := &ProtocolManager{
+		lightSync:   lightSync,
+		eventMux:    mux,
+		blockchain:  blockchain,
+		chainConfig: chainConfig,
+		chainDb:     chainDb,
+		odr:         odr,
+		networkId:   networkId,
+		txpool:      txpool,
+		peers:       peers,
+		maxPeers:    maxPeers,
+		newPeerCh:   make(chan *peer),
+		syncCh:      make(chan struct{}, 1),
+		quitSync:    quitSync,
+		noMorePeers: make(chan struct{}),
+	}
+	if odr != nil {
+		odr.removePeer = manager.removePeer
+	}
+	// Initiate a sub-protocol for every implemented version we can handle
+	manager.SubProtocols = make([]p2p.Protocol, 0, len(ProtocolVersions))
+	for i, version := range ProtocolVersions {
+		// Compatible, initialize the sub-protocol
+		version := version // Closure for the run
+		manager.SubProtocols = append(manager.SubProtocols, p2p.Protocol{
+			Name:    ProtocolName,
+			Version: version,
+			Length:  ProtocolLengths[i],
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				peer := manager.newPeer(int(version), networkId, p, rw)
+				select {
+				case manager.newPeerCh <- peer:
+					manager.wg.Add(1)
+					defer manager.wg.Done()
+					return manager.handle(peer)
+				case <-manager.quitSync:
+					return p2p.DiscQuitting
+				}
+			},
+			NodeInfo: func() interface{} {
+				return manager.NodeInfo()
+			},
+			PeerInfo: func(id discover.NodeID) interface{} {
+				if p := manager.peers.Peer(fmt.Sprintf("%x", id[:8])); p != nil {
+					return p.Info()
+				}
+				return nil
+			},
+		})
+	}
+	if len(manager.SubProtocols) == 0 {
+		return nil, fmt.Errorf("no compatible light protocol version")
+	}
+	if lightSync {
+		manager.downloader = downloader.New(downloader.LightSync, chainDb, manager.eventMux, nil, blockchain, manager.removePeer)
+	}
+	return manager, nil
+}
+
+func (pm *ProtocolManager) removePeer(id string) {
+	// Short circuit if the peer was already removed
+	peer := pm.peers.Peer(id)
+	if peer == nil {
+		return
+	}
+	log.Debug("Removing light Ethereum peer", "peer", id)
+
+	// Unregister the peer from the downloader and the peer set
+	if pm.lightSync {
+		pm.downloader.UnregisterPeer(id)
+	}
+	if err := pm.peers.Unregister(id); err != nil {
+		log.Error("Peer removal failed", "peer", id, "err", err)
+	}
+	// Hard disconnect at the networking layer
+	peer.Peer.Disconnect(p2p.DiscUselessPeer)
+}
+
+func (pm *ProtocolManager) Start() {
+	if pm.lightSync {
+		go pm.syncer()
+	} else {
+		go func() {
+			for {
+				select {
+				case <-pm.newPeerCh:
+				case <-pm.noMorePeers:
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (pm *ProtocolManager) Stop() {
+	// Showing a log message. During download / process this could actually
+	// take between 5 to 10 seconds and therefor feedback is required.
+	log.Info("Stopping light Ethereum protocol")
+
+	// Quit the sync loop.
+	// After this send has completed, no new peers will be accepted.
+	pm.noMorePeers <- struct{}{}
+
+	close(pm.quitSync) // quits syncer, announcer
+
+	// Disconnect existing sessions.
+	// This also closes the gate for any new registrations on the peer set.
+	// sessions which are already established but not added to pm.peers yet
+	// will exit when they try to register.
+	pm.peers.Close()
+
+	// Wait for any process action
+	pm.wg.Wait()
+
+	log.Info("Light Ethereum protocol stopped")
+}
+
+func (pm *ProtocolManager) newPeer(pv int, nv uint64, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
+	return newPeer(pv, nv, p, rw)
+}
+
+// handle is the callback invoked to manage the life cycle of a les peer. When
+// this function terminates, the peer is disconnected.
+func (pm *ProtocolManager) handle(p *peer) error {
+	if pm.peers.Len() >= pm.maxPeers {
+		return p2p.DiscTooManyPeers
+	}
+	p.Log().Debug("Light Ethereum peer connected", "name", p.Name())
+
+	// Execute the LES handshake
+	td, head, genesis := pm.blockchain.Status()
+	headNum := core.GetBlockNumber(pm.chainDb, head)
+	if err := p.Handshake(td, head, headNum, genesis, pm.server); err != nil {
+		p.Log().Debug("Light Ethereum handshake failed", "err", err)
+		return err
+	}
+	// Register the peer locally
+	if err := pm.peers.Register(p); err != nil {
+		p.Log().Error("Light Ethereum peer registration failed", "err", err)
+		return err
+	}
+	defer pm.removePeer(p.id)
+
+	// Register the peer in the downloader. If the downloader considers it banned, we disconnect
+	if pm.lightSync {
+		if err := pm.downloader.RegisterLightPeer(p.id, ethVersion, p); err != nil {
+			return err
+		}
+		pm.requestSync()
+	}
+	// main loop. handle incoming messages.
+	for {
+		if err := pm.handleMsg(p); err != nil {
+			p.Log().Debug("Light Ethereum message handling failed", "err", err)
+			return err
+		}
+	}
+}
+
+// acceptRequest charges the cost of a request to the flow control buffer of
+// the client, returning the remaining buffer value if the request is accepted.
+func (pm *ProtocolManager) acceptRequest(p *peer, msgcode uint64, amount, limit int) (uint64, error) {
+	if p.fcClient == nil {
+		return 0, errResp(ErrUnexpectedResponse, "request %d from a server", msgcode)
+	}
+	if amount > limit {
+		return 0, errResp(ErrRequestRejected, "%d items requested, limit %d", amount, limit)
+	}
+	bv, ok := p.fcClient.AcceptRequest(pm.server.costs.getCost(msgcode, uint64(amount)))
+	if !ok {
+		return 0, errResp(ErrRequestRejected, "flow control buffer exceeded")
+	}
+	return bv, nil
+}
+
+// handleMsg is invoked whenever an inbound message is received from a remote
+// peer. The remote connection is torn down upon returning any error.
+func (pm *ProtocolManager) handleMsg(p *peer) error {
+	// Read the next message from the remote peer, and ensure it's fully consumed
+	msg, err := p.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	p.Log().Trace("Light Ethereum message arrived", "code", msg.Code, "bytes", msg.Size)
+
+	if msg.Size > ProtocolMaxMsgSize {
+		return errResp(ErrMsgTooLarge, "%v > %v", msg.Size, ProtocolMaxMsgSize)
+	}
+	defer msg.Discard()
+
+	// Responses are only accepted from servers
+	switch msg.Code {
+	case BlockHeadersMsg, BlockBodiesMsg, ReceiptsMsg, ProofsMsg, CodeMsg, AnnounceMsg:
+		if p.fcServer == nil {
+			return errResp(ErrUnexpectedResponse, "response %d from a client", msg.Code)
+		}
+	}
+	var deliverMsg *Msg
+
+	// Handle the message depending on its contents
+	switch msg.Code {
+	case StatusMsg:
+		// Status messages should never arrive after the handshake
+		return errResp(ErrExtraStatusMsg, "uncontrolled status message")
+
+	case AnnounceMsg:
+		var req announceData
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "%v: %v", msg, err)
+		}
+		if req.Td == nil {
+			return errResp(ErrDecode, "%v: missing total difficulty", msg)
+		}
+		p.Log().Trace("Announce message content", "number", req.Number, "hash", req.Hash, "td", req.Td)
+		p.SetHead(&req)
+		pm.requestSync()
+
+	// Block header query, collect the requested headers and reply
+	case GetBlockHeadersMsg:
+		// Decode the complex header query
+		var req struct {
+			ReqID uint64
+			Query getBlockHeadersData
+		}
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "%v: %v", msg, err)
+		}
+		query := req.Query
+		bv, err := pm.acceptRequest(p, msg.Code, int(query.Amount), MaxHeaderFetch)
+		if err != nil {
+			return err
+		}
+		hashMode := query.Origin.Hash != (common.Hash{})
+
+		// Gather headers until the fetch or network limits is reached
+		var (
+			bytes   common.StorageSize
+			headers []*types.Header
+			unknown bool
+		)
+		for !unknown && len(headers) < int(query.Amount) && bytes < softResponseLimit {
+			// Retrieve the next header satisfying the query
+			var origin *types.Header
+			if hashMode {
+				origin = pm.blockchain.GetHeaderByHash(query.Origin.Hash)
+			} else {
+				origin = pm.blockchain.GetHeaderByNumber(query.Origin.Number)
+			}
+			if origin == nil {
+				break
+			}
+			number := origin.Number.Uint64()
+			headers = append(headers, origin)
+			bytes += estHeaderRlpSize
+
+			// Advance to the next header of the query
+			switch {
+			case query.Origin.Hash != (common.Hash{}) && query.Reverse:
+				// Hash based traversal towards the genesis block
+				for i := 0; i < int(query.Skip)+1; i++ {
+					if header := pm.blockchain.GetHeader(query.Origin.Hash, number); header != nil {
+						query.Origin.Hash = header.ParentHash
+						number--
+					} else {
+						unknown = true
+						break
+					}
+				}
+			case query.Origin.Hash != (common.Hash{}) && !query.Reverse:
+				// Hash based traversal towards the leaf block
+				var (
+					current = origin.Number.Uint64()
+					next    = current + query.Skip + 1
+				)
+				if next <= current {
+					infos, _ := json.MarshalIndent(p.Peer.Info(), "", "  ")
+					p.Log().Warn("GetBlockHeaders skip overflow attack", "current", current, "skip", query.Skip, "next", next, "attacker", infos)
+					unknown = true
+				} else {
+					if header := pm.blockchain.GetHeaderByNumber(next); header != nil {
+						if pm.blockchain.GetBlockHashesFromHash(header.Hash(), query.Skip+1)[query.Skip] == query.Origin.Hash {
+							query.Origin.Hash = header.Hash()
+						} else {
+							unknown = true
+						}
+					} else {
+						unknown = true
+					}
+				}
+			case query.Reverse:
+				// Number based traversal towards the genesis block
+				if query.Origin.Number >= query.Skip+1 {
+					query.Origin.Number -= (query.Skip + 1)
+				} else {
+					unknown = true
+				}
+
+			case !query.Reverse:
+				// Number based traversal towards the leaf block
+				query.Origin.Number += (query.Skip + 1)
+			}
+		}
+		return p.SendBlockHeaders(req.ReqID, bv, headers)
+
+	case BlockHeadersMsg:
+		if pm.downloader == nil {
+			return errResp(ErrUnexpectedResponse, "")
+		}
+		// A batch of headers arrived to one of our previous requests
+		var resp struct {
+			ReqID, BV uint64
+			Headers   []*types.Header
+		}
+		if err := msg.Decode(&resp); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		p.fcServer.GotReply(resp.ReqID, resp.BV)
+		if err := pm.downloader.DeliverHeaders(p.id, resp.Headers); err != nil {
+			log.Debug("Failed to deliver headers", "err", err)
+		}
+
+	case GetBlockBodiesMsg:
+		// Decode the retrieval message
+		var req struct {
+			ReqID  uint64
+			Hashes []common.Hash
+		}
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		bv, err := pm.acceptRequest(p, msg.Code, len(req.Hashes), MaxBodyFetch)
+		if err != nil {
+			return err
+		}
+		// Gather blocks until the fetch or network limits is reached, replying
+		// with the available prefix of the requested items
+		var (
+			bytes  int
+			bodies []rlp.RawValue
+		)
+		for _, hash := range req.Hashes {
+			if bytes >= softResponseLimit {
+				break
+			}
+			data := core.GetBodyRLP(pm.chainDb, hash, core.GetBlockNumber(pm.chainDb, hash))
+			if len(data) == 0 {
+				break
+			}
+			bodies = append(bodies, data)
+			bytes += len(data)
+		}
+		return p.SendBlockBodiesRLP(req.ReqID, bv, bodies)
+
+	case BlockBodiesMsg:
+		// A batch of block bodies arrived to one of our previous requests
+		var resp struct {
+			ReqID, BV uint64
+			Data      []*types.Body
+		}
+		if err := msg.Decode(&resp); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		p.fcServer.GotReply(resp.ReqID, resp.BV)
+		deliverMsg = &Msg{
+			MsgType: MsgBlockBodies,
+			ReqID:   resp.ReqID,
+			Obj:     resp.Data,
+		}
+
+	case GetReceiptsMsg:
+		// Decode the retrieval message
+		var req struct {
+			ReqID  uint64
+			Hashes []common.Hash
+		}
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		bv, err := pm.acceptRequest(p, msg.Code, len(req.Hashes), MaxReceiptFetch)
+		if err != nil {
+			return err
+		}
+		// Gather state data until the fetch or network limits is reached
+		var (
+			bytes    int
+			receipts []rlp.RawValue
+		)
+		for _, hash := range req.Hashes {
+			if bytes >= softResponseLimit {
+				break
+			}
+			// Retrieve the requested block's receipts, stopping at the first missing one
+			number := core.GetBlockNumber(pm.chainDb, hash)
+			results := core.GetBlockReceipts(pm.chainDb, hash, number)
+			if results == nil {
+				if header := core.GetHeader(pm.chainDb, hash, number); header == nil || header.ReceiptHash != types.EmptyRootHash {
+					break
+				}
+			}
+			// If known, encode and queue for response packet
+			encoded, err := rlp.EncodeToBytes(results)
+			if err != nil {
+				log.Error("Failed to encode receipt", "err", err)
+				break
+			}
+			receipts = append(receipts, encoded)
+			bytes += len(encoded)
+		}
+		return p.SendReceiptsRLP(req.ReqID, bv, receipts)
+
+	case ReceiptsMsg:
+		// A batch of receipts arrived to one of our previous requests
+		var resp struct {
+			ReqID, BV uint64
+			Receipts  []types.Receipts
+		}
+		if err := msg.Decode(&resp); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		p.fcServer.GotReply(resp.ReqID, resp.BV)
+		deliverMsg = &Msg{
+			MsgType: MsgReceipts,
+			ReqID:   resp.ReqID,
+			Obj:     resp.Receipts,
+		}
+
+	case GetProofsMsg:
+		// Decode the retrieval message
+		var req struct {
+			ReqID uint64
+			Reqs  []ProofReq
+		}
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		bv, err := pm.acceptRequest(p, msg.Code, len(req.Reqs), MaxProofsFetch)
+		if err != nil {
+			return err
+		}
+		// Gather the proofs until the fetch or network limits is reached
+		var (
+			bytes  int
+			proofs [][]rlp.RawValue
+		)
+		for _, req := range req.Reqs {
+			if bytes >= softResponseLimit {
+				break
+			}
+			tr := pm.openTrie(req.BHash, req.AccKey)
+			if tr == nil {
+				break
+			}
+			proof := tr.Prove(req.Key)
+			proofs = append(proofs, proof)
+			for _, node := range proof {
+				bytes += len(node)
+			}
+		}
+		return p.SendProofs(req.ReqID, bv, proofs)
+
+	case ProofsMsg:
+		// A batch of merkle proofs arrived to one of our previous requests
+		var resp struct {
+			ReqID, BV uint64
+			Data      [][]rlp.RawValue
+		}
+		if err := msg.Decode(&resp); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		p.fcServer.GotReply(resp.ReqID, resp.BV)
+		deliverMsg = &Msg{
+			MsgType: MsgProofs,
+			ReqID:   resp.ReqID,
+			Obj:     resp.Data,
+		}
+
+	case GetCodeMsg:
+		// Decode the retrieval message
+		var req struct {
+			ReqID uint64
+			Reqs  []CodeReq
+		}
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		bv, err := pm.acceptRequest(p, msg.Code, len(req.Reqs), MaxCodeFetch)
+		if err != nil {
+			return err
+		}
+		// Gather the contract codes until the fetch or network limits is reached
+		var (
+			bytes int
+			data  [][]byte
+		)
+		for _, req := range req.Reqs {
+			if bytes >= softResponseLimit {
+				break
+			}
+			account := pm.getAccount(req.BHash, req.AccKey)
+			if account == nil {
+				break
+			}
+			code, _ := pm.chainDb.Get(account.CodeHash)
+			if code == nil && common.BytesToHash(account.CodeHash) != emptyCodeHash {
+				break
+			}
+			data = append(data, code)
+			bytes += len(code)
+		}
+		return p.SendCode(req.ReqID, bv, data)
+
+	case CodeMsg:
+		// A batch of contract codes arrived to one of our previous requests
+		var resp struct {
+			ReqID, BV uint64
+			Data      [][]byte
+		}
+		if err := msg.Decode(&resp); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		p.fcServer.GotReply(resp.ReqID, resp.BV)
+		deliverMsg = &Msg{
+			MsgType: MsgCode,
+			ReqID:   resp.ReqID,
+			Obj:     resp.Data,
+		}
+
+	case SendTxMsg:
+		// Transactions arrived, make sure we have a valid and fresh chain to handle them
+		var req struct {
+			ReqID uint64
+			Txs   []*types.Transaction
+		}
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		if _, err := pm.acceptRequest(p, msg.Code, len(req.Txs), MaxTxSend); err != nil {
+			return err
+		}
+		for i, tx := range req.Txs {
+			// Validate and mark the remote transaction
+			if tx == nil {
+				return errResp(ErrDecode, "transaction %d is nil", i)
+			}
+		}
+		pm.txpool.AddRemotes(req.Txs)
+
+	default:
+		p.Log().Trace("Received unknown message", "code", msg.Code)
+		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
+	}
+
+	if deliverMsg != nil {
+		if err := pm.odr.Deliver(p, deliverMsg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emptyCodeHash is the known hash of the empty EVM bytecode.
+var emptyCodeHash = crypto.Keccak256Hash(nil)
+
+// getAccount retrieves an account from the state of the given block, or nil if
+// the block or its state is not available.
+func (pm *ProtocolManager) getAccount(blockHash common.Hash, accKey []byte) *state.Account {
+	header := core.GetHeader(pm.chainDb, blockHash, core.GetBlockNumber(pm.chainDb, blockHash))
+	if header == nil {
+		return nil
+	}
+	tr, err := trie.New(header.Root, pm.chainDb)
+	if err != nil {
+		return nil
+	}
+	blob, err := tr.TryGet(accKey)
+	if err != nil || len(blob) == 0 {
+		return nil
+	}
+	var account state.Account
+	if err := rlp.DecodeBytes(blob, &account); err != nil {
+		return nil
+	}
+	return &account
+}
+
+// openTrie opens the state trie of the given block, or the storage trie of the
+// account with the given hashed key in it, returning nil if not available.
+func (pm *ProtocolManager) openTrie(blockHash common.Hash, accKey []byte) *trie.Trie {
+	if len(accKey) > 0 {
+		account := pm.getAccount(blockHash, accKey)
+		if account == nil {
+			return nil
+		}
+		tr, err := trie.New(account.Root, pm.chainDb)
+		if err != nil {
+			return nil
+		}
+		return tr
+	}
+	header := core.GetHeader(pm.chainDb, blockHash, core.GetBlockNumber(pm.chainDb, blockHash))
+	if header == nil {
+		return nil
+	}
+	tr, err := trie.New(header.Root, pm.chainDb)
+	if err != nil {
+		return nil
+	}
+	return tr
+}
+
+// NodeInfo represents a short summary of the Light Ethereum sub-protocol metadata known
+// about the host peer.
+type NodeInfo struct {
+	Network    uint64              `json:"network"`    // Ethereum network ID (1=Frontier, 2=Morden, Ropsten=3)
+	Difficulty *big.Int            `json:"difficulty"` // Total difficulty of the host's blockchain
+	Genesis    common.Hash         `json:"genesis"`    // SHA3 hash of the host's genesis block
+	Config     *params.ChainConfig `json:"config"`     // Chain configuration for the fork rules
+	Head       common.Hash         `json:"head"`       // SHA3 hash of the host's best owned block
+}
+
+// NodeInfo retrieves some protocol metadata about the running host node.
+func (self *ProtocolManager) NodeInfo() *NodeInfo {
+	head := self.blockchain.CurrentHeader()
+	hash := head.Hash()
+
+	return &NodeInfo{
+		Network:    self.networkId,
+		Difficulty: self.blockchain.GetTd(hash, head.Number.Uint64()),
+		Genesis:    self.blockchain.Genesis().Hash(),
+		Config:     self.chainConfig,
+		Head:       hash,
+	}
+}
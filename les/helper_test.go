@@ -0,0 +1,189 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// This file contains some shares testing functionality, common to  multiple
+// different files and modules being tested.
+
+package les
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/les/flowcontrol"
+	"github.com/ethereum/go-ethereum/light"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	testBankKey, _  = crypto.GenerateKey()
+	testBankAddress = crypto.PubkeyToAddress(testBankKey.PublicKey)
+	testBankFunds   = big.NewInt(1000000000)
+
+	// testContractCode is a contract returning the value stored in its first slot
+	testContractCode = common.Hex2Bytes("60005460005260206000f3")
+	testContractAddr = common.Address{0xc0}
+
+	testNetworkId = uint64(1)
+)
+
+// testTxPool is a fake transaction pool collecting the transactions relayed to
+// a server.
+type testTxPool struct {
+	added chan []*types.Transaction
+}
+
+func (p *testTxPool) AddRemotes(txs []*types.Transaction) []error {
+	p.added <- txs
+	return make([]error, len(txs))
+}
+
+// testServer is a full chain served over the light protocol.
+type testServer struct {
+	gspec  *core.Genesis
+	db     ethdb.Database
+	chain  *core.BlockChain
+	pm     *ProtocolManager
+	txpool *testTxPool
+}
+
+// newTestServer creates a light server with a chain of n blocks, each block
+// transferring some funds from the test bank to a new account.
+func newTestServer(t *testing.T, n int) *testServer {
+	var (
+		db, _ = ethdb.NewMemDatabase()
+		gspec = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: core.GenesisAlloc{
+				testBankAddress:  {Balance: testBankFunds},
+				testContractAddr: {Balance: new(big.Int), Code: testContractCode, Storage: map[common.Hash]common.Hash{{}: common.HexToHash("0x2a")}},
+			},
+		}
+		genesis = gspec.MustCommit(db)
+		signer  = types.NewEIP155Signer(gspec.Config.ChainId)
+		mux     = new(event.TypeMux)
+	)
+	chain, err := core.NewBlockChain(db, gspec.Config, ethash.NewFaker(), mux, vm.Config{}, 0)
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	gendb, _ := ethdb.NewMemDatabase()
+	gspec.MustCommit(gendb)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, gendb, n, func(i int, block *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(testBankAddress), common.Address{byte(i + 1)}, big.NewInt(1000), nil), signer, testBankKey)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		block.AddTx(tx)
+	})
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	txpool := &testTxPool{added: make(chan []*types.Transaction, 1)}
+	pm, err := NewProtocolManager(gspec.Config, false, testNetworkId, 10, mux, newPeerSet(), chain, txpool, db, nil, make(chan struct{}))
+	if err != nil {
+		t.Fatalf("failed to create protocol manager: %v", err)
+	}
+	pm.server = &LesServer{
+		protocolManager: pm,
+		defParams:       &flowcontrol.ServerParams{BufLimit: 300000000, MinRecharge: 50000},
+		costs:           defaultRequestCosts,
+	}
+	pm.Start()
+	return &testServer{gspec: gspec, db: db, chain: chain, pm: pm, txpool: txpool}
+}
+
+// testClient is a light node following the header chain of its servers.
+type testClient struct {
+	db    ethdb.Database
+	chain *light.LightChain
+	odr   *LesOdr
+	pm    *ProtocolManager
+}
+
+// newTestClient creates a light client of the chain starting with the genesis
+// block of the given server. The genesis state is not stored locally, so all
+// state accesses are served through the ODR.
+func newTestClient(t *testing.T, server *testServer) *testClient {
+	db, _ := ethdb.NewMemDatabase()
+	genesis, _ := server.gspec.ToBlock()
+	core.WriteTd(db, genesis.Hash(), 0, genesis.Difficulty())
+	core.WriteBlock(db, genesis)
+	core.WriteCanonicalHash(db, genesis.Hash(), 0)
+	core.WriteHeadHeaderHash(db, genesis.Hash())
+	core.WriteChainConfig(db, genesis.Hash(), server.gspec.Config)
+
+	var (
+		mux   = new(event.TypeMux)
+		peers = newPeerSet()
+		odr   = NewLesOdr(db, peers)
+	)
+	chain, err := light.NewLightChain(odr, server.chain.Config(), ethash.NewFaker(), mux)
+	if err != nil {
+		t.Fatalf("failed to create light chain: %v", err)
+	}
+	pm, err := NewProtocolManager(server.chain.Config(), true, testNetworkId, 10, mux, peers, chain, nil, db, odr, make(chan struct{}))
+	if err != nil {
+		t.Fatalf("failed to create protocol manager: %v", err)
+	}
+	pm.Start()
+	return &testClient{db: db, chain: chain, odr: odr, pm: pm}
+}
+
+// connect links a client and a server through an in-memory pipe, returning
+// once both sides registered each other.
+func connect(t *testing.T, client *testClient, server *testServer) {
+	app, net := p2p.MsgPipe()
+
+	var id discover.NodeID
+	rand.Read(id[:])
+	speer := server.pm.newPeer(lpv1, testNetworkId, p2p.NewPeer(id, "client", nil), net)
+	rand.Read(id[:])
+	cpeer := client.pm.newPeer(lpv1, testNetworkId, p2p.NewPeer(id, "server", nil), app)
+
+	go server.pm.handle(speer)
+	go client.pm.handle(cpeer)
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if server.pm.peers.Len() == 1 && client.pm.peers.Len() == 1 {
+			return
+		}
+	}
+	t.Fatalf("peers not registered: server %d, client %d", server.pm.peers.Len(), client.pm.peers.Len())
+}
+
+// waitSynced waits until the client caught up with the head of the server.
+func waitSynced(t *testing.T, client *testClient, server *testServer) {
+	want := server.chain.CurrentBlock().Hash()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if client.chain.CurrentHeader().Hash() == want {
+			return
+		}
+	}
+	t.Fatalf("client head mismatch: have #%d, want #%d", client.chain.CurrentHeader().Number, server.chain.CurrentBlock().Number())
+}
@@ -0,0 +1,201 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/light"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	softRequestTimeout = time.Millisecond * 500 // Time allowed for a server to answer before trying another one
+	maxTimeouts        = 5                      // Number of consecutive timeouts after which a server is dropped
+)
+
+// Msg types for the delivery of ODR replies
+const (
+	MsgBlockBodies = iota
+	MsgCode
+	MsgReceipts
+	MsgProofs
+)
+
+// Msg encodes a LES message that delivers reply data for a request
+type Msg struct {
+	MsgType int
+	ReqID   uint64
+	Obj     interface{}
+}
+
+// LesOdr implements light.OdrBackend, retrieving data on demand from the
+// connected light servers.
+type LesOdr struct {
+	db         ethdb.Database
+	peers      *peerSet
+	removePeer func(string)
+
+	mlock    sync.Mutex
+	sentReqs map[uint64]*sentReq
+	stop     chan struct{}
+}
+
+// sentReq is a request sent to a server which has not yet been answered.
+type sentReq struct {
+	peer   *peer
+	lreq   LesOdrRequest
+	answer chan error
+}
+
+// NewLesOdr creates an ODR backend storing the retrieved data in db.
+func NewLesOdr(db ethdb.Database, peers *peerSet) *LesOdr {
+	return &LesOdr{
+		db:       db,
+		peers:    peers,
+		sentReqs: make(map[uint64]*sentReq),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Stop cancels all pending retrievals.
+func (odr *LesOdr) Stop() {
+	close(odr.stop)
+}
+
+// Database returns the database the retrieved data is stored in.
+func (odr *LesOdr) Database() ethdb.Database {
+	return odr.db
+}
+
+// Deliver is called by the protocol manager to deliver an ODR reply. Replies to
+// unknown requests are ignored, invalid ones are reported as an error which
+// makes the protocol manager drop the peer.
+func (odr *LesOdr) Deliver(peer *peer, msg *Msg) error {
+	odr.mlock.Lock()
+	req, ok := odr.sentReqs[msg.ReqID]
+	if ok && req.peer == peer {
+		delete(odr.sentReqs, msg.ReqID)
+	}
+	odr.mlock.Unlock()
+
+	if !ok || req.peer != peer {
+		peer.Log().Debug("Unsolicited ODR reply", "reqid", msg.ReqID)
+		return nil
+	}
+	peer.requestAnswered()
+
+	err := req.lreq.Validate(odr.db, msg)
+	req.answer <- err
+	if err != nil && err != errNotAvailable {
+		return errResp(ErrInvalidResponse, "%v", err)
+	}
+	return nil
+}
+
+// Retrieve tries to fetch an object from the LES network. It asks the suitable
+// servers one by one in random order until one of them returns a valid answer.
+// If successful, the retrieved data is stored in the local database.
+func (odr *LesOdr) Retrieve(ctx context.Context, req light.OdrRequest) error {
+	lreq := LesRequest(req)
+	tried := make(map[*peer]struct{})
+	for {
+		p := odr.selectPeer(lreq, tried)
+		if p == nil {
+			return light.ErrNoPeers
+		}
+		tried[p] = struct{}{}
+
+		err := odr.request(ctx, p, lreq)
+		switch err {
+		case nil:
+			req.StoreResult(odr.db)
+			return nil
+		case ctx.Err():
+			return err
+		}
+		log.Debug("ODR request failed", "peer", p.id, "err", err)
+		select {
+		case <-odr.stop:
+			return light.ErrNoPeers
+		default:
+		}
+	}
+}
+
+// selectPeer picks a random server not yet tried which can serve the request.
+func (odr *LesOdr) selectPeer(lreq LesOdrRequest, tried map[*peer]struct{}) *peer {
+	var candidates []*peer
+	for _, p := range odr.peers.AllPeers() {
+		if _, ok := tried[p]; ok {
+			continue
+		}
+		if p.fcServer != nil && lreq.CanSend(p) {
+			candidates = append(candidates, p)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
+
+// request sends a single request to the given server and waits for its answer.
+// A server not answering within the soft timeout is passed over, repeatedly
+// doing so gets it dropped.
+func (odr *LesOdr) request(ctx context.Context, p *peer, lreq LesOdrRequest) error {
+	reqID := genReqID()
+	req := &sentReq{
+		peer:   p,
+		lreq:   lreq,
+		answer: make(chan error, 1),
+	}
+	odr.mlock.Lock()
+	odr.sentReqs[reqID] = req
+	odr.mlock.Unlock()
+
+	defer func() {
+		odr.mlock.Lock()
+		delete(odr.sentReqs, reqID)
+		odr.mlock.Unlock()
+	}()
+
+	if err := lreq.Request(reqID, p); err != nil {
+		return err
+	}
+	timeout := time.NewTimer(softRequestTimeout)
+	defer timeout.Stop()
+
+	select {
+	case err := <-req.answer:
+		return err
+	case <-timeout.C:
+		if p.requestTimedOut() && odr.removePeer != nil {
+			p.Log().Debug("Too many ODR request timeouts, dropping")
+			go odr.removePeer(p.id)
+		}
+		return errResp(ErrTooManyTimeouts, "request timed out")
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-odr.stop:
+		return light.ErrNoPeers
+	}
+}
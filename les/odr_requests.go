@@ -0,0 +1,243 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/light"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+var (
+	errNotAvailable        = errors.New("requested data not available")
+	errInvalidMessageType  = errors.New("invalid message type")
+	errInvalidEntryCount   = errors.New("invalid number of response entries")
+	errHeaderUnavailable   = errors.New("header unavailable")
+	errTxHashMismatch      = errors.New("transaction hash mismatch")
+	errReceiptHashMismatch = errors.New("receipt hash mismatch")
+	errDataHashMismatch    = errors.New("data hash mismatch")
+)
+
+// LesOdrRequest is a light.OdrRequest which can be sent to and validated from
+// a light server.
+type LesOdrRequest interface {
+	// CanSend returns whether the given server is expected to serve the request.
+	CanSend(*peer) bool
+	// Request sends the request to the given server.
+	Request(uint64, *peer) error
+	// Validate checks the reply of the server, filling in the requested data.
+	// It returns errNotAvailable if the server did not have the data.
+	Validate(ethdb.Database, *Msg) error
+}
+
+// LesRequest wraps a light.OdrRequest into its LES counterpart.
+func LesRequest(req light.OdrRequest) LesOdrRequest {
+	switch r := req.(type) {
+	case *light.BlockRequest:
+		return (*BlockRequest)(r)
+	case *light.ReceiptsRequest:
+		return (*ReceiptsRequest)(r)
+	case *light.TrieRequest:
+		return (*TrieRequest)(r)
+	case *light.CodeRequest:
+		return (*CodeRequest)(r)
+	default:
+		panic(fmt.Sprintf("unknown ODR request type %T", req))
+	}
+}
+
+// BlockRequest is the ODR request type for block bodies
+type BlockRequest light.BlockRequest
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *BlockRequest) CanSend(peer *peer) bool {
+	return peer.HasBlock(r.Number)
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *BlockRequest) Request(reqID uint64, peer *peer) error {
+	peer.Log().Debug("Requesting block body", "hash", r.Hash)
+	return peer.RequestBodies(reqID, []common.Hash{r.Hash})
+}
+
+// Validate processes an ODR request reply message from the LES network
+// returns nil if the reply was valid and the requested data was retrieved,
+// stored in the request object.
+func (r *BlockRequest) Validate(db ethdb.Database, msg *Msg) error {
+	if msg.MsgType != MsgBlockBodies {
+		return errInvalidMessageType
+	}
+	bodies := msg.Obj.([]*types.Body)
+	if len(bodies) == 0 {
+		return errNotAvailable
+	}
+	if len(bodies) != 1 {
+		return errInvalidEntryCount
+	}
+	body := bodies[0]
+
+	// Retrieve our stored header and validate block content against it
+	header := core.GetHeader(db, r.Hash, r.Number)
+	if header == nil {
+		return errHeaderUnavailable
+	}
+	if header.TxHash != types.DeriveSha(types.Transactions(body.Transactions)) {
+		return errTxHashMismatch
+	}
+	// Validations passed, encode and store RLP
+	data, err := rlp.EncodeToBytes(body)
+	if err != nil {
+		return err
+	}
+	r.Rlp = data
+	return nil
+}
+
+// ReceiptsRequest is the ODR request type for block receipts by block hash
+type ReceiptsRequest light.ReceiptsRequest
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *ReceiptsRequest) CanSend(peer *peer) bool {
+	return peer.HasBlock(r.Number)
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *ReceiptsRequest) Request(reqID uint64, peer *peer) error {
+	peer.Log().Debug("Requesting block receipts", "hash", r.Hash)
+	return peer.RequestReceipts(reqID, []common.Hash{r.Hash})
+}
+
+// Validate processes an ODR request reply message from the LES network
+// returns nil if the reply was valid and the requested data was retrieved,
+// stored in the request object.
+func (r *ReceiptsRequest) Validate(db ethdb.Database, msg *Msg) error {
+	if msg.MsgType != MsgReceipts {
+		return errInvalidMessageType
+	}
+	receipts := msg.Obj.([]types.Receipts)
+	if len(receipts) == 0 {
+		return errNotAvailable
+	}
+	if len(receipts) != 1 {
+		return errInvalidEntryCount
+	}
+	receipt := receipts[0]
+
+	// Retrieve our stored header and validate receipt content against it
+	header := core.GetHeader(db, r.Hash, r.Number)
+	if header == nil {
+		return errHeaderUnavailable
+	}
+	if header.ReceiptHash != types.DeriveSha(receipt) {
+		return errReceiptHashMismatch
+	}
+	// Validations passed, store and return
+	r.Receipts = receipt
+	return nil
+}
+
+// TrieRequest is the ODR request type for state/storage trie entries
+type TrieRequest light.TrieRequest
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *TrieRequest) CanSend(peer *peer) bool {
+	return peer.HasBlock(r.Id.BlockNumber)
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *TrieRequest) Request(reqID uint64, peer *peer) error {
+	peer.Log().Debug("Requesting trie proof", "root", r.Id.Root, "key", r.Key)
+	req := &ProofReq{
+		BHash:  r.Id.BlockHash,
+		AccKey: r.Id.AccKey,
+		Key:    r.Key,
+	}
+	return peer.RequestProofs(reqID, []*ProofReq{req})
+}
+
+// Validate processes an ODR request reply message from the LES network
+// returns nil if the reply was valid and the requested data was retrieved,
+// stored in the request object.
+func (r *TrieRequest) Validate(db ethdb.Database, msg *Msg) error {
+	if msg.MsgType != MsgProofs {
+		return errInvalidMessageType
+	}
+	proofs := msg.Obj.([][]rlp.RawValue)
+	if len(proofs) == 0 {
+		return errNotAvailable
+	}
+	if len(proofs) != 1 {
+		return errInvalidEntryCount
+	}
+	// Verify the proof and store if checks out
+	if _, err := trie.VerifyProof(r.Id.Root, r.Key, proofs[0]); err != nil {
+		return fmt.Errorf("merkle proof verification failed: %v", err)
+	}
+	r.Proof = proofs[0]
+	return nil
+}
+
+// CodeRequest is the ODR request type for retrieving contract code
+type CodeRequest light.CodeRequest
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *CodeRequest) CanSend(peer *peer) bool {
+	return peer.HasBlock(r.Id.BlockNumber)
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *CodeRequest) Request(reqID uint64, peer *peer) error {
+	peer.Log().Debug("Requesting code data", "hash", r.Hash)
+	req := &CodeReq{
+		BHash:  r.Id.BlockHash,
+		AccKey: r.Id.AccKey,
+	}
+	return peer.RequestCode(reqID, []*CodeReq{req})
+}
+
+// Validate processes an ODR request reply message from the LES network
+// returns nil if the reply was valid and the requested data was retrieved,
+// stored in the request object.
+func (r *CodeRequest) Validate(db ethdb.Database, msg *Msg) error {
+	if msg.MsgType != MsgCode {
+		return errInvalidMessageType
+	}
+	reply := msg.Obj.([][]byte)
+	if len(reply) == 0 {
+		return errNotAvailable
+	}
+	if len(reply) != 1 {
+		return errInvalidEntryCount
+	}
+	data := reply[0]
+
+	// Verify the data and store if checks out
+	if hash := crypto.Keccak256(data); !bytes.Equal(r.Hash[:], hash) {
+		return errDataHashMismatch
+	}
+	r.Data = data
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/light"
+)
+
+// Tests that a light client syncs the header chain of a server and retrieves
+// the state of the head block on demand.
+func TestOdrState(t *testing.T) {
+	server := newTestServer(t, 4)
+	client := newTestClient(t, server)
+	connect(t, client, server)
+	waitSynced(t, client, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	head := server.chain.CurrentBlock()
+	want, err := server.chain.StateAt(head.Root())
+	if err != nil {
+		t.Fatalf("failed to open server state: %v", err)
+	}
+	have := light.NewState(ctx, client.chain.CurrentHeader(), client.odr)
+
+	for _, addr := range []common.Address{testBankAddress, {0x01}, {0x04}, {0x05}} {
+		if h, w := have.GetBalance(addr), want.GetBalance(addr); h.Cmp(w) != 0 {
+			t.Errorf("balance mismatch for %x: have %v, want %v", addr, h, w)
+		}
+		if h, w := have.GetNonce(addr), want.GetNonce(addr); h != w {
+			t.Errorf("nonce mismatch for %x: have %d, want %d", addr, h, w)
+		}
+	}
+	if code := have.GetCode(testContractAddr); !bytes.Equal(code, testContractCode) {
+		t.Errorf("code mismatch: have %x, want %x", code, testContractCode)
+	}
+	if value := have.GetState(testContractAddr, common.Hash{}); value != common.HexToHash("0x2a") {
+		t.Errorf("storage mismatch: have %x, want 0x2a", value)
+	}
+	if err := have.Error(); err != nil {
+		t.Fatalf("state retrieval failed: %v", err)
+	}
+}
+
+// Tests that block bodies and receipts are retrieved on demand and checked
+// against the local headers.
+func TestOdrBlockAndReceipts(t *testing.T) {
+	server := newTestServer(t, 4)
+	client := newTestClient(t, server)
+	connect(t, client, server)
+	waitSynced(t, client, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := uint64(1); i <= 4; i++ {
+		want := server.chain.GetBlockByNumber(i)
+		have, err := client.chain.GetBlockByNumber(ctx, i)
+		if err != nil {
+			t.Fatalf("block #%d: retrieval failed: %v", i, err)
+		}
+		if have.Hash() != want.Hash() || len(have.Transactions()) != len(want.Transactions()) {
+			t.Errorf("block #%d: mismatch: have %x, want %x", i, have.Hash(), want.Hash())
+		}
+		receipts, err := light.GetBlockReceipts(ctx, client.odr, want.Hash(), i)
+		if err != nil {
+			t.Fatalf("block #%d: receipt retrieval failed: %v", i, err)
+		}
+		if types.DeriveSha(receipts) != want.ReceiptHash() {
+			t.Errorf("block #%d: receipt hash mismatch", i)
+		}
+	}
+}
+
+// Tests that retrievals fail when no server can answer them.
+func TestOdrNoPeers(t *testing.T) {
+	server := newTestServer(t, 1)
+	client := newTestClient(t, server)
+
+	header := server.chain.CurrentBlock().Header()
+	core.WriteHeader(client.db, header)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	state := light.NewState(ctx, header, client.odr)
+	if balance := state.GetBalance(testBankAddress); balance.Sign() != 0 {
+		t.Errorf("balance without servers: have %v, want 0", balance)
+	}
+	if err := state.Error(); err == nil {
+		t.Fatalf("state retrieval succeeded without servers")
+	}
+}
+
+// Tests that transactions sent through the relay reach the server's pool.
+func TestTxRelay(t *testing.T) {
+	server := newTestServer(t, 1)
+	client := newTestClient(t, server)
+	connect(t, client, server)
+
+	tx := types.NewTransaction(0, common.Address{0x01}, big.NewInt(1), nil)
+	NewLesTxRelay(client.pm.peers).Send(types.Transactions{tx})
+
+	select {
+	case txs := <-server.txpool.added:
+		if len(txs) != 1 || txs[0].Hash() != tx.Hash() {
+			t.Fatalf("relayed transactions mismatch: have %v, want %x", txs, tx.Hash())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("transaction not relayed")
+	}
+}
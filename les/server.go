@@ -0,0 +1,201 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/les/flowcontrol"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discv5"
+)
+
+// bufLimitRatio is the number of milliseconds of recharge a client buffer can
+// hold, limiting the size of the request bursts a client may send.
+const bufLimitRatio = 6000
+
+// LesServer serves light clients from the chain and state of a full node.
+type LesServer struct {
+	config          *eth.Config
+	protocolManager *ProtocolManager
+	defParams       *flowcontrol.ServerParams
+	costs           requestCostTable
+	stopTopic       chan struct{}
+	quitSync        chan struct{}
+}
+
+// NewLesServer creates a light protocol server on top of a running full node.
+// The time share set with LightServ is split evenly among LightPeers clients.
+func NewLesServer(eth *eth.Ethereum, config *eth.Config) (*LesServer, error) {
+	if config.LightServ > 90 {
+		return nil, fmt.Errorf("invalid light server time share %d%%, must be at most 90%%", config.LightServ)
+	}
+	quitSync := make(chan struct{})
+	pm, err := NewProtocolManager(eth.BlockChain().Config(), false, config.NetworkId, config.LightPeers, eth.EventMux(), newPeerSet(), eth.BlockChain(), eth.TxPool(), eth.ChainDb(), nil, quitSync)
+	if err != nil {
+		return nil, err
+	}
+	// Request costs are measured in nanoseconds of processing time, so a client
+	// recharging one million units per millisecond could keep a core busy
+	peers := config.LightPeers
+	if peers < 1 {
+		peers = 1
+	}
+	recharge := uint64(1000000*config.LightServ/100) / uint64(peers)
+
+	srv := &LesServer{
+		config:          config,
+		protocolManager: pm,
+		defParams: &flowcontrol.ServerParams{
+			BufLimit:    recharge * bufLimitRatio,
+			MinRecharge: recharge,
+		},
+		costs:    defaultRequestCosts,
+		quitSync: quitSync,
+	}
+	pm.server = srv
+	return srv, nil
+}
+
+// Protocols returns the light protocols served to clients.
+func (s *LesServer) Protocols() []p2p.Protocol {
+	return s.protocolManager.SubProtocols
+}
+
+// Start starts the LES server, advertising it through the topic discovery if
+// enabled.
+func (s *LesServer) Start(srvr *p2p.Server) {
+	s.protocolManager.Start()
+
+	if srvr.DiscV5 != nil {
+		s.stopTopic = make(chan struct{})
+		topic := lesTopic(s.protocolManager.blockchain.Genesis().Hash())
+
+		go func() {
+			logger := log.New("topic", topic)
+			logger.Info("Starting topic registration")
+			defer logger.Info("Terminated topic registration")
+
+			srvr.DiscV5.RegisterTopic(topic, s.stopTopic)
+		}()
+	}
+	go s.announceLoop()
+}
+
+// Stop stops the LES service
+func (s *LesServer) Stop() {
+	if s.stopTopic != nil {
+		close(s.stopTopic)
+	}
+	s.protocolManager.Stop()
+}
+
+// announceLoop announces every new head of the chain to the connected clients.
+func (s *LesServer) announceLoop() {
+	sub := s.protocolManager.eventMux.Subscribe(core.ChainHeadEvent{})
+	defer sub.Unsubscribe()
+
+	var lastHead common.Hash
+	for {
+		select {
+		case ev, ok := <-sub.Chan():
+			if !ok {
+				return
+			}
+			block := ev.Data.(core.ChainHeadEvent).Block
+			if hash := block.Hash(); hash != lastHead {
+				lastHead = hash
+				td := s.protocolManager.blockchain.GetTd(hash, block.NumberU64())
+				if td == nil {
+					continue
+				}
+				announce := announceData{Hash: hash, Number: block.NumberU64(), Td: td}
+				for _, p := range s.protocolManager.peers.AllPeers() {
+					log.Trace("Announcing block to peer", "peer", p.id, "number", announce.Number, "hash", announce.Hash)
+					p.SendAnnounce(announce)
+				}
+			}
+		case <-s.quitSync:
+			return
+		}
+	}
+}
+
+// lesTopic returns the discovery topic light servers of the chain with the given
+// genesis block register themselves under.
+func lesTopic(genesisHash common.Hash) discv5.Topic {
+	return discv5.Topic("LES@" + common.Bytes2Hex(genesisHash.Bytes()[0:8]))
+}
+
+// requestCosts is the maximum cost a server charges for a request of some type,
+// being a base cost plus a cost for every item requested.
+type requestCosts struct {
+	baseCost, reqCost uint64
+}
+
+type requestCostTable map[uint64]*requestCosts
+
+// RequestCostList is the network encoding of a request cost table.
+type RequestCostList []struct {
+	MsgCode, BaseCost, ReqCost uint64
+}
+
+// defaultRequestCosts are the request costs of a server, in nanoseconds of the
+// approximate processing time.
+var defaultRequestCosts = requestCostTable{
+	GetBlockHeadersMsg: {150000, 30000},
+	GetBlockBodiesMsg:  {0, 700000},
+	GetReceiptsMsg:     {0, 1000000},
+	GetProofsMsg:       {0, 600000},
+	GetCodeMsg:         {0, 450000},
+	SendTxMsg:          {0, 450000},
+}
+
+func (list RequestCostList) decode() requestCostTable {
+	table := make(requestCostTable)
+	for _, e := range list {
+		table[e.MsgCode] = &requestCosts{
+			baseCost: e.BaseCost,
+			reqCost:  e.ReqCost,
+		}
+	}
+	return table
+}
+
+func (table requestCostTable) encode() RequestCostList {
+	list := make(RequestCostList, 0, len(table))
+	for code, costs := range table {
+		list = append(list, struct {
+			MsgCode, BaseCost, ReqCost uint64
+		}{code, costs.baseCost, costs.reqCost})
+	}
+	return list
+}
+
+// getCost returns the cost of a request of the given type and number of items,
+// or zero if the request type is free.
+func (table requestCostTable) getCost(msgcode, amount uint64) uint64 {
+	costs, ok := table[msgcode]
+	if !ok {
+		return 0
+	}
+	return costs.baseCost + costs.reqCost*amount
+}
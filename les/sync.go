@@ -0,0 +1,84 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/eth/downloader"
+)
+
+const (
+	forceSyncCycle = 10 * time.Second // Time interval to force syncs, even if few peers are available
+)
+
+// syncer is responsible for periodically synchronising with the network, both
+// downloading hashes and blocks as well as handling the announcement handler.
+func (pm *ProtocolManager) syncer() {
+	// Start and ensure cleanup of sync mechanisms
+	defer pm.downloader.Terminate()
+
+	// Wait for different events to fire synchronisation operations
+	forceSync := time.NewTicker(forceSyncCycle)
+	defer forceSync.Stop()
+
+	for {
+		select {
+		case <-pm.newPeerCh:
+			// Registration happens in the peer handler, nothing to do here
+
+		case <-pm.syncCh:
+			go pm.synchronise(pm.peers.BestPeer())
+
+		case <-forceSync.C:
+			// Force a sync even if no new announcements arrived
+			go pm.synchronise(pm.peers.BestPeer())
+
+		case <-pm.noMorePeers:
+			return
+		}
+	}
+}
+
+// requestSync signals the syncer to check for a better chain, without blocking
+// if a check is already scheduled.
+func (pm *ProtocolManager) requestSync() {
+	select {
+	case pm.syncCh <- struct{}{}:
+	default:
+	}
+}
+
+// needToSync returns whether the peer announced a chain with more total
+// difficulty than our own.
+func (pm *ProtocolManager) needToSync(peer *peer) bool {
+	head := pm.blockchain.CurrentHeader()
+	currentTd := pm.blockchain.GetTd(head.Hash(), head.Number.Uint64())
+
+	_, pTd := peer.Head()
+	return currentTd != nil && pTd.Cmp(currentTd) > 0
+}
+
+// synchronise tries to sync up our local header chain with a remote peer.
+func (pm *ProtocolManager) synchronise(peer *peer) {
+	// Short circuit if no peers are available
+	if peer == nil || !pm.needToSync(peer) {
+		return
+	}
+	pHead, pTd := peer.Head()
+	pm.downloader.Synchronise(peer.id, pHead, pTd, downloader.LightSync)
+}
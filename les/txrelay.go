@@ -0,0 +1,69 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// txRelayFanout is the number of servers every transaction is relayed to.
+const txRelayFanout = 3
+
+// LesTxRelay implements light.TxRelayBackend, sending the transactions of the
+// light pool to a few randomly chosen servers.
+type LesTxRelay struct {
+	peers *peerSet
+}
+
+// NewLesTxRelay creates a transaction relay sending to the given servers.
+func NewLesTxRelay(peers *peerSet) *LesTxRelay {
+	return &LesTxRelay{peers: peers}
+}
+
+// Send relays the given transactions to the network.
+func (r *LesTxRelay) Send(txs types.Transactions) {
+	peers := r.peers.AllPeers()
+	for i, j := range rand.Perm(len(peers)) {
+		if i >= txRelayFanout {
+			break
+		}
+		p := peers[j]
+		if p.fcServer == nil {
+			continue
+		}
+		go func() {
+			for start := 0; start < len(txs); start += MaxTxSend {
+				end := start + MaxTxSend
+				if end > len(txs) {
+					end = len(txs)
+				}
+				if err := p.SendTxs(txs[start:end]); err != nil {
+					p.Log().Debug("Failed to relay transactions", "err", err)
+					return
+				}
+			}
+		}()
+	}
+}
+
+// Discard is called when the given transactions are included in the chain.
+// Servers do not keep track of the relayed transactions, so there is nothing
+// to clean up.
+func (r *LesTxRelay) Discard(hashes []common.Hash) {}
@@ -0,0 +1,413 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// txPermanent is the number of blocks after which a mined transaction is
+// considered permanent if the chain has no finality of its own.
+const txPermanent = 500
+
+// headTimeout is the time allowance for retrieving the account nonces needed to
+// process a new chain head.
+const headTimeout = 10 * time.Second
+
+// TxPool implements the transaction pool for light clients, which keeps track
+// of the status of locally created transactions, detecting if they are included
+// in a block (mined) or rolled back. There are no queued transactions since we
+// always receive all locally signed transactions in the same order as they are
+// created.
+//
+// Since a light client cannot retrieve block bodies on every head change, a
+// transaction is considered mined once the nonce of its paying account at the
+// current head moves past it, and put back into the pending set if a reorg
+// moves the nonce back again.
+type TxPool struct {
+	config   *params.ChainConfig
+	signer   types.Signer
+	quit     chan bool
+	eventMux *event.TypeMux
+	events   *event.TypeMuxSubscription
+	mu       sync.RWMutex
+	chain    *LightChain
+	odr      OdrBackend
+	relay    TxRelayBackend
+	head     common.Hash
+
+	nonce   map[common.Address]uint64          // "pending" nonce
+	pending map[common.Hash]*types.Transaction // pending transactions by tx hash
+	mined   map[common.Hash]*minedTx           // mined transactions by tx hash
+}
+
+// minedTx is a transaction seen included in the chain, along with the number of
+// the head it was first seen at.
+type minedTx struct {
+	tx     *types.Transaction
+	number uint64
+}
+
+// TxRelayBackend provides an interface to the mechanism that forwards transacions
+// to the ETH network. The implementations of the functions should be non-blocking.
+//
+// Send instructs backend to forward new transactions
+// Discard notifies backend about transactions that should be discarded either
+// because they have been mined or replaced by another transaction
+type TxRelayBackend interface {
+	Send(txs types.Transactions)
+	Discard(hashes []common.Hash)
+}
+
+// NewTxPool creates a new light transaction pool
+func NewTxPool(config *params.ChainConfig, eventMux *event.TypeMux, chain *LightChain, relay TxRelayBackend) *TxPool {
+	pool := &TxPool{
+		config:   config,
+		signer:   types.NewEIP155Signer(config.ChainId),
+		nonce:    make(map[common.Address]uint64),
+		pending:  make(map[common.Hash]*types.Transaction),
+		mined:    make(map[common.Hash]*minedTx),
+		quit:     make(chan bool),
+		eventMux: eventMux,
+		events:   eventMux.Subscribe(core.ChainHeadEvent{}),
+		chain:    chain,
+		relay:    relay,
+		odr:      chain.Odr(),
+		head:     chain.CurrentHeader().Hash(),
+	}
+	go pool.eventLoop()
+
+	return pool
+}
+
+// currentState returns the light state of the current head header
+func (pool *TxPool) currentState(ctx context.Context) *state.StateDB {
+	return NewState(ctx, pool.chain.CurrentHeader(), pool.odr)
+}
+
+// GetNonce returns the "pending" nonce of a given address. It always queries
+// the nonce belonging to the latest header too in order to detect if another
+// client using the same key sent a transaction.
+func (pool *TxPool) GetNonce(ctx context.Context, addr common.Address) (uint64, error) {
+	state := pool.currentState(ctx)
+	nonce := state.GetNonce(addr)
+	if state.Error() != nil {
+		return 0, state.Error()
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if nonce > pool.nonce[addr] {
+		pool.nonce[addr] = nonce
+	}
+	return pool.nonce[addr], nil
+}
+
+// eventLoop processes chain head events and also notifies the tx relay backend
+// about the new head hash and tx state changes
+func (pool *TxPool) eventLoop() {
+	for ev := range pool.events.Chan() {
+		switch ev.Data.(type) {
+		case core.ChainHeadEvent:
+			pool.setNewHead(pool.chain.CurrentHeader())
+			// Give waiting pool users a chance to grab the lock
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+// setNewHead retrieves the nonces of all the accounts with pending or recently
+// mined transactions at the new head, moving transactions between the pending
+// and mined sets accordingly.
+func (pool *TxPool) setNewHead(head *types.Header) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	hash := head.Hash()
+	if hash == pool.head {
+		return
+	}
+	// Gather the accounts whose transactions may have changed status
+	accounts := make(map[common.Address]struct{})
+	for _, tx := range pool.pending {
+		from, _ := types.Payer(pool.signer, tx) // already validated
+		accounts[from] = struct{}{}
+	}
+	for _, mtx := range pool.mined {
+		from, _ := types.Payer(pool.signer, mtx.tx) // already validated
+		accounts[from] = struct{}{}
+	}
+	// Retrieve the account nonces of the new head, aborting on failure and
+	// leaving the update to the next head
+	ctx, cancel := context.WithTimeout(context.Background(), headTimeout)
+	defer cancel()
+
+	state := NewState(ctx, head, pool.odr)
+	nonces := make(map[common.Address]uint64, len(accounts))
+	for addr := range accounts {
+		nonces[addr] = state.GetNonce(addr)
+		if err := state.Error(); err != nil {
+			log.Debug("Failed to retrieve account nonces", "number", head.Number, "hash", hash, "err", err)
+			return
+		}
+	}
+	pool.head = hash
+
+	// Move the transactions behind the account nonces into the mined set and
+	// the rolled back ones into the pending set
+	number := head.Number.Uint64()
+
+	var discard []common.Hash
+	for txHash, tx := range pool.pending {
+		from, _ := types.Payer(pool.signer, tx)
+		if tx.Nonce() < nonces[from] {
+			pool.mined[txHash] = &minedTx{tx: tx, number: number}
+			delete(pool.pending, txHash)
+			discard = append(discard, txHash)
+		}
+	}
+	for txHash, mtx := range pool.mined {
+		from, _ := types.Payer(pool.signer, mtx.tx)
+		if mtx.tx.Nonce() >= nonces[from] {
+			log.Debug("Transaction rolled back", "hash", txHash)
+			pool.pending[txHash] = mtx.tx
+			delete(pool.mined, txHash)
+		}
+	}
+	// Forget mined transactions that can no longer be reorganised away
+	finalized := pool.chain.Finalized()
+	if finalized == 0 && number > txPermanent {
+		finalized = number - txPermanent
+	}
+	for txHash, mtx := range pool.mined {
+		if mtx.number <= finalized {
+			delete(pool.mined, txHash)
+		}
+	}
+	// Recalculate the pending nonces and notify the relay
+	for addr, nonce := range nonces {
+		pool.nonce[addr] = nonce
+	}
+	var resend types.Transactions
+	for _, tx := range pool.pending {
+		from, _ := types.Payer(pool.signer, tx)
+		if tx.Nonce() >= pool.nonce[from] {
+			pool.nonce[from] = tx.Nonce() + 1
+		}
+		resend = append(resend, tx)
+	}
+	if len(discard) > 0 {
+		pool.relay.Discard(discard)
+	}
+	if len(resend) > 0 {
+		pool.relay.Send(resend)
+	}
+}
+
+// Stop stops the light transaction pool
+func (pool *TxPool) Stop() {
+	close(pool.quit)
+	pool.events.Unsubscribe()
+	log.Info("Transaction pool stopped")
+}
+
+// Stats returns the number of currently pending (locally created) transactions
+func (pool *TxPool) Stats() (pending int) {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	pending = len(pool.pending)
+	return
+}
+
+// validateTx checks whether a transaction is valid according to the consensus
+// rules at the current head, retrieving the needed account state on demand.
+func (pool *TxPool) validateTx(ctx context.Context, tx *types.Transaction) error {
+	// Heuristic limit, reject transactions over 32KB to prevent DOS attacks
+	if tx.Size() > 32*1024 {
+		return core.ErrOversizedData
+	}
+	// Transactions can't be negative. This may never happen using RLP decoded
+	// transactions but may occur if you create a transaction using the RPC.
+	if tx.Value().Sign() < 0 {
+		return core.ErrNegativeValue
+	}
+	for _, call := range tx.Calls() {
+		if call.Value.Sign() < 0 {
+			return core.ErrNegativeValue
+		}
+	}
+	// Make sure the transaction is signed properly
+	sender, err := types.Sender(pool.signer, tx)
+	if err != nil {
+		return core.ErrInvalidSender
+	}
+	from, err := types.Payer(pool.signer, tx)
+	if err != nil {
+		return core.ErrInvalidSponsor
+	}
+	if tx.Sponsored() && tx.To() == nil && !tx.Batch() {
+		return core.ErrSponsoredCreation
+	}
+	// Ensure the transaction may still be included in the upcoming blocks
+	header := pool.chain.CurrentHeader()
+
+	number := new(big.Int).Add(header.Number, common.Big1)
+	stamp := big.NewInt(time.Now().Unix())
+	if header.Time.Cmp(stamp) >= 0 {
+		stamp = new(big.Int).Add(header.Time, common.Big1)
+	}
+	rules := pool.config.Rules(number, stamp)
+	if err := core.ValidateTxWindow(rules, tx, number); err != nil && err != core.ErrTxNotYetValid {
+		return err
+	}
+	// Ensure the transaction adheres to nonce ordering
+	currentState := NewState(ctx, header, pool.odr)
+	if n := currentState.GetNonce(from); n > tx.Nonce() {
+		return core.ErrNonceTooLow
+	}
+	// Transactor should have enough funds to cover the costs
+	balance, cost := currentState.GetBalance(from), tx.Cost()
+	if balance.Cmp(cost) < 0 {
+		return core.ErrInsufficientFunds
+	}
+	if rules.IsFee && balance.Cmp(cost.Add(cost, core.IntrinsicFee(pool.config.Fee, tx.Data(), tx.Calls()))) < 0 {
+		return core.ErrInsufficientFee
+	}
+	if tx.Sponsored() && currentState.GetBalance(sender).Cmp(tx.TotalValue()) < 0 {
+		return core.ErrInsufficientFunds
+	}
+	return currentState.Error()
+}
+
+// add validates a new transaction and sets its state pending if processable.
+// It also updates the locally stored nonce if necessary.
+func (self *TxPool) add(ctx context.Context, tx *types.Transaction) error {
+	hash := tx.Hash()
+
+	if self.pending[hash] != nil {
+		return fmt.Errorf("known transaction: %x", hash)
+	}
+	if err := self.validateTx(ctx, tx); err != nil {
+		return err
+	}
+	self.pending[hash] = tx
+
+	from, _ := types.Payer(self.signer, tx)
+	if tx.Nonce() >= self.nonce[from] {
+		self.nonce[from] = tx.Nonce() + 1
+	}
+	// Notify the subscribers. This event is posted in a goroutine
+	// because it's possible that somewhere during the post "Remove transaction"
+	// gets called which will then wait for the global tx pool lock and deadlock.
+	go self.eventMux.Post(core.TxPreEvent{Tx: tx})
+
+	// Print a log message if low enough level is set
+	log.Debug("Pooled new transaction", "hash", hash, "from", log.Lazy{Fn: func() common.Address { from, _ := types.Sender(self.signer, tx); return from }}, "to", tx.To())
+	return nil
+}
+
+// Add adds a transaction to the pool if valid and passes it to the tx relay
+// backend
+func (self *TxPool) Add(ctx context.Context, tx *types.Transaction) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if err := self.add(ctx, tx); err != nil {
+		return err
+	}
+	self.relay.Send(types.Transactions{tx})
+	return nil
+}
+
+// GetTransaction returns a transaction if it is contained in the pool
+// and nil otherwise.
+func (tp *TxPool) GetTransaction(hash common.Hash) *types.Transaction {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	return tp.pending[hash]
+}
+
+// GetTransactions returns all currently processable transactions.
+// The returned slice may be modified by the caller.
+func (self *TxPool) GetTransactions() (txs types.Transactions, err error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	txs = make(types.Transactions, 0, len(self.pending))
+	for _, tx := range self.pending {
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// Content retrieves the data content of the transaction pool, returning all the
+// pending as well as queued transactions, grouped by account and nonce.
+func (self *TxPool) Content() (map[common.Address]types.Transactions, map[common.Address]types.Transactions) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	// Retrieve all the pending transactions and sort by account and by nonce
+	pending := make(map[common.Address]types.Transactions)
+	for _, tx := range self.pending {
+		account, _ := types.Sender(self.signer, tx)
+		pending[account] = append(pending[account], tx)
+	}
+	for _, txs := range pending {
+		sort.Sort(types.TxByNonce(txs))
+	}
+	// There are no queued transactions in a light pool, just return an empty map
+	queued := make(map[common.Address]types.Transactions)
+	return pending, queued
+}
+
+// RemoveTransactions removes all given transactions from the pool.
+func (self *TxPool) RemoveTransactions(txs types.Transactions) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	var hashes []common.Hash
+	for _, tx := range txs {
+		hash := tx.Hash()
+		delete(self.pending, hash)
+		hashes = append(hashes, hash)
+	}
+	self.relay.Discard(hashes)
+}
+
+// RemoveTx removes the transaction with the given hash from the pool.
+func (pool *TxPool) RemoveTx(hash common.Hash) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	delete(pool.pending, hash)
+	pool.relay.Discard([]common.Hash{hash})
+}
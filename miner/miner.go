@@ -20,6 +20,7 @@ package miner
 import (
 	"fmt"
 	"sync/atomic"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/common"
@@ -42,6 +43,38 @@ type Backend interface {
 	ChainDb() ethdb.Database
 }
 
+// Config are the configuration parameters of block assembly.
+type Config struct {
+	Budget   time.Duration // Wall-clock time allowed for filling a block before handing it to the sealers (0 = unlimited)
+	MaxTxs   int           // Maximum number of transactions included in a block (0 = unlimited)
+	MaxBytes uint64        // Maximum total size of the transactions included in a block (0 = unlimited)
+	Ordering string        // Strategy ordering the pending transactions of different accounts
+}
+
+// DefaultConfig contains the default configurations for block assembly.
+var DefaultConfig = Config{
+	Ordering: OrderNonce,
+}
+
+// sanitize checks the provided user configurations and changes anything that's
+// unreasonable or unworkable.
+func (config *Config) sanitize() Config {
+	conf := *config
+	if _, ok := orderings[conf.Ordering]; !ok {
+		log.Warn("Sanitizing invalid miner ordering", "provided", conf.Ordering, "updated", DefaultConfig.Ordering)
+		conf.Ordering = DefaultConfig.Ordering
+	}
+	if conf.Budget < 0 {
+		log.Warn("Sanitizing invalid miner budget", "provided", conf.Budget, "updated", time.Duration(0))
+		conf.Budget = 0
+	}
+	if conf.MaxTxs < 0 {
+		log.Warn("Sanitizing invalid miner transaction limit", "provided", conf.MaxTxs, "updated", 0)
+		conf.MaxTxs = 0
+	}
+	return conf
+}
+
 // Miner creates blocks and searches for proof-of-work values.
 type Miner struct {
 	mux *event.TypeMux
@@ -57,12 +90,12 @@ type Miner struct {
 	shouldStart int32 // should start indicates whether we should start after sync
 }
 
-func New(eth Backend, config *params.ChainConfig, mux *event.TypeMux, engine consensus.Engine) *Miner {
+func New(eth Backend, config *params.ChainConfig, mux *event.TypeMux, engine consensus.Engine, conf Config) *Miner {
 	miner := &Miner{
 		eth:      eth,
 		mux:      mux,
 		engine:   engine,
-		worker:   newWorker(config, engine, common.Address{}, eth, mux),
+		worker:   newWorker(config, conf.sanitize(), engine, common.Address{}, eth, mux),
 		canStart: 1,
 	}
 	miner.Register(NewCpuAgent(eth.BlockChain(), engine))
@@ -0,0 +1,194 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"bytes"
+	"container/heap"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Strategies ordering the pending transactions of different accounts.
+const (
+	OrderNonce      = "nonce"      // Lowest account nonce first (legacy heap)
+	OrderArrival    = "arrival"    // Earliest admitted into the pool first
+	OrderRoundRobin = "roundrobin" // One transaction per account in turns, by arrival
+	OrderLocal      = "local"      // Local accounts first, by arrival
+)
+
+// TransactionSet offers the pending transactions to a block being assembled in
+// the order of a strategy, while honouring the nonce order within each account.
+type TransactionSet interface {
+	// Peek returns the next transaction to include, or nil if none are left.
+	Peek() *types.Transaction
+
+	// Shift replaces the next transaction with the following one from the same
+	// account, after the current one was included.
+	Shift()
+
+	// Pop discards the next transaction along with all the following ones from
+	// the same account, after the current one could not be included.
+	Pop()
+}
+
+// Ordering assembles the transaction set of a strategy from the pending, nonce
+// sorted transactions of each account in the pool.
+type Ordering func(pending map[common.Address]types.Transactions, pool *core.TxPool) TransactionSet
+
+// orderings are the strategies selectable by name in the miner configuration.
+var orderings = map[string]Ordering{
+	OrderNonce: func(pending map[common.Address]types.Transactions, pool *core.TxPool) TransactionSet {
+		return types.NewTransactionsByPriceAndNonce(pending)
+	},
+	OrderArrival: func(pending map[common.Address]types.Transactions, pool *core.TxPool) TransactionSet {
+		return newOrderedTxs(pending, pool.Arrivals(pending), nil, byArrival)
+	},
+	OrderRoundRobin: func(pending map[common.Address]types.Transactions, pool *core.TxPool) TransactionSet {
+		return newOrderedTxs(pending, pool.Arrivals(pending), nil, byTurn)
+	},
+	OrderLocal: func(pending map[common.Address]types.Transactions, pool *core.TxPool) TransactionSet {
+		return newOrderedTxs(pending, pool.Arrivals(pending), pool.Locals(), byLocality)
+	},
+}
+
+// accountTxs is the remainder of the pending transactions of a single account,
+// the head of which is the next one to be offered from it.
+type accountTxs struct {
+	from    common.Address
+	txs     types.Transactions // Nonce sorted transactions not yet offered, head first
+	arrival time.Time          // Pool admission time of the head transaction
+	local   bool               // Whether the account is local to the pool
+	served  int                // Number of transactions already included from the account
+}
+
+// byArrival orders accounts by the admission time of their head transactions.
+func byArrival(a, b *accountTxs) bool {
+	if !a.arrival.Equal(b.arrival) {
+		return a.arrival.Before(b.arrival)
+	}
+	return bytes.Compare(a.from[:], b.from[:]) < 0
+}
+
+// byTurn orders accounts by the number of transactions already included from
+// them, falling back to arrival order between equally served ones.
+func byTurn(a, b *accountTxs) bool {
+	if a.served != b.served {
+		return a.served < b.served
+	}
+	return byArrival(a, b)
+}
+
+// byLocality orders local accounts before remote ones, falling back to arrival
+// order within both groups.
+func byLocality(a, b *accountTxs) bool {
+	if a.local != b.local {
+		return a.local
+	}
+	return byArrival(a, b)
+}
+
+// accountHeap is a heap of accounts ordered by the strategy's less function.
+type accountHeap struct {
+	accounts []*accountTxs
+	less     func(a, b *accountTxs) bool
+}
+
+func (h *accountHeap) Len() int           { return len(h.accounts) }
+func (h *accountHeap) Less(i, j int) bool { return h.less(h.accounts[i], h.accounts[j]) }
+func (h *accountHeap) Swap(i, j int)      { h.accounts[i], h.accounts[j] = h.accounts[j], h.accounts[i] }
+
+func (h *accountHeap) Push(x interface{}) {
+	h.accounts = append(h.accounts, x.(*accountTxs))
+}
+
+func (h *accountHeap) Pop() interface{} {
+	old := h.accounts
+	n := len(old)
+	x := old[n-1]
+	h.accounts = old[0 : n-1]
+	return x
+}
+
+// orderedTxs is a transaction set offering the head transactions of accounts in
+// the order of a comparison function.
+type orderedTxs struct {
+	heads    *accountHeap
+	arrivals map[common.Hash]time.Time
+}
+
+// newOrderedTxs creates a transaction set ordering the accounts of the pending
+// transactions with the given comparison function.
+//
+// Note, the input map is reowned so the caller should not interact any more with
+// it after providing it to the constructor.
+func newOrderedTxs(pending map[common.Address]types.Transactions, arrivals map[common.Hash]time.Time, locals []common.Address, less func(a, b *accountTxs) bool) *orderedTxs {
+	local := make(map[common.Address]bool, len(locals))
+	for _, addr := range locals {
+		local[addr] = true
+	}
+	heads := &accountHeap{
+		accounts: make([]*accountTxs, 0, len(pending)),
+		less:     less,
+	}
+	for from, txs := range pending {
+		if len(txs) == 0 {
+			continue
+		}
+		heads.accounts = append(heads.accounts, &accountTxs{
+			from:    from,
+			txs:     txs,
+			arrival: arrivals[txs[0].Hash()],
+			local:   local[from],
+		})
+	}
+	heap.Init(heads)
+
+	return &orderedTxs{
+		heads:    heads,
+		arrivals: arrivals,
+	}
+}
+
+// Peek returns the head transaction of the first account in order.
+func (t *orderedTxs) Peek() *types.Transaction {
+	if t.heads.Len() == 0 {
+		return nil
+	}
+	return t.heads.accounts[0].txs[0]
+}
+
+// Shift replaces the head transaction of the first account with its next one,
+// reordering the account accordingly.
+func (t *orderedTxs) Shift() {
+	acc := t.heads.accounts[0]
+	if acc.txs = acc.txs[1:]; len(acc.txs) == 0 {
+		heap.Pop(t.heads)
+		return
+	}
+	acc.arrival = t.arrivals[acc.txs[0].Hash()]
+	acc.served++
+	heap.Fix(t.heads, 0)
+}
+
+// Pop removes the first account in order along with all its transactions.
+func (t *orderedTxs) Pop() {
+	heap.Pop(t.heads)
+}
@@ -0,0 +1,86 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that the ordering strategies offer the transactions of different accounts
+// in their expected order, while keeping the nonce order within each account.
+func TestTransactionOrderings(t *testing.T) {
+	// Create a few transactions for three accounts, admitted at different times
+	var (
+		accounts = []common.Address{{0x0a}, {0x0b}, {0x0c}}
+		admitted = map[common.Address][]int64{
+			accounts[0]: {1, 2, 3},
+			accounts[1]: {5, 4},
+			accounts[2]: {6},
+		}
+		labels = make(map[common.Hash]string)
+		start  = time.Now()
+	)
+	pending := func() (map[common.Address]types.Transactions, map[common.Hash]time.Time) {
+		txs := make(map[common.Address]types.Transactions)
+		arrivals := make(map[common.Hash]time.Time)
+		for i, addr := range accounts {
+			for nonce, offset := range admitted[addr] {
+				tx := types.NewTransaction(uint64(nonce), addr, big.NewInt(0), nil)
+				txs[addr] = append(txs[addr], tx)
+				arrivals[tx.Hash()] = start.Add(time.Duration(offset) * time.Second)
+				labels[tx.Hash()] = fmt.Sprintf("%c%d", 'A'+i, nonce)
+			}
+		}
+		return txs, arrivals
+	}
+	// drain collects the labels of all transactions offered by a set, discarding
+	// the account of the given transaction when reached
+	drain := func(set TransactionSet, discard string) (order []string) {
+		for tx := set.Peek(); tx != nil; tx = set.Peek() {
+			if label := labels[tx.Hash()]; label == discard {
+				set.Pop()
+				continue
+			}
+			order = append(order, labels[tx.Hash()])
+			set.Shift()
+		}
+		return order
+	}
+	tests := []struct {
+		less    func(a, b *accountTxs) bool
+		discard string
+		want    []string
+	}{
+		{less: byArrival, want: []string{"A0", "A1", "A2", "B0", "B1", "C0"}},
+		{less: byArrival, discard: "A1", want: []string{"A0", "B0", "B1", "C0"}},
+		{less: byTurn, want: []string{"A0", "B0", "C0", "A1", "B1", "A2"}},
+		{less: byLocality, want: []string{"B0", "B1", "A0", "A1", "A2", "C0"}},
+	}
+	for i, tt := range tests {
+		txs, arrivals := pending()
+		order := drain(newOrderedTxs(txs, arrivals, []common.Address{accounts[1]}, tt.less), tt.discard)
+		if fmt.Sprint(order) != fmt.Sprint(tt.want) {
+			t.Errorf("test %d: order mismatch: have %v, want %v", i, order, tt.want)
+		}
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 )
 
@@ -46,6 +47,7 @@ type RemoteAgent struct {
 	engine      consensus.Engine
 	currentWork *Work
 	work        map[common.Hash]*Work
+	workFeed    event.Feed // Feed announcing new work packages to push based miners
 
 	hashrateMu sync.RWMutex
 	hashrate   map[common.Hash]hashrate
@@ -73,6 +75,12 @@ func (a *RemoteAgent) Work() chan<- *Work {
 	return a.workCh
 }
 
+// SubscribeWork registers a subscription for the work packages handed to the
+// agent, each of which can be solved afterwards through SubmitWork.
+func (a *RemoteAgent) SubscribeWork(ch chan<- *Work) event.Subscription {
+	return a.workFeed.Subscribe(ch)
+}
+
 func (a *RemoteAgent) SetReturnCh(returnCh chan<- *Result) {
 	a.returnCh = returnCh
 }
@@ -178,7 +186,10 @@ func (a *RemoteAgent) loop(workCh chan *Work, quitCh chan struct{}) {
 		case work := <-workCh:
 			a.mu.Lock()
 			a.currentWork = work
+			a.work[work.Block.HashNoNonce()] = work
 			a.mu.Unlock()
+
+			a.workFeed.Send(work)
 		case <-ticker:
 			// cleanup
 			a.mu.Lock()
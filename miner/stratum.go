@@ -0,0 +1,617 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	stratumVersion = "EthereumStratum/1.0.0"
+
+	stratumExtranonceSize = 3                // Leading nonce bytes assigned to each session
+	stratumJobsKept       = 8                // Number of recent jobs accepting shares at the same height
+	stratumMaxLineSize    = 4096             // Maximum size of a single request line
+	stratumIdleTimeout    = 10 * time.Minute // Time after which silent miners are dropped
+	stratumWriteTimeout   = 5 * time.Second  // Time allowed for a miner to accept a message
+	stratumSendQueue      = 32               // Messages queued for a miner before it's dropped as too slow
+	stratumHashrateCycle  = 5 * time.Second  // Interval of reporting worker hashrates to the agent
+	stratumHashrateWindow = time.Minute      // Span of accepted shares hashrates are estimated over
+	stratumReportValidity = 10 * time.Second // Time a hashrate reported by a worker supersedes the estimate
+)
+
+// stratumBaseDifficulty is the proof-of-work difficulty of a stratum difficulty of
+// one, used to translate the share difficulty into the miners' units.
+var stratumBaseDifficulty = float64(1 << 32)
+
+// maxUint256 is a big integer representing 2^256, the numerator of PoW targets.
+var maxUint256 = new(big.Int).Exp(big.NewInt(2), big.NewInt(256), big.NewInt(0))
+
+// StratumConfig are the configuration parameters of the stratum mining server.
+type StratumConfig struct {
+	Addr       string // Listening address of the server (empty = disabled)
+	Difficulty uint64 // Proof-of-work difficulty a submitted nonce needs to count as a share
+}
+
+// DefaultStratumConfig contains the default configurations for the stratum server.
+var DefaultStratumConfig = StratumConfig{
+	Difficulty: 1 << 32,
+}
+
+// sanitize checks the provided user configurations and changes anything that's
+// unreasonable or unworkable.
+func (config *StratumConfig) sanitize() StratumConfig {
+	conf := *config
+	if conf.Difficulty == 0 {
+		log.Warn("Sanitizing invalid stratum share difficulty", "provided", conf.Difficulty, "updated", DefaultStratumConfig.Difficulty)
+		conf.Difficulty = DefaultStratumConfig.Difficulty
+	}
+	return conf
+}
+
+// errStratumNoHasher is returned if the consensus engine is unable to evaluate
+// the proof-of-work of shares.
+var errStratumNoHasher = errors.New("consensus engine cannot validate stratum shares")
+
+// Errors reported to stratum miners in response to their requests.
+var (
+	errStratumOther         = &stratumError{20, "Other/Unknown"}
+	errStratumJobNotFound   = &stratumError{21, "Job not found (=stale)"}
+	errStratumDuplicate     = &stratumError{22, "Duplicate share"}
+	errStratumLowDifficulty = &stratumError{23, "Low difficulty share"}
+	errStratumUnauthorized  = &stratumError{24, "Unauthorized worker"}
+	errStratumNotSubscribed = &stratumError{25, "Not subscribed"}
+)
+
+// stratumError is a protocol error, encoded as the [code, message, traceback]
+// triplet expected by stratum miners.
+type stratumError struct {
+	code    int
+	message string
+}
+
+func (e *stratumError) Error() string { return e.message }
+
+func (e *stratumError) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.code, e.message, nil})
+}
+
+// stratumRequest is a request or notification sent by a miner.
+type stratumRequest struct {
+	Id     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// stratumResponse is the reply to a miner's request.
+type stratumResponse struct {
+	Id     json.RawMessage `json:"id"`
+	Result interface{}     `json:"result"`
+	Error  *stratumError   `json:"error"`
+}
+
+// stratumNotification is a message pushed to miners unrequested.
+type stratumNotification struct {
+	Id     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params []interface{}   `json:"params"`
+}
+
+// powHasher is a consensus engine able to evaluate the proof-of-work of a nonce
+// without sealing a block, needed to validate shares below the block difficulty.
+type powHasher interface {
+	Compute(hash common.Hash, number uint64, nonce uint64) (common.Hash, common.Hash)
+}
+
+// stratumJob is a work package handed out to the miners.
+type stratumJob struct {
+	id     string
+	hash   common.Hash // Header hash without the nonce, as mined on
+	seed   common.Hash // Seed hash of the dataset epoch of the block
+	number uint64
+	target *big.Int            // Proof-of-work target a nonce needs to seal the block
+	shares map[uint64]struct{} // Nonces already submitted, to reject duplicates
+}
+
+// stratumSession is a connected miner.
+type stratumSession struct {
+	conn       net.Conn
+	extranonce []byte // Leading nonce bytes reserved for the session
+
+	enc   *json.Encoder
+	queue chan interface{} // Messages waiting to be written to the miner
+	quit  chan struct{}    // Closed when the session terminates
+
+	// Fields below are protected by the server lock
+	subscribed bool
+	worker     string      // Name of the authorized worker, empty if none yet
+	id         common.Hash // Identifier of the worker's hashrate within the agent
+	started    time.Time   // Time the worker was authorized
+	reported   time.Time   // Last time the worker reported its own hashrate
+	shares     []time.Time // Times of the shares accepted within the hashrate window
+}
+
+// send queues a message for the miner without blocking, so a slow miner can't
+// hold up the others. Miners falling too far behind are disconnected.
+func (s *stratumSession) send(msg interface{}) {
+	select {
+	case s.queue <- msg:
+	case <-s.quit:
+	default:
+		log.Debug("Stratum miner too slow, dropping", "addr", s.conn.RemoteAddr())
+		s.conn.Close()
+	}
+}
+
+// write relays the queued messages to the miner until the session terminates,
+// closing the connection on failure.
+func (s *stratumSession) write() {
+	for {
+		select {
+		case msg := <-s.queue:
+			s.conn.SetWriteDeadline(time.Now().Add(stratumWriteTimeout))
+			if err := s.enc.Encode(msg); err != nil {
+				log.Debug("Failed to send stratum message", "addr", s.conn.RemoteAddr(), "err", err)
+				s.conn.Close()
+				return
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// notify pushes a job to the miner.
+func (s *stratumSession) notify(job *stratumJob, clean bool) {
+	s.send(&stratumNotification{
+		Method: "mining.notify",
+		Params: []interface{}{job.id, hex.EncodeToString(job.seed[:]), hex.EncodeToString(job.hash[:]), clean},
+	})
+}
+
+// StratumServer is a TCP server speaking the EthereumStratum/1.0 protocol, pushing
+// the work packages of a remote agent to the connected miners and relaying their
+// solutions and hashrates back to it.
+type StratumServer struct {
+	agent  *RemoteAgent
+	hasher powHasher
+	config StratumConfig
+	target *big.Int // Proof-of-work target a nonce needs to count as a share
+
+	listener net.Listener
+	workCh   chan *Work
+	workSub  event.Subscription
+
+	lock      sync.Mutex
+	sessions  map[*stratumSession]struct{}
+	jobs      []*stratumJob // Jobs accepting shares, most recent last
+	jobSeq    uint64
+	nextExtra uint32
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewStratumServer starts listening for stratum miners, handing them the work
+// packages of the agent.
+func NewStratumServer(agent *RemoteAgent, engine consensus.Engine, config StratumConfig) (*StratumServer, error) {
+	hasher, ok := engine.(powHasher)
+	if !ok {
+		return nil, errStratumNoHasher
+	}
+	config = config.sanitize()
+
+	listener, err := net.Listen("tcp", config.Addr)
+	if err != nil {
+		return nil, err
+	}
+	srv := &StratumServer{
+		agent:    agent,
+		hasher:   hasher,
+		config:   config,
+		target:   new(big.Int).Div(maxUint256, new(big.Int).SetUint64(config.Difficulty)),
+		listener: listener,
+		workCh:   make(chan *Work, 16),
+		sessions: make(map[*stratumSession]struct{}),
+		quit:     make(chan struct{}),
+	}
+	srv.workSub = agent.SubscribeWork(srv.workCh)
+
+	srv.wg.Add(2)
+	go srv.accept()
+	go srv.loop()
+
+	log.Info("Stratum server started", "addr", listener.Addr(), "difficulty", config.Difficulty)
+	return srv, nil
+}
+
+// Addr returns the address the server is listening on.
+func (srv *StratumServer) Addr() net.Addr {
+	return srv.listener.Addr()
+}
+
+// Stop terminates the server, disconnecting all miners.
+func (srv *StratumServer) Stop() {
+	close(srv.quit)
+	srv.workSub.Unsubscribe()
+	srv.listener.Close()
+
+	srv.lock.Lock()
+	for session := range srv.sessions {
+		session.conn.Close()
+	}
+	srv.lock.Unlock()
+
+	srv.wg.Wait()
+	log.Info("Stratum server stopped")
+}
+
+// accept admits new miners until the listener is closed.
+func (srv *StratumServer) accept() {
+	defer srv.wg.Done()
+
+	for {
+		conn, err := srv.listener.Accept()
+		if err != nil {
+			select {
+			case <-srv.quit:
+			default:
+				log.Error("Stratum server failed to accept miner", "err", err)
+			}
+			return
+		}
+		srv.wg.Add(1)
+		go srv.handle(conn)
+	}
+}
+
+// loop turns the work packages of the agent into jobs and periodically reports
+// the hashrates of the workers.
+func (srv *StratumServer) loop() {
+	defer srv.wg.Done()
+
+	ticker := time.NewTicker(stratumHashrateCycle)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case work := <-srv.workCh:
+			srv.push(work)
+
+		case <-ticker.C:
+			srv.reportHashrates()
+
+		case <-srv.quit:
+			return
+		}
+	}
+}
+
+// push creates a job from a work package and queues it for all ready miners.
+func (srv *StratumServer) push(work *Work) {
+	block := work.Block
+
+	srv.lock.Lock()
+	srv.jobSeq++
+	job := &stratumJob{
+		id:     fmt.Sprintf("%x", srv.jobSeq),
+		hash:   block.HashNoNonce(),
+		seed:   common.BytesToHash(ethash.SeedHash(block.NumberU64())),
+		number: block.NumberU64(),
+		target: new(big.Int).Div(maxUint256, block.Difficulty()),
+		shares: make(map[uint64]struct{}),
+	}
+	// Jobs of earlier heights are stale, the miners should abandon them
+	clean := len(srv.jobs) == 0 || srv.jobs[len(srv.jobs)-1].number != job.number
+	if clean {
+		srv.jobs = srv.jobs[:0]
+	}
+	if srv.jobs = append(srv.jobs, job); len(srv.jobs) > stratumJobsKept {
+		srv.jobs = srv.jobs[len(srv.jobs)-stratumJobsKept:]
+	}
+	var ready []*stratumSession
+	for session := range srv.sessions {
+		if session.subscribed && session.worker != "" {
+			ready = append(ready, session)
+		}
+	}
+	srv.lock.Unlock()
+
+	log.Debug("Pushing stratum job", "job", job.id, "number", job.number, "hash", job.hash, "miners", len(ready))
+	for _, session := range ready {
+		session.notify(job, clean)
+	}
+}
+
+// reportHashrates relays the estimated hashrate of the workers not reporting
+// their own to the agent.
+func (srv *StratumServer) reportHashrates() {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	now := time.Now()
+	for session := range srv.sessions {
+		if session.worker == "" || now.Sub(session.reported) < stratumReportValidity {
+			continue
+		}
+		// Drop the shares outside the window and estimate from the remainder
+		cutoff := now.Add(-stratumHashrateWindow)
+		for len(session.shares) > 0 && session.shares[0].Before(cutoff) {
+			session.shares = session.shares[1:]
+		}
+		elapsed := now.Sub(session.started)
+		if elapsed > stratumHashrateWindow {
+			elapsed = stratumHashrateWindow
+		}
+		if elapsed <= 0 {
+			continue
+		}
+		rate := float64(len(session.shares)) * float64(srv.config.Difficulty) / elapsed.Seconds()
+		srv.agent.SubmitHashrate(session.id, uint64(rate))
+	}
+}
+
+// handle serves the requests of a single miner until it disconnects.
+func (srv *StratumServer) handle(conn net.Conn) {
+	defer srv.wg.Done()
+	defer conn.Close()
+
+	// Reserve a unique nonce prefix for the miner, unless the server is stopping
+	// and already disconnected the registered ones
+	srv.lock.Lock()
+	select {
+	case <-srv.quit:
+		srv.lock.Unlock()
+		return
+	default:
+	}
+	extra := srv.nextExtra
+	srv.nextExtra = (srv.nextExtra + 1) % (1 << (8 * stratumExtranonceSize))
+
+	session := &stratumSession{
+		conn:       conn,
+		extranonce: make([]byte, stratumExtranonceSize),
+		enc:        json.NewEncoder(conn),
+		queue:      make(chan interface{}, stratumSendQueue),
+		quit:       make(chan struct{}),
+	}
+	for i := range session.extranonce {
+		session.extranonce[i] = byte(extra >> uint(8*(stratumExtranonceSize-1-i)))
+	}
+	srv.sessions[session] = struct{}{}
+	srv.lock.Unlock()
+
+	srv.wg.Add(1)
+	go func() {
+		defer srv.wg.Done()
+		session.write()
+	}()
+
+	logger := log.New("miner", conn.RemoteAddr())
+	logger.Debug("Stratum miner connected", "extranonce", hex.EncodeToString(session.extranonce))
+
+	defer func() {
+		srv.lock.Lock()
+		delete(srv.sessions, session)
+		srv.lock.Unlock()
+		close(session.quit)
+		logger.Debug("Stratum miner disconnected")
+	}()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 512), stratumMaxLineSize)
+	for {
+		conn.SetReadDeadline(time.Now().Add(stratumIdleTimeout))
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				logger.Debug("Stratum miner read failed", "err", err)
+			}
+			return
+		}
+		var req stratumRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			logger.Debug("Invalid stratum request", "err", err)
+			return
+		}
+		result, after, err := srv.serve(session, &req)
+		if err != nil {
+			logger.Trace("Stratum request failed", "method", req.Method, "err", err)
+			session.send(&stratumResponse{Id: req.Id, Error: err})
+		} else {
+			session.send(&stratumResponse{Id: req.Id, Result: result})
+		}
+		if after != nil {
+			after()
+		}
+	}
+}
+
+// serve executes a single request of a miner, returning the result along with
+// any messages to push to the miner after the response.
+func (srv *StratumServer) serve(session *stratumSession, req *stratumRequest) (interface{}, func(), *stratumError) {
+	switch req.Method {
+	case "mining.subscribe":
+		return srv.subscribe(session)
+	case "mining.extranonce.subscribe":
+		// The nonce prefix of a session never changes, nothing to notify about
+		return true, nil, nil
+	case "mining.authorize":
+		return srv.authorize(session, req.Params)
+	case "mining.submit":
+		result, err := srv.submit(session, req.Params)
+		return result, nil, err
+	case "mining.hashrate", "eth_submitHashrate":
+		result, err := srv.hashrate(session, req.Params)
+		return result, nil, err
+	default:
+		return nil, nil, errStratumOther
+	}
+}
+
+// subscribe registers the miner for receiving jobs, assigning its nonce prefix.
+func (srv *StratumServer) subscribe(session *stratumSession) (interface{}, func(), *stratumError) {
+	srv.lock.Lock()
+	session.subscribed = true
+	job := srv.current(session)
+	srv.lock.Unlock()
+
+	extranonce := hex.EncodeToString(session.extranonce)
+	result := []interface{}{
+		[]interface{}{"mining.notify", extranonce, stratumVersion},
+		extranonce,
+	}
+	return result, func() {
+		session.send(&stratumNotification{
+			Method: "mining.set_difficulty",
+			Params: []interface{}{float64(srv.config.Difficulty) / stratumBaseDifficulty},
+		})
+		if job != nil {
+			session.notify(job, true)
+		}
+	}, nil
+}
+
+// authorize registers the worker mining on the connection.
+func (srv *StratumServer) authorize(session *stratumSession, params []json.RawMessage) (interface{}, func(), *stratumError) {
+	var worker string
+	if len(params) < 1 || json.Unmarshal(params[0], &worker) != nil || worker == "" {
+		return nil, nil, errStratumUnauthorized
+	}
+	srv.lock.Lock()
+	if session.worker == "" {
+		session.started = time.Now()
+	}
+	session.worker = worker
+	session.id = crypto.Keccak256Hash(session.extranonce, []byte(worker))
+	job := srv.current(session)
+	srv.lock.Unlock()
+
+	log.Debug("Stratum worker authorized", "miner", session.conn.RemoteAddr(), "worker", worker)
+	if job == nil {
+		return true, nil, nil
+	}
+	return true, func() { session.notify(job, true) }, nil
+}
+
+// current returns the latest job if the session is ready to receive it, and nil
+// otherwise. The server lock is assumed to be held.
+func (srv *StratumServer) current(session *stratumSession) *stratumJob {
+	if !session.subscribed || session.worker == "" || len(srv.jobs) == 0 {
+		return nil
+	}
+	return srv.jobs[len(srv.jobs)-1]
+}
+
+// submit validates a share of a worker, relaying it to the agent if it also
+// seals the block.
+func (srv *StratumServer) submit(session *stratumSession, params []json.RawMessage) (interface{}, *stratumError) {
+	var fields [3]string
+	if len(params) < len(fields) {
+		return nil, errStratumOther
+	}
+	for i := range fields {
+		if err := json.Unmarshal(params[i], &fields[i]); err != nil {
+			return nil, errStratumOther
+		}
+	}
+	suffix, err := hex.DecodeString(fields[2])
+	if err != nil || len(suffix) != 8-stratumExtranonceSize {
+		return nil, errStratumOther
+	}
+	nonce := binary.BigEndian.Uint64(append(common.CopyBytes(session.extranonce), suffix...))
+
+	srv.lock.Lock()
+	if !session.subscribed {
+		srv.lock.Unlock()
+		return nil, errStratumNotSubscribed
+	}
+	if session.worker == "" {
+		srv.lock.Unlock()
+		return nil, errStratumUnauthorized
+	}
+	var job *stratumJob
+	for _, j := range srv.jobs {
+		if j.id == fields[1] {
+			job = j
+			break
+		}
+	}
+	if job == nil {
+		srv.lock.Unlock()
+		return nil, errStratumJobNotFound
+	}
+	if _, ok := job.shares[nonce]; ok {
+		srv.lock.Unlock()
+		return nil, errStratumDuplicate
+	}
+	job.shares[nonce] = struct{}{}
+	srv.lock.Unlock()
+
+	// Evaluate the share outside of the lock, hashing is expensive
+	digest, result := srv.hasher.Compute(job.hash, job.number, nonce)
+	value := result.Big()
+	if value.Cmp(srv.target) > 0 && value.Cmp(job.target) > 0 {
+		return nil, errStratumLowDifficulty
+	}
+	srv.lock.Lock()
+	session.shares = append(session.shares, time.Now())
+	srv.lock.Unlock()
+
+	if value.Cmp(job.target) <= 0 {
+		if !srv.agent.SubmitWork(types.EncodeNonce(nonce), digest, job.hash) {
+			return false, nil
+		}
+		log.Info("Stratum worker sealed block", "worker", fields[0], "number", job.number, "hash", job.hash)
+	}
+	return true, nil
+}
+
+// hashrate relays the hashrate reported by a worker to the agent.
+func (srv *StratumServer) hashrate(session *stratumSession, params []json.RawMessage) (interface{}, *stratumError) {
+	var rate hexutil.Uint64
+	if len(params) < 1 || json.Unmarshal(params[0], &rate) != nil {
+		return nil, errStratumOther
+	}
+	srv.lock.Lock()
+	if session.worker == "" {
+		srv.lock.Unlock()
+		return nil, errStratumUnauthorized
+	}
+	session.reported = time.Now()
+	id := session.id
+	srv.lock.Unlock()
+
+	srv.agent.SubmitHashrate(id, uint64(rate))
+	return true, nil
+}
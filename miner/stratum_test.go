@@ -0,0 +1,242 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// stratumMessage is any message received from the stratum server.
+type stratumMessage struct {
+	Id     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+	Result json.RawMessage   `json:"result"`
+	Error  []interface{}     `json:"error"`
+}
+
+// stratumClient is a minimal stratum miner driving the server in tests.
+type stratumClient struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+	seq     int
+	pushed  []*stratumMessage // Notifications received while waiting for responses
+}
+
+func (c *stratumClient) read(t *testing.T) *stratumMessage {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if !c.scanner.Scan() {
+		t.Fatalf("failed to read stratum message: %v", c.scanner.Err())
+	}
+	msg := new(stratumMessage)
+	if err := json.Unmarshal(c.scanner.Bytes(), msg); err != nil {
+		t.Fatalf("failed to decode stratum message %q: %v", c.scanner.Text(), err)
+	}
+	return msg
+}
+
+// call issues a request and waits for its response, stashing any notifications.
+func (c *stratumClient) call(t *testing.T, method string, params ...interface{}) *stratumMessage {
+	c.seq++
+	req, _ := json.Marshal(map[string]interface{}{"id": c.seq, "method": method, "params": params})
+	if _, err := c.conn.Write(append(req, '\n')); err != nil {
+		t.Fatalf("failed to send %s: %v", method, err)
+	}
+	for {
+		msg := c.read(t)
+		if msg.Method != "" {
+			c.pushed = append(c.pushed, msg)
+			continue
+		}
+		if string(msg.Id) != fmt.Sprint(c.seq) {
+			t.Fatalf("response id mismatch: have %s, want %d", msg.Id, c.seq)
+		}
+		return msg
+	}
+}
+
+// notification returns the next notification of the given method.
+func (c *stratumClient) notification(t *testing.T, method string) *stratumMessage {
+	for {
+		var msg *stratumMessage
+		if len(c.pushed) > 0 {
+			msg, c.pushed = c.pushed[0], c.pushed[1:]
+		} else {
+			msg = c.read(t)
+		}
+		if msg.Method == method {
+			return msg
+		}
+	}
+}
+
+// Tests that stratum miners receive the work of the agent, and that their shares
+// are validated against the share difficulty, relaying block solutions.
+func TestStratumMining(t *testing.T) {
+	engine := ethash.NewTester()
+
+	agent := NewRemoteAgent(nil, engine)
+	results := make(chan *Result, 1)
+	agent.SetReturnCh(results)
+	agent.Start()
+	defer agent.Stop()
+
+	srv, err := NewStratumServer(agent, engine, StratumConfig{Addr: "127.0.0.1:0", Difficulty: 4})
+	if err != nil {
+		t.Fatalf("failed to start stratum server: %v", err)
+	}
+	defer srv.Stop()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to connect to stratum server: %v", err)
+	}
+	defer conn.Close()
+	client := &stratumClient{conn: conn, scanner: bufio.NewScanner(conn)}
+
+	// Ensure shares are refused before subscribing, then subscribe and authorize
+	if res := client.call(t, "mining.submit", "worker", "1", "0000000000"); len(res.Error) == 0 || res.Error[0] != float64(25) {
+		t.Fatalf("unsubscribed share error mismatch: have %v, want code 25", res.Error)
+	}
+	var subscription []json.RawMessage
+	if err := json.Unmarshal(client.call(t, "mining.subscribe", "test", stratumVersion).Result, &subscription); err != nil || len(subscription) != 2 {
+		t.Fatalf("invalid subscription result: %v", err)
+	}
+	var extranonceHex string
+	json.Unmarshal(subscription[1], &extranonceHex)
+	extranonce, err := hex.DecodeString(extranonceHex)
+	if err != nil || len(extranonce) != stratumExtranonceSize {
+		t.Fatalf("invalid extranonce %q: %v", extranonceHex, err)
+	}
+	var diff float64
+	json.Unmarshal(client.notification(t, "mining.set_difficulty").Params[0], &diff)
+	if diff != 4/stratumBaseDifficulty {
+		t.Fatalf("share difficulty mismatch: have %v, want %v", diff, 4/stratumBaseDifficulty)
+	}
+	if res := client.call(t, "mining.authorize", "worker", "x"); string(res.Result) != "true" {
+		t.Fatalf("failed to authorize worker: %s %v", res.Result, res.Error)
+	}
+	// Hand the agent some work and ensure it's pushed to the miner
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(64), Time: big.NewInt(0)}
+	agent.Work() <- &Work{Block: types.NewBlockWithHeader(header), createdAt: time.Now()}
+
+	notify := client.notification(t, "mining.notify")
+	var job, hash string
+	json.Unmarshal(notify.Params[0], &job)
+	json.Unmarshal(notify.Params[2], &hash)
+	if want := hex.EncodeToString(header.HashNoNonce().Bytes()); hash != want {
+		t.Fatalf("job header hash mismatch: have %s, want %s", hash, want)
+	}
+	// Search for nonces below the share, and at the share and block difficulties
+	var (
+		shareTarget = new(big.Int).Div(maxUint256, big.NewInt(4))
+		blockTarget = new(big.Int).Div(maxUint256, header.Difficulty)
+		suffixes    = make(map[string]string)
+	)
+	prefix := make([]byte, 8)
+	copy(prefix, extranonce)
+	for i := uint64(0); len(suffixes) < 3; i++ {
+		nonce := binary.BigEndian.Uint64(prefix) | i
+		_, result := engine.Compute(header.HashNoNonce(), 1, nonce)
+
+		kind := "low"
+		switch {
+		case result.Big().Cmp(blockTarget) <= 0:
+			kind = "block"
+		case result.Big().Cmp(shareTarget) <= 0:
+			kind = "share"
+		}
+		if _, ok := suffixes[kind]; !ok {
+			suffixes[kind] = fmt.Sprintf("%010x", i)
+		}
+	}
+	submit := func(job, kind string) *stratumMessage {
+		return client.call(t, "mining.submit", "worker", job, suffixes[kind])
+	}
+	if res := submit(job, "low"); len(res.Error) == 0 || res.Error[0] != float64(23) {
+		t.Fatalf("low difficulty share error mismatch: have %v, want code 23", res.Error)
+	}
+	if res := submit(job, "share"); string(res.Result) != "true" {
+		t.Fatalf("valid share rejected: %v", res.Error)
+	}
+	if res := submit(job, "share"); len(res.Error) == 0 || res.Error[0] != float64(22) {
+		t.Fatalf("duplicate share error mismatch: have %v, want code 22", res.Error)
+	}
+	if res := submit("ff", "block"); len(res.Error) == 0 || res.Error[0] != float64(21) {
+		t.Fatalf("unknown job error mismatch: have %v, want code 21", res.Error)
+	}
+	select {
+	case <-results:
+		t.Fatalf("share below block difficulty sealed a block")
+	default:
+	}
+	// Ensure a block solution is relayed to the miner through the agent
+	if res := submit(job, "block"); string(res.Result) != "true" {
+		t.Fatalf("block solution rejected: %s %v", res.Result, res.Error)
+	}
+	select {
+	case result := <-results:
+		if err := engine.VerifySeal(nil, result.Block.Header()); err != nil {
+			t.Fatalf("relayed block has invalid seal: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("block solution not relayed")
+	}
+}
+
+// Tests that messages to a miner not reading them are queued without blocking the
+// sender, and that the miner is dropped once the queue fills up.
+func TestStratumSlowMiner(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	session := &stratumSession{
+		conn:  server,
+		enc:   json.NewEncoder(server),
+		queue: make(chan interface{}, stratumSendQueue),
+		quit:  make(chan struct{}),
+	}
+	defer close(session.quit)
+
+	job := &stratumJob{id: "1"}
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i <= stratumSendQueue; i++ {
+			session.notify(job, false)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("sending to a slow miner blocked")
+	}
+	if _, err := server.Write([]byte{0}); err == nil {
+		t.Fatalf("slow miner not disconnected")
+	}
+}
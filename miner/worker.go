@@ -38,6 +38,14 @@ import (
 const (
 	resultQueueSize  = 10
 	miningLogAtDepth = 5
+
+	// swapMargin is the time before the slot of a block after which an improved
+	// version of it is not swapped in any more, giving the agents time to switch.
+	swapMargin = 100 * time.Millisecond
+
+	// rebuildDelay is the time transactions are gathered for before rebuilding the
+	// work of an on demand sealer, instead of rebuilding on every single one.
+	rebuildDelay = 100 * time.Millisecond
 )
 
 // Agent can register themself with the worker
@@ -53,17 +61,25 @@ type Agent interface {
 // all of the current state information
 type Work struct {
 	config *params.ChainConfig
+	rules  params.Rules
 	signer types.Signer
 
 	state     *state.StateDB // apply state changes here
+	parent    *state.StateDB // parent state to check admission filters against
 	tcount    int            // tx count in cycle
+	size      uint64         // total size of the txs in cycle
 	failedTxs types.Transactions
 
+	maxTxs    int    // maximum number of txs in cycle (0 = unlimited)
+	maxBytes  uint64 // maximum total size of the txs in cycle (0 = unlimited)
+	interrupt *int32 // set once the work is superseded by a newer one
+
 	Block *types.Block // the new block
 
 	header   *types.Header
 	txs      []*types.Transaction
 	receipts []*types.Receipt
+	fees     *big.Int // fees charged by the txs, credited to the coinbase on finalization
 
 	createdAt time.Time
 }
@@ -76,6 +92,7 @@ type Result struct {
 // worker is the main object which takes care of applying messages to the new state
 type worker struct {
 	config *params.ChainConfig
+	conf   Config
 	engine consensus.Engine
 
 	mu sync.Mutex
@@ -111,9 +128,10 @@ type worker struct {
 	fullValidation bool
 }
 
-func newWorker(config *params.ChainConfig, engine consensus.Engine, coinbase common.Address, eth Backend, mux *event.TypeMux) *worker {
+func newWorker(config *params.ChainConfig, conf Config, engine consensus.Engine, coinbase common.Address, eth Backend, mux *event.TypeMux) *worker {
 	return &worker{
 		config:         config,
+		conf:           conf,
 		engine:         engine,
 		eth:            eth,
 		mux:            mux,
@@ -162,7 +180,7 @@ func (self *worker) pendingBlock() *types.Block {
 }
 
 func (self *worker) start() {
-	self.events = self.mux.Subscribe(core.ChainHeadEvent{}, core.ChainSideEvent{})
+	self.events = self.mux.Subscribe(core.ChainHeadEvent{}, core.ChainSideEvent{}, core.TxPreEvent{})
 	go self.update()
 	go self.wait()
 	self.mu.Lock()
@@ -202,16 +220,43 @@ func (self *worker) unregister(agent Agent) {
 }
 
 func (self *worker) update() {
-	for event := range self.events.Chan() {
-		// A real event arrived, process interesting content
-		switch event.Data.(type) {
-		case core.ChainHeadEvent:
+	var rebuild <-chan time.Time // fires once new transactions settled for on demand sealing
+
+	events := self.events.Chan()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			// A real event arrived, process interesting content
+			switch event.Data.(type) {
+			case core.ChainHeadEvent:
+				self.commitNewWork()
+				rebuild = nil
+			case core.ChainSideEvent:
+			case core.TxPreEvent:
+				// Sealing on demand needs fresh work to pick up new transactions, but
+				// rebuild once per burst of them, not for every single one
+				next := new(big.Int).Add(self.chain.CurrentBlock().Number(), common.Big1)
+				if self.sealOnDemand(next) && rebuild == nil {
+					rebuild = time.After(rebuildDelay)
+				}
+			}
+		case <-rebuild:
 			self.commitNewWork()
-		case core.ChainSideEvent:
+			rebuild = nil
 		}
 	}
 }
 
+// sealOnDemand returns whether block number is sealed as soon as it contains
+// transactions instead of on a fixed interval.
+func (self *worker) sealOnDemand(number *big.Int) bool {
+	instant := self.config.EngineConfig(number).Instant
+	return instant != nil && instant.Period == 0
+}
+
 func (self *worker) wait() {
 	for {
 		mustCommitNewWork := true
@@ -304,9 +349,14 @@ func (self *worker) makeCurrent(parent *types.Block, header *types.Header) error
 	}
 	work := &Work{
 		config:    self.config,
+		rules:     self.config.Rules(header.Number, header.Time),
 		signer:    types.NewEIP155Signer(self.config.ChainId),
 		state:     state,
 		header:    header,
+		maxTxs:    self.conf.MaxTxs,
+		maxBytes:  self.conf.MaxBytes,
+		interrupt: new(int32),
+		fees:      new(big.Int),
 		createdAt: time.Now(),
 	}
 
@@ -333,6 +383,12 @@ func (self *worker) commitNewWork() {
 	tstamp := tstart.Unix()
 	if parent.Time().Cmp(new(big.Int).SetInt64(tstamp)) >= 0 {
 		tstamp = parent.Time().Int64() + 1
+
+		// Blocks sealed on demand may share their parent's timestamp, don't run
+		// ahead of the clock (and wait for it) when many are sealed in a second
+		if self.sealOnDemand(new(big.Int).Add(parent.Number(), common.Big1)) {
+			tstamp = parent.Time().Int64()
+		}
 	}
 	// this will ensure we're not going off too far in the future
 	if now := time.Now().Unix(); tstamp > now+1 {
@@ -356,6 +412,10 @@ func (self *worker) commitNewWork() {
 		log.Error("Failed to prepare header for mining", "err", err)
 		return
 	}
+	// Abort filling the previous work in the background, it's being superseded
+	if self.current != nil {
+		atomic.StoreInt32(self.current.interrupt, 1)
+	}
 	// Could potentially happen if starting to mine in an odd state.
 	err := self.makeCurrent(parent, header)
 	if err != nil {
@@ -369,12 +429,24 @@ func (self *worker) commitNewWork() {
 		log.Error("Failed to fetch pending transactions", "err", err)
 		return
 	}
-	txs := types.NewTransactionsByPriceAndNonce(pending)
-	work.commitTransactions(self.mux, txs, self.chain, self.coinbase)
+	txs := orderings[self.conf.Ordering](pending, self.eth.TxPool())
+
+	var deadline time.Time
+	if self.conf.Budget > 0 {
+		deadline = time.Now().Add(self.conf.Budget)
+	}
+	more := work.commitTransactions(self.mux, txs, self.chain, self.coinbase, deadline)
 
 	self.eth.TxPool().RemoveBatch(work.failedTxs)
 
+	// If the budget ran out before all transactions were offered, keep filling a
+	// copy of the block in the background while the current one is being sealed
+	var next *Work
+	if more {
+		next = work.copy()
+	}
 	// Create the new block to seal with the consensus engine
+	consensus.AccumulateFees(work.state, self.coinbase, work.fees)
 	if work.Block, err = self.engine.Finalize(self.chain, header, work.state, work.txs, work.receipts); err != nil {
 		log.Error("Failed to finalize block for sealing", "err", err)
 		return
@@ -385,19 +457,127 @@ func (self *worker) commitNewWork() {
 		self.unconfirmed.Shift(work.Block.NumberU64() - 1)
 	}
 	self.push(work)
+
+	if next != nil {
+		go self.continueWork(next, txs, self.coinbase)
+	}
+}
+
+// continueWork keeps filling a block whose build budget ran out and swaps it in
+// for sealing, provided it's improved before the slot of the block arrives.
+func (self *worker) continueWork(work *Work, txs TransactionSet, coinbase common.Address) {
+	deadline := time.Unix(work.header.Time.Int64(), 0).Add(-swapMargin)
+	if !time.Now().Before(deadline) {
+		return
+	}
+	tcount := work.tcount
+	work.commitTransactions(self.mux, txs, self.chain, coinbase, deadline)
+
+	self.eth.TxPool().RemoveBatch(work.failedTxs)
+	if work.tcount == tcount {
+		return
+	}
+	consensus.AccumulateFees(work.state, coinbase, work.fees)
+	block, err := self.engine.Finalize(self.chain, work.header, work.state, work.txs, work.receipts)
+	if err != nil {
+		log.Error("Failed to finalize improved block for sealing", "err", err)
+		return
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.currentMu.Lock()
+	defer self.currentMu.Unlock()
+
+	// Only swap if the block is still the one being sealed, and its slot is yet to come
+	if atomic.LoadInt32(work.interrupt) != 0 || !time.Now().Before(deadline) {
+		log.Debug("Discarding improved mining work", "number", block.Number(), "txs", work.tcount)
+		return
+	}
+	work.Block = block
+	self.current = work
+
+	if atomic.LoadInt32(&self.mining) == 1 {
+		log.Info("Swap in improved mining work", "number", block.Number(), "txs", work.tcount, "added", work.tcount-tcount)
+	}
+	self.push(work)
 }
 
-func (env *Work) commitTransactions(mux *event.TypeMux, txs *types.TransactionsByPriceAndNonce, bc *core.BlockChain, coinbase common.Address) {
+// copy creates an independent copy of the work environment, which can be filled
+// further without affecting the original.
+func (env *Work) copy() *Work {
+	cpy := *env
+	cpy.state = env.state.Copy()
+	cpy.header = types.CopyHeader(env.header)
+	cpy.txs = append([]*types.Transaction(nil), env.txs...)
+	cpy.receipts = append([]*types.Receipt(nil), env.receipts...)
+	cpy.fees = new(big.Int).Set(env.fees)
+	cpy.failedTxs = nil
+	cpy.Block = nil
+	cpy.createdAt = time.Now()
+	return &cpy
+}
+
+// commitTransactions applies the transactions of the set to the work until it's
+// exhausted, the block is full or the deadline (if any) passes. It reports
+// whether transactions might be left to be applied after the deadline.
+func (env *Work) commitTransactions(mux *event.TypeMux, txs TransactionSet, bc *core.BlockChain, coinbase common.Address, deadline time.Time) bool {
 	gp := new(core.GasPool)
 
 	var coalescedLogs []*types.Log
 
+	// Admission filters are checked against the parent state, same as the block
+	// validator does, so snapshot it before any transaction is applied
+	filter := bc.TxFilter()
+	if filter != nil && env.parent == nil {
+		env.parent = env.state.Copy()
+	}
+	var more bool
 	for {
+		// Abort if the work was superseded, or the block is full
+		if atomic.LoadInt32(env.interrupt) != 0 {
+			break
+		}
+		if env.maxTxs > 0 && env.tcount >= env.maxTxs {
+			break
+		}
 		// Retrieve the next transaction and abort if all done
 		tx := txs.Peek()
 		if tx == nil {
 			break
 		}
+		// Stop if the build budget ran out, leaving the rest for later
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			log.Debug("Block build budget exhausted", "number", env.header.Number, "txs", env.tcount)
+			more = true
+			break
+		}
+		// Skip the transaction (and the rest from the account) if it doesn't fit
+		size := uint64(tx.Size())
+		if env.maxBytes > 0 && env.size+size > env.maxBytes {
+			log.Trace("Skipping transaction exceeding block size", "hash", tx.Hash(), "size", size)
+			txs.Pop()
+			continue
+		}
+		// Skip the transaction (and the rest from the account) if it's outside of
+		// its validity window, dropping it from the pool if already expired
+		if err := core.ValidateTxWindow(env.rules, tx, env.header.Number); err != nil {
+			log.Trace("Skipping transaction outside validity window", "hash", tx.Hash(), "err", err)
+			if err != core.ErrTxNotYetValid {
+				env.failedTxs = append(env.failedTxs, tx)
+			}
+			txs.Pop()
+			continue
+		}
+		// Drop the transaction (and the rest from the account) if it's filtered
+		if filter != nil {
+			from, _ := types.Sender(env.signer, tx)
+			if err := filter.FilterTx(from, tx, env.parent); err != nil {
+				log.Trace("Filtered transaction, will be removed", "hash", tx.Hash(), "err", err)
+				env.failedTxs = append(env.failedTxs, tx)
+				txs.Pop()
+				continue
+			}
+		}
 
 		// Error may be ignored here. The error has already been checked
 		// during transaction acceptance is the transaction pool.
@@ -412,6 +592,7 @@ func (env *Work) commitTransactions(mux *event.TypeMux, txs *types.TransactionsB
 			// Everything ok, collect the logs and shift in the next transaction from the same account
 			coalescedLogs = append(coalescedLogs, logs...)
 			env.tcount++
+			env.size += size
 			txs.Shift()
 
 		default:
@@ -440,16 +621,20 @@ func (env *Work) commitTransactions(mux *event.TypeMux, txs *types.TransactionsB
 			}
 		}(cpy, env.tcount)
 	}
+	return more
 }
 
 func (env *Work) commitTransaction(tx *types.Transaction, bc *core.BlockChain, coinbase common.Address, gp *core.GasPool) (error, []*types.Log) {
 	snap := env.state.Snapshot()
 
-	receipt, err := core.ApplyTransaction(env.config, bc, &coinbase, gp, env.state, env.header, tx, vm.Config{})
+	receipt, fee, err := core.ApplyTransaction(env.config, bc, &coinbase, gp, env.state, env.header, tx, vm.Config{})
 	if err != nil {
 		env.state.RevertToSnapshot(snap)
 		return err, nil
 	}
+	if fee != nil {
+		env.fees.Add(env.fees, fee)
+	}
 	env.txs = append(env.txs, tx)
 	env.receipts = append(env.receipts, receipt)
 
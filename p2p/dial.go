@@ -54,6 +54,7 @@ type dialstate struct {
 	maxDynDials int
 	ntab        discoverTable
 	netrestrict *netutil.Netlist
+	banned      func(discover.NodeID) bool // Reports temporarily banned nodes, nil if none are
 
 	lookupRunning bool
 	dialing       map[discover.NodeID]connFlag
@@ -237,6 +238,7 @@ var (
 	errAlreadyConnected = errors.New("already connected")
 	errRecentlyDialed   = errors.New("recently dialed")
 	errNotWhitelisted   = errors.New("not contained in netrestrict whitelist")
+	errBanned           = errors.New("temporarily banned")
 )
 
 func (s *dialstate) checkDial(n *discover.Node, peers map[discover.NodeID]*Peer) error {
@@ -252,6 +254,8 @@ func (s *dialstate) checkDial(n *discover.Node, peers map[discover.NodeID]*Peer)
 		return errNotWhitelisted
 	case s.hist.contains(n.ID):
 		return errRecentlyDialed
+	case s.banned != nil && s.banned(n.ID):
+		return errBanned
 	}
 	return nil
 }
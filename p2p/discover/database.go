@@ -56,6 +56,7 @@ type nodeDB struct {
 var (
 	nodeDBVersionKey = []byte("version") // Version of the database to flush if changes
 	nodeDBItemPrefix = []byte("n:")      // Identifier to prefix node entries with
+	nodeDBBanPrefix  = []byte("b:")      // Identifier to prefix ban entries with (kept apart from node expiry)
 
 	nodeDBDiscoverRoot      = ":discover"
 	nodeDBDiscoverPing      = nodeDBDiscoverRoot + ":lastping"
@@ -264,6 +265,12 @@ func (db *nodeDB) expireNodes() error {
 		// Otherwise delete all associated information
 		db.deleteNode(id)
 	}
+	// Drop any bans that already ran out
+	for id, until := range db.bans() {
+		if !until.After(time.Now()) {
+			db.unban(id)
+		}
+	}
 	return nil
 }
 
@@ -298,6 +305,36 @@ func (db *nodeDB) updateFindFails(id NodeID, fails int) error {
 	return db.storeInt64(makeKey(id, nodeDBDiscoverFindFails), int64(fails))
 }
 
+// ban marks a remote node as banned until the given time.
+func (db *nodeDB) ban(id NodeID, until time.Time) error {
+	return db.storeInt64(append(nodeDBBanPrefix, id[:]...), until.Unix())
+}
+
+// unban removes the ban of a remote node, if any.
+func (db *nodeDB) unban(id NodeID) error {
+	return db.lvl.Delete(append(nodeDBBanPrefix, id[:]...), nil)
+}
+
+// bans retrieves all the banned nodes along with the time their ban expires.
+// Expired bans are included until the expirer gets around to dropping them.
+func (db *nodeDB) bans() map[NodeID]time.Time {
+	it := db.lvl.NewIterator(util.BytesPrefix(nodeDBBanPrefix), nil)
+	defer it.Release()
+
+	bans := make(map[NodeID]time.Time)
+	for it.Next() {
+		var id NodeID
+		if len(it.Key()) != len(nodeDBBanPrefix)+len(id) {
+			continue
+		}
+		copy(id[:], it.Key()[len(nodeDBBanPrefix):])
+		if until, read := binary.Varint(it.Value()); read > 0 {
+			bans[id] = time.Unix(until, 0)
+		}
+	}
+	return bans
+}
+
 // querySeeds retrieves random nodes to be used as potential seed nodes
 // for bootstrapping.
 func (db *nodeDB) querySeeds(n int, maxAge time.Duration) []*Node {
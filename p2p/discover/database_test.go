@@ -378,3 +378,64 @@ func TestNodeDBSelfExpiration(t *testing.T) {
 		t.Errorf("self not evacuated")
 	}
 }
+
+func TestNodeDBBans(t *testing.T) {
+	root, err := ioutil.TempDir("", "nodedb-")
+	if err != nil {
+		t.Fatalf("failed to create temporary data folder: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	var (
+		active  = nodeDBExpirationNodes[0].node.ID
+		expired = nodeDBExpirationNodes[1].node.ID
+		until   = time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+	)
+	// Create a persistent database, ban some nodes and store their node records
+	db, err := newNodeDB(filepath.Join(root, "database"), Version, NodeID{})
+	if err != nil {
+		t.Fatalf("failed to create persistent database: %v", err)
+	}
+	for i, seed := range nodeDBExpirationNodes {
+		if err := db.updateNode(seed.node); err != nil {
+			t.Fatalf("node %d: failed to insert: %v", i, err)
+		}
+	}
+	if err := db.ban(active, until); err != nil {
+		t.Fatalf("failed to ban node: %v", err)
+	}
+	if err := db.ban(expired, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("failed to ban node: %v", err)
+	}
+	db.close()
+
+	// Reopen the database and check that both bans are still present
+	db, err = newNodeDB(filepath.Join(root, "database"), Version, NodeID{})
+	if err != nil {
+		t.Fatalf("failed to open persistent database: %v", err)
+	}
+	defer db.close()
+
+	if bans := db.bans(); len(bans) != 2 || !bans[active].Equal(until) {
+		t.Fatalf("ban mismatch after reopen: have %v, want %x until %v", bans, active[:8], until)
+	}
+	// Expire the data and check that only the run out ban was dropped, even
+	// though both node records are gone
+	if err := db.expireNodes(); err != nil {
+		t.Fatalf("failed to expire nodes: %v", err)
+	}
+	if node := db.node(active); node != nil {
+		t.Errorf("banned node not evacuated")
+	}
+	bans := db.bans()
+	if len(bans) != 1 || !bans[active].Equal(until) {
+		t.Fatalf("ban mismatch after expiration: have %v, want %x until %v", bans, active[:8], until)
+	}
+	// Lift the remaining ban and make sure it's gone
+	if err := db.unban(active); err != nil {
+		t.Fatalf("failed to unban node: %v", err)
+	}
+	if bans := db.bans(); len(bans) != 0 {
+		t.Fatalf("bans remained after unban: %v", bans)
+	}
+}
@@ -180,6 +180,23 @@ func (tab *Table) Close() {
 	}
 }
 
+// Ban persists a ban of the given node in the node database, lasting until the
+// specified time.
+func (tab *Table) Ban(id NodeID, until time.Time) error {
+	return tab.db.ban(id, until)
+}
+
+// Unban removes the persisted ban of the given node.
+func (tab *Table) Unban(id NodeID) error {
+	return tab.db.unban(id)
+}
+
+// Bans returns all the bans persisted in the node database, mapped to the time
+// they expire.
+func (tab *Table) Bans() map[NodeID]time.Time {
+	return tab.db.bans()
+}
+
 // SetFallbackNodes sets the initial points of contact. These nodes
 // are used to connect to the network if the table is empty and there
 // are no known nodes in the database.
@@ -71,6 +71,7 @@ type Peer struct {
 	protoErr chan error
 	closed   chan struct{}
 	disc     chan DiscReason
+	penalise func(Misbehaviour) // Reputation hook of the server, nil if untracked
 }
 
 // NewPeer returns a peer for testing purposes.
@@ -117,6 +118,14 @@ func (p *Peer) Disconnect(reason DiscReason) {
 	}
 }
 
+// Penalise reports a misbehaviour of the remote node, lowering its reputation.
+// Nodes whose reputation drops too low are disconnected and temporarily banned.
+func (p *Peer) Penalise(m Misbehaviour) {
+	if p.penalise != nil {
+		p.penalise(m)
+	}
+}
+
 // String implements fmt.Stringer.
 func (p *Peer) String() string {
 	return fmt.Sprintf("Peer %x %v", p.rw.id[:8], p.RemoteAddr())
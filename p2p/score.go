@@ -0,0 +1,239 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+)
+
+const (
+	scoreHalfLife    = 10 * time.Minute // Time after which half of a penalty is forgiven
+	scoreForgotten   = -1               // Score above which a node isn't tracked any more
+	banThreshold     = -100             // Score below which a node gets banned
+	maxTrackedScores = 1024             // Number of scores after which forgotten ones are pruned
+
+	// DefaultBanDuration is the time a node is banned for if its score drops
+	// below the ban threshold.
+	DefaultBanDuration = time.Hour
+)
+
+// Misbehaviour is a kind of remote peer misbehaviour detected by a protocol,
+// lowering the reputation of the node.
+type Misbehaviour int
+
+const (
+	InvalidBlock       Misbehaviour = iota // Block or header failing validation
+	RequestTimeout                         // Data request left unanswered
+	UselessTransaction                     // Transaction rejected by the pool
+	MalformedMessage                       // Message violating the protocol encoding
+)
+
+// misbehaviourPenalties is the score deducted for each kind of misbehaviour.
+var misbehaviourPenalties = map[Misbehaviour]float64{
+	InvalidBlock:       50,
+	RequestTimeout:     10,
+	UselessTransaction: 2,
+	MalformedMessage:   25,
+}
+
+var misbehaviourToString = map[Misbehaviour]string{
+	InvalidBlock:       "invalid block",
+	RequestTimeout:     "request timeout",
+	UselessTransaction: "useless transaction",
+	MalformedMessage:   "malformed message",
+}
+
+func (m Misbehaviour) String() string {
+	if str, ok := misbehaviourToString[m]; ok {
+		return str
+	}
+	return fmt.Sprintf("unknown misbehaviour %d", int(m))
+}
+
+// banStore is a persistent storage of node bans, implemented by the discovery
+// table on top of the node database.
+type banStore interface {
+	Ban(id discover.NodeID, until time.Time) error
+	Unban(id discover.NodeID) error
+	Bans() map[discover.NodeID]time.Time
+}
+
+// peerScore is the reputation of a single node, decaying towards zero.
+type peerScore struct {
+	value   float64
+	updated time.Time
+}
+
+// decay forgives the part of the score that halved away since the last update.
+func (s *peerScore) decay(now time.Time) {
+	if elapsed := now.Sub(s.updated); elapsed > 0 {
+		s.value *= math.Pow(0.5, float64(elapsed)/float64(scoreHalfLife))
+	}
+	s.updated = now
+}
+
+// reputation tracks the misbehaviour scores of remote nodes, banning the ones
+// dropping below the threshold. Scores are kept across reconnects but not across
+// restarts, whereas bans are persisted if a backing store is available.
+type reputation struct {
+	scores map[discover.NodeID]*peerScore
+	bans   map[discover.NodeID]time.Time
+	store  banStore         // Persistent ban storage, nil if bans are only kept in memory
+	clock  func() time.Time // Time source, replaceable for testing
+
+	lock sync.Mutex
+}
+
+// newReputation creates a reputation tracker, loading any unexpired bans from
+// the given persistent store.
+func newReputation(store banStore) *reputation {
+	r := &reputation{
+		scores: make(map[discover.NodeID]*peerScore),
+		bans:   make(map[discover.NodeID]time.Time),
+		store:  store,
+		clock:  time.Now,
+	}
+	if store != nil {
+		now := r.clock()
+		for id, until := range store.Bans() {
+			if until.After(now) {
+				r.bans[id] = until
+			}
+		}
+	}
+	return r
+}
+
+// penalise deducts the penalty of a misbehaviour from the score of a node,
+// banning it if the score dropped below the threshold. The returned flag
+// reports whether the node got banned.
+func (r *reputation) penalise(id discover.NodeID, m Misbehaviour) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := r.clock()
+	score := r.scores[id]
+	if score == nil {
+		if len(r.scores) >= maxTrackedScores {
+			r.prune(now)
+		}
+		score = &peerScore{updated: now}
+		r.scores[id] = score
+	}
+	score.decay(now)
+	score.value -= misbehaviourPenalties[m]
+
+	if score.value >= banThreshold {
+		return false
+	}
+	delete(r.scores, id)
+	if err := r.ban(id, now.Add(DefaultBanDuration)); err != nil {
+		log.Warn("Failed to persist node ban", "id", id, "err", err)
+	}
+	return true
+}
+
+// prune drops the scores of all nodes whose misbehaviour was mostly forgiven.
+// The caller must hold the lock.
+func (r *reputation) prune(now time.Time) {
+	for id, score := range r.scores {
+		if score.decay(now); score.value > scoreForgotten {
+			delete(r.scores, id)
+		}
+	}
+}
+
+// score retrieves the current, decayed score of a node.
+func (r *reputation) score(id discover.NodeID) float64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	score := r.scores[id]
+	if score == nil {
+		return 0
+	}
+	score.decay(r.clock())
+	return score.value
+}
+
+// ban bans a node until the given time. The caller must hold the lock.
+func (r *reputation) ban(id discover.NodeID, until time.Time) error {
+	r.bans[id] = until
+	if r.store != nil {
+		return r.store.Ban(id, until)
+	}
+	return nil
+}
+
+// setBan bans a node until the given time, overriding any previous ban.
+func (r *reputation) setBan(id discover.NodeID, until time.Time) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.ban(id, until)
+}
+
+// unban lifts the ban of a node and resets its score.
+func (r *reputation) unban(id discover.NodeID) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.scores, id)
+	delete(r.bans, id)
+	if r.store != nil {
+		return r.store.Unban(id)
+	}
+	return nil
+}
+
+// banned reports whether a node is currently banned.
+func (r *reputation) banned(id discover.NodeID) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	until, ok := r.bans[id]
+	if !ok {
+		return false
+	}
+	if !until.After(r.clock()) {
+		// The ban ran out, the node database expirer drops the stored entry
+		delete(r.bans, id)
+		return false
+	}
+	return true
+}
+
+// list returns all the active bans, mapped to the time they expire.
+func (r *reputation) list() map[discover.NodeID]time.Time {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := r.clock()
+	bans := make(map[discover.NodeID]time.Time, len(r.bans))
+	for id, until := range r.bans {
+		if until.After(now) {
+			bans[id] = until
+		}
+	}
+	return bans
+}
@@ -0,0 +1,140 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/discover"
+)
+
+// memoryBanStore is a ban store keeping its bans in a map.
+type memoryBanStore map[discover.NodeID]time.Time
+
+func (s memoryBanStore) Ban(id discover.NodeID, until time.Time) error { s[id] = until; return nil }
+func (s memoryBanStore) Unban(id discover.NodeID) error                { delete(s, id); return nil }
+
+func (s memoryBanStore) Bans() map[discover.NodeID]time.Time {
+	bans := make(map[discover.NodeID]time.Time)
+	for id, until := range s {
+		bans[id] = until
+	}
+	return bans
+}
+
+// newTestReputation creates a reputation tracker driven by a manual clock.
+func newTestReputation(store banStore) (*reputation, *time.Time) {
+	now := time.Now()
+	r := newReputation(store)
+	r.clock = func() time.Time { return now }
+	return r, &now
+}
+
+// Tests that repeated misbehaviour gets a node banned, and the ban runs out.
+func TestReputationBan(t *testing.T) {
+	r, now := newTestReputation(nil)
+	id := randomID()
+
+	// Invalid blocks cost 50 points each, the third one crosses the threshold
+	for i := 0; i < 2; i++ {
+		if r.penalise(id, InvalidBlock) {
+			t.Fatalf("penalty %d: node banned too early", i)
+		}
+	}
+	if score := r.score(id); score != -100 {
+		t.Fatalf("score mismatch: have %v, want %v", score, -100)
+	}
+	if r.banned(id) {
+		t.Fatalf("node banned at the threshold")
+	}
+	if !r.penalise(id, InvalidBlock) {
+		t.Fatalf("node not banned below the threshold")
+	}
+	if !r.banned(id) {
+		t.Fatalf("banned node not reported")
+	}
+	if score := r.score(id); score != 0 {
+		t.Fatalf("score not reset after ban: have %v", score)
+	}
+	if bans := r.list(); len(bans) != 1 || !bans[id].Equal(now.Add(DefaultBanDuration)) {
+		t.Fatalf("ban list mismatch: have %v", bans)
+	}
+	// Wait out the ban and check that the node is accepted again
+	*now = now.Add(DefaultBanDuration)
+	if r.banned(id) {
+		t.Fatalf("node still banned after expiry")
+	}
+	if bans := r.list(); len(bans) != 0 {
+		t.Fatalf("expired ban still listed: %v", bans)
+	}
+}
+
+// Tests that scores decay over time, so sporadic misbehaviour is forgiven.
+func TestReputationDecay(t *testing.T) {
+	r, now := newTestReputation(nil)
+	id := randomID()
+
+	r.penalise(id, InvalidBlock)
+	*now = now.Add(scoreHalfLife)
+	if score := r.score(id); math.Abs(score+25) > 1e-9 {
+		t.Fatalf("score mismatch after a half-life: have %v, want %v", score, -25)
+	}
+	// Periodic timeouts slower than the decay never reach the threshold
+	for i := 0; i < 100; i++ {
+		if r.penalise(id, RequestTimeout) {
+			t.Fatalf("timeout %d: sporadic misbehaviour banned", i)
+		}
+		*now = now.Add(scoreHalfLife / 2)
+	}
+}
+
+// Tests that bans are written to the backing store and loaded from it.
+func TestReputationStore(t *testing.T) {
+	var (
+		store   = make(memoryBanStore)
+		active  = randomID()
+		expired = randomID()
+	)
+	r, now := newTestReputation(store)
+	if err := r.setBan(active, now.Add(time.Hour)); err != nil {
+		t.Fatalf("failed to ban node: %v", err)
+	}
+	if _, ok := store[active]; !ok {
+		t.Fatalf("ban not persisted")
+	}
+	store[expired] = now.Add(-time.Minute)
+
+	// Recreate the tracker and check that only the active ban was loaded
+	r = newReputation(store)
+	if !r.banned(active) {
+		t.Fatalf("persisted ban not loaded")
+	}
+	if r.banned(expired) {
+		t.Fatalf("expired ban loaded")
+	}
+	if err := r.unban(active); err != nil {
+		t.Fatalf("failed to unban node: %v", err)
+	}
+	if r.banned(active) {
+		t.Fatalf("node still banned after unban")
+	}
+	if _, ok := store[active]; ok {
+		t.Fatalf("unban not persisted")
+	}
+}
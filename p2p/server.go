@@ -154,6 +154,7 @@ type Server struct {
 	ourHandshake *protoHandshake
 	lastLookup   time.Time
 	DiscV5       *discv5.Network
+	reputation   *reputation
 
 	// These are for Peers, PeerCount (and nothing else).
 	peerOp     chan peerOpFunc
@@ -291,6 +292,63 @@ func (srv *Server) RemovePeer(node *discover.Node) {
 	}
 }
 
+// Penalise lowers the reputation of the given node for a misbehaviour. If its
+// score drops below the ban threshold, the node is temporarily banned and any
+// connection to it is dropped.
+func (srv *Server) Penalise(id discover.NodeID, m Misbehaviour) {
+	if srv.reputation == nil {
+		return
+	}
+	log.Debug("Penalising p2p peer", "id", id, "misbehaviour", m)
+	if srv.reputation.penalise(id, m) {
+		log.Info("Banning misbehaving p2p peer", "id", id, "duration", DefaultBanDuration)
+		srv.disconnect(id, DiscUselessPeer)
+	}
+}
+
+// BanPeer bans the given node for the specified duration, dropping any existing
+// connection to it. Bans are persisted in the node database if discovery is on.
+// Inbound connections of trusted nodes are accepted regardless.
+func (srv *Server) BanPeer(id discover.NodeID, duration time.Duration) error {
+	if srv.reputation == nil {
+		return errServerStopped
+	}
+	if err := srv.reputation.setBan(id, time.Now().Add(duration)); err != nil {
+		return err
+	}
+	srv.disconnect(id, DiscRequested)
+	return nil
+}
+
+// UnbanPeer lifts the ban of the given node, also forgiving its past misbehaviour.
+func (srv *Server) UnbanPeer(id discover.NodeID) error {
+	if srv.reputation == nil {
+		return errServerStopped
+	}
+	return srv.reputation.unban(id)
+}
+
+// Bans returns the currently banned nodes, mapped to the time their ban expires.
+func (srv *Server) Bans() map[discover.NodeID]time.Time {
+	if srv.reputation == nil {
+		return nil
+	}
+	return srv.reputation.list()
+}
+
+// disconnect drops the connection to the given node, if any.
+func (srv *Server) disconnect(id discover.NodeID, reason DiscReason) {
+	select {
+	case srv.peerOp <- func(peers map[discover.NodeID]*Peer) {
+		if p := peers[id]; p != nil {
+			p.Disconnect(reason)
+		}
+	}:
+		<-srv.peerOpDone
+	case <-srv.quit:
+	}
+}
+
 // Self returns the local node's endpoint information.
 func (srv *Server) Self() *discover.Node {
 	srv.lock.Lock()
@@ -391,12 +449,19 @@ func (srv *Server) Start() (err error) {
 		}
 		srv.DiscV5 = ntab
 	}
+	// Bans are persisted in the node database if the discovery table is available
+	var bans banStore
+	if store, ok := srv.ntab.(banStore); ok {
+		bans = store
+	}
+	srv.reputation = newReputation(bans)
 
 	dynPeers := (srv.MaxPeers + 1) / 2
 	if srv.NoDiscovery {
 		dynPeers = 0
 	}
 	dialer := newDialState(srv.StaticNodes, srv.BootstrapNodes, srv.ntab, dynPeers, srv.NetRestrict)
+	dialer.banned = srv.reputation.banned
 
 	// handshake
 	srv.ourHandshake = &protoHandshake{Version: baseProtocolVersion, Name: srv.Name, ID: discover.PubkeyID(&srv.PrivateKey.PublicKey)}
@@ -544,6 +609,11 @@ running:
 			if err == nil {
 				// The handshakes are done and it passed all checks.
 				p := newPeer(c, srv.Protocols)
+				if !c.is(trustedConn) {
+					// Trusted nodes are exempt from reputation tracking
+					id := c.id
+					p.penalise = func(m Misbehaviour) { srv.Penalise(id, m) }
+				}
 				name := truncateName(c.name)
 				log.Debug("Adding p2p peer", "id", c.id, "name", name, "addr", c.fd.RemoteAddr(), "peers", len(peers)+1)
 				peers[c.id] = p
@@ -602,6 +672,8 @@ func (srv *Server) encHandshakeChecks(peers map[discover.NodeID]*Peer, c *conn)
 		return DiscAlreadyConnected
 	case c.id == srv.Self().ID:
 		return DiscSelf
+	case !c.is(trustedConn) && srv.reputation != nil && srv.reputation.banned(c.id):
+		return DiscUselessPeer
 	default:
 		return nil
 	}
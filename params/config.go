@@ -65,9 +65,9 @@ var (
 	// means that all fields must be set at all times. This forces
 	// anyone adding flags to the config to also have to set these
 	// fields.
-	AllProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(math.MaxInt64) /*disabled*/, new(EthashConfig), nil}
-	TestChainConfig    = &ChainConfig{big.NewInt(1), nil, new(EthashConfig), nil}
-	TestRules          = TestChainConfig.Rules(new(big.Int))
+	AllProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(math.MaxInt64) /*disabled*/, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, new(EthashConfig), nil, nil, nil, nil, 0, nil}
+	TestChainConfig    = &ChainConfig{big.NewInt(1), nil, big.NewInt(0), nil, big.NewInt(0), nil, nil, nil, new(EthashConfig), nil, nil, nil, nil, 0, nil}
+	TestRules          = TestChainConfig.Rules(new(big.Int), new(big.Int))
 )
 
 // ChainConfig is the core config which determines the blockchain settings.
@@ -79,10 +79,89 @@ type ChainConfig struct {
 	ChainId *big.Int `json:"chainId"` // Chain id identifies the current chain and is used for replay protection
 
 	MetropolisBlock *big.Int `json:"metropolisBlock,omitempty"` // Metropolis switch block (nil = no fork, 0 = alraedy on homestead)
+	ExpiryBlock     *big.Int `json:"expiryBlock,omitempty"`     // Transaction validity window switch block (nil = no fork, 0 = already activated)
+	FeeBlock        *big.Int `json:"feeBlock,omitempty"`        // Transaction fee switch block (nil = no fork, 0 = already activated)
+	RewardBlock     *big.Int `json:"rewardBlock,omitempty"`     // Block reward schedule switch block (nil = no fork, 0 = already activated)
+
+	Forks []*Fork `json:"forks,omitempty"` // Generic fork schedule, in activation order
+
+	Fee    *FeeConfig    `json:"fee,omitempty"`    // Transaction fee schedule, charged from the fee fork onwards
+	Reward *RewardConfig `json:"reward,omitempty"` // Block reward schedule, minted from the reward fork onwards
 
 	// Various consensus engines
-	Ethash *EthashConfig `json:"ethash,omitempty"`
-	Clique *CliqueConfig `json:"clique,omitempty"`
+	Ethash  *EthashConfig  `json:"ethash,omitempty"`
+	Clique  *CliqueConfig  `json:"clique,omitempty"`
+	Instant *InstantConfig `json:"instant,omitempty"`
+	BFT     *BFTConfig     `json:"bft,omitempty"`
+
+	Transition *TransitionConfig `json:"transition,omitempty"` // Switch to a different consensus engine (nil = no switch)
+
+	MaxReorgDepth uint64        `json:"maxReorgDepth,omitempty"` // Maximum number of blocks a reorg may revert (0 = unlimited)
+	Checkpoints   []*Checkpoint `json:"checkpoints,omitempty"`   // Trusted blocks the chain must contain, in ascending order
+}
+
+// Checkpoint is a trusted block the canonical chain is required to contain. No
+// reorg may revert it and no competing block at its height is accepted.
+type Checkpoint struct {
+	Number uint64      `json:"number"`
+	Hash   common.Hash `json:"hash"`
+}
+
+// Checkpoint returns the checkpoint at block num, or nil if there's none.
+func (c *ChainConfig) Checkpoint(num uint64) *Checkpoint {
+	for _, checkpoint := range c.Checkpoints {
+		if checkpoint.Number == num {
+			return checkpoint
+		}
+	}
+	return nil
+}
+
+// LastCheckpoint returns the highest checkpoint at or below block num, or nil if
+// there's none.
+func (c *ChainConfig) LastCheckpoint(num uint64) *Checkpoint {
+	var last *Checkpoint
+	for _, checkpoint := range c.Checkpoints {
+		if checkpoint.Number <= num && (last == nil || checkpoint.Number > last.Number) {
+			last = checkpoint
+		}
+	}
+	return last
+}
+
+// CheckCheckpoints validates the trusted checkpoints: they must be listed in
+// ascending order of distinct, non-genesis blocks.
+func (c *ChainConfig) CheckCheckpoints() error {
+	for i, checkpoint := range c.Checkpoints {
+		if checkpoint == nil || checkpoint.Number == 0 || checkpoint.Hash == (common.Hash{}) {
+			return fmt.Errorf("checkpoint %d: invalid block %v", i, checkpoint)
+		}
+		if i > 0 && checkpoint.Number <= c.Checkpoints[i-1].Number {
+			return fmt.Errorf("checkpoint %d: block %d not above previous checkpoint %d", i, checkpoint.Number, c.Checkpoints[i-1].Number)
+		}
+	}
+	return nil
+}
+
+// FeeConfig is the flat transaction fee schedule, debited from the account
+// sequencing a transaction and credited to the producer of its block.
+type FeeConfig struct {
+	Base    *big.Int `json:"base"`              // Fee charged per transaction
+	PerByte *big.Int `json:"perByte"`           // Fee charged per byte of transaction payload
+	PerStep *big.Int `json:"perStep,omitempty"` // Fee charged per executed instruction (nil = none)
+}
+
+// String implements the stringer interface, returning the fee schedule.
+func (c *FeeConfig) String() string {
+	return fmt.Sprintf("{Base: %v PerByte: %v PerStep: %v}", c.Base, c.PerByte, c.PerStep)
+}
+
+// equal returns whether two fee schedules charge the same fees.
+func (c *FeeConfig) equal(other *FeeConfig) bool {
+	if c == nil || other == nil {
+		return c == other
+	}
+	return configNumEqual(c.Base, other.Base) && configNumEqual(c.PerByte, other.PerByte) && configNumEqual(c.PerStep, other.PerStep)
 }
 
 // EthashConfig is the consensus engine configs for proof-of-work based sealing.
@@ -97,6 +176,8 @@ func (c *EthashConfig) String() string {
 type CliqueConfig struct {
 	Period uint64 `json:"period"` // Number of seconds between blocks to enforce
 	Epoch  uint64 `json:"epoch"`  // Epoch length to reset votes and checkpoint
+
+	Governance *common.Address `json:"governance,omitempty"` // Contract holding the signer set (nil = header votes)
 }
 
 // String implements the stringer interface, returning the consensus engine details.
@@ -104,28 +185,184 @@ func (c *CliqueConfig) String() string {
 	return "clique"
 }
 
-// String implements the fmt.Stringer interface.
-func (c *ChainConfig) String() string {
-	var engine interface{}
+// InstantConfig is the consensus engine configs for on-demand sealing on single
+// node development networks.
+type InstantConfig struct {
+	Period uint64 `json:"period"` // Number of seconds between blocks (0 = seal on new transactions)
+}
+
+// String implements the stringer interface, returning the consensus engine details.
+func (c *InstantConfig) String() string {
+	return "instant"
+}
+
+// BFTConfig is the consensus engine configs for byzantine fault tolerant sealing
+// with immediate finality among a set of validators.
+type BFTConfig struct {
+	Period  uint64 `json:"period"`            // Minimum number of seconds between blocks
+	Epoch   uint64 `json:"epoch"`             // Epoch length to reset votes and checkpoint
+	Timeout uint64 `json:"timeout,omitempty"` // Milliseconds of the first round before changing round
+}
+
+// String implements the stringer interface, returning the consensus engine details.
+func (c *BFTConfig) String() string {
+	return "bft"
+}
+
+// TransitionConfig switches the chain over to a different consensus engine at a
+// given block, the blocks before it being sealed by the top level engine.
+type TransitionConfig struct {
+	Block   *big.Int         `json:"block"`             // First block sealed by the new engine
+	Signers []common.Address `json:"signers,omitempty"` // Initial signers of an authority based new engine
+
+	// Consensus engine taking over the chain
+	Ethash  *EthashConfig  `json:"ethash,omitempty"`
+	Clique  *CliqueConfig  `json:"clique,omitempty"`
+	Instant *InstantConfig `json:"instant,omitempty"`
+	BFT     *BFTConfig     `json:"bft,omitempty"`
+}
+
+// String implements the stringer interface, returning the engine switch.
+func (c *TransitionConfig) String() string {
+	return fmt.Sprintf("{Block: %v Engine: %v}", c.Block, engineString(c.Ethash, c.Clique, c.Instant, c.BFT))
+}
+
+// engines returns the number of consensus engines configured.
+func (c *TransitionConfig) engines() int {
+	var n int
+	for _, set := range []bool{c.Ethash != nil, c.Clique != nil, c.Instant != nil, c.BFT != nil} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// equal returns whether two transitions hand the chain over to the same engine
+// with the same initial signers.
+func (c *TransitionConfig) equal(other *TransitionConfig) bool {
+	if c == nil || other == nil {
+		return c == other
+	}
+	if c.String() != other.String() || len(c.Signers) != len(other.Signers) {
+		return false
+	}
+	for i, signer := range c.Signers {
+		if signer != other.Signers[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// engineString returns the name of the configured consensus engine.
+func engineString(ethash *EthashConfig, clique *CliqueConfig, instant *InstantConfig, bft *BFTConfig) interface{} {
 	switch {
-	case c.Ethash != nil:
-		engine = c.Ethash
-	case c.Clique != nil:
-		engine = c.Clique
+	case ethash != nil:
+		return ethash
+	case clique != nil:
+		return clique
+	case instant != nil:
+		return instant
+	case bft != nil:
+		return bft
 	default:
-		engine = "unknown"
+		return "unknown"
+	}
+}
+
+// String implements the fmt.Stringer interface.
+func (c *ChainConfig) String() string {
+	engine := engineString(c.Ethash, c.Clique, c.Instant, c.BFT)
+	if c.Transition != nil {
+		engine = fmt.Sprintf("%v -> %v", engine, c.Transition)
 	}
-	return fmt.Sprintf("{ChainID: %v Metropolis: %v Engine: %v}",
+	return fmt.Sprintf("{ChainID: %v Metropolis: %v Expiry: %v Fee: %v Reward: %v Forks: %v Engine: %v}",
 		c.ChainId,
 		c.MetropolisBlock,
+		c.ExpiryBlock,
+		c.FeeBlock,
+		c.RewardBlock,
+		c.Forks,
 		engine,
 	)
 }
 
+// IsTransition returns whether num is sealed by the consensus engine taking over
+// the chain.
+func (c *ChainConfig) IsTransition(num *big.Int) bool {
+	return c.Transition != nil && isForked(c.Transition.Block, num)
+}
+
+// AfterTransition returns a copy of the chain config with the consensus engine
+// taking over the chain in place of the original one.
+func (c *ChainConfig) AfterTransition() *ChainConfig {
+	cpy := *c
+	if c.Transition != nil {
+		cpy.Ethash, cpy.Clique, cpy.Instant, cpy.BFT = c.Transition.Ethash, c.Transition.Clique, c.Transition.Instant, c.Transition.BFT
+		cpy.Transition = nil
+	}
+	return &cpy
+}
+
+// EngineConfig returns the chain config with the consensus engine sealing block
+// num configured at the top level.
+func (c *ChainConfig) EngineConfig(num *big.Int) *ChainConfig {
+	if c.IsTransition(num) {
+		return c.AfterTransition()
+	}
+	return c
+}
+
+// HeaderVerifiable returns whether the headers of the chain can be verified without
+// executing the blocks. Contract governed clique signer lists are only known from
+// the state, so header-only sync (fast and light) can't be used on such chains.
+func (c *ChainConfig) HeaderVerifiable() bool {
+	for _, config := range []*ChainConfig{c, c.AfterTransition()} {
+		if config.Clique != nil && config.Clique.Governance != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckTransition validates the consensus engine switch: it may not happen in the
+// genesis block and exactly one engine must take over.
+func (c *ChainConfig) CheckTransition() error {
+	if c.Transition == nil {
+		return nil
+	}
+	if c.Transition.Block == nil || c.Transition.Block.Sign() <= 0 {
+		return fmt.Errorf("invalid engine transition block %v", c.Transition.Block)
+	}
+	if n := c.Transition.engines(); n != 1 {
+		return fmt.Errorf("engine transition configures %d engines, want 1", n)
+	}
+	return nil
+}
+
+// CheckConfig validates the fork schedule, consensus engine switch and trusted
+// checkpoints.
+func (c *ChainConfig) CheckConfig() error {
+	if err := c.CheckForks(); err != nil {
+		return err
+	}
+	if err := c.CheckTransition(); err != nil {
+		return err
+	}
+	return c.CheckCheckpoints()
+}
+
 func (c *ChainConfig) IsMetropolis(num *big.Int) bool {
 	return isForked(c.MetropolisBlock, num)
 }
 
+// IsReward returns whether num is past the fork introducing the configurable
+// block reward schedule.
+func (c *ChainConfig) IsReward(num *big.Int) bool {
+	return isForked(forkBlock(c.featureFork(FeatureBlockReward)), num)
+}
+
 // GasTable returns the gas table corresponding to the current phase (homestead or homestead reprice).
 //
 // The returned GasTable's fields shouldn't, under any circumstances, be changed.
@@ -134,37 +371,61 @@ func (c *ChainConfig) GasTable(num *big.Int) GasTable {
 }
 
 // CheckCompatible checks whether scheduled fork transitions have been imported
-// with a mismatching chain configuration.
-func (c *ChainConfig) CheckCompatible(newcfg *ChainConfig, height uint64) *ConfigCompatError {
+// with a mismatching chain configuration, given the number and timestamp of the
+// local head block.
+func (c *ChainConfig) CheckCompatible(newcfg *ChainConfig, height uint64, time uint64) *ConfigCompatError {
 	bhead := new(big.Int).SetUint64(height)
+	btime := new(big.Int).SetUint64(time)
 
 	// Iterate checkCompatible to find the lowest conflict.
 	var lasterr *ConfigCompatError
 	for {
-		err := c.checkCompatible(newcfg, bhead)
-		if err == nil || (lasterr != nil && err.RewindTo == lasterr.RewindTo) {
+		err := c.checkCompatible(newcfg, bhead, btime)
+		if err == nil || (lasterr != nil && err.RewindTo == lasterr.RewindTo && err.RewindToTime == lasterr.RewindToTime) {
 			break
 		}
 		lasterr = err
-		bhead.SetUint64(err.RewindTo)
+		if err.RewindToTime > 0 {
+			btime.SetUint64(err.RewindToTime)
+		} else {
+			bhead.SetUint64(err.RewindTo)
+		}
 	}
 	return lasterr
 }
 
-func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *ConfigCompatError {
-	if isForkIncompatible(c.MetropolisBlock, newcfg.MetropolisBlock, head) {
-		return newCompatError("Metropolis fork block", c.MetropolisBlock, newcfg.MetropolisBlock)
+func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head, time *big.Int) *ConfigCompatError {
+	if err := c.checkForksCompatible(newcfg, head, time); err != nil {
+		return err
+	}
+	if c.IsTransition(head) && !c.Transition.equal(newcfg.Transition) {
+		return newCompatError("Transition engine", c.Transition.Block, newcfg.transitionBlock())
+	}
+	if fork := c.featureFork(FeatureFlatFee); fork != nil && fork.active(head, time) && !c.Fee.equal(newcfg.Fee) {
+		return newForkCompatError("Fee schedule", fork, newcfg.featureFork(FeatureFlatFee))
+	}
+	if fork := c.featureFork(FeatureBlockReward); fork != nil && fork.active(head, time) && !c.Reward.equal(newcfg.Reward) {
+		return newForkCompatError("Reward schedule", fork, newcfg.featureFork(FeatureBlockReward))
 	}
 	return nil
 }
 
+// transitionBlock returns the block switching consensus engines, or nil.
+func (c *ChainConfig) transitionBlock() *big.Int {
+	if c.Transition == nil {
+		return nil
+	}
+	return c.Transition.Block
+}
+
 // isForkIncompatible returns true if a fork scheduled at s1 cannot be rescheduled to
 // block s2 because head is already past the fork.
 func isForkIncompatible(s1, s2, head *big.Int) bool {
 	return (isForked(s1, head) || isForked(s2, head)) && !configNumEqual(s1, s2)
 }
 
-// isForked returns whether a fork scheduled at block s is active at the given head block.
+// isForked returns whether a fork scheduled at block (or timestamp) s is active at
+// the given head block (or timestamp).
 func isForked(s, head *big.Int) bool {
 	if s == nil || head == nil {
 		return false
@@ -186,10 +447,13 @@ func configNumEqual(x, y *big.Int) bool {
 // ChainConfig that would alter the past.
 type ConfigCompatError struct {
 	What string
-	// block numbers of the stored and new configurations
+	// block numbers (or timestamps) of the stored and new configurations
 	StoredConfig, NewConfig *big.Int
 	// the block number to which the local chain must be rewound to correct the error
 	RewindTo uint64
+	// the timestamp to which the local chain must be rewound to correct the error,
+	// set instead of RewindTo for timestamp activated forks
+	RewindToTime uint64
 }
 
 func newCompatError(what string, storedblock, newblock *big.Int) *ConfigCompatError {
@@ -202,14 +466,25 @@ func newCompatError(what string, storedblock, newblock *big.Int) *ConfigCompatEr
 	default:
 		rew = newblock
 	}
-	err := &ConfigCompatError{what, storedblock, newblock, 0}
+	err := &ConfigCompatError{What: what, StoredConfig: storedblock, NewConfig: newblock}
 	if rew != nil && rew.Sign() > 0 {
 		err.RewindTo = rew.Uint64() - 1
 	}
 	return err
 }
 
+// newTimestampCompatError creates a compatibility error for a fork activated by
+// block timestamp, rewinding the chain to the last second before either switch.
+func newTimestampCompatError(what string, storedtime, newtime *big.Int) *ConfigCompatError {
+	err := newCompatError(what, storedtime, newtime)
+	err.RewindTo, err.RewindToTime = 0, err.RewindTo
+	return err
+}
+
 func (err *ConfigCompatError) Error() string {
+	if err.RewindToTime > 0 {
+		return fmt.Sprintf("mismatching %s in database (have timestamp %d, want timestamp %d, rewindto timestamp %d)", err.What, err.StoredConfig, err.NewConfig, err.RewindToTime)
+	}
 	return fmt.Sprintf("mismatching %s in database (have %d, want %d, rewindto %d)", err.What, err.StoredConfig, err.NewConfig, err.RewindTo)
 }
 
@@ -221,12 +496,47 @@ func (err *ConfigCompatError) Error() string {
 type Rules struct {
 	ChainId      *big.Int
 	IsMetropolis bool
+	IsExpiry     bool
+	IsFee        bool
+	IsReward     bool
+
+	MaxCodeSize uint64 // Maximum size of deployed contract code
+
+	features map[Feature]bool
+}
+
+// Enabled returns whether the given feature is in force.
+func (r Rules) Enabled(feature Feature) bool {
+	return r.features[feature]
 }
 
-func (c *ChainConfig) Rules(num *big.Int) Rules {
+// Rules returns the protocol rules in force in the block with the given number
+// and timestamp. A nil timestamp leaves all timestamp activated forks disabled.
+func (c *ChainConfig) Rules(num, time *big.Int) Rules {
 	chainId := c.ChainId
 	if chainId == nil {
 		chainId = new(big.Int)
 	}
-	return Rules{ChainId: new(big.Int).Set(chainId), IsMetropolis: c.IsMetropolis(num)}
+	rules := Rules{
+		ChainId:      new(big.Int).Set(chainId),
+		IsMetropolis: c.IsMetropolis(num),
+		MaxCodeSize:  MaxCodeSize,
+		features:     make(map[Feature]bool),
+	}
+	for _, fork := range c.Schedule() {
+		if !fork.active(num, time) {
+			continue
+		}
+		for _, feature := range fork.Features {
+			rules.features[feature] = true
+		}
+		if fork.MaxCodeSize > 0 {
+			rules.MaxCodeSize = fork.MaxCodeSize
+		}
+	}
+	rules.IsExpiry = rules.features[FeatureWindowedTx]
+	rules.IsFee = rules.features[FeatureFlatFee]
+	rules.IsReward = rules.features[FeatureBlockReward]
+
+	return rules
 }
@@ -32,17 +32,17 @@ func TestCheckCompatible(t *testing.T) {
 		{stored: AllProtocolChanges, new: AllProtocolChanges, head: 0, wantErr: nil},
 		{stored: AllProtocolChanges, new: AllProtocolChanges, head: 100, wantErr: nil},
 		{
-			stored:  &ChainConfig{EIP150Block: big.NewInt(10)},
-			new:     &ChainConfig{EIP150Block: big.NewInt(20)},
+			stored:  &ChainConfig{FeeBlock: big.NewInt(10)},
+			new:     &ChainConfig{FeeBlock: big.NewInt(20)},
 			head:    9,
 			wantErr: nil,
 		},
 		{
 			stored: AllProtocolChanges,
-			new:    &ChainConfig{HomesteadBlock: nil},
+			new:    &ChainConfig{ExpiryBlock: nil},
 			head:   3,
 			wantErr: &ConfigCompatError{
-				What:         "Homestead fork block",
+				What:         "Expiry fork block",
 				StoredConfig: big.NewInt(0),
 				NewConfig:    nil,
 				RewindTo:     0,
@@ -50,21 +50,21 @@ func TestCheckCompatible(t *testing.T) {
 		},
 		{
 			stored: AllProtocolChanges,
-			new:    &ChainConfig{HomesteadBlock: big.NewInt(1)},
+			new:    &ChainConfig{ExpiryBlock: big.NewInt(1)},
 			head:   3,
 			wantErr: &ConfigCompatError{
-				What:         "Homestead fork block",
+				What:         "Expiry fork block",
 				StoredConfig: big.NewInt(0),
 				NewConfig:    big.NewInt(1),
 				RewindTo:     0,
 			},
 		},
 		{
-			stored: &ChainConfig{HomesteadBlock: big.NewInt(30), EIP150Block: big.NewInt(10)},
-			new:    &ChainConfig{HomesteadBlock: big.NewInt(25), EIP150Block: big.NewInt(20)},
+			stored: &ChainConfig{ExpiryBlock: big.NewInt(30), FeeBlock: big.NewInt(10)},
+			new:    &ChainConfig{ExpiryBlock: big.NewInt(25), FeeBlock: big.NewInt(20)},
 			head:   25,
 			wantErr: &ConfigCompatError{
-				What:         "EIP150 fork block",
+				What:         "Fee fork block",
 				StoredConfig: big.NewInt(10),
 				NewConfig:    big.NewInt(20),
 				RewindTo:     9,
@@ -73,7 +73,7 @@ func TestCheckCompatible(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		err := test.stored.CheckCompatible(test.new, test.head)
+		err := test.stored.CheckCompatible(test.new, test.head, 0)
 		if !reflect.DeepEqual(err, test.wantErr) {
 			t.Errorf("error mismatch:\nstored: %v\nnew: %v\nhead: %v\nerr: %v\nwant: %v", test.stored, test.new, test.head, err, test.wantErr)
 		}
@@ -0,0 +1,255 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package params
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Feature is a protocol change that a fork may switch on.
+type Feature string
+
+const (
+	FeatureDelegateCall Feature = "delegateCall" // DELEGATECALL opcode in the instruction set
+	FeatureWindowedTx   Feature = "windowedTx"   // Transactions carrying a validity window
+	FeatureFlatFee      Feature = "flatFee"      // Flat transaction fees paid to the block producer
+	FeatureBlockReward  Feature = "blockReward"  // Configurable block reward schedule
+)
+
+// knownFeatures contains every feature a fork may enable.
+var knownFeatures = map[Feature]bool{
+	FeatureDelegateCall: true,
+	FeatureWindowedTx:   true,
+	FeatureFlatFee:      true,
+	FeatureBlockReward:  true,
+}
+
+// Fork is a named protocol upgrade, switching on a set of features and limits at
+// a given block number or block timestamp. Exactly one of the two must be set.
+type Fork struct {
+	Name  string   `json:"name"`
+	Block *big.Int `json:"block,omitempty"` // Block number activating the fork
+	Time  *big.Int `json:"time,omitempty"`  // Block timestamp activating the fork
+
+	Features    []Feature `json:"features,omitempty"`    // Features enabled from the fork onwards
+	MaxCodeSize uint64    `json:"maxCodeSize,omitempty"` // Maximum size of deployed contract code (0 = unchanged)
+}
+
+// String implements the stringer interface, returning the fork activation.
+func (f *Fork) String() string {
+	if f.Time != nil {
+		return fmt.Sprintf("%s@time %v", f.Name, f.Time)
+	}
+	return fmt.Sprintf("%s@%v", f.Name, f.Block)
+}
+
+// active returns whether the fork is in force in the block with the given number
+// and timestamp.
+func (f *Fork) active(num, time *big.Int) bool {
+	if f.Time != nil {
+		return isForked(f.Time, time)
+	}
+	return isForked(f.Block, num)
+}
+
+// enables returns whether the fork switches the given feature on.
+func (f *Fork) enables(feature Feature) bool {
+	for _, have := range f.Features {
+		if have == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// sameRules returns whether two forks switch on the same features and limits,
+// regardless of their activation.
+func (f *Fork) sameRules(other *Fork) bool {
+	if f == nil || other == nil {
+		return f == other
+	}
+	if len(f.Features) != len(other.Features) || f.MaxCodeSize != other.MaxCodeSize {
+		return false
+	}
+	for _, feature := range f.Features {
+		if !other.enables(feature) {
+			return false
+		}
+	}
+	return true
+}
+
+// forkBlock and forkTime return the activation of a possibly missing fork.
+func forkBlock(f *Fork) *big.Int {
+	if f == nil {
+		return nil
+	}
+	return f.Block
+}
+
+func forkTime(f *Fork) *big.Int {
+	if f == nil {
+		return nil
+	}
+	return f.Time
+}
+
+// legacyForks returns the forks scheduled through the dedicated switch block
+// fields of the chain config. Their names are reserved.
+func (c *ChainConfig) legacyForks() []*Fork {
+	return []*Fork{
+		{Name: "Metropolis", Block: c.MetropolisBlock},
+		{Name: "Expiry", Block: c.ExpiryBlock, Features: []Feature{FeatureWindowedTx}},
+		{Name: "Fee", Block: c.FeeBlock, Features: []Feature{FeatureFlatFee}},
+		{Name: "Reward", Block: c.RewardBlock, Features: []Feature{FeatureBlockReward}},
+		{Name: "Transition", Block: c.transitionBlock()},
+	}
+}
+
+// Schedule returns every fork of the chain: the ones set through the dedicated
+// switch block fields followed by the generic fork list.
+func (c *ChainConfig) Schedule() []*Fork {
+	return append(c.legacyForks(), c.Forks...)
+}
+
+// findFork returns the fork with the given name from the schedule, or nil.
+func (c *ChainConfig) findFork(name string) *Fork {
+	for _, fork := range c.Schedule() {
+		if fork.Name == name {
+			return fork
+		}
+	}
+	return nil
+}
+
+// featureFork returns the earliest scheduled fork enabling the given feature, or
+// nil if it is never switched on. Block activated forks precede timestamp ones.
+func (c *ChainConfig) featureFork(feature Feature) *Fork {
+	var first *Fork
+	for _, fork := range c.Schedule() {
+		if !fork.enables(feature) || (fork.Block == nil && fork.Time == nil) {
+			continue
+		}
+		switch {
+		case first == nil:
+			first = fork
+		case fork.Block != nil && (first.Block == nil || fork.Block.Cmp(first.Block) < 0):
+			first = fork
+		case fork.Time != nil && first.Time != nil && fork.Time.Cmp(first.Time) < 0:
+			first = fork
+		}
+	}
+	return first
+}
+
+// IsEnabled returns whether the given feature is in force in the block with the
+// given number and timestamp.
+func (c *ChainConfig) IsEnabled(feature Feature, num, time *big.Int) bool {
+	for _, fork := range c.Schedule() {
+		if fork.enables(feature) && fork.active(num, time) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckForks validates the generic fork list: every fork needs a unique name and
+// exactly one activation, may only enable known features, and forks must be
+// listed in activation order with block activated ones first.
+func (c *ChainConfig) CheckForks() error {
+	names := make(map[string]bool)
+	for _, fork := range c.legacyForks() {
+		names[strings.ToLower(fork.Name)] = true
+	}
+	var lastBlock, lastTime *Fork
+	for i, fork := range c.Forks {
+		if fork == nil || fork.Name == "" {
+			return fmt.Errorf("fork %d: missing name", i)
+		}
+		if names[strings.ToLower(fork.Name)] {
+			return fmt.Errorf("fork %q: duplicate or reserved name", fork.Name)
+		}
+		names[strings.ToLower(fork.Name)] = true
+
+		if (fork.Block == nil) == (fork.Time == nil) {
+			return fmt.Errorf("fork %q: exactly one of block and time must be set", fork.Name)
+		}
+		for _, feature := range fork.Features {
+			if !knownFeatures[feature] {
+				return fmt.Errorf("fork %q: unknown feature %q", fork.Name, feature)
+			}
+			// The reward schedule counts blocks from its activation block
+			if feature == FeatureBlockReward && fork.Time != nil {
+				return fmt.Errorf("fork %q: feature %q requires block activation", fork.Name, feature)
+			}
+		}
+		if fork.Block != nil {
+			if lastTime != nil {
+				return fmt.Errorf("fork %q: block activated after timestamp activated fork %q", fork.Name, lastTime.Name)
+			}
+			if lastBlock != nil && fork.Block.Cmp(lastBlock.Block) < 0 {
+				return fmt.Errorf("fork %q: block %v before block %v of fork %q", fork.Name, fork.Block, lastBlock.Block, lastBlock.Name)
+			}
+			lastBlock = fork
+		} else {
+			if lastTime != nil && fork.Time.Cmp(lastTime.Time) < 0 {
+				return fmt.Errorf("fork %q: time %v before time %v of fork %q", fork.Name, fork.Time, lastTime.Time, lastTime.Name)
+			}
+			lastTime = fork
+		}
+	}
+	return nil
+}
+
+// checkForksCompatible checks every fork known to either configuration for an
+// activation or rule change that would alter blocks before the given head.
+func (c *ChainConfig) checkForksCompatible(newcfg *ChainConfig, head, time *big.Int) *ConfigCompatError {
+	var names []string
+	for _, fork := range c.Schedule() {
+		names = append(names, fork.Name)
+	}
+	for _, fork := range newcfg.Forks {
+		if c.findFork(fork.Name) == nil {
+			names = append(names, fork.Name)
+		}
+	}
+	for _, name := range names {
+		stored, updated := c.findFork(name), newcfg.findFork(name)
+
+		if isForkIncompatible(forkBlock(stored), forkBlock(updated), head) {
+			return newCompatError(name+" fork block", forkBlock(stored), forkBlock(updated))
+		}
+		if isForkIncompatible(forkTime(stored), forkTime(updated), time) {
+			return newTimestampCompatError(name+" fork timestamp", forkTime(stored), forkTime(updated))
+		}
+		if stored != nil && stored.active(head, time) && !stored.sameRules(updated) {
+			return newForkCompatError(name+" fork rules", stored, updated)
+		}
+	}
+	return nil
+}
+
+// newForkCompatError creates a compatibility error for a fork, rewinding by block
+// number or timestamp depending on how the forks are activated.
+func newForkCompatError(what string, stored, updated *Fork) *ConfigCompatError {
+	if forkBlock(stored) != nil || forkBlock(updated) != nil {
+		return newCompatError(what, forkBlock(stored), forkBlock(updated))
+	}
+	return newTimestampCompatError(what, forkTime(stored), forkTime(updated))
+}
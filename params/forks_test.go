@@ -0,0 +1,140 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package params
+
+import (
+	"math/big"
+	"testing"
+)
+
+// Tests that the fork list is rejected if unnamed, ambiguously activated, using
+// unknown features or out of order.
+func TestCheckForks(t *testing.T) {
+	tests := []struct {
+		forks []*Fork
+		fail  bool
+	}{
+		{nil, false},
+		{[]*Fork{{Name: "a", Block: big.NewInt(1)}, {Name: "b", Block: big.NewInt(1)}, {Name: "c", Time: big.NewInt(5)}}, false},
+		{[]*Fork{{Block: big.NewInt(1)}}, true},
+		{[]*Fork{{Name: "fee", Block: big.NewInt(1)}}, true}, // reserved by the legacy fields
+		{[]*Fork{{Name: "a", Block: big.NewInt(1)}, {Name: "A", Block: big.NewInt(2)}}, true},
+		{[]*Fork{{Name: "a"}}, true},
+		{[]*Fork{{Name: "a", Block: big.NewInt(1), Time: big.NewInt(1)}}, true},
+		{[]*Fork{{Name: "a", Block: big.NewInt(1), Features: []Feature{"warp"}}}, true},
+		{[]*Fork{{Name: "a", Time: big.NewInt(1), Features: []Feature{FeatureBlockReward}}}, true},
+		{[]*Fork{{Name: "a", Block: big.NewInt(2)}, {Name: "b", Block: big.NewInt(1)}}, true},
+		{[]*Fork{{Name: "a", Time: big.NewInt(2)}, {Name: "b", Time: big.NewInt(1)}}, true},
+		{[]*Fork{{Name: "a", Time: big.NewInt(1)}, {Name: "b", Block: big.NewInt(1)}}, true},
+	}
+	for i, tt := range tests {
+		err := (&ChainConfig{Forks: tt.forks}).CheckForks()
+		if tt.fail && err == nil {
+			t.Errorf("test %d: invalid fork list accepted", i)
+		}
+		if !tt.fail && err != nil {
+			t.Errorf("test %d: valid fork list rejected: %v", i, err)
+		}
+	}
+}
+
+// Tests that the rules enable the features and limits of all forks activated by
+// either block number or timestamp.
+func TestForkRules(t *testing.T) {
+	config := &ChainConfig{
+		ChainId:  big.NewInt(1),
+		FeeBlock: big.NewInt(10),
+		Forks: []*Fork{
+			{Name: "calls", Block: big.NewInt(5), Features: []Feature{FeatureDelegateCall}},
+			{Name: "windows", Time: big.NewInt(1000), Features: []Feature{FeatureWindowedTx}, MaxCodeSize: 1024},
+		},
+	}
+	tests := []struct {
+		number, time int64
+		features     []Feature
+		maxCodeSize  uint64
+	}{
+		{0, 0, nil, MaxCodeSize},
+		{5, 999, []Feature{FeatureDelegateCall}, MaxCodeSize},
+		{10, 999, []Feature{FeatureDelegateCall, FeatureFlatFee}, MaxCodeSize},
+		{4, 1000, []Feature{FeatureWindowedTx}, 1024},
+	}
+	for i, tt := range tests {
+		number, time := big.NewInt(tt.number), big.NewInt(tt.time)
+
+		rules := config.Rules(number, time)
+		for feature := range knownFeatures {
+			want := false
+			for _, enabled := range tt.features {
+				want = want || enabled == feature
+			}
+			if rules.Enabled(feature) != want {
+				t.Errorf("test %d: feature %q mismatch: have %v, want %v", i, feature, rules.Enabled(feature), want)
+			}
+			if config.IsEnabled(feature, number, time) != want {
+				t.Errorf("test %d: config feature %q mismatch: have %v, want %v", i, feature, !want, want)
+			}
+		}
+		if rules.IsFee != rules.Enabled(FeatureFlatFee) || rules.IsExpiry != rules.Enabled(FeatureWindowedTx) {
+			t.Errorf("test %d: rule flags out of sync with features", i)
+		}
+		if rules.MaxCodeSize != tt.maxCodeSize {
+			t.Errorf("test %d: max code size mismatch: have %d, want %d", i, rules.MaxCodeSize, tt.maxCodeSize)
+		}
+	}
+}
+
+// Tests that generic forks cannot be rescheduled or changed once in force.
+func TestCheckForksCompatible(t *testing.T) {
+	stored := &ChainConfig{
+		Forks: []*Fork{
+			{Name: "calls", Block: big.NewInt(10), Features: []Feature{FeatureDelegateCall}},
+			{Name: "windows", Time: big.NewInt(1000), Features: []Feature{FeatureWindowedTx}},
+		},
+	}
+	moved := &ChainConfig{
+		Forks: []*Fork{
+			{Name: "calls", Block: big.NewInt(20), Features: []Feature{FeatureDelegateCall}},
+			{Name: "windows", Time: big.NewInt(2000), Features: []Feature{FeatureWindowedTx}},
+		},
+	}
+	changed := &ChainConfig{
+		Forks: []*Fork{
+			{Name: "calls", Block: big.NewInt(10)},
+			{Name: "windows", Time: big.NewInt(1000), Features: []Feature{FeatureWindowedTx}, MaxCodeSize: 1},
+		},
+	}
+	// Forks not yet reached may be freely rescheduled
+	if err := stored.CheckCompatible(moved, 9, 999); err != nil {
+		t.Errorf("pre-fork reschedule rejected: %v", err)
+	}
+	// Block forks already passed rewind to before the earlier activation
+	if err := stored.CheckCompatible(moved, 15, 999); err == nil || err.What != "calls fork block" || err.RewindTo != 9 {
+		t.Errorf("block reschedule error mismatch: have %v, want rewind to 9", err)
+	}
+	// Timestamp forks already passed rewind by time
+	if err := stored.CheckCompatible(moved, 9, 1500); err == nil || err.What != "windows fork timestamp" || err.RewindToTime != 999 {
+		t.Errorf("timestamp reschedule error mismatch: have %v, want rewind to time 999", err)
+	}
+	// Rules of forks in force cannot change
+	if err := stored.CheckCompatible(changed, 15, 999); err == nil || err.What != "calls fork rules" || err.RewindTo != 9 {
+		t.Errorf("rule change error mismatch: have %v, want rewind to 9", err)
+	}
+	if err := stored.CheckCompatible(changed, 9, 1500); err == nil || err.What != "windows fork rules" || err.RewindToTime != 999 {
+		t.Errorf("limit change error mismatch: have %v, want rewind to time 999", err)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package params
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// LegacyBlockReward is the static reward in wei minted for each proof-of-work
+// block on chains without a reward schedule, or before it activated.
+var LegacyBlockReward = big.NewInt(5e+18)
+
+// RewardConfig is the block reward schedule, minting new coins for the producer
+// of each block and optionally a treasury.
+type RewardConfig struct {
+	Initial   *big.Int `json:"initial"`             // Reward minted for each block of the first interval
+	Interval  uint64   `json:"interval,omitempty"`  // Number of blocks after which the reward decays (0 = never)
+	Decay     uint64   `json:"decay,omitempty"`     // Percentage the reward shrinks by every interval (50 = halving)
+	MaxSupply *big.Int `json:"maxSupply,omitempty"` // Cap on the total coins minted by the schedule (nil = uncapped)
+
+	Treasury      *common.Address `json:"treasury,omitempty"`      // Account receiving a share of each reward (nil = none)
+	TreasuryShare uint64          `json:"treasuryShare,omitempty"` // Percentage of each reward paid to the treasury
+}
+
+// String implements the stringer interface, returning the reward schedule.
+func (c *RewardConfig) String() string {
+	treasury := "none"
+	if c.Treasury != nil {
+		treasury = fmt.Sprintf("%d%% to %x", c.TreasuryShare, *c.Treasury)
+	}
+	return fmt.Sprintf("{Initial: %v Interval: %d Decay: %d%% MaxSupply: %v Treasury: %s}",
+		c.Initial, c.Interval, c.Decay, c.MaxSupply, treasury)
+}
+
+// equal returns whether two reward schedules mint the same rewards.
+func (c *RewardConfig) equal(other *RewardConfig) bool {
+	if c == nil || other == nil {
+		return c == other
+	}
+	if c.Treasury == nil || other.Treasury == nil {
+		if c.Treasury != other.Treasury {
+			return false
+		}
+	} else if *c.Treasury != *other.Treasury || c.TreasuryShare != other.TreasuryShare {
+		return false
+	}
+	return configNumEqual(c.Initial, other.Initial) && c.Interval == other.Interval &&
+		c.Decay == other.Decay && configNumEqual(c.MaxSupply, other.MaxSupply)
+}
+
+// minted returns the total coins minted by the first n blocks of the schedule,
+// disregarding the supply cap.
+func (c *RewardConfig) minted(n uint64) *big.Int {
+	total := new(big.Int)
+	if c.Initial == nil || n == 0 {
+		return total
+	}
+	if c.Interval == 0 || c.Decay == 0 {
+		return total.Mul(c.Initial, new(big.Int).SetUint64(n))
+	}
+	decay := uint64(100)
+	if c.Decay < decay {
+		decay = c.Decay
+	}
+	var (
+		reward = new(big.Int).Set(c.Initial)
+		keep   = big.NewInt(int64(100 - decay))
+		full   = big.NewInt(100)
+	)
+	for n > 0 && reward.Sign() > 0 {
+		blocks := c.Interval
+		if n < blocks {
+			blocks = n
+		}
+		total.Add(total, new(big.Int).Mul(reward, new(big.Int).SetUint64(blocks)))
+		n -= blocks
+
+		reward.Mul(reward, keep)
+		reward.Div(reward, full)
+	}
+	return total
+}
+
+// issued returns the total coins minted by the first n blocks of the schedule,
+// honouring the supply cap.
+func (c *RewardConfig) issued(n uint64) *big.Int {
+	total := c.minted(n)
+	if c.MaxSupply != nil && total.Cmp(c.MaxSupply) > 0 {
+		total.Set(c.MaxSupply)
+	}
+	return total
+}
+
+// split divides a block reward between the block producer and the treasury.
+func (c *RewardConfig) split(reward *big.Int) (producer, treasury *big.Int) {
+	treasury = new(big.Int)
+	if c.Treasury != nil && c.TreasuryShare > 0 {
+		share := c.TreasuryShare
+		if share > 100 {
+			share = 100
+		}
+		treasury.Mul(reward, new(big.Int).SetUint64(share))
+		treasury.Div(treasury, big.NewInt(100))
+	}
+	return new(big.Int).Sub(reward, treasury), treasury
+}
+
+// rewardStart returns the first block minted by the reward schedule.
+func (c *ChainConfig) rewardStart() uint64 {
+	if block := forkBlock(c.featureFork(FeatureBlockReward)); block != nil && block.Sign() > 0 {
+		return block.Uint64()
+	}
+	return 1 // The genesis block mints nothing
+}
+
+// legacyReward returns the reward of block num without a reward schedule in force,
+// minted only for proof-of-work blocks.
+func (c *ChainConfig) legacyReward(num *big.Int) *big.Int {
+	if c.EngineConfig(num).Ethash != nil {
+		return new(big.Int).Set(LegacyBlockReward)
+	}
+	return new(big.Int)
+}
+
+// legacyBlocks returns how many of the first n blocks after the genesis are
+// sealed by proof-of-work, minting the legacy reward.
+func (c *ChainConfig) legacyBlocks(n uint64) uint64 {
+	before, after := n, uint64(0)
+	if block := c.transitionBlock(); block != nil && block.Uint64() <= n {
+		before, after = block.Uint64()-1, n-block.Uint64()+1
+	}
+	var blocks uint64
+	if c.Ethash != nil {
+		blocks += before
+	}
+	if c.Transition != nil && c.Transition.Ethash != nil {
+		blocks += after
+	}
+	return blocks
+}
+
+// BlockReward returns the coins minted by block num for its producer and the
+// treasury, excluding the transaction fees.
+func (c *ChainConfig) BlockReward(num *big.Int) (producer, treasury *big.Int) {
+	if num == nil || num.Sign() == 0 {
+		return new(big.Int), new(big.Int)
+	}
+	if !c.IsReward(num) || c.Reward == nil {
+		return c.legacyReward(num), new(big.Int)
+	}
+	n := num.Uint64() - c.rewardStart()
+	reward := new(big.Int).Sub(c.Reward.issued(n+1), c.Reward.issued(n))
+	return c.Reward.split(reward)
+}
+
+// Issuance returns the total coins minted by block rewards from the genesis up
+// to and including block num. Preallocated balances and fees are not included.
+func (c *ChainConfig) Issuance(num *big.Int) *big.Int {
+	if num == nil || num.Sign() == 0 {
+		return new(big.Int)
+	}
+	legacy := num.Uint64()
+	if c.IsReward(num) && c.Reward != nil {
+		legacy = c.rewardStart() - 1
+	}
+	total := new(big.Int).Mul(LegacyBlockReward, new(big.Int).SetUint64(c.legacyBlocks(legacy)))
+
+	if legacy < num.Uint64() {
+		total.Add(total, c.Reward.issued(num.Uint64()-legacy))
+	}
+	return total
+}
@@ -0,0 +1,126 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package params
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Tests that block rewards follow the legacy reward before the schedule's fork,
+// and decay, split and stop at the supply cap afterwards.
+func TestRewardSchedule(t *testing.T) {
+	treasury := common.Address{0x77}
+	config := &ChainConfig{
+		ChainId:     big.NewInt(1),
+		RewardBlock: big.NewInt(3),
+		Reward: &RewardConfig{
+			Initial:       big.NewInt(100),
+			Interval:      2,
+			Decay:         50,
+			MaxSupply:     big.NewInt(320),
+			Treasury:      &treasury,
+			TreasuryShare: 10,
+		},
+		Ethash: new(EthashConfig),
+	}
+	legacy := new(big.Int).Mul(LegacyBlockReward, big.NewInt(2))
+
+	tests := []struct {
+		number             int64
+		producer, treasury int64
+		issuance           *big.Int
+	}{
+		{0, 0, 0, new(big.Int)},
+		{3, 90, 10, new(big.Int).Add(legacy, big.NewInt(100))},
+		{4, 90, 10, new(big.Int).Add(legacy, big.NewInt(200))},
+		{5, 45, 5, new(big.Int).Add(legacy, big.NewInt(250))},
+		{7, 18, 2, new(big.Int).Add(legacy, big.NewInt(320))}, // capped at the max supply
+		{8, 0, 0, new(big.Int).Add(legacy, big.NewInt(320))},
+		{1000000, 0, 0, new(big.Int).Add(legacy, big.NewInt(320))},
+	}
+	for i, tt := range tests {
+		number := big.NewInt(tt.number)
+		producer, treasury := config.BlockReward(number)
+		if producer.Int64() != tt.producer || treasury.Int64() != tt.treasury {
+			t.Errorf("test %d: reward mismatch: have %v/%v, want %v/%v", i, producer, treasury, tt.producer, tt.treasury)
+		}
+		if issuance := config.Issuance(number); issuance.Cmp(tt.issuance) != 0 {
+			t.Errorf("test %d: issuance mismatch: have %v, want %v", i, issuance, tt.issuance)
+		}
+	}
+	// Ensure blocks before the fork receive the legacy reward
+	if producer, treasury := config.BlockReward(big.NewInt(2)); producer.Cmp(LegacyBlockReward) != 0 || treasury.Sign() != 0 {
+		t.Errorf("pre-fork reward mismatch: have %v/%v, want %v/0", producer, treasury, LegacyBlockReward)
+	}
+	// Ensure the schedule cannot be changed once in force
+	changed := *config
+	changed.Reward = &RewardConfig{Initial: big.NewInt(200)}
+	if err := config.CheckCompatible(&changed, 2, 0); err != nil {
+		t.Errorf("pre-fork schedule change rejected: %v", err)
+	}
+	if err := config.CheckCompatible(&changed, 3, 0); err == nil || err.RewindTo != 2 {
+		t.Errorf("post-fork schedule change error mismatch: have %v, want rewind to 2", err)
+	}
+}
+
+// Tests that the legacy reward is only minted for blocks sealed by proof-of-work
+// on either side of a consensus engine transition.
+func TestTransitionReward(t *testing.T) {
+	config := &ChainConfig{
+		ChainId:    big.NewInt(1),
+		Ethash:     new(EthashConfig),
+		Transition: &TransitionConfig{Block: big.NewInt(4), Clique: &CliqueConfig{Period: 1}},
+	}
+	if err := config.CheckTransition(); err != nil {
+		t.Fatalf("valid transition rejected: %v", err)
+	}
+	for number := int64(1); number < 6; number++ {
+		want := new(big.Int)
+		if number < 4 {
+			want.Set(LegacyBlockReward)
+		}
+		if producer, _ := config.BlockReward(big.NewInt(number)); producer.Cmp(want) != 0 {
+			t.Errorf("block %d: reward mismatch: have %v, want %v", number, producer, want)
+		}
+	}
+	want := new(big.Int).Mul(LegacyBlockReward, big.NewInt(3))
+	if issuance := config.Issuance(big.NewInt(10)); issuance.Cmp(want) != 0 {
+		t.Errorf("issuance mismatch: have %v, want %v", issuance, want)
+	}
+	// Ensure the engine taking over cannot be changed once in force
+	changed := *config
+	changed.Transition = &TransitionConfig{Block: big.NewInt(4), BFT: new(BFTConfig)}
+	if err := config.CheckCompatible(&changed, 3, 0); err != nil {
+		t.Errorf("pre-transition engine change rejected: %v", err)
+	}
+	if err := config.CheckCompatible(&changed, 4, 0); err == nil || err.RewindTo != 3 {
+		t.Errorf("post-transition engine change error mismatch: have %v, want rewind to 3", err)
+	}
+	// Ensure transitions need exactly one engine past the genesis
+	for i, transition := range []*TransitionConfig{
+		{Block: big.NewInt(0), Clique: new(CliqueConfig)},
+		{Block: big.NewInt(1)},
+		{Block: big.NewInt(1), Clique: new(CliqueConfig), BFT: new(BFTConfig)},
+	} {
+		if err := (&ChainConfig{Transition: transition}).CheckTransition(); err == nil {
+			t.Errorf("test %d: invalid transition accepted", i)
+		}
+	}
+}
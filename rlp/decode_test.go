@@ -256,16 +256,31 @@ func TestStreamList(t *testing.T) {
 }
 
 func TestStreamRaw(t *testing.T) {
-	s := NewStream(bytes.NewReader(unhex("C58401010101")), 0)
-	s.List()
-
-	want := unhex("8401010101")
-	raw, err := s.Raw()
-	if err != nil {
-		t.Fatal(err)
-	}
-	if !bytes.Equal(want, raw) {
-		t.Errorf("raw mismatch: got %x, want %x", raw, want)
+	tests := []struct {
+		input  string
+		output string
+	}{
+		{
+			"C58401010101",
+			"8401010101",
+		},
+		{
+			"F842B84001010101010101010101010101010101010101010101010101010101010101010101010101010101010101010101010101010101010101010101010101010101",
+			"B84001010101010101010101010101010101010101010101010101010101010101010101010101010101010101010101010101010101010101010101010101010101",
+		},
+	}
+	for i, tt := range tests {
+		s := NewStream(bytes.NewReader(unhex(tt.input)), 0)
+		s.List()
+
+		want := unhex(tt.output)
+		raw, err := s.Raw()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want, raw) {
+			t.Errorf("test %d: raw mismatch: got %x, want %x", i, raw, want)
+		}
 	}
 }
 
@@ -601,6 +616,37 @@ func TestDecodeWithNonByteReader(t *testing.T) {
 	})
 }
 
+// eofReader reads from a byte slice, returning io.EOF along with the last chunk
+// of data instead of on the following call.
+type eofReader []byte
+
+func (r *eofReader) Read(buf []byte) (n int, err error) {
+	if len(*r) == 0 {
+		return 0, io.EOF
+	}
+	n = copy(buf, *r)
+	if *r = (*r)[n:]; len(*r) == 0 {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Tests that a string read in one go is decoded even if the underlying reader
+// reports io.EOF in the same call that completes it.
+func TestDecodeWithEOFReader(t *testing.T) {
+	want := bytes.Repeat([]byte{0xaa}, 10*1024)
+	input, _ := EncodeToBytes(want)
+
+	r := eofReader(input)
+	var have []byte
+	if err := NewStream(&r, uint64(len(input))).Decode(&have); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Fatalf("decoded data mismatch: have %d bytes, want %d bytes", len(have), len(want))
+	}
+}
+
 func TestDecodeStreamReset(t *testing.T) {
 	s := NewStream(nil, 0)
 	runTests(t, func(input []byte, into interface{}) error {